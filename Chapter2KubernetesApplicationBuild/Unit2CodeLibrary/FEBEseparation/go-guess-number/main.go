@@ -5,8 +5,9 @@ import (
 	"fmt"
 	"math/rand"
 	"net/http"
+	"os"
+	"strings"
 	"sync"
-	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -16,16 +17,61 @@ type GuessRequest struct {
 }
 
 type GuessResponse struct {
-	Message string `json:"message"`
+	Message           string `json:"message"`
+	Difficulty        string `json:"difficulty"`
+	RangeMin          int    `json:"rangeMin"`
+	RangeMax          int    `json:"rangeMax"`
+	RemainingAttempts *int   `json:"remainingAttempts"` // null 表示不限次数
+}
+
+type NewGameRequest struct {
+	Difficulty string `json:"difficulty"`
+}
+
+// Difficulty 难度配置：数字范围与最大尝试次数（0 表示不限次数）
+type Difficulty struct {
+	Name        string `json:"name"`
+	Min         int    `json:"min"`
+	Max         int    `json:"max"`
+	MaxAttempts int    `json:"maxAttempts"`
+}
+
+var difficulties = map[string]Difficulty{
+	"easy":   {Name: "easy", Min: 1, Max: 50, MaxAttempts: 0},
+	"normal": {Name: "normal", Min: 1, Max: 100, MaxAttempts: 0},
+	"hard":   {Name: "hard", Min: 1, Max: 1000, MaxAttempts: 10},
 }
 
 type Game struct {
 	sync.Mutex
+	Difficulty    Difficulty
 	TargetNumber  int
+	Attempts      int
 	LastGuess     int
 	LastDirection string
 }
 
+// reset 按指定难度开始新的一局
+func (g *Game) reset(d Difficulty) {
+	g.Difficulty = d
+	g.TargetNumber = rand.Intn(d.Max-d.Min+1) + d.Min
+	g.Attempts = 0
+	g.LastGuess = 0
+	g.LastDirection = ""
+	fmt.Printf("New %s game, target number: %d\n", d.Name, g.TargetNumber)
+}
+
+func (g *Game) remainingAttempts() *int {
+	if g.Difficulty.MaxAttempts <= 0 {
+		return nil
+	}
+	remaining := g.Difficulty.MaxAttempts - g.Attempts
+	if remaining < 0 {
+		remaining = 0
+	}
+	return &remaining
+}
+
 func (g *Game) checkGuessHandler(w http.ResponseWriter, r *http.Request) {
 	g.Lock()
 	defer g.Unlock()
@@ -37,29 +83,75 @@ func (g *Game) checkGuessHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var res GuessResponse
+	d := g.Difficulty
+	res := GuessResponse{Difficulty: d.Name, RangeMin: d.Min, RangeMax: d.Max}
 	if req.Guess == g.LastGuess {
 		res.Message = "您已经尝试过这个数字，请尝试一个不同的数字。"
-	} else if req.Guess < g.TargetNumber {
-		res.Message = fmt.Sprintf("太小了！试试更大一点的数字（%d ～ 100）。", req.Guess+1)
-		g.LastDirection = "up"
-	} else if req.Guess > g.TargetNumber {
-		res.Message = fmt.Sprintf("太大了！试试更小一点的数字（1 ～ %d）。", req.Guess-1)
-		g.LastDirection = "down"
+	} else if req.Guess < d.Min || req.Guess > d.Max {
+		res.Message = fmt.Sprintf("请输入 %d ～ %d 之间的数字。", d.Min, d.Max)
 	} else {
-		res.Message = "恭喜你，猜对了！"
+		g.Attempts++
+		if req.Guess < g.TargetNumber {
+			res.Message = fmt.Sprintf("太小了！试试更大一点的数字（%d ～ %d）。", req.Guess+1, d.Max)
+			g.LastDirection = "up"
+		} else if req.Guess > g.TargetNumber {
+			res.Message = fmt.Sprintf("太大了！试试更小一点的数字（%d ～ %d）。", d.Min, req.Guess-1)
+			g.LastDirection = "down"
+		} else {
+			res.Message = "恭喜你，猜对了！"
+		}
+		g.LastGuess = req.Guess
 	}
+	res.RemainingAttempts = g.remainingAttempts()
 
-	g.LastGuess = req.Guess
+	if req.Guess == g.TargetNumber {
+		g.reset(d)
+	} else if res.RemainingAttempts != nil && *res.RemainingAttempts == 0 {
+		res.Message = fmt.Sprintf("次数用完了！正确答案是 %d，已开始新的一局。", g.TargetNumber)
+		g.reset(d)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(res)
 }
 
+// newGameHandler 按请求的难度开始新的一局
+func (g *Game) newGameHandler(w http.ResponseWriter, r *http.Request) {
+	var req NewGameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	d, ok := difficulties[strings.ToLower(req.Difficulty)]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	g.Lock()
+	g.reset(d)
+	res := GuessResponse{
+		Message:           "新的一局已开始。",
+		Difficulty:        d.Name,
+		RangeMin:          d.Min,
+		RangeMax:          d.Max,
+		RemainingAttempts: g.remainingAttempts(),
+	}
+	g.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+func difficultiesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(difficulties)
+}
+
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 
 		if r.Method == http.MethodOptions {
@@ -72,18 +164,21 @@ func corsMiddleware(next http.Handler) http.Handler {
 }
 
 func main() {
-	rand.Seed(time.Now().UnixNano())
-	targetNumber := rand.Intn(100) + 1
-	fmt.Println("Target number:", targetNumber)
-
-	game := &Game{
-		TargetNumber: targetNumber,
+	// 通过 GUESS_DIFFICULTY 环境变量选择默认难度
+	d, ok := difficulties[strings.ToLower(os.Getenv("GUESS_DIFFICULTY"))]
+	if !ok {
+		d = difficulties["normal"]
 	}
 
+	game := &Game{}
+	game.reset(d)
+
 	router := mux.NewRouter()
 	router.Use(corsMiddleware)
 
 	router.HandleFunc("/check-guess", game.checkGuessHandler).Methods("POST", "OPTIONS")
+	router.HandleFunc("/new-game", game.newGameHandler).Methods("POST", "OPTIONS")
+	router.HandleFunc("/difficulties", difficultiesHandler).Methods("GET", "OPTIONS")
 
 	http.ListenAndServe(":8081", router)
 }
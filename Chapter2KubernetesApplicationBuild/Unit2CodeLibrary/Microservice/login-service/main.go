@@ -2,15 +2,19 @@ package main
 
 import (
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/jinzhu/gorm"
 	"github.com/rs/cors"
+	"golang.org/x/crypto/bcrypt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 )
 
 type loginRequest struct {
@@ -68,6 +72,34 @@ func updateUser(user *User) error {
 	return nil
 }
 
+var errInvalidPassword = errors.New("invalid password")
+
+// checkPassword 使用 bcrypt 校验密码；早期以明文保存的密码校验通过后立即改存为 bcrypt 哈希。
+// 与 Chapter 5 的 login-service 相同：所有明文记录升级后设置 LEGACY_PLAINTEXT_PASSWORDS=false，之后拒绝明文记录
+func checkPassword(user *User, password string) bool {
+	if strings.HasPrefix(user.Password, "$2") {
+		return bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) == nil
+	}
+	if strings.EqualFold(os.Getenv("LEGACY_PLAINTEXT_PASSWORDS"), "false") {
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(user.Password), []byte(password)) != 1 {
+		return false
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Println("Error hashing legacy password:", err)
+		return true
+	}
+	if err = db.Model(user).Where("id = ?", user.ID).Update("Password", string(hash)).Error; err != nil {
+		log.Println("Error upgrading legacy password:", err)
+		return true
+	}
+	user.Password = string(hash)
+	log.Println("Upgraded legacy plaintext password for user:", user.ID)
+	return true
+}
+
 func generateAuthToken() (string, error) {
 	return generateRandomToken(32)
 }
@@ -103,16 +135,15 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("Received login request with username: %s, password: %s\n", req.Username, req.Password)
+	log.Printf("Received login request with username: %s\n", req.Username)
 
 	var user User
-	db = db.LogMode(true)
-
-	if err := db.Select("ID, Username, Password, AuthToken, Wins, Attempts").Where("username = ? AND password = ?", req.Username, req.Password).First(&user).Error; err == nil {
-		log.Println("User found:", user)
-		log.Println("User data retrieved from the database:", user)
-		log.Println("Generated SQL query:", db.Where("username = ? AND password = ?", req.Username, req.Password).First(&user).QueryExpr())
-		fmt.Printf("User data after query: %+v\n", user)
+	err = db.Select("ID, Username, Password, AuthToken, Wins, Attempts").Where("username = ?", req.Username).First(&user).Error
+	if err == nil && !checkPassword(&user, req.Password) {
+		err = errInvalidPassword
+	}
+	if err == nil {
+		log.Println("User found:", user.ID, user.Username)
 
 		newAuthToken, err := generateAuthToken()
 		if err != nil {
@@ -209,7 +240,7 @@ func registerHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("Received register request with username: %s, password: %s\n", req.Username, req.Password)
+	log.Printf("Received register request with username: %s\n", req.Username)
 
 	var user User
 	err = db.Where("username = ?", req.Username).First(&user).Error
@@ -232,9 +263,16 @@ func registerHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Println("Error hashing password:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
 	user = User{
 		Username:  req.Username,
-		Password:  req.Password,
+		Password:  string(hash),
 		AuthToken: newAuthToken,
 		Wins:      0,
 		Attempts:  0,
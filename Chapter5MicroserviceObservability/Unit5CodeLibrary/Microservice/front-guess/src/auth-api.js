@@ -26,6 +26,10 @@ export default {
                 console.log('Stored userId and authToken in localStorage:', data.id, data.authToken);
                 return { id: data.id, authToken: data.authToken };
             }
+            // 已启用两步验证，需调用 loginMFA 完成登录
+            if (data && data.mfaRequired && data.mfaToken) {
+                return { mfaRequired: true, mfaToken: data.mfaToken };
+            }
             return null;
         } catch (error) {
             // Log the error and traceId if available
@@ -40,10 +44,95 @@ export default {
         }
     },
 
-    // 注册
-    async register(username, password) {
+    // 企业账号登录回跳后，凭 RefreshToken Cookie 换取令牌
+    async completeOIDC() {
+        try {
+            const { data } = await axiosInstance.post('/refresh');
+            if (data && data.success && data.id && data.authToken) {
+                store.commit('setUserId', data.id);
+                store.commit('setAuthToken', data.authToken);
+                store.commit('setIsLoggedIn', true);
+
+                localStorage.setItem('userId', data.id);
+                localStorage.setItem('authToken', data.authToken);
+                return { id: data.id, authToken: data.authToken };
+            }
+            return null;
+        } catch (error) {
+            console.error('OIDC login failed:', error.message || error);
+            return null;
+        }
+    },
+
+    // 登录第二步：提交认证器验证码，或 useRecovery 为 true 时提交恢复码
+    async loginMFA(mfaToken, code, useRecovery) {
+        try {
+            const body = useRecovery ? { mfaToken, recoveryCode: code } : { mfaToken, code };
+            const response = await axiosInstance.post('/login/2fa', body);
+            const data = response.data;
+
+            if (data && data.success && data.id && data.authToken) {
+                store.commit('setUserId', data.id);
+                store.commit('setAuthToken', data.authToken);
+                store.commit('setIsLoggedIn', true);
+
+                localStorage.setItem('userId', data.id);
+                localStorage.setItem('authToken', data.authToken);
+                return { id: data.id, authToken: data.authToken };
+            }
+            return null;
+        } catch (error) {
+            console.error('2FA login failed:', error.message || error);
+            return null;
+        }
+    },
+
+    // 申请重置密码：无论账号是否存在后端都返回 202
+    async forgotPassword(usernameOrEmail) {
+        const body = usernameOrEmail.includes('@') ? { email: usernameOrEmail } : { username: usernameOrEmail };
         try {
-            const response = await axiosInstance.post('/register', { username, password });
+            await axiosInstance.post('/password/forgot', body);
+            return true;
+        } catch (error) {
+            console.error('Forgot password failed:', error.message || error);
+            return false;
+        }
+    },
+
+    // 凭邮件中的令牌设置新密码；失败时返回 { fields } 或 { error }
+    async resetPassword(token, password) {
+        try {
+            const { data } = await axiosInstance.post('/password/reset', { token, password });
+            return data && data.success ? { success: true } : { error: '重置失败，请重试。' };
+        } catch (error) {
+            console.error('Reset password failed:', error.message || error);
+            const fields = error?.response?.data?.fields;
+            if (Array.isArray(fields) && fields.length > 0) {
+                return { fields };
+            }
+            return { error: error?.response?.status === 400 ? '链接无效或已过期，请重新申请。' : '重置失败，请稍后再试。' };
+        }
+    },
+
+    // 凭邮件中的令牌验证邮箱
+    async verifyEmail(token) {
+        try {
+            const { data } = await axiosInstance.post('/verify-email', { token });
+            return !!(data && data.success);
+        } catch (error) {
+            console.error('Verify email failed:', error.message || error);
+            return false;
+        }
+    },
+
+    // 注册；失败时返回 { fields }，fields 为后端逐字段的校验错误
+    async register(username, password, email) {
+        try {
+            const body = { username, password };
+            if (email) {
+                body.email = email;
+            }
+            const response = await axiosInstance.post('/register', body);
             const data = response.data;
             console.log('Register response:', data);
 
@@ -66,6 +155,11 @@ export default {
             console.error('Registration failed:', error.message || error);
             console.log('Trace ID:', traceId);
 
+            const fields = error?.response?.data?.fields;
+            if (Array.isArray(fields) && fields.length > 0) {
+                return { fields };
+            }
+
             // Customize the error message for users
             this.errorMessage = error?.response?.data?.message || '注册失败，请重试。';
 
@@ -12,12 +12,18 @@ function deleteCookie(name) {
     document.cookie = name + '=; Path=/; Expires=Thu, 01 Jan 1970 00:00:01 GMT;';
 }
 
+// 读取 Cookie 函数
+function readCookie(name) {
+    const match = document.cookie.match(new RegExp('(?:^|; )' + name + '=([^;]*)'));
+    return match ? decodeURIComponent(match[1]) : '';
+}
+
 // 请求拦截器：设置请求头
 axiosInstance.interceptors.request.use(config => {
     const userId = store.state.userId || localStorage.getItem('userId');
     const authToken = store.state.authToken || localStorage.getItem('authToken');
 
-    // 设置请求头
+    // X-User-ID 仅用于网关灰度路由，后端以访问令牌识别用户
     if (userId) {
         deleteCookie('X-User-ID');
         document.cookie = `X-User-ID=${userId}; path=/;`;
@@ -27,6 +33,13 @@ axiosInstance.interceptors.request.use(config => {
         config.headers['Authorization'] = authToken;
     }
 
+    // 双提交 CSRF：写请求回传 login-service 写入的 XSRF-TOKEN Cookie
+    const method = (config.method || 'get').toLowerCase();
+    const csrfToken = readCookie('XSRF-TOKEN');
+    if (csrfToken && !['get', 'head', 'options'].includes(method)) {
+        config.headers['X-XSRF-TOKEN'] = csrfToken;
+    }
+
     if (!config.headers['Content-Type']) {
         config.headers['Content-Type'] = 'application/json';
     }
@@ -34,6 +47,9 @@ axiosInstance.interceptors.request.use(config => {
     return config;
 }, error => Promise.reject(error));
 
+// 正在进行的刷新请求，并发的 401 共用同一次刷新
+let refreshing = null;
+
 // 响应拦截器：从请求配置中获取 X-B3-TraceId
 axiosInstance.interceptors.response.use(
     response => {
@@ -43,7 +59,27 @@ axiosInstance.interceptors.response.use(
 
         return response;
     },
-    error => {
+    async error => {
+        // 访问令牌过期：使用 RefreshToken Cookie 刷新后重试一次
+        const original = error.config;
+        if (error.response?.status === 401 && original && !original._retried &&
+            !['/login', '/register', '/refresh'].includes(original.url)) {
+            original._retried = true;
+            try {
+                if (!refreshing) {
+                    refreshing = axiosInstance.post('/refresh').finally(() => { refreshing = null; });
+                }
+                const { data } = await refreshing;
+                store.commit('setAuthToken', data.authToken);
+                localStorage.setItem('authToken', data.authToken);
+                original.headers['Authorization'] = data.authToken;
+                return axiosInstance(original);
+            } catch (refreshError) {
+                store.commit('logout');
+                return Promise.reject(error);
+            }
+        }
+
         // 如果请求失败，检查请求头中的 X-B3-TraceId
         const traceId = error.config?.headers['X-B3-TraceId'] || 'No traceId available';
         console.error('Request failed:', error);
@@ -4,6 +4,8 @@ import LoginComponent from '../components/LoginComponent.vue';
 import GuessNumberComponent from '../components/GuessNumberComponent.vue';
 import ScoreboardComponent from '../components/ScoreboardComponent.vue';
 import RegisterComponent from '../components/RegisterComponent.vue';
+import ResetPasswordComponent from '../components/ResetPasswordComponent.vue';
+import VerifyEmailComponent from '../components/VerifyEmailComponent.vue';
 import store from '../store';
 
 const routes = [
@@ -11,8 +13,14 @@ const routes = [
     { path: '/register', component: RegisterComponent },
     { path: '/game', component: GuessNumberComponent },
     { path: '/scoreboard', component: ScoreboardComponent },
+    // 邮件中的链接：<base>/#/reset-password?token=…、<base>/#/verify-email?token=…
+    { path: '/reset-password', component: ResetPasswordComponent },
+    { path: '/verify-email', component: VerifyEmailComponent },
 ];
 
+// 无需登录即可访问的页面
+const publicPaths = ['/login', '/register', '/reset-password', '/verify-email'];
+
 const router = createRouter({
     history: createWebHashHistory(process.env.BASE_URL),
     routes,
@@ -20,11 +28,7 @@ const router = createRouter({
 
 // 导航守卫：如果未登录则跳转到 /login
 router.beforeEach((to, from, next) => {
-    if (
-        to.path !== '/login' &&
-        to.path !== '/register' &&
-        !store.state.isLoggedIn
-    ) {
+    if (!publicPaths.includes(to.path) && !store.state.isLoggedIn) {
         next('/login');
     } else {
         next();
@@ -1,5 +1,6 @@
 // src/store/index.js
 import { createStore } from 'vuex';
+import axiosInstance from '../axiosInstance';
 
 export default createStore({
     state: {
@@ -32,7 +33,13 @@ export default createStore({
         },
     },
     actions: {
-        logout({ commit }) {
+        // 通知 login-service 吊销当前会话；all 为 true 时退出所有设备
+        async logout({ commit }, { all = false } = {}) {
+            try {
+                await axiosInstance.post(all ? '/logout/all' : '/logout');
+            } catch (error) {
+                console.error('Logout failed:', error.message || error);
+            }
             commit('logout');
         },
     },
@@ -0,0 +1,44 @@
+// admin.go
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"microservice/pkg/auth"
+)
+
+// 管理接口：需要访问令牌携带 admin 角色，每个操作输出 audit=admin_action 的审计日志
+const roleAdmin = "admin"
+
+// auditAdminAction 输出管理操作审计记录
+func auditAdminAction(c *gin.Context, action, target string, keysAndValues ...interface{}) {
+	actor := ""
+	if claims, ok := auth.ClaimsFrom(c); ok {
+		actor = claims.Subject
+	}
+	zapLog.Infow("Admin action", append([]interface{}{
+		"audit", "admin_action",
+		"action", action,
+		"actor", actor,
+		"target", target,
+		"ip", c.ClientIP(),
+	}, keysAndValues...)...)
+}
+
+// adminResetGameHandler 重置用户的游戏：放弃进行中的对局，清零尝试与猜中次数
+func adminResetGameHandler(c *gin.Context) {
+	userID := c.Param("id")
+	abandoned, err := store.ResetGame(userID)
+	if err == errGameNotFound {
+		respondWithError(c, http.StatusNotFound, "Game not found")
+		return
+	}
+	if err != nil {
+		zapLog.Errorf("Error resetting game for user %s: %v", userID, err)
+		respondWithError(c, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+	auditAdminAction(c, "reset_game", userID, "abandoned_rounds", abandoned)
+	c.JSON(http.StatusOK, gin.H{"success": true, "abandonedRounds": abandoned})
+}
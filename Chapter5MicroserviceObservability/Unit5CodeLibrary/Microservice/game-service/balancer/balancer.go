@@ -0,0 +1,328 @@
+// Package balancer 在 Nacos 返回的服务实例之间做客户端负载均衡。
+//
+// 每次 Pick 都从 Naming 读取最新实例列表（SDK 自带本地缓存与订阅推送），过滤掉不健康、
+// 未启用（Enable=false）、权重不大于 0 以及元数据不匹配的实例，再按策略选择：
+//   - weighted_round_robin：平滑加权轮询，与 nginx 相同的算法，权重 10:5 的两个实例按 2:1 交错分配
+//   - least_outstanding：进行中请求数 / 权重 最小的实例，相同时随机
+//   - p2c：按权重随机抽取两个实例，取 进行中请求数 / 权重 较小者
+//
+// 调用方在请求结束后必须调用 Pick 返回的 done，进行中请求数才会回落。
+package balancer
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nacos-group/nacos-sdk-go/model"
+	"github.com/nacos-group/nacos-sdk-go/vo"
+)
+
+// 策略名称
+const (
+	WeightedRoundRobin = "weighted_round_robin"
+	LeastOutstanding   = "least_outstanding"
+	PowerOfTwoChoices  = "p2c"
+)
+
+// ErrNoInstance 没有可用实例
+var ErrNoInstance = errors.New("no available instance")
+
+// Naming 负载均衡用到的 Nacos 命名客户端方法，naming_client.INamingClient 满足该接口
+type Naming interface {
+	GetService(param vo.GetServiceParam) (model.Service, error)
+}
+
+// Config 目标服务与选择策略
+type Config struct {
+	ServiceName string
+	GroupName   string   // 默认 DEFAULT_GROUP
+	Clusters    []string // 为空时不限集群
+	// Metadata 实例元数据须包含全部键值，如 version=v2
+	Metadata map[string]string
+	Strategy string // 默认 weighted_round_robin
+}
+
+// Balancer 某个服务的客户端负载均衡器，可并发使用
+type Balancer struct {
+	naming Naming
+	cfg    Config
+	picker picker
+}
+
+// picker 从过滤后的实例中选择一个；返回的 done 在请求结束后调用
+type picker interface {
+	pick(instances []model.Instance) (model.Instance, func())
+}
+
+// New 创建负载均衡器，策略名未知时返回错误
+func New(naming Naming, cfg Config) (*Balancer, error) {
+	if naming == nil {
+		return nil, errors.New("balancer: naming client is nil")
+	}
+	if cfg.ServiceName == "" {
+		return nil, errors.New("balancer: service name is empty")
+	}
+	if cfg.GroupName == "" {
+		cfg.GroupName = "DEFAULT_GROUP"
+	}
+	p, err := newPicker(cfg.Strategy)
+	if err != nil {
+		return nil, err
+	}
+	return &Balancer{naming: naming, cfg: cfg, picker: p}, nil
+}
+
+func newPicker(strategy string) (picker, error) {
+	rnd := newLockedRand()
+	switch strategy {
+	case "", WeightedRoundRobin:
+		return &weightedRoundRobin{current: make(map[string]float64)}, nil
+	case LeastOutstanding:
+		return &leastOutstanding{loads: newLoads(), rnd: rnd}, nil
+	case PowerOfTwoChoices:
+		return &powerOfTwo{loads: newLoads(), rnd: rnd}, nil
+	default:
+		return nil, fmt.Errorf("balancer: unknown strategy %q", strategy)
+	}
+}
+
+// Strategy 实际使用的策略名称
+func (b *Balancer) Strategy() string {
+	if b.cfg.Strategy == "" {
+		return WeightedRoundRobin
+	}
+	return b.cfg.Strategy
+}
+
+// Pick 选择一个实例；请求结束后须调用 done
+func (b *Balancer) Pick() (model.Instance, func(), error) {
+	service, err := b.naming.GetService(vo.GetServiceParam{
+		ServiceName: b.cfg.ServiceName,
+		GroupName:   b.cfg.GroupName,
+		Clusters:    b.cfg.Clusters,
+	})
+	if err != nil {
+		return model.Instance{}, nil, fmt.Errorf("discover %s: %w", b.cfg.ServiceName, err)
+	}
+	candidates := b.filter(service.Hosts)
+	if len(candidates) == 0 {
+		return model.Instance{}, nil, fmt.Errorf("%s: %w", b.cfg.ServiceName, ErrNoInstance)
+	}
+	instance, done := b.picker.pick(candidates)
+	return instance, done, nil
+}
+
+// filter 保留健康、已启用、权重为正且元数据匹配的实例
+func (b *Balancer) filter(hosts []model.Instance) []model.Instance {
+	out := make([]model.Instance, 0, len(hosts))
+	for _, h := range hosts {
+		if !h.Healthy || !h.Enable || h.Weight <= 0 || !matchMetadata(h.Metadata, b.cfg.Metadata) {
+			continue
+		}
+		out = append(out, h)
+	}
+	return out
+}
+
+func matchMetadata(have, want map[string]string) bool {
+	for k, v := range want {
+		if got, ok := have[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseMetadata 解析 "k1=v1,k2=v2" 形式的元数据过滤条件
+func ParseMetadata(s string) (map[string]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	m := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("balancer: invalid metadata %q, want key=value", pair)
+		}
+		m[k] = strings.TrimSpace(v)
+	}
+	return m, nil
+}
+
+// instanceKey 实例标识，实例列表刷新后仍能对应到原有状态
+func instanceKey(in model.Instance) string {
+	return in.Ip + ":" + strconv.FormatUint(in.Port, 10)
+}
+
+func noop() {}
+
+/* ----------------- 平滑加权轮询 ----------------- */
+
+type weightedRoundRobin struct {
+	mu      sync.Mutex
+	current map[string]float64
+}
+
+func (w *weightedRoundRobin) pick(instances []model.Instance) (model.Instance, func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	seen := make(map[string]bool, len(instances))
+	total := 0.0
+	best := -1
+	for i, in := range instances {
+		key := instanceKey(in)
+		seen[key] = true
+		w.current[key] += in.Weight
+		total += in.Weight
+		if best < 0 || w.current[key] > w.current[instanceKey(instances[best])] {
+			best = i
+		}
+	}
+	w.current[instanceKey(instances[best])] -= total
+	// 下线实例的状态不再保留，重新上线时从零开始
+	for key := range w.current {
+		if !seen[key] {
+			delete(w.current, key)
+		}
+	}
+	return instances[best], noop
+}
+
+/* ----------------- 进行中请求计数 ----------------- */
+
+type loads struct {
+	mu       sync.Mutex
+	inflight map[string]int
+}
+
+func newLoads() *loads {
+	return &loads{inflight: make(map[string]int)}
+}
+
+// acquire 计数加一，返回只生效一次的 done
+func (l *loads) acquire(in model.Instance) func() {
+	key := instanceKey(in)
+	l.mu.Lock()
+	l.inflight[key]++
+	l.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			if l.inflight[key] <= 1 {
+				delete(l.inflight, key)
+			} else {
+				l.inflight[key]--
+			}
+		})
+	}
+}
+
+// score 进行中请求数 / 权重，调用方持有锁
+func (l *loads) score(in model.Instance) float64 {
+	return float64(l.inflight[instanceKey(in)]) / in.Weight
+}
+
+/* ----------------- 最少进行中请求 ----------------- */
+
+type leastOutstanding struct {
+	loads *loads
+	rnd   *lockedRand
+}
+
+func (p *leastOutstanding) pick(instances []model.Instance) (model.Instance, func()) {
+	p.loads.mu.Lock()
+	var ties []int
+	lowest := 0.0
+	for i, in := range instances {
+		s := p.loads.score(in)
+		switch {
+		case len(ties) == 0 || s < lowest:
+			lowest, ties = s, append(ties[:0], i)
+		case s == lowest:
+			ties = append(ties, i)
+		}
+	}
+	p.loads.mu.Unlock()
+
+	chosen := instances[ties[p.rnd.Intn(len(ties))]]
+	return chosen, p.loads.acquire(chosen)
+}
+
+/* ----------------- 两次随机选择 ----------------- */
+
+type powerOfTwo struct {
+	loads *loads
+	rnd   *lockedRand
+}
+
+func (p *powerOfTwo) pick(instances []model.Instance) (model.Instance, func()) {
+	if len(instances) == 1 {
+		return instances[0], p.loads.acquire(instances[0])
+	}
+	a := p.weightedIndex(instances, -1)
+	b := p.weightedIndex(instances, a)
+
+	p.loads.mu.Lock()
+	chosen := instances[a]
+	if p.loads.score(instances[b]) < p.loads.score(chosen) {
+		chosen = instances[b]
+	}
+	p.loads.mu.Unlock()
+	return chosen, p.loads.acquire(chosen)
+}
+
+// weightedIndex 按权重随机抽取一个下标，跳过 exclude
+func (p *powerOfTwo) weightedIndex(instances []model.Instance, exclude int) int {
+	total := 0.0
+	for i, in := range instances {
+		if i != exclude {
+			total += in.Weight
+		}
+	}
+	r := p.rnd.Float64() * total
+	last := -1
+	for i, in := range instances {
+		if i == exclude {
+			continue
+		}
+		last = i
+		if r < in.Weight {
+			return i
+		}
+		r -= in.Weight
+	}
+	return last
+}
+
+/* ----------------- 并发安全的随机数 ----------------- */
+
+type lockedRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+func newLockedRand() *lockedRand {
+	return &lockedRand{r: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+func (l *lockedRand) Intn(n int) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Intn(n)
+}
+
+func (l *lockedRand) Float64() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Float64()
+}
@@ -0,0 +1,292 @@
+package balancer
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nacos-group/nacos-sdk-go/model"
+	"github.com/nacos-group/nacos-sdk-go/vo"
+)
+
+// fakeNaming 返回固定实例列表，并记录最近一次查询参数
+type fakeNaming struct {
+	mu    sync.Mutex
+	hosts []model.Instance
+	err   error
+	last  vo.GetServiceParam
+}
+
+func (f *fakeNaming) GetService(param vo.GetServiceParam) (model.Service, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.last = param
+	if f.err != nil {
+		return model.Service{}, f.err
+	}
+	return model.Service{Name: param.ServiceName, Hosts: append([]model.Instance(nil), f.hosts...)}, nil
+}
+
+func (f *fakeNaming) set(hosts ...model.Instance) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.hosts = hosts
+}
+
+// host 健康、已启用的实例
+func host(ip string, weight float64) model.Instance {
+	return model.Instance{Ip: ip, Port: 8083, Weight: weight, Healthy: true, Enable: true}
+}
+
+func newBalancer(t *testing.T, naming Naming, cfg Config) *Balancer {
+	t.Helper()
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = "login-service"
+	}
+	b, err := New(naming, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func pick(t *testing.T, b *Balancer) (string, func()) {
+	t.Helper()
+	in, done, err := b.Pick()
+	if err != nil {
+		t.Fatalf("pick: %v", err)
+	}
+	return in.Ip, done
+}
+
+func TestWeightedRoundRobinDistribution(t *testing.T) {
+	naming := &fakeNaming{}
+	naming.set(host("a", 5), host("b", 3), host("c", 2))
+	b := newBalancer(t, naming, Config{Strategy: WeightedRoundRobin})
+
+	counts := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		ip, done := pick(t, b)
+		done()
+		counts[ip]++
+	}
+	if want := map[string]int{"a": 500, "b": 300, "c": 200}; !reflect.DeepEqual(counts, want) {
+		t.Fatalf("distribution %v, want %v", counts, want)
+	}
+}
+
+func TestWeightedRoundRobinIsSmooth(t *testing.T) {
+	naming := &fakeNaming{}
+	naming.set(host("a", 10), host("b", 5))
+	b := newBalancer(t, naming, Config{})
+	if b.Strategy() != WeightedRoundRobin {
+		t.Fatalf("default strategy %q", b.Strategy())
+	}
+
+	var seq []string
+	for i := 0; i < 6; i++ {
+		ip, _ := pick(t, b)
+		seq = append(seq, ip)
+	}
+	// 10:5 交错为 a b a，而不是 a a b
+	if got := strings.Join(seq, ""); got != "abaaba" {
+		t.Fatalf("sequence %s, want abaaba", got)
+	}
+
+	// 实例下线后状态清除，剩余实例独占流量
+	naming.set(host("b", 5))
+	for i := 0; i < 3; i++ {
+		if ip, _ := pick(t, b); ip != "b" {
+			t.Fatalf("picked removed instance %s", ip)
+		}
+	}
+	if w := b.picker.(*weightedRoundRobin); len(w.current) != 1 {
+		t.Fatalf("state kept for removed instances: %v", w.current)
+	}
+}
+
+func TestLeastOutstandingTracksInflight(t *testing.T) {
+	naming := &fakeNaming{}
+	naming.set(host("a", 1), host("b", 1))
+	b := newBalancer(t, naming, Config{Strategy: LeastOutstanding})
+	loads := b.picker.(*leastOutstanding).loads
+
+	first, doneFirst := pick(t, b)
+	second, doneSecond := pick(t, b)
+	if first == second {
+		t.Fatalf("both requests went to %s while the other instance was idle", first)
+	}
+	// first 的请求结束后，下一次选择回到 first
+	doneFirst()
+	doneFirst() // 重复调用不会多减
+	if ip, done := pick(t, b); ip != first {
+		t.Fatalf("picked %s, want idle instance %s", ip, first)
+	} else {
+		done()
+	}
+	doneSecond()
+	if len(loads.inflight) != 0 {
+		t.Fatalf("inflight not released: %v", loads.inflight)
+	}
+}
+
+func TestLeastOutstandingWeighted(t *testing.T) {
+	naming := &fakeNaming{}
+	naming.set(host("a", 3), host("b", 1))
+	b := newBalancer(t, naming, Config{Strategy: LeastOutstanding})
+
+	// 同时保持 8 个请求：按 进行中请求数 / 权重 分配为 6:2
+	counts := make(map[string]int)
+	var dones []func()
+	for i := 0; i < 8; i++ {
+		ip, done := pick(t, b)
+		counts[ip]++
+		dones = append(dones, done)
+	}
+	if counts["a"] != 6 || counts["b"] != 2 {
+		t.Fatalf("inflight split %v, want a:6 b:2", counts)
+	}
+	for _, done := range dones {
+		done()
+	}
+}
+
+func TestLeastOutstandingConcurrent(t *testing.T) {
+	naming := &fakeNaming{}
+	naming.set(host("a", 1), host("b", 1), host("c", 1), host("d", 1))
+	b := newBalancer(t, naming, Config{Strategy: LeastOutstanding})
+	loads := b.picker.(*leastOutstanding).loads
+
+	const workers = 200
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	dones := make(chan func(), workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, done, err := b.Pick()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			dones <- done
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(dones)
+
+	loads.mu.Lock()
+	for ip, n := range loads.inflight {
+		if n != workers/4 {
+			t.Errorf("instance %s has %d in flight, want %d", ip, n, workers/4)
+		}
+	}
+	loads.mu.Unlock()
+
+	for done := range dones {
+		wg.Add(1)
+		go func(done func()) {
+			defer wg.Done()
+			done()
+		}(done)
+	}
+	wg.Wait()
+	if len(loads.inflight) != 0 {
+		t.Fatalf("inflight not released: %v", loads.inflight)
+	}
+}
+
+func TestPowerOfTwoPrefersIdle(t *testing.T) {
+	naming := &fakeNaming{}
+	naming.set(host("a", 1), host("b", 1))
+	b := newBalancer(t, naming, Config{Strategy: PowerOfTwoChoices})
+
+	busy, done := pick(t, b)
+	for i := 0; i < 20; i++ {
+		ip, release := pick(t, b)
+		release()
+		if ip == busy {
+			t.Fatalf("picked busy instance %s over an idle one", ip)
+		}
+	}
+	done()
+}
+
+func TestFilterExcludesUnavailableInstances(t *testing.T) {
+	disabled := host("disabled", 1)
+	disabled.Enable = false
+	unhealthy := host("unhealthy", 1)
+	unhealthy.Healthy = false
+	zero := host("zero", 0)
+	negative := host("negative", -1)
+	v1 := host("v1", 100)
+	v1.Metadata = map[string]string{"version": "v1", "zone": "a"}
+	otherZone := host("other-zone", 100)
+	otherZone.Metadata = map[string]string{"version": "v2", "zone": "b"}
+	good := host("good", 1)
+	good.Metadata = map[string]string{"version": "v2", "zone": "a"}
+
+	for _, strategy := range []string{WeightedRoundRobin, LeastOutstanding, PowerOfTwoChoices} {
+		naming := &fakeNaming{}
+		naming.set(disabled, unhealthy, zero, negative, v1, otherZone, good)
+		b := newBalancer(t, naming, Config{Strategy: strategy, Metadata: map[string]string{"version": "v2", "zone": "a"}})
+		for i := 0; i < 20; i++ {
+			ip, done := pick(t, b)
+			done()
+			if ip != "good" {
+				t.Fatalf("%s picked filtered instance %s", strategy, ip)
+			}
+		}
+
+		naming.set(disabled, unhealthy, zero, negative, v1, otherZone)
+		if _, _, err := b.Pick(); !errors.Is(err, ErrNoInstance) {
+			t.Fatalf("%s: error %v, want ErrNoInstance", strategy, err)
+		}
+	}
+}
+
+func TestPickQueriesConfiguredService(t *testing.T) {
+	naming := &fakeNaming{}
+	naming.set(host("a", 1))
+	b := newBalancer(t, naming, Config{ServiceName: "scoreboard-service", Clusters: []string{"c1"}})
+	pick(t, b)
+	want := vo.GetServiceParam{ServiceName: "scoreboard-service", GroupName: "DEFAULT_GROUP", Clusters: []string{"c1"}}
+	if !reflect.DeepEqual(naming.last, want) {
+		t.Fatalf("query %+v, want %+v", naming.last, want)
+	}
+
+	naming.err = errors.New("nacos down")
+	if _, _, err := b.Pick(); err == nil || !strings.Contains(err.Error(), "nacos down") {
+		t.Fatalf("naming error not returned: %v", err)
+	}
+}
+
+func TestNewValidatesConfig(t *testing.T) {
+	if _, err := New(nil, Config{ServiceName: "s"}); err == nil {
+		t.Error("nil naming accepted")
+	}
+	if _, err := New(&fakeNaming{}, Config{}); err == nil {
+		t.Error("empty service name accepted")
+	}
+	if _, err := New(&fakeNaming{}, Config{ServiceName: "s", Strategy: "random"}); err == nil {
+		t.Error("unknown strategy accepted")
+	}
+}
+
+func TestParseMetadata(t *testing.T) {
+	m, err := ParseMetadata(" version = v2 , zone=a ")
+	if err != nil || !reflect.DeepEqual(m, map[string]string{"version": "v2", "zone": "a"}) {
+		t.Fatalf("ParseMetadata = %v, %v", m, err)
+	}
+	if m, err = ParseMetadata(""); err != nil || m != nil {
+		t.Fatalf("empty metadata = %v, %v", m, err)
+	}
+	if _, err = ParseMetadata("version"); err == nil {
+		t.Fatal("pair without value separator accepted")
+	}
+}
@@ -0,0 +1,128 @@
+// dbpool.go
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+	"microservice/pkg/dbpool"
+	"microservice/pkg/migrate"
+)
+
+// MySQL 连接池热替换见 microservice/pkg/dbpool：gorm 持有 dbPool，Prod_DATABASE 变更时
+// 存储与 outbox 转发器无需重建；新连接池在切换前执行 game-service 的迁移
+
+var dbPool *dbpool.Pool
+
+// sqlDBOf 返回 gorm 当前使用的 *sql.DB
+func sqlDBOf(db *gorm.DB) *sql.DB {
+	if p, ok := db.CommonDB().(*dbpool.Pool); ok {
+		return p.Current()
+	}
+	return db.DB()
+}
+
+// poolConfig 从 Prod_DATABASE 中取出连接池所需的配置
+func poolConfig(dbConfig map[string]string) dbpool.Config {
+	return dbpool.Config{
+		Driver:          driverMySQL,
+		User:            dbConfig["DB_USER"],
+		Password:        dbConfig["DB_PASSWORD"],
+		Host:            dbConfig["DB_HOST"],
+		Port:            dbConfig["DB_PORT"],
+		Name:            dbConfig["DB_NAME"],
+		MaxOpenConns:    dbConfig["DB_MAX_OPEN_CONNS"],
+		MaxIdleConns:    dbConfig["DB_MAX_IDLE_CONNS"],
+		ConnMaxLifetime: dbConfig["DB_CONN_MAX_LIFETIME"],
+	}
+}
+
+// openMySQL 建立连接池并包装为可替换的 gorm 数据源
+func openMySQL(dbConfig map[string]string) (*gorm.DB, error) {
+	cfg := poolConfig(dbConfig)
+	zapLog.Infof("Connecting to MySQL at %s:%s/%s", cfg.Host, cfg.Port, cfg.Name)
+	sqlDB, err := dbpool.Open(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	p := dbpool.New(sqlDB, cfg, func(err error) {
+		zapLog.Warnw("Error closing previous database pool", "error", err)
+	})
+	gdb, err := gorm.Open("mysql", p)
+	if err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	dbPool = p
+	return gdb, nil
+}
+
+// parseDatabaseConfig 解析并校验 Prod_DATABASE
+func parseDatabaseConfig(content string) (map[string]string, error) {
+	var dbConfig map[string]string
+	if err := json.Unmarshal([]byte(content), &dbConfig); err != nil {
+		return nil, fmt.Errorf("parse database config: %w", err)
+	}
+	if storeDriver(dbConfig) != driverMySQL {
+		return dbConfig, nil
+	}
+	if err := poolConfig(dbConfig).Validate(); err != nil {
+		return nil, err
+	}
+	return dbConfig, nil
+}
+
+// applyDatabaseConfig 应用 Prod_DATABASE 的变更；新连接池无法建立或迁移失败时保留当前连接池
+func applyDatabaseConfig(content string) error {
+	dbConfig, err := parseDatabaseConfig(content)
+	if err != nil {
+		return err
+	}
+	if dbPool == nil {
+		return fmt.Errorf("database hot reload requires the mysql driver")
+	}
+	if storeDriver(dbConfig) != driverMySQL {
+		return fmt.Errorf("changing DB_DRIVER requires a restart")
+	}
+
+	replaced, err := dbPool.Apply(poolConfig(dbConfig), func(next *sql.DB) error {
+		if !autoMigrateEnabled() {
+			return nil
+		}
+		applied, err := migrate.New(next, "mysql", "game-service", gameMigrations).Up(0)
+		if err != nil {
+			return fmt.Errorf("failed to migrate database: %w", err)
+		}
+		for _, m := range applied {
+			zapLog.Infof("Applied migration %03d_%s", m.Version, m.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if replaced {
+		zapLog.Infow("Database pool replaced", "host", dbConfig["DB_HOST"], "db", dbConfig["DB_NAME"])
+	}
+	return nil
+}
+
+// watchDatabaseConfig 存储打开之后监听 Prod_DATABASE；非 mysql 驱动不从 Nacos 读取数据库配置
+func watchDatabaseConfig() {
+	if dbPool == nil {
+		return
+	}
+	if err := watchConfig("Prod_DATABASE", applyDatabaseConfig); err != nil {
+		zapLog.Errorw("Database config differs from the one in use", "error", err)
+	}
+}
+
+// databaseSettings 当前连接池的配置，不含密码
+func databaseSettings() dbpool.Config {
+	if dbPool == nil {
+		return dbpool.Config{Driver: storeDriver(nil)}
+	}
+	return dbPool.Config()
+}
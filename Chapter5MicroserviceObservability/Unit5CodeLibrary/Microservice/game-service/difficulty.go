@@ -0,0 +1,118 @@
+// difficulty.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Difficulty 难度配置：数字范围与最大尝试次数（0 表示不限次数）
+type Difficulty struct {
+	Name        string `json:"name"`
+	Min         int    `json:"min"`
+	Max         int    `json:"max"`
+	MaxAttempts int    `json:"maxAttempts"`
+}
+
+const defaultDifficulty = "normal"
+
+// 内置难度，Nacos 未配置时使用
+var builtinDifficulties = []Difficulty{
+	{Name: "easy", Min: 1, Max: 50, MaxAttempts: 0},
+	{Name: "normal", Min: 1, Max: 100, MaxAttempts: 0},
+	{Name: "hard", Min: 1, Max: 1000, MaxAttempts: 10},
+}
+
+var (
+	difficultyMu sync.RWMutex
+	difficulties = indexDifficulties(builtinDifficulties)
+)
+
+func indexDifficulties(list []Difficulty) map[string]Difficulty {
+	m := make(map[string]Difficulty, len(list))
+	for _, d := range list {
+		m[d.Name] = d
+	}
+	return m
+}
+
+// 校验难度配置
+func validateDifficulties(list []Difficulty) error {
+	if len(list) == 0 {
+		return fmt.Errorf("no difficulty defined")
+	}
+	seen := make(map[string]bool, len(list))
+	for _, d := range list {
+		if d.Name == "" {
+			return fmt.Errorf("difficulty name is empty")
+		}
+		if seen[d.Name] {
+			return fmt.Errorf("duplicate difficulty %q", d.Name)
+		}
+		seen[d.Name] = true
+		if d.Min >= d.Max {
+			return fmt.Errorf("difficulty %q: min %d must be less than max %d", d.Name, d.Min, d.Max)
+		}
+		if d.MaxAttempts < 0 {
+			return fmt.Errorf("difficulty %q: maxAttempts must not be negative", d.Name)
+		}
+	}
+	if !seen[defaultDifficulty] {
+		return fmt.Errorf("default difficulty %q is missing", defaultDifficulty)
+	}
+	return nil
+}
+
+// 解析并替换难度配置，格式为 Difficulty 的 JSON 数组
+func applyDifficultyConfig(content string) error {
+	var list []Difficulty
+	if err := json.Unmarshal([]byte(content), &list); err != nil {
+		return fmt.Errorf("parse difficulty config: %w", err)
+	}
+	for i := range list {
+		list[i].Name = strings.ToLower(strings.TrimSpace(list[i].Name))
+	}
+	if err := validateDifficulties(list); err != nil {
+		return err
+	}
+
+	difficultyMu.Lock()
+	difficulties = indexDifficulties(list)
+	difficultyMu.Unlock()
+	zapLog.Infof("Loaded %d difficulty profiles", len(list))
+	return nil
+}
+
+// lookupDifficulty 按名称查找难度，名称为空时返回默认难度
+func lookupDifficulty(name string) (Difficulty, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		name = defaultDifficulty
+	}
+	difficultyMu.RLock()
+	defer difficultyMu.RUnlock()
+	d, ok := difficulties[name]
+	return d, ok
+}
+
+// listDifficulties 返回按名称排序的全部难度
+func listDifficulties() []Difficulty {
+	difficultyMu.RLock()
+	defer difficultyMu.RUnlock()
+	list := make([]Difficulty, 0, len(difficulties))
+	for _, d := range difficulties {
+		list = append(list, d)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// 从 Nacos 加载难度配置并监听变更；未配置或配置无效时保留内置难度
+func loadDifficultiesFromNacos() {
+	if err := watchConfig("Game_DIFFICULTY", applyDifficultyConfig); err != nil {
+		zapLog.Warnf("No valid difficulty config in Nacos (DataId: Game_DIFFICULTY), using built-in profiles: %v", err)
+	}
+}
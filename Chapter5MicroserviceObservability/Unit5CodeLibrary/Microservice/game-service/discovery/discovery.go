@@ -0,0 +1,258 @@
+// Package discovery 维护由 Nacos 订阅回调驱动的本地实例缓存。
+//
+// Watch 订阅服务后，实例列表只在 SubscribeCallback 推送时更新，GetService 直接读内存；
+// 尚未缓存的服务在首次查询时向 Nacos 拉取一次并补订阅。回调报错或推送空列表（Nacos 不可达、
+// 实例全部下线时 SDK 都会这样回调）时保留上一次的有效列表，并记录错误供调试接口查看。
+//
+// Cache 实现了 balancer.Naming，可直接交给负载均衡器使用。
+package discovery
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nacos-group/nacos-sdk-go/model"
+	"github.com/nacos-group/nacos-sdk-go/vo"
+)
+
+// 实例列表来源
+const (
+	SourceSubscribe = "subscribe"
+	SourceQuery     = "query"
+)
+
+var errEmpty = errors.New("empty instance list")
+
+// Naming 缓存用到的 Nacos 命名客户端方法，naming_client.INamingClient 满足该接口
+type Naming interface {
+	GetService(param vo.GetServiceParam) (model.Service, error)
+	Subscribe(param *vo.SubscribeParam) error
+}
+
+// ChangeFunc 实例列表变化的通知，在 SDK 回调协程中执行，不应阻塞；
+// err 不为 nil 时表示本次更新失败，instances 为继续使用的上一次列表
+type ChangeFunc func(service string, instances []model.Instance, err error)
+
+// ServiceView 某个服务的缓存状态，用于调试接口
+type ServiceView struct {
+	Service     string           `json:"service"`
+	Group       string           `json:"group"`
+	Subscribed  bool             `json:"subscribed"`
+	Source      string           `json:"source,omitempty"`
+	UpdatedAt   *time.Time       `json:"updatedAt,omitempty"`
+	Instances   []model.Instance `json:"instances"`
+	LastError   string           `json:"lastError,omitempty"`
+	LastErrorAt *time.Time       `json:"lastErrorAt,omitempty"`
+}
+
+type entry struct {
+	hosts       []model.Instance
+	cached      bool
+	subscribed  bool
+	source      string
+	updatedAt   time.Time
+	lastError   string
+	lastErrorAt time.Time
+}
+
+// Cache 本地实例缓存，可并发使用；只支持一个分组，不区分集群
+type Cache struct {
+	naming   Naming
+	group    string
+	onChange ChangeFunc
+	now      func() time.Time
+
+	mu       sync.RWMutex
+	services map[string]*entry
+}
+
+// New 创建缓存；group 为空时使用 DEFAULT_GROUP，onChange 可为 nil
+func New(naming Naming, group string, onChange ChangeFunc) *Cache {
+	if group == "" {
+		group = "DEFAULT_GROUP"
+	}
+	return &Cache{
+		naming:   naming,
+		group:    group,
+		onChange: onChange,
+		now:      time.Now,
+		services: make(map[string]*entry),
+	}
+}
+
+// Watch 订阅服务的实例变化并拉取一次当前列表；Nacos 不可达时返回错误，之后的 GetService 会再次尝试
+func (c *Cache) Watch(service string) error {
+	// 先标记为已订阅，避免并发调用重复注册回调；订阅失败时再撤销
+	c.mu.Lock()
+	e := c.entryLocked(service)
+	subscribe := !e.subscribed
+	e.subscribed = true
+	c.mu.Unlock()
+
+	if subscribe {
+		err := c.naming.Subscribe(&vo.SubscribeParam{
+			ServiceName: service,
+			GroupName:   c.group,
+			SubscribeCallback: func(services []model.SubscribeService, err error) {
+				c.update(service, services, err)
+			},
+		})
+		if err != nil {
+			c.mu.Lock()
+			e.subscribed = false
+			c.failLocked(e, err)
+			c.mu.Unlock()
+			return fmt.Errorf("subscribe %s: %w", service, err)
+		}
+	}
+	return c.refresh(service)
+}
+
+// GetService 返回缓存的实例列表；未缓存时订阅并向 Nacos 查询一次
+func (c *Cache) GetService(param vo.GetServiceParam) (model.Service, error) {
+	if hosts, ok := c.cachedHosts(param.ServiceName); ok {
+		return model.Service{Name: param.ServiceName, Hosts: hosts}, nil
+	}
+	if err := c.Watch(param.ServiceName); err != nil {
+		return model.Service{}, err
+	}
+	hosts, _ := c.cachedHosts(param.ServiceName)
+	return model.Service{Name: param.ServiceName, Hosts: hosts}, nil
+}
+
+func (c *Cache) cachedHosts(service string) ([]model.Instance, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	e, ok := c.services[service]
+	if !ok || !e.cached {
+		return nil, false
+	}
+	return copyHosts(e.hosts), true
+}
+
+// refresh 尚无有效列表时向 Nacos 查询一次
+func (c *Cache) refresh(service string) error {
+	if _, ok := c.cachedHosts(service); ok {
+		return nil
+	}
+	svc, err := c.naming.GetService(vo.GetServiceParam{ServiceName: service, GroupName: c.group})
+	if err == nil && len(svc.Hosts) == 0 {
+		err = errEmpty
+	}
+	c.mu.Lock()
+	e := c.entryLocked(service)
+	if err != nil {
+		c.failLocked(e, err)
+		c.mu.Unlock()
+		return fmt.Errorf("query %s: %w", service, err)
+	}
+	c.storeLocked(e, svc.Hosts, SourceQuery)
+	c.mu.Unlock()
+	c.notify(service, svc.Hosts, nil)
+	return nil
+}
+
+// Snapshot 所有服务的缓存状态，按服务名排序
+func (c *Cache) Snapshot() []ServiceView {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	views := make([]ServiceView, 0, len(c.services))
+	for name, e := range c.services {
+		v := ServiceView{
+			Service:    name,
+			Group:      c.group,
+			Subscribed: e.subscribed,
+			Source:     e.source,
+			Instances:  copyHosts(e.hosts),
+			LastError:  e.lastError,
+		}
+		if v.Instances == nil {
+			v.Instances = []model.Instance{}
+		}
+		if e.cached {
+			t := e.updatedAt
+			v.UpdatedAt = &t
+		}
+		if e.lastError != "" {
+			t := e.lastErrorAt
+			v.LastErrorAt = &t
+		}
+		views = append(views, v)
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].Service < views[j].Service })
+	return views
+}
+
+// update 处理订阅回调；出错或推送空列表时保留上一次的有效列表
+func (c *Cache) update(service string, services []model.SubscribeService, err error) {
+	if err == nil && len(services) == 0 {
+		err = errEmpty
+	}
+	c.mu.Lock()
+	e := c.entryLocked(service)
+	if err != nil {
+		c.failLocked(e, err)
+		kept := copyHosts(e.hosts)
+		c.mu.Unlock()
+		c.notify(service, kept, err)
+		return
+	}
+	hosts := make([]model.Instance, 0, len(services))
+	for _, s := range services {
+		hosts = append(hosts, model.Instance{
+			InstanceId:  s.InstanceId,
+			Ip:          s.Ip,
+			Port:        s.Port,
+			Weight:      s.Weight,
+			Healthy:     s.Healthy,
+			Enable:      s.Enable,
+			Valid:       s.Valid,
+			Metadata:    s.Metadata,
+			ClusterName: s.ClusterName,
+			ServiceName: s.ServiceName,
+		})
+	}
+	c.storeLocked(e, hosts, SourceSubscribe)
+	c.mu.Unlock()
+	c.notify(service, hosts, nil)
+}
+
+func (c *Cache) entryLocked(service string) *entry {
+	e, ok := c.services[service]
+	if !ok {
+		e = &entry{}
+		c.services[service] = e
+	}
+	return e
+}
+
+func (c *Cache) storeLocked(e *entry, hosts []model.Instance, source string) {
+	e.hosts = copyHosts(hosts)
+	e.cached = true
+	e.source = source
+	e.updatedAt = c.now()
+	e.lastError = ""
+}
+
+func (c *Cache) failLocked(e *entry, err error) {
+	e.lastError = err.Error()
+	e.lastErrorAt = c.now()
+}
+
+func (c *Cache) notify(service string, hosts []model.Instance, err error) {
+	if c.onChange != nil {
+		c.onChange(service, copyHosts(hosts), err)
+	}
+}
+
+func copyHosts(hosts []model.Instance) []model.Instance {
+	if hosts == nil {
+		return nil
+	}
+	out := make([]model.Instance, len(hosts))
+	copy(out, hosts)
+	return out
+}
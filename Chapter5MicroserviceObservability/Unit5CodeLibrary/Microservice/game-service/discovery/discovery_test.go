@@ -0,0 +1,311 @@
+package discovery
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nacos-group/nacos-sdk-go/model"
+	"github.com/nacos-group/nacos-sdk-go/vo"
+)
+
+// fakeNaming 记录订阅回调，由测试主动推送；GetService 返回预设结果并计数
+type fakeNaming struct {
+	mu           sync.Mutex
+	hosts        map[string][]model.Instance
+	queryErr     error
+	subscribeErr error
+	queries      int
+	subscribes   int
+	callbacks    map[string]func([]model.SubscribeService, error)
+}
+
+func newFakeNaming() *fakeNaming {
+	return &fakeNaming{
+		hosts:     make(map[string][]model.Instance),
+		callbacks: make(map[string]func([]model.SubscribeService, error)),
+	}
+}
+
+func (f *fakeNaming) GetService(param vo.GetServiceParam) (model.Service, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queries++
+	if f.queryErr != nil {
+		return model.Service{}, f.queryErr
+	}
+	return model.Service{Name: param.ServiceName, Hosts: f.hosts[param.ServiceName]}, nil
+}
+
+func (f *fakeNaming) Subscribe(param *vo.SubscribeParam) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.subscribes++
+	if f.subscribeErr != nil {
+		return f.subscribeErr
+	}
+	f.callbacks[param.ServiceName] = param.SubscribeCallback
+	return nil
+}
+
+// push 模拟 SDK 的订阅回调
+func (f *fakeNaming) push(t *testing.T, service string, services []model.SubscribeService, err error) {
+	t.Helper()
+	f.mu.Lock()
+	cb, ok := f.callbacks[service]
+	f.mu.Unlock()
+	if !ok {
+		t.Fatalf("%s not subscribed", service)
+	}
+	cb(services, err)
+}
+
+func (f *fakeNaming) counts() (queries, subscribes int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.queries, f.subscribes
+}
+
+// change 一次 onChange 通知
+type change struct {
+	service string
+	ips     []string
+	err     error
+}
+
+// newTestCache 创建使用固定时钟的缓存，并收集 onChange 通知
+func newTestCache(naming Naming) (*Cache, *[]change) {
+	var changes []change
+	c := New(naming, "", func(service string, instances []model.Instance, err error) {
+		changes = append(changes, change{service: service, ips: ips(instances), err: err})
+	})
+	c.now = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+	return c, &changes
+}
+
+func ips(hosts []model.Instance) []string {
+	out := []string{}
+	for _, h := range hosts {
+		out = append(out, h.Ip)
+	}
+	return out
+}
+
+func cachedIPs(t *testing.T, c *Cache, service string) []string {
+	t.Helper()
+	svc, err := c.GetService(vo.GetServiceParam{ServiceName: service})
+	if err != nil {
+		t.Fatalf("GetService(%s): %v", service, err)
+	}
+	return ips(svc.Hosts)
+}
+
+func TestWatchQueriesOnceThenServesFromCache(t *testing.T) {
+	naming := newFakeNaming()
+	naming.hosts["login-service"] = []model.Instance{{Ip: "10.0.0.1", Port: 8082, Weight: 1}}
+	c, changes := newTestCache(naming)
+
+	if err := c.Watch("login-service"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if got := cachedIPs(t, c, "login-service"); !reflect.DeepEqual(got, []string{"10.0.0.1"}) {
+			t.Fatalf("cached hosts %v", got)
+		}
+	}
+	if q, s := naming.counts(); q != 1 || s != 1 {
+		t.Fatalf("naming called %d queries / %d subscribes, want 1 / 1", q, s)
+	}
+	if len(*changes) != 1 || (*changes)[0].err != nil {
+		t.Fatalf("changes %+v", *changes)
+	}
+}
+
+func TestSubscribeCallbackUpdatesHosts(t *testing.T) {
+	naming := newFakeNaming()
+	naming.hosts["login-service"] = []model.Instance{{Ip: "10.0.0.1"}}
+	c, changes := newTestCache(naming)
+	// 首次 GetService 时补订阅
+	cachedIPs(t, c, "login-service")
+
+	naming.push(t, "login-service", []model.SubscribeService{
+		{Ip: "10.0.0.2", Port: 8082, Weight: 2, Healthy: true, Enable: true, Metadata: map[string]string{"version": "v2"}},
+		{Ip: "10.0.0.3", Port: 8082, Weight: 1, Healthy: false, Enable: true},
+	}, nil)
+
+	svc, err := c.GetService(vo.GetServiceParam{ServiceName: "login-service"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ips(svc.Hosts); !reflect.DeepEqual(got, []string{"10.0.0.2", "10.0.0.3"}) {
+		t.Fatalf("hosts after push %v", got)
+	}
+	if h := svc.Hosts[0]; h.Port != 8082 || h.Weight != 2 || !h.Healthy || !h.Enable || h.Metadata["version"] != "v2" {
+		t.Fatalf("instance fields not copied: %+v", h)
+	}
+	if q, _ := naming.counts(); q != 1 {
+		t.Fatalf("push triggered %d queries, want 1", q)
+	}
+	if last := (*changes)[len(*changes)-1]; last.err != nil || len(last.ips) != 2 {
+		t.Fatalf("last change %+v", last)
+	}
+
+	// 调用方修改返回值不影响缓存
+	svc.Hosts[0].Ip = "mutated"
+	if got := cachedIPs(t, c, "login-service"); got[0] != "10.0.0.2" {
+		t.Fatalf("cache aliased caller slice: %v", got)
+	}
+}
+
+func TestCallbackErrorKeepsLastHosts(t *testing.T) {
+	naming := newFakeNaming()
+	naming.hosts["login-service"] = []model.Instance{{Ip: "10.0.0.1"}}
+	c, changes := newTestCache(naming)
+	if err := c.Watch("login-service"); err != nil {
+		t.Fatal(err)
+	}
+
+	naming.push(t, "login-service", nil, errors.New("nacos unreachable"))
+	if got := cachedIPs(t, c, "login-service"); !reflect.DeepEqual(got, []string{"10.0.0.1"}) {
+		t.Fatalf("hosts after callback error %v", got)
+	}
+	last := (*changes)[len(*changes)-1]
+	if last.err == nil || !reflect.DeepEqual(last.ips, []string{"10.0.0.1"}) {
+		t.Fatalf("error change %+v, want error with kept hosts", last)
+	}
+
+	// 空列表同样视为失败
+	naming.push(t, "login-service", []model.SubscribeService{}, nil)
+	if got := cachedIPs(t, c, "login-service"); !reflect.DeepEqual(got, []string{"10.0.0.1"}) {
+		t.Fatalf("hosts after empty push %v", got)
+	}
+	if (*changes)[len(*changes)-1].err == nil {
+		t.Fatal("empty push not reported as error")
+	}
+}
+
+func TestFailedRefreshKeepsLastHosts(t *testing.T) {
+	naming := newFakeNaming()
+	naming.hosts["login-service"] = []model.Instance{{Ip: "10.0.0.1"}}
+	c, _ := newTestCache(naming)
+	if err := c.Watch("login-service"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nacos 不可用时已有缓存照常返回，不再查询
+	naming.queryErr = errors.New("nacos down")
+	if err := c.Watch("login-service"); err != nil {
+		t.Fatalf("watch with cached hosts: %v", err)
+	}
+	if got := cachedIPs(t, c, "login-service"); !reflect.DeepEqual(got, []string{"10.0.0.1"}) {
+		t.Fatalf("hosts while nacos down %v", got)
+	}
+	if q, s := naming.counts(); q != 1 || s != 1 {
+		t.Fatalf("naming called %d queries / %d subscribes, want 1 / 1", q, s)
+	}
+}
+
+func TestFailedFirstQueryRetries(t *testing.T) {
+	naming := newFakeNaming()
+	naming.queryErr = errors.New("nacos down")
+	c, _ := newTestCache(naming)
+
+	if _, err := c.GetService(vo.GetServiceParam{ServiceName: "login-service"}); err == nil {
+		t.Fatal("GetService succeeded without any hosts")
+	}
+	// 空列表也不缓存
+	naming.queryErr = nil
+	if _, err := c.GetService(vo.GetServiceParam{ServiceName: "login-service"}); !errors.Is(err, errEmpty) {
+		t.Fatalf("empty query: %v, want errEmpty", err)
+	}
+
+	naming.hosts["login-service"] = []model.Instance{{Ip: "10.0.0.1"}}
+	if got := cachedIPs(t, c, "login-service"); !reflect.DeepEqual(got, []string{"10.0.0.1"}) {
+		t.Fatalf("hosts after recovery %v", got)
+	}
+	if q, s := naming.counts(); q != 3 || s != 1 {
+		t.Fatalf("naming called %d queries / %d subscribes, want 3 / 1", q, s)
+	}
+}
+
+func TestSubscribeFailureIsRetried(t *testing.T) {
+	naming := newFakeNaming()
+	naming.hosts["login-service"] = []model.Instance{{Ip: "10.0.0.1"}}
+	naming.subscribeErr = errors.New("subscribe rejected")
+	c, _ := newTestCache(naming)
+
+	if err := c.Watch("login-service"); err == nil {
+		t.Fatal("watch succeeded although subscribe failed")
+	}
+	if v := c.Snapshot()[0]; v.Subscribed || v.LastError == "" {
+		t.Fatalf("view after failed subscribe %+v", v)
+	}
+
+	naming.subscribeErr = nil
+	if err := c.Watch("login-service"); err != nil {
+		t.Fatal(err)
+	}
+	if _, s := naming.counts(); s != 2 {
+		t.Fatalf("%d subscribe calls, want 2", s)
+	}
+	naming.push(t, "login-service", []model.SubscribeService{{Ip: "10.0.0.2"}}, nil)
+	if got := cachedIPs(t, c, "login-service"); !reflect.DeepEqual(got, []string{"10.0.0.2"}) {
+		t.Fatalf("hosts after push %v", got)
+	}
+}
+
+func TestSnapshotReportsCurrentView(t *testing.T) {
+	naming := newFakeNaming()
+	naming.hosts["login-service"] = []model.Instance{{Ip: "10.0.0.1"}}
+	naming.hosts["auth-service"] = []model.Instance{{Ip: "10.0.1.1"}}
+	c, _ := newTestCache(naming)
+	now := c.now()
+
+	if len(c.Snapshot()) != 0 {
+		t.Fatal("snapshot of an empty cache is not empty")
+	}
+	for _, s := range []string{"login-service", "auth-service"} {
+		if err := c.Watch(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	naming.push(t, "login-service", []model.SubscribeService{{Ip: "10.0.0.2"}}, nil)
+	naming.push(t, "auth-service", nil, errors.New("nacos unreachable"))
+
+	views := c.Snapshot()
+	if len(views) != 2 || views[0].Service != "auth-service" || views[1].Service != "login-service" {
+		t.Fatalf("views not sorted by service: %+v", views)
+	}
+	auth, login := views[0], views[1]
+	if auth.Group != "DEFAULT_GROUP" || !auth.Subscribed || auth.Source != SourceQuery ||
+		!reflect.DeepEqual(ips(auth.Instances), []string{"10.0.1.1"}) ||
+		auth.LastError != "nacos unreachable" || auth.LastErrorAt == nil || !auth.LastErrorAt.Equal(now) {
+		t.Fatalf("auth-service view %+v", auth)
+	}
+	if !login.Subscribed || login.Source != SourceSubscribe ||
+		!reflect.DeepEqual(ips(login.Instances), []string{"10.0.0.2"}) ||
+		login.UpdatedAt == nil || !login.UpdatedAt.Equal(now) || login.LastError != "" {
+		t.Fatalf("login-service view %+v", login)
+	}
+
+	// 成功推送清除上一次的错误
+	naming.push(t, "auth-service", []model.SubscribeService{{Ip: "10.0.1.2"}}, nil)
+	if auth = c.Snapshot()[0]; auth.LastError != "" || auth.Source != SourceSubscribe ||
+		!reflect.DeepEqual(ips(auth.Instances), []string{"10.0.1.2"}) {
+		t.Fatalf("auth-service view after recovery %+v", auth)
+	}
+}
+
+func TestUncachedServiceViewHasEmptyInstances(t *testing.T) {
+	naming := newFakeNaming()
+	naming.queryErr = errors.New("nacos down")
+	c, _ := newTestCache(naming)
+	c.Watch("login-service")
+
+	v := c.Snapshot()[0]
+	if v.Instances == nil || len(v.Instances) != 0 || v.UpdatedAt != nil || v.LastError == "" {
+		t.Fatalf("view %+v", v)
+	}
+}
@@ -0,0 +1,77 @@
+// events.go
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// 领域事件类型
+const (
+	EventRoundStarted   = "RoundStarted"
+	EventGuessMade      = "GuessMade"
+	EventRoundWon       = "RoundWon"
+	EventRoundLost      = "RoundLost"
+	EventRoundAbandoned = "RoundAbandoned"
+)
+
+// DomainEvent 游戏领域事件，由 EventPublisher 投递给 scoreboard-service 等下游。
+// 投递语义为至少一次，消费者需按 ID 去重。
+type DomainEvent struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	UserID     string    `json:"user_id"`
+	Username   string    `json:"username"`
+	RoundID    uint      `json:"round_id"`
+	Difficulty string    `json:"difficulty"`
+	Number     int       `json:"number,omitempty"`  // GuessMade：猜测的数字
+	Correct    bool      `json:"correct,omitempty"` // GuessMade：是否猜中
+	Attempts   int       `json:"attempts"`          // 本局已尝试次数
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// eventBatch 收集一次猜测中产生的事件
+type eventBatch struct {
+	user   User
+	events []DomainEvent
+}
+
+func newEventBatch(user User) *eventBatch {
+	return &eventBatch{user: user}
+}
+
+// add 记录一条与对局相关的事件
+func (b *eventBatch) add(eventType string, round *GameRound) *DomainEvent {
+	b.events = append(b.events, DomainEvent{
+		ID:         newEventID(),
+		Type:       eventType,
+		UserID:     b.user.ID,
+		Username:   b.user.Username,
+		RoundID:    round.ID,
+		Difficulty: round.Difficulty,
+		Attempts:   round.Attempts,
+		OccurredAt: time.Now(),
+	})
+	return &b.events[len(b.events)-1]
+}
+
+// addGuess 记录一次猜测及其导致的对局结束事件
+func (b *eventBatch) addGuess(round *GameRound, number int, won bool) {
+	e := b.add(EventGuessMade, round)
+	e.Number = number
+	e.Correct = won
+	switch round.Result {
+	case RoundWon:
+		b.add(EventRoundWon, round)
+	case RoundLost:
+		b.add(EventRoundLost, round)
+	}
+}
+
+// newEventID 生成随机的事件 ID
+func newEventID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,89 @@
+// lb.go
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"game-service/balancer"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 调用 login-service（JWKS）与 scoreboard-service（领域事件）时在服务发现得到的实例间做客户端负载均衡：
+//   - LB_STRATEGY：weighted_round_robin（默认）/ least_outstanding / p2c
+//   - LB_LOGIN_METADATA / LB_SCOREBOARD_METADATA：只选元数据匹配的实例，格式 k1=v1,k2=v2
+
+var (
+	loginBalancer      *balancer.Balancer
+	scoreboardBalancer *balancer.Balancer
+)
+
+// initBalancers 在 initDiscovery 之后调用，实例列表取自服务发现后端；配置无效时直接退出
+func initBalancers() {
+	strategy := os.Getenv("LB_STRATEGY")
+	var err error
+	if loginBalancer, err = newServiceBalancer("login-service", strategy, os.Getenv("LB_LOGIN_METADATA")); err != nil {
+		zapLog.Fatalf("login-service balancer: %v", err)
+	}
+	if scoreboardBalancer, err = newServiceBalancer("scoreboard-service", strategy, os.Getenv("LB_SCOREBOARD_METADATA")); err != nil {
+		zapLog.Fatalf("scoreboard-service balancer: %v", err)
+	}
+	zapLog.Infow("Load balancer initialized", "strategy", loginBalancer.Strategy())
+}
+
+func newServiceBalancer(service, strategy, metadata string) (*balancer.Balancer, error) {
+	meta, err := balancer.ParseMetadata(metadata)
+	if err != nil {
+		return nil, err
+	}
+	return balancer.New(serviceNaming, balancer.Config{
+		ServiceName: service,
+		GroupName:   nacosGroup(),
+		Metadata:    meta,
+		Strategy:    strategy,
+	})
+}
+
+// pickInstance 选择实例并返回其 http 基础地址；请求结束后须调用 done
+func pickInstance(b *balancer.Balancer, service string) (string, func(), error) {
+	if b == nil {
+		return "", nil, fmt.Errorf("%s balancer not initialized", service)
+	}
+	instance, done, err := b.Pick()
+	if err != nil {
+		return "", nil, err
+	}
+	return fmt.Sprintf("http://%s:%d", instance.Ip, instance.Port), done, nil
+}
+
+// discoveryDebugHandler 查看服务发现后端、实例列表与负载均衡策略
+func discoveryDebugHandler(c *gin.Context) {
+	if serviceBackend == nil {
+		respondWithError(c, http.StatusServiceUnavailable, "Discovery not initialized")
+		return
+	}
+	strategy := ""
+	if loginBalancer != nil {
+		strategy = loginBalancer.Strategy()
+	}
+	body := gin.H{"backend": serviceBackend.Name(), "strategy": strategy}
+	if discoveryCache != nil {
+		body["services"] = discoveryCache.Snapshot()
+	} else {
+		// dns / static 后端没有订阅缓存，直接解析一次
+		views := make([]gin.H, 0, 2)
+		for _, service := range []string{"login-service", "scoreboard-service"} {
+			view := gin.H{"service": service}
+			if instances, err := serviceBackend.Resolve(service); err != nil {
+				view["lastError"] = err.Error()
+			} else {
+				view["instances"] = instances
+			}
+			views = append(views, view)
+		}
+		body["services"] = views
+	}
+	c.JSON(http.StatusOK, body)
+}
@@ -2,19 +2,24 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"microservice/pkg/auth"
 	"net/http"
 	"os"
 	"os/signal"
-	"strings"
 	"syscall"
 	"time"
 )
 
 // 全局 logger
-var zapLog *zap.SugaredLogger
+var (
+	zapLog   *zap.SugaredLogger
+	logLevel = zap.NewAtomicLevel()
+)
 
 func initLogger() {
 	cfg := zap.NewProductionConfig()
@@ -23,18 +28,10 @@ func initLogger() {
 	cfg.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
 	// 2) 不要 caller 全路径，只保留文件名:行号
 	cfg.EncoderConfig.EncodeCaller = zapcore.ShortCallerEncoder
-	// 3) 用环境变量控制最低级别：INFO | WARN | ERROR | DEBUG
-	level := os.Getenv("LOG_LEVEL")
-	switch strings.ToLower(level) {
-	case "debug":
-		cfg.Level = zap.NewAtomicLevelAt(zap.DebugLevel)
-	case "warn":
-		cfg.Level = zap.NewAtomicLevelAt(zap.WarnLevel)
-	case "error":
-		cfg.Level = zap.NewAtomicLevelAt(zap.ErrorLevel)
-	default:
-		cfg.Level = zap.NewAtomicLevelAt(zap.InfoLevel)
-	}
+	// 3) 用环境变量控制最低级别：INFO | WARN | ERROR | DEBUG，运行中可由 Game_RUNTIME 的 logLevel 调整
+	level, _ := parseLogLevel(os.Getenv("LOG_LEVEL"))
+	logLevel = zap.NewAtomicLevelAt(level)
+	cfg.Level = logLevel
 	// 4) 打开采样，压缩重复日志
 	cfg.Sampling = &zap.SamplingConfig{
 		Initial:    100,
@@ -46,13 +43,37 @@ func initLogger() {
 
 // 定义请求和响应结构体
 type guessRequest struct {
-	Number int `json:"number"`
+	Number     int    `json:"number"`
+	Difficulty string `json:"difficulty"` // 可选，为空时沿用当前对局的难度
 }
 
 type guessResponse struct {
-	Success  bool   `json:"success"`
-	Message  string `json:"message"`
-	Attempts int    `json:"attempts"`
+	Success       bool   `json:"success"`
+	Message       string `json:"message"`
+	Attempts      int    `json:"attempts"`
+	RoundID       uint   `json:"roundId"`
+	RoundAttempts int    `json:"roundAttempts"`
+	NextRoundID   uint   `json:"nextRoundId,omitempty"`
+
+	Difficulty        string `json:"difficulty"`
+	RangeMin          int    `json:"rangeMin"`
+	RangeMax          int    `json:"rangeMax"`
+	RemainingAttempts *int   `json:"remainingAttempts"` // null 表示不限次数
+	RoundResult       string `json:"roundResult"`
+}
+
+// 历史对局分页参数
+const (
+	defaultHistoryPageSize = 20
+	maxHistoryPageSize     = 100
+)
+
+type historyResponse struct {
+	Success  bool        `json:"success"`
+	Page     int         `json:"page"`
+	PageSize int         `json:"pageSize"`
+	Total    int         `json:"total"`
+	Rounds   []roundView `json:"rounds"`
 }
 
 type registerRequest struct {
@@ -99,18 +120,22 @@ func main() {
 	initLogger()
 	defer zapLog.Sync()
 
+	// migrate 子命令：执行数据库迁移后退出
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if storeDriver(nil) == driverMySQL {
+			initNacos()
+		}
+		migrateMain(os.Args[2:])
+		return
+	}
+
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
 	r.Use(ZapRequestLogger(), gin.Recovery())
 
-	// CORS
-	r.Use(func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "http://micro.roliyal.com")
-		c.Header("Access-Control-Allow-Credentials", "true")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization, X-User-ID")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		c.Next()
-	})
+	// CORS，允许的来源由 Game_RUNTIME 配置
+	r.Use(corsMiddleware)
+	r.Use(auth.CSRF(zapLog))
 
 	// 初始化日志目录
 	logDir := "/app/log"
@@ -121,25 +146,43 @@ func main() {
 	// 初始化 Nacos
 	initNacos()
 
-	// 注册 game-service 到 Nacos
-	err := registerService(NamingClient, "game-service", "127.0.0.1", 8084)
+	// 日志级别、CORS 来源与功能开关，随 Nacos 配置热更新
+	loadRuntimeConfig()
+
+	// 服务发现后端（nacos / dns / static）
+	initDiscovery()
+
+	// 注册 game-service
+	err := registerService("game-service", 8084)
 	if err != nil {
 		zapLog.Fatalf("Error registering game service instance: %v", err)
 	}
 
-	// 订阅 login-service 的变化
-	subscribeLoginService()
+	// 下游服务的客户端负载均衡
+	initBalancers()
 
-	// 获取并初始化数据库配置
-	dbConfig, err := getDatabaseConfigFromNacos()
+	// 加载访问令牌校验密钥（共享密钥 / login-service JWKS）
+	initVerifier()
+
+	// 加载难度配置
+	loadDifficultiesFromNacos()
+
+	// 获取存储配置并初始化存储（mysql / sqlite / memory）
+	dbConfig, err := loadStoreConfig()
 	if err != nil {
-		panic("failed to get database configuration from Nacos")
+		zapLog.Fatalf("Failed to get database configuration: %v", err)
 	}
-	initDatabase(dbConfig) // Initialize the database with the configuration from Nacos
-	defer closeDatabase()
+	initStore(dbConfig)
+	defer closeStore()
+	watchDatabaseConfig()
 
 	// 设置路由
-	r.POST("/game", guessHandler)
+	r.POST("/game", verifier.Middleware(true), guessHandler)
+	r.GET("/game/history", verifier.Middleware(true), historyHandler)
+	r.GET("/game/difficulties", difficultiesHandler)
+	r.POST("/admin/users/:id/game/reset", verifier.Middleware(true), auth.RequireRole(roleAdmin, zapLog), adminResetGameHandler)
+	r.GET("/debug/discovery", verifier.Middleware(true), auth.RequireRole(roleAdmin, zapLog), discoveryDebugHandler)
+	r.GET("/debug/config", verifier.Middleware(true), auth.RequireRole(roleAdmin, zapLog), configDebugHandler)
 	r.GET("/health", healthCheckHandler)
 
 	// 启动 Gin HTTP 服务器
@@ -150,7 +193,7 @@ func main() {
 	}()
 
 	// 处理优雅关闭
-	c := make(chan os.Signal)
+	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	<-c
 
@@ -165,78 +208,127 @@ func healthCheckHandler(c *gin.Context) {
 	})
 }
 
+// authenticateRequest 读取 verifier.Middleware 校验通过的用户身份，无需再请求 login-service
+func authenticateRequest(c *gin.Context) (User, bool) {
+	claims, ok := auth.ClaimsFrom(c)
+	if !ok {
+		respondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return User{}, false
+	}
+	return User{ID: claims.Subject, Username: claims.Name}, true
+}
+
 // guessHandler 处理猜数字请求
 func guessHandler(c *gin.Context) {
-	zapLog.Infof("Received headers: %v", c.Request.Header)
-
-	// 打印所有 cookies
-	cookies := c.Request.Cookies()
-	zapLog.Infof("Received cookies: %v", cookies)
-
-	userIdStr, err := c.Cookie("X-User-ID")
-	if err != nil || userIdStr == "" {
-		userIdStr = c.GetHeader("X-User-ID")
-	}
-	if userIdStr == "" {
-		zapLog.Error("Missing X-User-ID from Cookie or Header")
-		respondWithError(c, http.StatusBadRequest, "Missing X-User-ID")
+	user, ok := authenticateRequest(c)
+	if !ok {
 		return
 	}
-	zapLog.Infof("Got X-User-ID: %s", userIdStr)
-
-	authToken := c.GetHeader("Authorization")
-	if authToken == "" {
-		zapLog.Warn("Missing Authorization header")
-		respondWithError(c, http.StatusUnauthorized, "Missing Authorization token")
-		return
-	}
-	zapLog.Infof("Got Authorization: %s", authToken)
-
-	user, err := getUserFromUserID(userIdStr, authToken)
-	if err != nil {
-		zapLog.Errorf("Error getting user from login-service: %v", err)
-		respondWithError(c, http.StatusUnauthorized, "Unauthorized")
+	if featureEnabled(featureMaintenance) {
+		respondWithError(c, http.StatusServiceUnavailable, "Game is under maintenance")
 		return
 	}
 
 	//  读取 JSON 请求体
 	var req guessRequest
 	if err := c.BindJSON(&req); err != nil {
-		zapLog.Errorf("Error decoding request body:", err)
+		zapLog.Errorf("Error decoding request body: %v", err)
 		respondWithError(c, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 	zapLog.Infof("User guessed number: %d", req.Number)
 
-	//  获取或创建游戏记录
-	game, err := getOrCreateGame(&user)
+	//  在事务中判定并记录本次猜测，同时发布领域事件
+	ctx, cancel := context.WithTimeout(c.Request.Context(), guessTimeout)
+	defer cancel()
+	out, err := store.SubmitGuess(ctx, user, req.Difficulty, req.Number)
+	if err == errUnknownDifficulty {
+		respondWithError(c, http.StatusBadRequest, "Unknown difficulty: "+req.Difficulty)
+		return
+	}
+	if err == errGuessConflict {
+		respondWithError(c, http.StatusConflict, "Too many concurrent guesses, please retry")
+		return
+	}
 	if err != nil {
-		zapLog.Errorf("Error getting or creating game:", err)
+		zapLog.Errorf("Error recording guess: %v", err)
 		respondWithError(c, http.StatusInternalServerError, "Internal Server Error")
 		return
 	}
 
 	//  猜数字逻辑
-	var res guessResponse
-	if req.Number == game.TargetNumber {
-		res.Success = true
+	round := out.Round
+	res := guessResponse{
+		Success:           out.Won,
+		Attempts:          out.Game.Attempts,
+		RoundID:           round.ID,
+		RoundAttempts:     round.Attempts,
+		Difficulty:        round.Difficulty,
+		RangeMin:          round.RangeMin,
+		RangeMax:          round.RangeMax,
+		RemainingAttempts: round.RemainingAttempts(),
+		RoundResult:       round.Result,
+	}
+	if out.Next != nil {
+		res.NextRoundID = out.Next.ID
+	}
+	target := round.TargetNumber
+	switch {
+	case out.Won:
 		res.Message = " Congratulations! You guessed the correct number."
-		res.Attempts = game.Attempts
-		game.CorrectGuesses++
-		if err := db.Save(game).Error; err != nil {
-			zapLog.Errorf("Error updating game: %v", err)
-		}
-	} else {
-		res.Success = false
-		if req.Number < game.TargetNumber {
-			res.Message = " Too low. Try again!"
-		} else {
-			res.Message = " Too high. Try again!"
-		}
-		incrementAttempts(game)
-		res.Attempts = game.Attempts
+	case round.Result == RoundLost:
+		res.Message = fmt.Sprintf(" Out of attempts! The number was %d. A new round has started.", target)
+	case req.Number < target:
+		res.Message = " Too low. Try again!"
+	default:
+		res.Message = " Too high. Try again!"
 	}
 
 	//  返回 JSON 响应
 	c.JSON(http.StatusOK, res)
 }
+
+// difficultiesHandler 返回可选的难度列表
+func difficultiesHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success":      true,
+		"default":      defaultDifficulty,
+		"difficulties": listDifficulties(),
+	})
+}
+
+// historyHandler 分页返回用户的历史对局
+func historyHandler(c *gin.Context) {
+	user, ok := authenticateRequest(c)
+	if !ok {
+		return
+	}
+
+	page := parseInt(c.Query("page"), 1)
+	if page < 1 {
+		page = 1
+	}
+	pageSize := parseInt(c.Query("page_size"), defaultHistoryPageSize)
+	if pageSize < 1 || pageSize > maxHistoryPageSize {
+		pageSize = defaultHistoryPageSize
+	}
+
+	rounds, total, err := store.ListRounds(user.ID, page, pageSize)
+	if err != nil {
+		zapLog.Errorf("Error listing game rounds: %v", err)
+		respondWithError(c, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	views := make([]roundView, 0, len(rounds))
+	for _, r := range rounds {
+		views = append(views, newRoundView(r))
+	}
+	c.JSON(http.StatusOK, historyResponse{
+		Success:  true,
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+		Rounds:   views,
+	})
+}
@@ -0,0 +1,151 @@
+// migrations.go
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"microservice/pkg/migrate"
+)
+
+// game-service 负责 game、game_round 与 outbox_events 表；users 表由 login-service 的迁移维护
+var gameMigrations = []migrate.Migration{
+	{
+		Version: 1,
+		Name:    "create_game",
+		Up: migrate.SameSQL(`CREATE TABLE IF NOT EXISTS game (
+    ID             VARCHAR(255) NOT NULL,
+    TargetNumber   INT          NOT NULL,
+    Attempts       INT          DEFAULT 0,
+    CorrectGuesses INT          DEFAULT 0,
+    PRIMARY KEY (ID)
+)`),
+		Down: migrate.SameSQL(`DROP TABLE IF EXISTS game`),
+	},
+	{
+		Version: 2,
+		Name:    "create_game_round",
+		Up: map[string][]string{
+			"mysql": {`CREATE TABLE IF NOT EXISTS game_round (
+    ID           INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    UserID       VARCHAR(255) NOT NULL,
+    Difficulty   VARCHAR(255) NOT NULL DEFAULT 'normal',
+    RangeMin     INT          NOT NULL DEFAULT 1,
+    RangeMax     INT          NOT NULL DEFAULT 100,
+    MaxAttempts  INT          DEFAULT 0,
+    TargetNumber INT          NOT NULL,
+    Attempts     INT          DEFAULT 0,
+    Guesses      TEXT,
+    Result       VARCHAR(255) NOT NULL DEFAULT 'in_progress',
+    StartedAt    DATETIME     NULL,
+    FinishedAt   DATETIME     NULL,
+    PRIMARY KEY (ID),
+    INDEX idx_round_user (UserID)
+)`},
+			"sqlite": {`CREATE TABLE IF NOT EXISTS game_round (
+    ID           INTEGER PRIMARY KEY AUTOINCREMENT,
+    UserID       VARCHAR(255) NOT NULL,
+    Difficulty   VARCHAR(255) NOT NULL DEFAULT 'normal',
+    RangeMin     INT          NOT NULL DEFAULT 1,
+    RangeMax     INT          NOT NULL DEFAULT 100,
+    MaxAttempts  INT          DEFAULT 0,
+    TargetNumber INT          NOT NULL,
+    Attempts     INT          DEFAULT 0,
+    Guesses      TEXT,
+    Result       VARCHAR(255) NOT NULL DEFAULT 'in_progress',
+    StartedAt    DATETIME     NULL,
+    FinishedAt   DATETIME     NULL
+)`, `CREATE INDEX IF NOT EXISTS idx_round_user ON game_round (UserID)`},
+		},
+		Down: migrate.SameSQL(`DROP TABLE IF EXISTS game_round`),
+	},
+	{
+		Version: 3,
+		Name:    "add_game_version",
+		// 早期由 AutoMigrate 建出的表可能已有该列
+		UpFunc: func(tx *sql.Tx, dialect string) error {
+			exists, err := migrate.ColumnExists(tx, dialect, "game", "Version")
+			if err != nil || exists {
+				return err
+			}
+			_, err = tx.Exec(`ALTER TABLE game ADD COLUMN Version INT NOT NULL DEFAULT 0`)
+			return err
+		},
+		Down: migrate.SameSQL(`ALTER TABLE game DROP COLUMN Version`),
+	},
+	{
+		Version: 4,
+		Name:    "create_outbox_events",
+		Up: map[string][]string{
+			"mysql": {`CREATE TABLE IF NOT EXISTS outbox_events (
+    ID          BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    EventID     VARCHAR(64)     NOT NULL,
+    Type        VARCHAR(64)     NOT NULL,
+    UserID      VARCHAR(255)    NOT NULL,
+    Payload     TEXT            NOT NULL,
+    CreatedAt   DATETIME        NOT NULL,
+    PublishedAt DATETIME        NULL,
+    Attempts    INT             NOT NULL DEFAULT 0,
+    LastError   TEXT,
+    PRIMARY KEY (ID),
+    UNIQUE KEY uix_outbox_event (EventID),
+    INDEX idx_outbox_unpublished (PublishedAt, ID)
+)`},
+			"sqlite": {`CREATE TABLE IF NOT EXISTS outbox_events (
+    ID          INTEGER PRIMARY KEY AUTOINCREMENT,
+    EventID     VARCHAR(64)  NOT NULL,
+    Type        VARCHAR(64)  NOT NULL,
+    UserID      VARCHAR(255) NOT NULL,
+    Payload     TEXT         NOT NULL,
+    CreatedAt   DATETIME     NOT NULL,
+    PublishedAt DATETIME     NULL,
+    Attempts    INT          NOT NULL DEFAULT 0,
+    LastError   TEXT
+)`,
+				`CREATE UNIQUE INDEX IF NOT EXISTS uix_outbox_event ON outbox_events (EventID)`,
+				`CREATE INDEX IF NOT EXISTS idx_outbox_unpublished ON outbox_events (PublishedAt, ID)`},
+		},
+		Down: migrate.SameSQL(`DROP TABLE IF EXISTS outbox_events`),
+	},
+}
+
+// dialectOf 返回迁移使用的方言名称
+func dialectOf(db *gorm.DB) string {
+	if strings.HasPrefix(db.Dialect().GetName(), "sqlite") {
+		return "sqlite"
+	}
+	return "mysql"
+}
+
+func newGameMigrator(db *gorm.DB) *migrate.Migrator {
+	return migrate.New(sqlDBOf(db), dialectOf(db), "game-service", gameMigrations)
+}
+
+// autoMigrateEnabled 启动时是否自动执行迁移，AUTO_MIGRATE=false 时关闭
+func autoMigrateEnabled() bool {
+	return !strings.EqualFold(os.Getenv("AUTO_MIGRATE"), "false")
+}
+
+// migrateMain 处理 `game-service migrate ...` 子命令
+func migrateMain(args []string) {
+	dbConfig, err := loadStoreConfig()
+	if err != nil {
+		zapLog.Fatalf("Error loading database configuration: %v", err)
+	}
+	if storeDriver(dbConfig) == driverMemory {
+		fmt.Println("memory store has no schema to migrate")
+		return
+	}
+	gdb, err := openDatabase(dbConfig)
+	if err != nil {
+		zapLog.Fatalf("Error opening database: %v", err)
+	}
+	defer gdb.Close()
+
+	if err := migrate.RunCommand(newGameMigrator(gdb), args); err != nil {
+		zapLog.Fatalf("Migration failed: %v", err)
+	}
+}
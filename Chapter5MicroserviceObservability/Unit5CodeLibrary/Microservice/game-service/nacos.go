@@ -3,14 +3,13 @@ package main
 
 import (
 	"fmt"
+	"game-service/discovery"
 	"github.com/joho/godotenv"
 	"github.com/nacos-group/nacos-sdk-go/clients"
 	"github.com/nacos-group/nacos-sdk-go/clients/config_client"
 	"github.com/nacos-group/nacos-sdk-go/clients/naming_client"
 	"github.com/nacos-group/nacos-sdk-go/common/constant"
 	"github.com/nacos-group/nacos-sdk-go/model"
-	"github.com/nacos-group/nacos-sdk-go/vo"
-	"net"
 	"os"
 	"strconv"
 )
@@ -19,12 +18,16 @@ import (
 var NamingClient naming_client.INamingClient
 var ConfigClient config_client.IConfigClient
 
-// 初始化 Nacos 客户端
+// 初始化 Nacos 客户端；未配置 NACOS_SERVER_IP 时不连接 Nacos，
+// NamingClient / ConfigClient 保持为 nil，服务发现与配置改用其他来源
 func initNacos() {
-	// 读取.env文件
-	err := godotenv.Load(".env")
-	if err != nil {
-		panic("Error loading .env file")
+	// 读取.env文件，不存在时直接使用环境变量
+	if err := godotenv.Load(".env"); err != nil {
+		zapLog.Infof("No .env file loaded, using environment variables: %v", err)
+	}
+	if !nacosConfigured() {
+		zapLog.Info("NACOS_SERVER_IP not set, running without Nacos")
+		return
 	}
 
 	clientConfig := constant.ClientConfig{
@@ -64,105 +67,47 @@ func initNacos() {
 	ConfigClient = cc
 }
 
-// 订阅 login-service 的实例变化
-func subscribeLoginService() {
-	err := NamingClient.Subscribe(&vo.SubscribeParam{
-		ServiceName: "login-service",
-		GroupName:   "DEFAULT_GROUP",
-		Clusters:    []string{"DEFAULT"},
-		SubscribeCallback: func(services []model.SubscribeService, err error) {
-			if err != nil {
-				zapLog.Errorf("Error in SubscribeCallback: %v\n", err)
-				return
-			}
-
-			zapLog.Info("Login service instances update:")
-			for _, service := range services {
-				zapLog.Infof("Instance: IP=%s, Port=%d\n", service.Ip, service.Port)
-			}
-		},
-	})
-	if err != nil {
-		panic("failed to subscribe to login-service")
-	} else {
-		zapLog.Info("Successfully subscribed to login-service") // 输出订阅成功信息
-	}
+// nacosConfigured 是否配置了 Nacos 服务器
+func nacosConfigured() bool {
+	return os.Getenv("NACOS_SERVER_IP") != ""
 }
 
-// 解析字符串为整数，失败则返回默认值
-func parseInt(value string, defaultValue int) int {
-	result, err := strconv.Atoi(value)
-	if err != nil {
-		return defaultValue
-	}
-	return result
-}
+// 下游服务的本地实例缓存，由订阅回调更新
+var discoveryCache *discovery.Cache
 
-// 获取主机的非回环 IP 地址
-func getHostIP() (string, error) {
-	addrs, err := net.InterfaceAddrs()
-	if err != nil {
-		return "", err
+// 订阅 login-service 与 scoreboard-service 的实例变化
+func subscribeServices() {
+	discoveryCache = discovery.New(NamingClient, nacosGroup(), logInstanceChange)
+	if err := discoveryCache.Watch("login-service"); err != nil {
+		panic("failed to subscribe to login-service")
 	}
+	zapLog.Info("Successfully subscribed to login-service") // 输出订阅成功信息
 
-	for _, addr := range addrs {
-		ip, _, err := net.ParseCIDR(addr.String())
-		if err != nil {
-			continue
-		}
-		if !ip.IsLoopback() && ip.To4() != nil {
-			return ip.String(), nil
-		}
+	// scoreboard-service 可能晚于 game-service 启动，首次投递事件时会再次订阅
+	if err := discoveryCache.Watch("scoreboard-service"); err != nil {
+		zapLog.Warnw("Subscribe to scoreboard-service failed, will retry on first use", "error", err)
 	}
-
-	return "", fmt.Errorf("No valid IP address found")
 }
 
-// 注册服务到 Nacos
-func registerService(client naming_client.INamingClient, serviceName, ip string, port uint64) error {
-	hostIP, err := getHostIP()
-	if err != nil {
-		return fmt.Errorf("Failed to get host IP address: %w", err)
-	}
-
-	success, err := client.RegisterInstance(vo.RegisterInstanceParam{
-		Ip:          hostIP, // 使用动态获取的宿主机 IP 地址
-		Port:        port,
-		ServiceName: serviceName,
-		Weight:      10,
-		Enable:      true,
-		Healthy:     true,
-		Ephemeral:   true,
-	})
-
+// logInstanceChange 输出实例变化；订阅回调出错时继续使用上一次的列表
+func logInstanceChange(service string, instances []model.Instance, err error) {
 	if err != nil {
-		return fmt.Errorf("registerService error: %w", err)
+		zapLog.Warnw("Instance update failed, keeping last known instances",
+			"service", service, "instances", len(instances), "error", err)
+		return
 	}
-
-	if !success {
-		return fmt.Errorf("Failed to register service")
+	addrs := make([]string, 0, len(instances))
+	for _, in := range instances {
+		addrs = append(addrs, fmt.Sprintf("%s:%d", in.Ip, in.Port))
 	}
-
-	return nil
+	zapLog.Infow("Service instances update", "service", service, "instances", addrs)
 }
 
-// 注销 game-service
-func deregisterGameService() {
-	hostIP, err := getHostIP()
-	if err != nil {
-		zapLog.Errorf("Failed to get host IP for deregistration: %v\n", err)
-		return
-	}
-
-	_, err = NamingClient.DeregisterInstance(vo.DeregisterInstanceParam{
-		Ip:          hostIP,
-		Port:        8084,
-		ServiceName: "game-service",
-		GroupName:   "DEFAULT_GROUP",
-	})
+// 解析字符串为整数，失败则返回默认值
+func parseInt(value string, defaultValue int) int {
+	result, err := strconv.Atoi(value)
 	if err != nil {
-		zapLog.Errorf("Error deregistering game service instance: %v\n", err)
-	} else {
-		zapLog.Info("Game service deregistered successfully")
+		return defaultValue
 	}
+	return result
 }
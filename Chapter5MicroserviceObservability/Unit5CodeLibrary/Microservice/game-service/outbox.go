@@ -0,0 +1,192 @@
+// outbox.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// outbox 转发参数，轮询间隔可通过 OUTBOX_POLL_INTERVAL 修改
+const (
+	defaultOutboxPollInterval = time.Second
+	outboxBatchSize           = 100
+	outboxRetention           = 24 * time.Hour // 已投递事件的保留时间
+	outboxCleanupInterval     = time.Hour
+)
+
+// OutboxEvent outbox_events 表中的一条待投递事件
+type OutboxEvent struct {
+	ID          uint64     `gorm:"column:ID;primary_key;AUTO_INCREMENT"`
+	EventID     string     `gorm:"column:EventID;not null"`
+	Type        string     `gorm:"column:Type;not null"`
+	UserID      string     `gorm:"column:UserID;not null"`
+	Payload     string     `gorm:"column:Payload;type:text;not null"`
+	CreatedAt   time.Time  `gorm:"column:CreatedAt"`
+	PublishedAt *time.Time `gorm:"column:PublishedAt"`
+	Attempts    int        `gorm:"column:Attempts;default:0"`
+	LastError   string     `gorm:"column:LastError;type:text"`
+}
+
+// 自定义表名
+func (OutboxEvent) TableName() string {
+	return "outbox_events"
+}
+
+// outboxPublisher 事务性 outbox：事件与游戏数据在同一事务中写入 outbox_events，
+// 由后台转发器按写入顺序投递，投递成功后标记 PublishedAt。
+// 多个实例同时转发时同一事件可能被投递多次，由消费者按事件 ID 去重。
+type outboxPublisher struct {
+	db       *gorm.DB
+	sinks    []EventSink
+	interval time.Duration
+	wake     chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func newOutboxPublisher(db *gorm.DB, sinks []EventSink) *outboxPublisher {
+	p := &outboxPublisher{
+		db:       db,
+		sinks:    sinks,
+		interval: outboxPollInterval(),
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// outboxPollInterval 读取轮询间隔配置
+func outboxPollInterval() time.Duration {
+	if v := os.Getenv("OUTBOX_POLL_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+		zapLog.Warnf("Invalid OUTBOX_POLL_INTERVAL %q, using default", v)
+	}
+	return defaultOutboxPollInterval
+}
+
+func (p *outboxPublisher) Stage(tx *gorm.DB, events []DomainEvent) error {
+	if tx == nil {
+		return fmt.Errorf("outbox publisher requires a transaction")
+	}
+	for _, e := range events {
+		payload, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		row := OutboxEvent{
+			EventID:   e.ID,
+			Type:      e.Type,
+			UserID:    e.UserID,
+			Payload:   string(payload),
+			CreatedAt: e.OccurredAt,
+		}
+		if err := tx.Create(&row).Error; err != nil {
+			return fmt.Errorf("failed to write outbox event: %w", err)
+		}
+	}
+	return nil
+}
+
+// Publish 事务提交后唤醒转发器，不必等到下一次轮询
+func (p *outboxPublisher) Publish(events []DomainEvent) {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (p *outboxPublisher) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	lastCleanup := time.Now()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		case <-p.wake:
+		}
+		// 持续转发直到积压清空
+		for {
+			n, err := p.relay()
+			if err != nil {
+				zapLog.Warnf("Outbox relay failed: %v", err)
+				break
+			}
+			if n < outboxBatchSize {
+				break
+			}
+		}
+		if time.Since(lastCleanup) >= outboxCleanupInterval {
+			p.cleanup()
+			lastCleanup = time.Now()
+		}
+	}
+}
+
+// relay 投递一批未发布的事件，返回成功投递的数量
+func (p *outboxPublisher) relay() (int, error) {
+	var rows []OutboxEvent
+	if err := p.db.Where("PublishedAt IS NULL").Order("ID ASC").
+		Limit(outboxBatchSize).Find(&rows).Error; err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+
+	events := make([]DomainEvent, 0, len(rows))
+	ids := make([]uint64, 0, len(rows))
+	for _, row := range rows {
+		var e DomainEvent
+		if err := json.Unmarshal([]byte(row.Payload), &e); err != nil {
+			// 无法解析的事件不会自行恢复，记录错误后跳过
+			zapLog.Errorf("Skipping malformed outbox event %d: %v", row.ID, err)
+		} else {
+			events = append(events, e)
+		}
+		ids = append(ids, row.ID)
+	}
+
+	if err := deliver(p.sinks, events); err != nil {
+		p.db.Model(&OutboxEvent{}).Where("ID IN (?)", ids).Updates(map[string]interface{}{
+			"Attempts":  gorm.Expr("Attempts + 1"),
+			"LastError": err.Error(),
+		})
+		return 0, err
+	}
+	now := time.Now()
+	if err := p.db.Model(&OutboxEvent{}).Where("ID IN (?)", ids).
+		Update("PublishedAt", &now).Error; err != nil {
+		return 0, err
+	}
+	return len(rows), nil
+}
+
+// cleanup 删除超过保留时间的已投递事件
+func (p *outboxPublisher) cleanup() {
+	res := p.db.Where("PublishedAt IS NOT NULL AND PublishedAt < ?", time.Now().Add(-outboxRetention)).
+		Delete(&OutboxEvent{})
+	if res.Error != nil {
+		zapLog.Warnf("Outbox cleanup failed: %v", res.Error)
+	} else if res.RowsAffected > 0 {
+		zapLog.Infof("Removed %d published outbox events", res.RowsAffected)
+	}
+}
+
+// Close 停止转发器，未投递的事件保留在表中，下次启动后继续投递
+func (p *outboxPublisher) Close() error {
+	close(p.stop)
+	<-p.done
+	return nil
+}
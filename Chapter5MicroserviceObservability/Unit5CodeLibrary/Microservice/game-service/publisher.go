@@ -0,0 +1,138 @@
+// publisher.go
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// EventPublisher 领域事件发布器
+type EventPublisher interface {
+	// Stage 在写入游戏数据的事务内调用：outbox 实现把事件写入同一事务，内存实现不做处理
+	Stage(tx *gorm.DB, events []DomainEvent) error
+	// Publish 在事务提交后调用：内存实现在此异步投递，outbox 实现唤醒后台转发
+	Publish(events []DomainEvent)
+	Close() error
+}
+
+// 发布器类型
+const (
+	publisherMemory = "memory"
+	publisherOutbox = "outbox"
+)
+
+var publisher EventPublisher = newMemoryPublisher(nil)
+
+// publisherKind 读取 EVENT_PUBLISHER；SQL 存储默认 outbox，内存存储只能使用 memory
+func publisherKind(driver string) (string, error) {
+	kind := strings.ToLower(os.Getenv("EVENT_PUBLISHER"))
+	if driver == driverMemory {
+		if kind == publisherOutbox {
+			return "", fmt.Errorf("outbox publisher requires a SQL store")
+		}
+		return publisherMemory, nil
+	}
+	switch kind {
+	case "":
+		return publisherOutbox, nil
+	case publisherMemory, publisherOutbox:
+		return kind, nil
+	default:
+		return "", fmt.Errorf("unknown event publisher %q", kind)
+	}
+}
+
+// openPublisher 按配置创建发布器，db 为 SQL 存储的连接（内存存储时为空）
+func openPublisher(driver string, db *gorm.DB) (EventPublisher, error) {
+	kind, err := publisherKind(driver)
+	if err != nil {
+		return nil, err
+	}
+	sinks, err := eventSinks()
+	if err != nil {
+		return nil, err
+	}
+	zapLog.Infof("Using %s event publisher with sinks %v", kind, sinkNames(sinks))
+	if kind == publisherOutbox {
+		return newOutboxPublisher(db, sinks), nil
+	}
+	return newMemoryPublisher(sinks), nil
+}
+
+// deliver 把一批事件投递给全部下游，任一下游失败即返回错误；
+// 重试时已成功的下游会再次收到同一批事件
+func deliver(sinks []EventSink, events []DomainEvent) error {
+	for _, sink := range sinks {
+		if err := sink.Deliver(events); err != nil {
+			return fmt.Errorf("%s: %w", sink.Name(), err)
+		}
+	}
+	return nil
+}
+
+/* ---------- 内存发布器 ---------- */
+
+// 内存发布器参数
+const (
+	memoryPublisherQueue   = 1024
+	memoryPublisherRetries = 3
+)
+
+// memoryPublisher 在进程内排队并异步投递，进程退出时未投递的事件会丢失
+type memoryPublisher struct {
+	sinks []EventSink
+	queue chan []DomainEvent
+	done  chan struct{}
+}
+
+func newMemoryPublisher(sinks []EventSink) *memoryPublisher {
+	p := &memoryPublisher{
+		sinks: sinks,
+		queue: make(chan []DomainEvent, memoryPublisherQueue),
+		done:  make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+func (p *memoryPublisher) Stage(tx *gorm.DB, events []DomainEvent) error {
+	return nil
+}
+
+func (p *memoryPublisher) Publish(events []DomainEvent) {
+	if len(events) == 0 || len(p.sinks) == 0 {
+		return
+	}
+	select {
+	case p.queue <- events:
+	default:
+		zapLog.Warnf("Event queue is full, dropping %d events", len(events))
+	}
+}
+
+func (p *memoryPublisher) run() {
+	defer close(p.done)
+	for events := range p.queue {
+		var err error
+		for i := 0; i < memoryPublisherRetries; i++ {
+			if err = deliver(p.sinks, events); err == nil {
+				break
+			}
+			time.Sleep(time.Duration(i+1) * 500 * time.Millisecond)
+		}
+		if err != nil {
+			zapLog.Errorf("Dropping %d events after %d attempts: %v", len(events), memoryPublisherRetries, err)
+		}
+	}
+}
+
+// Close 停止接收事件并等待队列中的事件投递完成
+func (p *memoryPublisher) Close() error {
+	close(p.queue)
+	<-p.done
+	return nil
+}
@@ -0,0 +1,211 @@
+// registry.go
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"game-service/balancer"
+	"game-service/registry"
+)
+
+// 服务注册与发现的后端，由 DISCOVERY_BACKEND 选择：
+//   - nacos（默认）：注册到 Nacos，订阅下游服务的实例变化并缓存在本地
+//   - dns：Kubernetes headless Service，见 DISCOVERY_DNS_TARGETS / DISCOVERY_DNS_DOMAIN / DISCOVERY_DNS_PORT_NAME
+//   - static：静态 YAML 文件 DISCOVERY_STATIC_FILE（默认 discovery.yml），本地开发与测试无需 Nacos
+
+var (
+	serviceBackend registry.Backend
+	serviceNaming  balancer.Naming // 负载均衡器读取实例列表的来源
+)
+
+// initDiscovery 在 initNacos 之后、注册与创建负载均衡器之前调用；配置无效时直接退出
+func initDiscovery() {
+	switch backend := discoveryBackend(); backend {
+	case registry.BackendNacos:
+		if NamingClient == nil {
+			zapLog.Fatalf("DISCOVERY_BACKEND=nacos requires NACOS_SERVER_IP")
+		}
+		// 订阅下游服务的实例变化，本地缓存实例列表
+		subscribeServices()
+		serviceBackend = registry.NewNacos(NamingClient, discoveryCache, nacosGroup())
+		serviceNaming = discoveryCache
+	case registry.BackendDNS:
+		targets, err := registry.ParseTargets(os.Getenv("DISCOVERY_DNS_TARGETS"))
+		if err != nil {
+			zapLog.Fatalf("DISCOVERY_DNS_TARGETS: %v", err)
+		}
+		dns := registry.NewDNS(registry.DNSConfig{
+			Targets:  targets,
+			Domain:   os.Getenv("DISCOVERY_DNS_DOMAIN"),
+			PortName: os.Getenv("DISCOVERY_DNS_PORT_NAME"),
+		})
+		serviceBackend = dns
+		serviceNaming = registry.Naming{Resolver: dns}
+	case registry.BackendStatic:
+		path := os.Getenv("DISCOVERY_STATIC_FILE")
+		if path == "" {
+			path = "discovery.yml"
+		}
+		static, err := registry.LoadStatic(path)
+		if err != nil {
+			zapLog.Fatalf("Static discovery: %v", err)
+		}
+		serviceBackend = static
+		serviceNaming = registry.Naming{Resolver: static}
+	default:
+		zapLog.Fatalf("Unknown DISCOVERY_BACKEND %q, want nacos / dns / static", backend)
+	}
+	zapLog.Infow("Service discovery initialized", "backend", serviceBackend.Name())
+}
+
+func discoveryBackend() string {
+	if v := strings.ToLower(strings.TrimSpace(os.Getenv("DISCOVERY_BACKEND"))); v != "" {
+		return v
+	}
+	return registry.BackendNacos
+}
+
+// 本服务实例的注册信息，取自环境变量（Kubernetes 中由 Downward API 注入）：
+//   - POD_IP：注册的地址，未设置时使用第一个非回环 IPv4 地址
+//   - SERVICE_PORT：注册的端口，默认为监听端口
+//   - NACOS_GROUP / NACOS_CLUSTER：分组（默认 DEFAULT_GROUP）与集群（默认 DEFAULT），分组同时用于发现下游服务
+//   - SERVICE_WEIGHT：权重，默认 10
+//   - SERVICE_VERSION / SERVICE_ZONE / SERVICE_METADATA：实例元数据 version、zone 及其他 k1=v1,k2=v2，
+//     供调用方按元数据筛选（见 LB_*_METADATA）
+//
+// 注销时使用注册成功的同一份信息。启动时 Nacos 短暂不可用会按指数退避重试，
+// 最多 REGISTER_MAX_ATTEMPTS 次（默认 6 次，约 15 秒）。
+
+const (
+	registerBaseBackoff = 500 * time.Millisecond
+	registerMaxBackoff  = 8 * time.Second
+)
+
+// registeredInstance 注册成功的实例，注销时原样使用
+var registeredInstance *registry.Instance
+
+// nacosGroup 注册与发现使用的 Nacos 分组
+func nacosGroup() string {
+	if g := os.Getenv("NACOS_GROUP"); g != "" {
+		return g
+	}
+	return "DEFAULT_GROUP"
+}
+
+// selfInstance 根据环境变量生成本服务实例的注册信息
+func selfInstance(serviceName string, listenPort uint64) (registry.Instance, error) {
+	in := registry.Instance{
+		Service: serviceName,
+		Group:   nacosGroup(),
+		Cluster: os.Getenv("NACOS_CLUSTER"),
+		Host:    os.Getenv("POD_IP"),
+		Port:    listenPort,
+		Weight:  10,
+	}
+	if in.Host == "" {
+		hostIP, err := getHostIP()
+		if err != nil {
+			return in, fmt.Errorf("Failed to get host IP address: %w", err)
+		}
+		in.Host = hostIP
+	} else if net.ParseIP(in.Host) == nil {
+		return in, fmt.Errorf("invalid POD_IP %q", in.Host)
+	}
+	if v := os.Getenv("SERVICE_PORT"); v != "" {
+		port, err := strconv.ParseUint(v, 10, 16)
+		if err != nil || port == 0 {
+			return in, fmt.Errorf("invalid SERVICE_PORT %q", v)
+		}
+		in.Port = port
+	}
+	if v := os.Getenv("SERVICE_WEIGHT"); v != "" {
+		weight, err := strconv.ParseFloat(v, 64)
+		if err != nil || weight <= 0 {
+			return in, fmt.Errorf("invalid SERVICE_WEIGHT %q", v)
+		}
+		in.Weight = weight
+	}
+	metadata, err := balancer.ParseMetadata(os.Getenv("SERVICE_METADATA"))
+	if err != nil {
+		return in, fmt.Errorf("SERVICE_METADATA: %w", err)
+	}
+	for key, env := range map[string]string{"version": "SERVICE_VERSION", "zone": "SERVICE_ZONE"} {
+		if v := os.Getenv(env); v != "" {
+			if metadata == nil {
+				metadata = make(map[string]string)
+			}
+			metadata[key] = v
+		}
+	}
+	in.Metadata = metadata
+	return in, nil
+}
+
+// 获取主机的非回环 IP 地址
+func getHostIP() (string, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return "", err
+	}
+
+	for _, addr := range addrs {
+		ip, _, err := net.ParseCIDR(addr.String())
+		if err != nil {
+			continue
+		}
+		if !ip.IsLoopback() && ip.To4() != nil {
+			return ip.String(), nil
+		}
+	}
+
+	return "", fmt.Errorf("No valid IP address found")
+}
+
+// 注册服务实例，失败时按指数退避重试；dns / static 后端不需要注册
+func registerService(serviceName string, listenPort uint64) error {
+	in, err := selfInstance(serviceName, listenPort)
+	if err != nil {
+		return err
+	}
+
+	attempts := parseInt(os.Getenv("REGISTER_MAX_ATTEMPTS"), 6)
+	backoff := registerBaseBackoff
+	for attempt := 1; ; attempt++ {
+		if err = serviceBackend.Register(in); err == nil {
+			break
+		}
+		if attempt >= attempts {
+			return fmt.Errorf("register %s after %d attempts: %w", serviceName, attempt, err)
+		}
+		// 抖动避免多个实例同时重试
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		zapLog.Warnw("Register failed, retrying", "service", serviceName, "attempt", attempt, "retry_in", wait.String(), "error", err)
+		time.Sleep(wait)
+		if backoff *= 2; backoff > registerMaxBackoff {
+			backoff = registerMaxBackoff
+		}
+	}
+
+	registeredInstance = &in
+	zapLog.Infow("Service registered", "service", in.Service, "ip", in.Host, "port", in.Port,
+		"group", in.Group, "cluster", in.Cluster, "metadata", in.Metadata, "backend", serviceBackend.Name())
+	return nil
+}
+
+// 注销 game-service，使用注册时的实例信息
+func deregisterGameService() {
+	if registeredInstance == nil {
+		return
+	}
+	if err := serviceBackend.Deregister(*registeredInstance); err != nil {
+		zapLog.Errorf("Error deregistering game service instance: %v\n", err)
+	} else {
+		zapLog.Info("Game service deregistered successfully")
+	}
+}
@@ -0,0 +1,150 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DNSConfig Kubernetes headless Service 的解析方式。
+//
+// 每个服务的 DNS 名称取 Targets 中的映射，未映射时为 "<service>.<Domain>"（Domain 为空时即服务名，
+// 依赖 Pod 的 DNS search 域）。名称带端口时解析 A/AAAA 记录，每个 Pod IP 一个实例；
+// 不带端口时按 PortName 查询 SRV 记录（_<PortName>._tcp.<name>），端口取自 Service 的命名端口。
+type DNSConfig struct {
+	Targets  map[string]string // 服务名 -> host[:port]，如 login-service=micro-go-login.crolord.svc.cluster.local:8083
+	Domain   string            // 如 crolord.svc.cluster.local
+	PortName string            // 如 http
+	TTL      time.Duration     // 解析结果的缓存时间，默认 5s
+	Timeout  time.Duration     // 单次 DNS 查询超时，默认 2s
+}
+
+// DNS 基于 Kubernetes headless Service DNS 的后端；实例由 Kubernetes Endpoints 维护，注册与注销为空操作
+type DNS struct {
+	cfg        DNSConfig
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+	lookupSRV  func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	now        func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]dnsEntry
+}
+
+type dnsEntry struct {
+	list      []Instance
+	expiresAt time.Time
+}
+
+func NewDNS(cfg DNSConfig) *DNS {
+	if cfg.TTL <= 0 {
+		cfg.TTL = 5 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 2 * time.Second
+	}
+	return &DNS{
+		cfg:        cfg,
+		lookupHost: net.DefaultResolver.LookupHost,
+		lookupSRV:  net.DefaultResolver.LookupSRV,
+		now:        time.Now,
+		cache:      make(map[string]dnsEntry),
+	}
+}
+
+func (d *DNS) Name() string { return BackendDNS }
+
+func (d *DNS) Register(Instance) error   { return nil }
+func (d *DNS) Deregister(Instance) error { return nil }
+
+// Resolve 在 TTL 内复用上一次结果；查询失败时继续使用上一次的有效结果
+func (d *DNS) Resolve(service string) ([]Instance, error) {
+	d.mu.Lock()
+	e, ok := d.cache[service]
+	d.mu.Unlock()
+	if ok && d.now().Before(e.expiresAt) {
+		return e.list, nil
+	}
+
+	list, err := d.lookup(service)
+	if err != nil {
+		if !ok {
+			return nil, err
+		}
+		// 沿用旧结果一个 TTL，避免 DNS 故障期间每次请求都等待查询超时
+		list = e.list
+	}
+	d.mu.Lock()
+	d.cache[service] = dnsEntry{list: list, expiresAt: d.now().Add(d.cfg.TTL)}
+	d.mu.Unlock()
+	return list, nil
+}
+
+func (d *DNS) lookup(service string) ([]Instance, error) {
+	target, ok := d.cfg.Targets[service]
+	if !ok {
+		target = service
+		if d.cfg.Domain != "" {
+			target += "." + strings.TrimPrefix(d.cfg.Domain, ".")
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), d.cfg.Timeout)
+	defer cancel()
+
+	var list []Instance
+	if host, portStr, err := net.SplitHostPort(target); err == nil {
+		port, err := strconv.ParseUint(portStr, 10, 16)
+		if err != nil || port == 0 {
+			return nil, fmt.Errorf("resolve %s: invalid port in %q", service, target)
+		}
+		addrs, err := d.lookupHost(ctx, host)
+		if err != nil {
+			return nil, fmt.Errorf("resolve %s: %w", service, err)
+		}
+		for _, addr := range addrs {
+			list = append(list, Instance{Service: service, Host: addr, Port: port, Weight: 1})
+		}
+	} else {
+		if d.cfg.PortName == "" {
+			return nil, fmt.Errorf("resolve %s: no port for %q and no SRV port name configured", service, target)
+		}
+		_, records, err := d.lookupSRV(ctx, d.cfg.PortName, "tcp", target)
+		if err != nil {
+			return nil, fmt.Errorf("resolve %s: %w", service, err)
+		}
+		for _, r := range records {
+			weight := float64(r.Weight)
+			if weight == 0 {
+				weight = 1
+			}
+			list = append(list, Instance{Service: service, Host: strings.TrimSuffix(r.Target, "."), Port: uint64(r.Port), Weight: weight})
+		}
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, service)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Addr() < list[j].Addr() })
+	return list, nil
+}
+
+// ParseTargets 解析 k1=host:port,k2=host 格式的服务地址映射
+func ParseTargets(s string) (map[string]string, error) {
+	targets := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, target, ok := strings.Cut(pair, "=")
+		name, target = strings.TrimSpace(name), strings.TrimSpace(target)
+		if !ok || name == "" || target == "" {
+			return nil, fmt.Errorf("invalid dns target %q, want service=host[:port]", pair)
+		}
+		targets[name] = target
+	}
+	return targets, nil
+}
@@ -0,0 +1,111 @@
+package registry
+
+import (
+	"fmt"
+
+	"github.com/nacos-group/nacos-sdk-go/model"
+	"github.com/nacos-group/nacos-sdk-go/vo"
+)
+
+// NacosClient 注册用到的 Nacos 命名客户端方法，naming_client.INamingClient 满足该接口
+type NacosClient interface {
+	RegisterInstance(param vo.RegisterInstanceParam) (bool, error)
+	DeregisterInstance(param vo.DeregisterInstanceParam) (bool, error)
+}
+
+// ServiceGetter 查询服务实例，naming_client.INamingClient 与 discovery.Cache 均满足该接口
+type ServiceGetter interface {
+	GetService(param vo.GetServiceParam) (model.Service, error)
+}
+
+// Nacos 基于 Nacos 命名服务的后端
+type Nacos struct {
+	client NacosClient
+	lookup ServiceGetter
+	group  string
+}
+
+// NewNacos lookup 为 nil 时直接查询 client；group 为空时使用 DEFAULT_GROUP
+func NewNacos(client NacosClient, lookup ServiceGetter, group string) *Nacos {
+	if group == "" {
+		group = "DEFAULT_GROUP"
+	}
+	if lookup == nil {
+		lookup, _ = client.(ServiceGetter)
+	}
+	return &Nacos{client: client, lookup: lookup, group: group}
+}
+
+func (n *Nacos) Name() string { return BackendNacos }
+
+func (n *Nacos) Register(in Instance) error {
+	if err := validate(&in); err != nil {
+		return err
+	}
+	ok, err := n.client.RegisterInstance(vo.RegisterInstanceParam{
+		Ip:          in.Host,
+		Port:        in.Port,
+		ServiceName: in.Service,
+		GroupName:   n.groupOf(in),
+		ClusterName: in.Cluster,
+		Weight:      in.Weight,
+		Metadata:    in.Metadata,
+		Enable:      true,
+		Healthy:     true,
+		Ephemeral:   true,
+	})
+	if err != nil {
+		return fmt.Errorf("register %s: %w", in.Service, err)
+	}
+	if !ok {
+		return fmt.Errorf("register %s: rejected by nacos", in.Service)
+	}
+	return nil
+}
+
+func (n *Nacos) Deregister(in Instance) error {
+	ok, err := n.client.DeregisterInstance(vo.DeregisterInstanceParam{
+		Ip:          in.Host,
+		Port:        in.Port,
+		ServiceName: in.Service,
+		GroupName:   n.groupOf(in),
+		Cluster:     in.Cluster,
+		Ephemeral:   true,
+	})
+	if err != nil {
+		return fmt.Errorf("deregister %s: %w", in.Service, err)
+	}
+	if !ok {
+		return fmt.Errorf("deregister %s: rejected by nacos", in.Service)
+	}
+	return nil
+}
+
+func (n *Nacos) groupOf(in Instance) string {
+	if in.Group != "" {
+		return in.Group
+	}
+	return n.group
+}
+
+// Resolve 返回健康且已启用的实例
+func (n *Nacos) Resolve(service string) ([]Instance, error) {
+	if n.lookup == nil {
+		return nil, fmt.Errorf("resolve %s: no nacos lookup configured", service)
+	}
+	svc, err := n.lookup.GetService(vo.GetServiceParam{ServiceName: service, GroupName: n.group})
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Instance, 0, len(svc.Hosts))
+	for _, h := range svc.Hosts {
+		if !h.Healthy || !h.Enable || h.Weight <= 0 {
+			continue
+		}
+		list = append(list, Instance{Service: service, Group: n.group, Cluster: h.ClusterName, Host: h.Ip, Port: h.Port, Weight: h.Weight, Metadata: h.Metadata})
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, service)
+	}
+	return list, nil
+}
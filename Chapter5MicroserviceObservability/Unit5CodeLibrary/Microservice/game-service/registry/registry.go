@@ -0,0 +1,104 @@
+// Package registry 服务注册与发现的抽象，服务只依赖 Registry / Resolver，不直接依赖 Nacos。
+//
+// 后端：
+//   - Nacos：注册实例并按 Nacos 的实例列表解析（通常交给 discovery.Cache 做本地缓存）
+//   - DNS：Kubernetes headless Service，实例由 Endpoints 维护，注册为空操作
+//   - Static：静态 YAML 文件，用于本地开发与测试，无需 Nacos
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/nacos-group/nacos-sdk-go/model"
+	"github.com/nacos-group/nacos-sdk-go/vo"
+)
+
+// 后端名称，与 DISCOVERY_BACKEND 的取值一致
+const (
+	BackendNacos  = "nacos"
+	BackendDNS    = "dns"
+	BackendStatic = "static"
+)
+
+// ErrNotFound 服务没有任何可用实例
+var ErrNotFound = errors.New("service not found")
+
+// Instance 一个服务实例
+type Instance struct {
+	Service  string            `json:"service" yaml:"-"`
+	Group    string            `json:"group,omitempty" yaml:"-"`   // 为空时使用后端的默认分组
+	Cluster  string            `json:"cluster,omitempty" yaml:"-"` // 为空时为 Nacos 的 DEFAULT 集群
+	Host     string            `json:"host" yaml:"host"`
+	Port     uint64            `json:"port" yaml:"port"`
+	Weight   float64           `json:"weight" yaml:"weight"`
+	Metadata map[string]string `json:"metadata,omitempty" yaml:"metadata"`
+}
+
+// Addr host:port
+func (in Instance) Addr() string {
+	return net.JoinHostPort(in.Host, strconv.FormatUint(in.Port, 10))
+}
+
+// Registry 把本服务实例登记到注册中心
+type Registry interface {
+	Register(in Instance) error
+	Deregister(in Instance) error
+}
+
+// Resolver 解析服务的当前实例列表
+type Resolver interface {
+	Resolve(service string) ([]Instance, error)
+}
+
+// Backend 同时提供注册与解析的后端
+type Backend interface {
+	Registry
+	Resolver
+	Name() string
+}
+
+// Naming 把 Resolver 适配为 balancer.Naming，解析到的实例均视为健康、已启用
+type Naming struct {
+	Resolver Resolver
+}
+
+func (n Naming) GetService(param vo.GetServiceParam) (model.Service, error) {
+	list, err := n.Resolver.Resolve(param.ServiceName)
+	if err != nil {
+		return model.Service{}, err
+	}
+	hosts := make([]model.Instance, 0, len(list))
+	for _, in := range list {
+		hosts = append(hosts, model.Instance{
+			InstanceId:  in.Addr(),
+			Ip:          in.Host,
+			Port:        in.Port,
+			Weight:      in.Weight,
+			Healthy:     true,
+			Enable:      true,
+			ServiceName: param.ServiceName,
+			Metadata:    in.Metadata,
+		})
+	}
+	return model.Service{Name: param.ServiceName, Hosts: hosts}, nil
+}
+
+// validate 校验实例地址并补全默认权重
+func validate(in *Instance) error {
+	if in.Host == "" {
+		return fmt.Errorf("%s: host is required", in.Service)
+	}
+	if in.Port == 0 || in.Port > 65535 {
+		return fmt.Errorf("%s: invalid port %d", in.Service, in.Port)
+	}
+	if in.Weight < 0 {
+		return fmt.Errorf("%s: invalid weight %v", in.Service, in.Weight)
+	}
+	if in.Weight == 0 {
+		in.Weight = 1
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package registry
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Static 静态实例列表，注册与注销为空操作。文件格式：
+//
+//	services:
+//	  login-service:
+//	    - host: 127.0.0.1
+//	      port: 8083
+//	  scoreboard-service:
+//	    - host: 127.0.0.1
+//	      port: 8085
+//	      weight: 1          # 可省略，默认 1
+//	      metadata:          # 可省略，供负载均衡按元数据筛选
+//	        version: v2
+type Static struct {
+	services map[string][]Instance
+}
+
+type staticFile struct {
+	Services map[string][]Instance `yaml:"services"`
+}
+
+// LoadStatic 读取并校验静态实例文件
+func LoadStatic(path string) (*Static, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read static registry: %w", err)
+	}
+	var f staticFile
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("parse static registry %s: %w", path, err)
+	}
+	return NewStatic(f.Services)
+}
+
+// NewStatic 使用给定的实例列表
+func NewStatic(services map[string][]Instance) (*Static, error) {
+	s := &Static{services: make(map[string][]Instance, len(services))}
+	for name, list := range services {
+		checked := make([]Instance, 0, len(list))
+		for _, in := range list {
+			in.Service = name
+			if err := validate(&in); err != nil {
+				return nil, fmt.Errorf("static registry: %w", err)
+			}
+			checked = append(checked, in)
+		}
+		s.services[name] = checked
+	}
+	return s, nil
+}
+
+func (s *Static) Name() string { return BackendStatic }
+
+func (s *Static) Register(Instance) error   { return nil }
+func (s *Static) Deregister(Instance) error { return nil }
+
+func (s *Static) Resolve(service string) ([]Instance, error) {
+	list := s.services[service]
+	if len(list) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, service)
+	}
+	return append([]Instance(nil), list...), nil
+}
@@ -0,0 +1,168 @@
+// round.go
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// 对局结果
+const (
+	RoundInProgress = "in_progress"
+	RoundWon        = "won"
+	RoundLost       = "lost"      // 达到难度的最大尝试次数
+	RoundAbandoned  = "abandoned" // 玩家切换难度，放弃当前对局
+)
+
+var errUnknownDifficulty = errors.New("unknown difficulty")
+
+// GameRound 一局猜数字游戏，记录目标数字、猜测序列和结果
+type GameRound struct {
+	ID           uint       `gorm:"column:ID;primary_key;AUTO_INCREMENT"`
+	UserID       string     `gorm:"column:UserID;not null;index:idx_round_user"`
+	Difficulty   string     `gorm:"column:Difficulty;not null;default:'normal'"`
+	RangeMin     int        `gorm:"column:RangeMin;not null;default:1"`
+	RangeMax     int        `gorm:"column:RangeMax;not null;default:100"`
+	MaxAttempts  int        `gorm:"column:MaxAttempts;default:0"` // 0 表示不限次数
+	TargetNumber int        `gorm:"column:TargetNumber;not null"`
+	Attempts     int        `gorm:"column:Attempts;default:0"`
+	Guesses      string     `gorm:"column:Guesses;type:text"` // JSON 数组，例如 [50,25,37]
+	Result       string     `gorm:"column:Result;not null;default:'in_progress'"`
+	StartedAt    time.Time  `gorm:"column:StartedAt"`
+	FinishedAt   *time.Time `gorm:"column:FinishedAt"`
+}
+
+// 自定义表名
+func (GameRound) TableName() string {
+	return "game_round"
+}
+
+// GuessList 解析猜测序列
+func (r *GameRound) GuessList() []int {
+	var guesses []int
+	if r.Guesses != "" {
+		_ = json.Unmarshal([]byte(r.Guesses), &guesses)
+	}
+	if guesses == nil {
+		guesses = []int{}
+	}
+	return guesses
+}
+
+// RemainingAttempts 剩余尝试次数，不限次数时返回 nil
+func (r *GameRound) RemainingAttempts() *int {
+	if r.MaxAttempts <= 0 {
+		return nil
+	}
+	remaining := r.MaxAttempts - r.Attempts
+	if remaining < 0 {
+		remaining = 0
+	}
+	return &remaining
+}
+
+// appendGuess 追加一次猜测
+func (r *GameRound) appendGuess(number int) {
+	b, _ := json.Marshal(append(r.GuessList(), number))
+	r.Guesses = string(b)
+}
+
+// roundView 对外返回的对局信息（进行中的对局不暴露目标数字）
+type roundView struct {
+	ID           uint       `json:"id"`
+	Difficulty   string     `json:"difficulty"`
+	RangeMin     int        `json:"rangeMin"`
+	RangeMax     int        `json:"rangeMax"`
+	MaxAttempts  int        `json:"maxAttempts"`
+	Result       string     `json:"result"`
+	Attempts     int        `json:"attempts"`
+	Guesses      []int      `json:"guesses"`
+	TargetNumber *int       `json:"targetNumber,omitempty"`
+	StartedAt    time.Time  `json:"startedAt"`
+	FinishedAt   *time.Time `json:"finishedAt,omitempty"`
+}
+
+func newRoundView(r GameRound) roundView {
+	v := roundView{
+		ID:          r.ID,
+		Difficulty:  r.Difficulty,
+		RangeMin:    r.RangeMin,
+		RangeMax:    r.RangeMax,
+		MaxAttempts: r.MaxAttempts,
+		Result:      r.Result,
+		Attempts:    r.Attempts,
+		Guesses:     r.GuessList(),
+		StartedAt:   r.StartedAt,
+		FinishedAt:  r.FinishedAt,
+	}
+	if r.Result != RoundInProgress {
+		target := r.TargetNumber
+		v.TargetNumber = &target
+	}
+	return v
+}
+
+// 并发猜测冲突时按指数退避重试，直到请求的 context 结束；整个请求最多等待 guessTimeout
+const (
+	guessRetryBaseDelay = 2 * time.Millisecond
+	guessRetryMaxDelay  = 100 * time.Millisecond
+	guessTimeout        = 5 * time.Second
+)
+
+var errGuessConflict = errors.New("concurrent guess conflict")
+
+// guessOutcome 一次猜测的结果
+type guessOutcome struct {
+	Game  Game       // 更新后的游戏记录
+	Round GameRound  // 本次猜测所在的对局（更新后）
+	Next  *GameRound // 本局结束时开启的下一局
+	Won   bool
+}
+
+// newRound 按难度构造一局新的对局
+func newRound(userID string, difficulty Difficulty) GameRound {
+	return GameRound{
+		UserID:       userID,
+		Difficulty:   difficulty.Name,
+		RangeMin:     difficulty.Min,
+		RangeMax:     difficulty.Max,
+		MaxAttempts:  difficulty.MaxAttempts,
+		TargetNumber: generateTargetNumber(difficulty),
+		Result:       RoundInProgress,
+		Guesses:      "[]",
+		StartedAt:    time.Now(),
+	}
+}
+
+// applyGuess 将一次猜测记入对局并判定结果；猜中或用完尝试次数时结束本局
+func applyGuess(round *GameRound, number int) (won bool) {
+	round.appendGuess(number)
+	round.Attempts++
+	won = number == round.TargetNumber
+	if won {
+		round.Result = RoundWon
+	} else if round.MaxAttempts > 0 && round.Attempts >= round.MaxAttempts {
+		round.Result = RoundLost
+	}
+	if round.Result != RoundInProgress {
+		now := time.Now()
+		round.FinishedAt = &now
+	}
+	return won
+}
+
+// nextDifficulty 对局结束后下一局沿用的难度
+func nextDifficulty(round *GameRound) Difficulty {
+	difficulty, ok := lookupDifficulty(round.Difficulty)
+	if !ok {
+		difficulty, _ = lookupDifficulty("")
+	}
+	return difficulty
+}
+
+// normalizeDifficulty 统一难度名称格式
+func normalizeDifficulty(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
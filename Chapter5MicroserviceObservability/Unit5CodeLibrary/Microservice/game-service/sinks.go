@@ -0,0 +1,116 @@
+// sinks.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"microservice/pkg/auth"
+)
+
+// EventSink 领域事件的下游
+type EventSink interface {
+	Name() string
+	Deliver(events []DomainEvent) error
+}
+
+// eventSinks 读取 EVENT_SINKS（逗号分隔），默认只投递给 scoreboard-service
+func eventSinks() ([]EventSink, error) {
+	names := os.Getenv("EVENT_SINKS")
+	if names == "" {
+		names = "scoreboard"
+	}
+	var sinks []EventSink
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(strings.ToLower(name)) {
+		case "scoreboard":
+			if eventSigningSecret() == "" {
+				zapLog.Warn("EVENT_SIGNING_SECRETS not set, scoreboard-service will reject event deliveries")
+			}
+			sinks = append(sinks, scoreboardSink{})
+		case "log":
+			sinks = append(sinks, logSink{})
+		case "", "none":
+		default:
+			return nil, fmt.Errorf("unknown event sink %q", name)
+		}
+	}
+	return sinks, nil
+}
+
+func sinkNames(sinks []EventSink) []string {
+	names := make([]string, 0, len(sinks))
+	for _, s := range sinks {
+		names = append(names, s.Name())
+	}
+	return names
+}
+
+// scoreboardSink 通过服务发现找到 scoreboard-service 并推送事件，
+// 请求体用 EVENT_SIGNING_SECRETS 的第一个密钥签名
+type scoreboardSink struct{}
+
+func (scoreboardSink) Name() string { return "scoreboard" }
+
+func (scoreboardSink) Deliver(events []DomainEvent) error {
+	base, done, err := pickInstance(scoreboardBalancer, "scoreboard-service")
+	if err != nil {
+		return fmt.Errorf("failed to discover scoreboard service: %w", err)
+	}
+	defer done()
+
+	body, err := json.Marshal(map[string]interface{}{"events": events})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, base+"/scoreboard/events", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	auth.SignRequest(req, eventSigningSecret(), body)
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending events to scoreboard service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("scoreboard service returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// eventSigningSecret EVENT_SIGNING_SECRETS 中用于签名的密钥（第一个）
+func eventSigningSecret() string {
+	secret, _, _ := strings.Cut(os.Getenv("EVENT_SIGNING_SECRETS"), ",")
+	return strings.TrimSpace(secret)
+}
+
+// logSink 以结构化日志输出事件，供日志采集链路做分析
+type logSink struct{}
+
+func (logSink) Name() string { return "log" }
+
+func (logSink) Deliver(events []DomainEvent) error {
+	for _, e := range events {
+		zapLog.Infow("DomainEvent",
+			"event_id", e.ID,
+			"event_type", e.Type,
+			"user_id", e.UserID,
+			"round_id", e.RoundID,
+			"difficulty", e.Difficulty,
+			"number", e.Number,
+			"correct", e.Correct,
+			"attempts", e.Attempts,
+			"occurred_at", e.OccurredAt,
+		)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+// store.go
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/mysql"
+	_ "modernc.org/sqlite"
+)
+
+// GameStore 游戏数据存储，屏蔽 MySQL / SQLite / 内存等具体实现
+type GameStore interface {
+	// GetOrCreateGame 获取或创建用户的游戏记录
+	GetOrCreateGame(userID string) (*Game, error)
+	// SubmitGuess 原子地记录一次猜测并发布相应的领域事件；difficulty 为空表示沿用当前对局的难度。
+	// 与同一用户的其他猜测冲突时重试，ctx 结束仍未成功则返回 errGuessConflict
+	SubmitGuess(ctx context.Context, user User, difficulty string, number int) (*guessOutcome, error)
+	// ListRounds 分页查询用户的历史对局，按开始时间倒序
+	ListRounds(userID string, page, pageSize int) ([]GameRound, int, error)
+	// ResetGame 放弃进行中的对局并清零计数，返回被放弃的对局数；用户没有游戏记录时返回 errGameNotFound
+	ResetGame(userID string) (abandoned int, err error)
+	Close() error
+}
+
+var errGameNotFound = errors.New("game not found")
+
+// 存储驱动
+const (
+	driverMySQL  = "mysql"
+	driverSQLite = "sqlite"
+	driverMemory = "memory"
+)
+
+var store GameStore
+
+// storeDriver 读取存储驱动：环境变量 STORE_DRIVER 优先，其次为数据库配置中的 DB_DRIVER，默认 mysql
+func storeDriver(dbConfig map[string]string) string {
+	driver := os.Getenv("STORE_DRIVER")
+	if driver == "" {
+		driver = dbConfig["DB_DRIVER"]
+	}
+	if driver == "" {
+		return driverMySQL
+	}
+	return strings.ToLower(driver)
+}
+
+// openGameStore 根据配置创建存储与事件发布器，SQL 存储在启动时执行未完成的迁移
+func openGameStore(dbConfig map[string]string) (GameStore, error) {
+	driver := storeDriver(dbConfig)
+	if driver == driverMemory {
+		zapLog.Info("Using in-memory game store")
+		p, err := openPublisher(driver, nil)
+		if err != nil {
+			return nil, err
+		}
+		publisher = p
+		return newMemoryGameStore(), nil
+	}
+
+	gdb, err := openDatabase(dbConfig)
+	if err != nil {
+		return nil, err
+	}
+	if autoMigrateEnabled() {
+		applied, err := newGameMigrator(gdb).Up(0)
+		if err != nil {
+			gdb.Close()
+			return nil, fmt.Errorf("failed to migrate database: %w", err)
+		}
+		for _, m := range applied {
+			zapLog.Infof("Applied migration %03d_%s", m.Version, m.Name)
+		}
+	}
+	p, err := openPublisher(driver, gdb)
+	if err != nil {
+		gdb.Close()
+		return nil, err
+	}
+	publisher = p
+	return newSQLGameStore(gdb), nil
+}
+
+// openDatabase 按驱动打开 MySQL 或 SQLite 数据库
+func openDatabase(dbConfig map[string]string) (*gorm.DB, error) {
+	switch driver := storeDriver(dbConfig); driver {
+	case driverMySQL:
+		return openMySQL(dbConfig)
+	case driverSQLite:
+		path := dbConfig["DB_PATH"]
+		if path == "" {
+			path = "guess.db"
+		}
+		zapLog.Infof("Opening SQLite database %s", path)
+		return openSQLite(path)
+	default:
+		return nil, fmt.Errorf("unknown store driver %q", driver)
+	}
+}
+
+// openSQLite 使用纯 Go 的 SQLite 驱动打开数据库，不依赖 CGO
+func openSQLite(path string) (*gorm.DB, error) {
+	sqlDB, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+	// SQLite 只允许单个写连接
+	sqlDB.SetMaxOpenConns(1)
+	gdb, err := gorm.Open("sqlite3", sqlDB)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+	return gdb, nil
+}
@@ -0,0 +1,165 @@
+// store_memory.go
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryGameStore 纯内存存储，用于本地开发和测试，进程退出后数据丢失
+type memoryGameStore struct {
+	mu     sync.Mutex
+	games  map[string]*Game
+	rounds []*GameRound // 下标 + 1 即对局 ID
+	active map[string]*GameRound
+}
+
+func newMemoryGameStore() *memoryGameStore {
+	return &memoryGameStore{
+		games:  make(map[string]*Game),
+		active: make(map[string]*GameRound),
+	}
+}
+
+// GetOrCreateGame 获取或创建游戏记录
+func (s *memoryGameStore) GetOrCreateGame(userID string) (*Game, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	game := *s.getOrCreateGameLocked(userID)
+	return &game, nil
+}
+
+func (s *memoryGameStore) getOrCreateGameLocked(userID string) *Game {
+	game, ok := s.games[userID]
+	if !ok {
+		difficulty, _ := lookupDifficulty("")
+		game = &Game{ID: userID, TargetNumber: generateTargetNumber(difficulty)}
+		s.games[userID] = game
+	}
+	return game
+}
+
+// SubmitGuess 在互斥锁内完成一次猜测，解锁后发布事件；互斥锁保证不会冲突，无需重试
+func (s *memoryGameStore) SubmitGuess(_ context.Context, user User, difficulty string, number int) (*guessOutcome, error) {
+	events := newEventBatch(user)
+	out, err := s.submitGuess(user.ID, difficulty, number, events)
+	if err != nil {
+		return nil, err
+	}
+	if err := publisher.Stage(nil, events.events); err != nil {
+		return nil, err
+	}
+	publisher.Publish(events.events)
+	return out, nil
+}
+
+func (s *memoryGameStore) submitGuess(userID, difficulty string, number int, events *eventBatch) (*guessOutcome, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	game := s.getOrCreateGameLocked(userID)
+	difficulty = normalizeDifficulty(difficulty)
+
+	round := s.active[userID]
+	if round == nil || (difficulty != "" && round.Difficulty != difficulty) {
+		d, ok := lookupDifficulty(difficulty)
+		if !ok {
+			return nil, errUnknownDifficulty
+		}
+		if round != nil {
+			now := time.Now()
+			round.Result = RoundAbandoned
+			round.FinishedAt = &now
+			events.add(EventRoundAbandoned, round)
+		}
+		round = s.startRoundLocked(game, d, events)
+	}
+
+	won := applyGuess(round, number)
+	events.addGuess(round, number, won)
+	if won {
+		game.CorrectGuesses++
+	} else {
+		game.Attempts++
+	}
+	game.Version++
+
+	out := &guessOutcome{Round: *round, Won: won}
+	if round.Result != RoundInProgress {
+		next := *s.startRoundLocked(game, nextDifficulty(round), events)
+		out.Next = &next
+	}
+	out.Game = *game
+	return out, nil
+}
+
+func (s *memoryGameStore) startRoundLocked(game *Game, difficulty Difficulty, events *eventBatch) *GameRound {
+	round := newRound(game.ID, difficulty)
+	round.ID = uint(len(s.rounds) + 1)
+	s.rounds = append(s.rounds, &round)
+	s.active[game.ID] = &round
+	game.TargetNumber = round.TargetNumber
+	events.add(EventRoundStarted, &round)
+	return &round
+}
+
+// ListRounds 分页查询用户的历史对局，按开始时间倒序
+func (s *memoryGameStore) ListRounds(userID string, page, pageSize int) ([]GameRound, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var rounds []GameRound
+	for _, r := range s.rounds {
+		if r.UserID == userID {
+			rounds = append(rounds, *r)
+		}
+	}
+	sort.SliceStable(rounds, func(i, j int) bool {
+		if !rounds[i].StartedAt.Equal(rounds[j].StartedAt) {
+			return rounds[i].StartedAt.After(rounds[j].StartedAt)
+		}
+		return rounds[i].ID > rounds[j].ID
+	})
+
+	total := len(rounds)
+	start := (page - 1) * pageSize
+	if start >= total {
+		return []GameRound{}, total, nil
+	}
+	end := start + pageSize
+	if end > total {
+		end = total
+	}
+	return rounds[start:end], total, nil
+}
+
+// ResetGame 放弃进行中的对局并清零计数
+func (s *memoryGameStore) ResetGame(userID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	game, ok := s.games[userID]
+	if !ok {
+		return 0, errGameNotFound
+	}
+	abandoned := 0
+	if round := s.active[userID]; round != nil {
+		now := time.Now()
+		round.Result = RoundAbandoned
+		round.FinishedAt = &now
+		delete(s.active, userID)
+		abandoned++
+	}
+	difficulty, _ := lookupDifficulty("")
+	game.TargetNumber = generateTargetNumber(difficulty)
+	game.Attempts, game.CorrectGuesses = 0, 0
+	game.Version++
+	return abandoned, nil
+}
+
+// Close 内存存储无需释放资源
+func (s *memoryGameStore) Close() error {
+	return nil
+}
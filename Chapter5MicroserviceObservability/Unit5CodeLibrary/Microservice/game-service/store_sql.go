@@ -0,0 +1,275 @@
+// store_sql.go
+package main
+
+import (
+	"context"
+	"database/sql"
+	"math/rand"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// sqlGameStore 基于 gorm 的存储实现，支持 MySQL 与 SQLite
+type sqlGameStore struct {
+	db *gorm.DB
+	// lockRows 猜测时以 SELECT ... FOR UPDATE 锁定游戏记录（MySQL）；
+	// SQLite 只有一个写连接，事务本身已串行
+	lockRows bool
+}
+
+// newSQLGameStore 表结构由 migrations.go 中的迁移维护
+func newSQLGameStore(db *gorm.DB) *sqlGameStore {
+	return &sqlGameStore{db: db, lockRows: db.Dialect().GetName() == "mysql"}
+}
+
+// GetOrCreateGame 获取或创建游戏记录；并发创建同一记录时以先写入者为准
+func (s *sqlGameStore) GetOrCreateGame(userID string) (*Game, error) {
+	var game Game
+	err := s.db.Where("ID = ?", userID).First(&game).Error
+	if err == nil {
+		return &game, nil
+	}
+	if !gorm.IsRecordNotFoundError(err) {
+		zapLog.Errorf("Error querying game record: %v", err)
+		return nil, err
+	}
+
+	zapLog.Infof("No game record found for user: %s", userID)
+	difficulty, _ := lookupDifficulty("")
+	game = Game{
+		ID:           userID, // 使用 user.ID 作为游戏记录的 ID
+		TargetNumber: generateTargetNumber(difficulty),
+	}
+	if createErr := s.db.Create(&game).Error; createErr != nil {
+		// 可能是并发请求已创建该记录，重新读取
+		if err := s.db.Where("ID = ?", userID).First(&game).Error; err != nil {
+			return nil, createErr
+		}
+	}
+	return &game, nil
+}
+
+// SubmitGuess 在事务中完成一次猜测：读取当前对局、判定结果、更新计数并在需要时开启下一局。
+// MySQL 上先锁定游戏记录使同一用户的并发猜测排队执行；game.Version 乐观锁兜底，
+// 冲突时按指数退避整体重试，直到 ctx 结束；事务与等待行锁同样受 ctx 限制。
+// 领域事件与游戏数据在同一事务中交给发布器，提交后再通知其投递。
+func (s *sqlGameStore) SubmitGuess(ctx context.Context, user User, difficulty string, number int) (*guessOutcome, error) {
+	if _, err := s.GetOrCreateGame(user.ID); err != nil {
+		return nil, err
+	}
+	difficulty = normalizeDifficulty(difficulty)
+
+	delay := guessRetryBaseDelay
+	for attempt := 1; ; attempt++ {
+		events := newEventBatch(user)
+		out, err := s.tryGuess(ctx, user.ID, difficulty, number, events)
+		if err == nil {
+			publisher.Publish(events.events)
+		}
+		if err != nil && ctx.Err() != nil {
+			zapLog.Warnf("Guess for user %s gave up after %d attempts: %v", user.ID, attempt, err)
+			return nil, errGuessConflict
+		}
+		if err != errGuessConflict {
+			return out, err
+		}
+		zapLog.Infof("Guess conflict for user %s, retrying (%d)", user.ID, attempt)
+		// 抖动避免冲突的请求同时重试
+		wait := delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+		select {
+		case <-ctx.Done():
+			zapLog.Warnf("Guess for user %s gave up after %d conflicts: %v", user.ID, attempt, ctx.Err())
+			return nil, errGuessConflict
+		case <-time.After(wait):
+		}
+		if delay *= 2; delay > guessRetryMaxDelay {
+			delay = guessRetryMaxDelay
+		}
+	}
+}
+
+func (s *sqlGameStore) tryGuess(ctx context.Context, userID, difficulty string, number int, events *eventBatch) (out *guessOutcome, err error) {
+	tx := s.db.BeginTx(ctx, nil)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if s.lockRows {
+		if err = lockGame(ctx, tx, userID); err != nil {
+			return nil, err
+		}
+	}
+	var game Game
+	if err = tx.Where("ID = ?", userID).First(&game).Error; err != nil {
+		return nil, err
+	}
+	round, err := s.currentRound(tx, &game, difficulty, events)
+	if err != nil {
+		return nil, err
+	}
+
+	won := applyGuess(round, number)
+	events.addGuess(round, number, won)
+	attemptsDelta, correctDelta := 1, 0
+	if won {
+		attemptsDelta, correctDelta = 0, 1
+	}
+
+	// 仅当版本号未被其他请求修改时才更新计数
+	res := tx.Model(&Game{}).Where("ID = ? AND Version = ?", game.ID, game.Version).
+		Updates(map[string]interface{}{
+			"Attempts":       gorm.Expr("Attempts + ?", attemptsDelta),
+			"CorrectGuesses": gorm.Expr("CorrectGuesses + ?", correctDelta),
+			"Version":        gorm.Expr("Version + 1"),
+		})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, errGuessConflict
+	}
+	game.Attempts += attemptsDelta
+	game.CorrectGuesses += correctDelta
+	game.Version++
+
+	if err = tx.Save(round).Error; err != nil {
+		return nil, err
+	}
+
+	var next *GameRound
+	if round.Result != RoundInProgress {
+		if next, err = s.startRound(tx, &game, nextDifficulty(round), events); err != nil {
+			return nil, err
+		}
+	}
+	if err = publisher.Stage(tx, events.events); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return &guessOutcome{Game: game, Round: *round, Next: next, Won: won}, nil
+}
+
+// lockGame 以 SELECT ... FOR UPDATE 锁定游戏记录。gorm v1 的查询不接受 ctx，
+// 这里直接在底层事务上执行，使等待行锁的时间也受请求截止时间限制
+func lockGame(ctx context.Context, tx *gorm.DB, userID string) error {
+	sqlTx, ok := tx.CommonDB().(*sql.Tx)
+	if !ok {
+		return gorm.ErrCantStartTransaction
+	}
+	var id string
+	err := sqlTx.QueryRowContext(ctx, "SELECT ID FROM "+Game{}.TableName()+" WHERE ID = ? FOR UPDATE", userID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return gorm.ErrRecordNotFound
+	}
+	return err
+}
+
+// 获取用户当前进行中的对局，不存在则按指定难度开启新的一局。
+// requested 为空表示沿用当前对局的难度；与当前对局难度不同时放弃当前对局。
+func (s *sqlGameStore) currentRound(tx *gorm.DB, game *Game, requested string, events *eventBatch) (*GameRound, error) {
+	var round GameRound
+	err := tx.Where("UserID = ? AND Result = ?", game.ID, RoundInProgress).
+		Order("ID DESC").First(&round).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		zapLog.Errorf("Error querying game round: %v", err)
+		return nil, err
+	}
+	found := err == nil
+
+	if found && (requested == "" || round.Difficulty == requested) {
+		return &round, nil
+	}
+
+	difficulty, ok := lookupDifficulty(requested)
+	if !ok {
+		return nil, errUnknownDifficulty
+	}
+	if found {
+		now := time.Now()
+		if err := tx.Model(&round).Updates(map[string]interface{}{
+			"Result":     RoundAbandoned,
+			"FinishedAt": &now,
+		}).Error; err != nil {
+			return nil, err
+		}
+		events.add(EventRoundAbandoned, &round)
+	}
+	return s.startRound(tx, game, difficulty, events)
+}
+
+// 开启新的一局，并同步 game 表中的目标数字
+func (s *sqlGameStore) startRound(tx *gorm.DB, game *Game, difficulty Difficulty, events *eventBatch) (*GameRound, error) {
+	round := newRound(game.ID, difficulty)
+	if err := tx.Create(&round).Error; err != nil {
+		return nil, err
+	}
+	game.TargetNumber = round.TargetNumber
+	if err := tx.Model(&Game{}).Where("ID = ?", game.ID).
+		Update("TargetNumber", round.TargetNumber).Error; err != nil {
+		return nil, err
+	}
+	events.add(EventRoundStarted, &round)
+	zapLog.Infof("Started %s round %d for user %s", round.Difficulty, round.ID, game.ID)
+	return &round, nil
+}
+
+// ListRounds 分页查询用户的历史对局，按开始时间倒序
+func (s *sqlGameStore) ListRounds(userID string, page, pageSize int) ([]GameRound, int, error) {
+	var total int
+	query := s.db.Model(&GameRound{}).Where("UserID = ?", userID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var rounds []GameRound
+	if err := query.Order("StartedAt DESC").Order("ID DESC").
+		Limit(pageSize).Offset((page - 1) * pageSize).
+		Find(&rounds).Error; err != nil {
+		return nil, 0, err
+	}
+	return rounds, total, nil
+}
+
+// ResetGame 在事务中放弃进行中的对局、清零计数并换新目标数字；递增版本号使并发的猜测冲突重试。
+// 重置不产生领域事件，排行榜统计由 scoreboard-service 的管理接口单独清除
+func (s *sqlGameStore) ResetGame(userID string) (int, error) {
+	var abandoned int
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var game Game
+		if err := tx.Where("ID = ?", userID).First(&game).Error; err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				return errGameNotFound
+			}
+			return err
+		}
+		now := time.Now()
+		res := tx.Model(&GameRound{}).Where("UserID = ? AND Result = ?", userID, RoundInProgress).
+			Updates(map[string]interface{}{"Result": RoundAbandoned, "FinishedAt": &now})
+		if res.Error != nil {
+			return res.Error
+		}
+		abandoned = int(res.RowsAffected)
+
+		difficulty, _ := lookupDifficulty("")
+		return tx.Model(&Game{}).Where("ID = ?", userID).Updates(map[string]interface{}{
+			"TargetNumber":   generateTargetNumber(difficulty),
+			"Attempts":       0,
+			"CorrectGuesses": 0,
+			"Version":        gorm.Expr("Version + 1"),
+		}).Error
+	})
+	return abandoned, err
+}
+
+// Close 关闭数据库连接
+func (s *sqlGameStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,60 @@
+// store_sql_test.go
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+// openTestSQLStore 在临时目录创建 SQLite 数据库并执行迁移；事件使用不投递的内存发布器
+func openTestSQLStore(t *testing.T) *sqlGameStore {
+	t.Helper()
+	gdb, err := openSQLite(filepath.Join(t.TempDir(), "game.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newGameMigrator(gdb).Up(0); err != nil {
+		gdb.Close()
+		t.Fatalf("migrate: %v", err)
+	}
+	prev := publisher
+	publisher = newMemoryPublisher(nil)
+	t.Cleanup(func() {
+		publisher.Close()
+		publisher = prev
+		gdb.Close()
+	})
+	return newSQLGameStore(gdb)
+}
+
+func TestSQLStoreConcurrentGuesses(t *testing.T) {
+	testConcurrentGuesses(t, openTestSQLStore(t))
+}
+
+func TestSQLStoreResetGame(t *testing.T) {
+	testResetGame(t, openTestSQLStore(t))
+}
+
+func TestSQLStoreLocksRowsOnlyOnMySQL(t *testing.T) {
+	if s := openTestSQLStore(t); s.lockRows {
+		t.Fatal("SQLite store must not use SELECT ... FOR UPDATE")
+	}
+}
+
+func TestSQLStoreGuessHonoursContext(t *testing.T) {
+	s := openTestSQLStore(t)
+	user := User{ID: "u1", Username: "alice"}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.SubmitGuess(ctx, user, "", 1); err != errGuessConflict {
+		t.Fatalf("guess with a finished context: %v, want errGuessConflict", err)
+	}
+	game, err := s.GetOrCreateGame(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if game.Attempts != 0 || game.CorrectGuesses != 0 {
+		t.Fatalf("guess recorded after the context ended: %+v", game)
+	}
+}
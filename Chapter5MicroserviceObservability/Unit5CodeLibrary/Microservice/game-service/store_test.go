@@ -0,0 +1,148 @@
+// store_test.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestMain(m *testing.M) {
+	zapLog = zap.NewNop().Sugar()
+	os.Exit(m.Run())
+}
+
+// 并发猜测测试的规模
+const (
+	concurrentUsers   = 4
+	guessesPerUser    = 200
+	concurrentGuesses = concurrentUsers * guessesPerUser
+)
+
+// testConcurrentGuesses 多个用户同时发起大量猜测，校验计数与对局记录与实际结果完全一致
+func testConcurrentGuesses(t *testing.T, s GameStore) {
+	t.Helper()
+	var (
+		mu   sync.Mutex
+		wins = make(map[string]int)
+		errs []error
+		wg   sync.WaitGroup
+	)
+	for i := 0; i < concurrentGuesses; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			user := User{ID: fmt.Sprintf("user-%d", i%concurrentUsers)}
+			// easy 与 hard 交替，切换难度会放弃进行中的对局；easy 下猜 1-10 时有猜中，hard 最多 10 次，对局多以失败结束
+			difficulty := "hard"
+			if i%2 == 0 {
+				difficulty = "easy"
+			}
+			out, err := s.SubmitGuess(context.Background(), user, difficulty, i%10+1)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			if out.Won {
+				wins[user.ID]++
+			}
+		}(i)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		t.Fatalf("%d guesses failed, first: %v", len(errs), errs[0])
+	}
+
+	for u := 0; u < concurrentUsers; u++ {
+		userID := fmt.Sprintf("user-%d", u)
+		game, err := s.GetOrCreateGame(userID)
+		if err != nil {
+			t.Fatalf("%s: %v", userID, err)
+		}
+		if game.CorrectGuesses != wins[userID] {
+			t.Errorf("%s: CorrectGuesses = %d, want %d", userID, game.CorrectGuesses, wins[userID])
+		}
+		if want := guessesPerUser - wins[userID]; game.Attempts != want {
+			t.Errorf("%s: Attempts = %d, want %d", userID, game.Attempts, want)
+		}
+		if game.Version != guessesPerUser {
+			t.Errorf("%s: Version = %d, want %d", userID, game.Version, guessesPerUser)
+		}
+
+		rounds, total, err := s.ListRounds(userID, 1, concurrentGuesses)
+		if err != nil {
+			t.Fatalf("%s: list rounds: %v", userID, err)
+		}
+		if total != len(rounds) {
+			t.Fatalf("%s: ListRounds returned %d of %d rounds", userID, len(rounds), total)
+		}
+		attempts, won, inProgress := 0, 0, 0
+		for _, r := range rounds {
+			attempts += r.Attempts
+			if len(r.GuessList()) != r.Attempts {
+				t.Errorf("%s: round %d records %d guesses for %d attempts", userID, r.ID, len(r.GuessList()), r.Attempts)
+			}
+			switch r.Result {
+			case RoundWon:
+				won++
+			case RoundInProgress:
+				inProgress++
+			}
+		}
+		if attempts != guessesPerUser {
+			t.Errorf("%s: rounds record %d attempts, want %d", userID, attempts, guessesPerUser)
+		}
+		if won != wins[userID] {
+			t.Errorf("%s: %d rounds won, want %d", userID, won, wins[userID])
+		}
+		if inProgress != 1 {
+			t.Errorf("%s: %d rounds in progress, want 1", userID, inProgress)
+		}
+	}
+}
+
+func TestMemoryStoreConcurrentGuesses(t *testing.T) {
+	testConcurrentGuesses(t, newMemoryGameStore())
+}
+
+func TestMemoryStoreResetGame(t *testing.T) {
+	testResetGame(t, newMemoryGameStore())
+}
+
+// testResetGame 重置后计数清零、进行中的对局被放弃，之后的猜测开启新的一局
+func testResetGame(t *testing.T, s GameStore) {
+	t.Helper()
+	if _, err := s.ResetGame("nobody"); err != errGameNotFound {
+		t.Fatalf("reset unknown user: %v, want errGameNotFound", err)
+	}
+	user := User{ID: "reset-user"}
+	for i := 0; i < 3; i++ {
+		if _, err := s.SubmitGuess(context.Background(), user, "hard", 0); err != nil {
+			t.Fatalf("guess: %v", err)
+		}
+	}
+	abandoned, err := s.ResetGame(user.ID)
+	if err != nil || abandoned != 1 {
+		t.Fatalf("reset: abandoned %d, %v; want 1", abandoned, err)
+	}
+	game, err := s.GetOrCreateGame(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if game.Attempts != 0 || game.CorrectGuesses != 0 {
+		t.Fatalf("counters not cleared: %+v", game)
+	}
+	out, err := s.SubmitGuess(context.Background(), user, "", 0)
+	if err != nil {
+		t.Fatalf("guess after reset: %v", err)
+	}
+	if out.Round.Attempts != 1 || out.Game.Attempts != 1 {
+		t.Fatalf("guess after reset continued the abandoned round: %+v", out.Round)
+	}
+}
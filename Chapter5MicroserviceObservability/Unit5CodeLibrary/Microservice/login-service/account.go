@@ -0,0 +1,436 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap"
+)
+
+/* ----------------- 找回密码与邮箱验证 ----------------- */
+
+// 重置密码与验证邮箱使用一次性令牌：令牌只以 SHA-256 摘要保存，使用后或过期即失效，
+// 同一用户签发新令牌时旧的同类令牌作废。重置密码成功后吊销该用户的全部会话。
+const (
+	purposePasswordReset = "password_reset"
+	purposeEmailVerify   = "email_verify"
+
+	defaultPasswordResetTTL = 30 * time.Minute
+	defaultEmailVerifyTTL   = 24 * time.Hour
+)
+
+var (
+	errTokenInvalid = errors.New("token invalid")
+	errInvalidEmail = errors.New("invalid email")
+)
+
+// UserToken 一次性令牌
+type UserToken struct {
+	ID        string     `gorm:"column:ID;primary_key"`
+	UserID    string     `gorm:"column:UserID;not null"`
+	Purpose   string     `gorm:"column:Purpose;not null"`
+	TokenHash string     `gorm:"column:TokenHash;not null"`
+	Email     string     `gorm:"column:Email"` // 验证邮箱令牌对应的地址，邮箱变更后旧令牌不再生效
+	ExpiresAt time.Time  `gorm:"column:ExpiresAt"`
+	UsedAt    *time.Time `gorm:"column:UsedAt"`
+	CreatedAt time.Time  `gorm:"column:CreatedAt"`
+}
+
+func (UserToken) TableName() string { return "user_tokens" }
+
+// UserTokenStore 一次性令牌存储
+type UserTokenStore interface {
+	// Create 保存新令牌，并作废该用户同一用途的未使用令牌
+	Create(t *UserToken) error
+	// Consume 校验并标记令牌已使用，令牌不存在、已使用或已过期时返回 errTokenInvalid
+	Consume(purpose, hash string, now time.Time) (*UserToken, error)
+	// Find 查询有效令牌但不标记使用，错误语义同 Consume
+	Find(purpose, hash string, now time.Time) (*UserToken, error)
+	// ConsumeAndSave 在同一事务中标记令牌已使用并保存用户；令牌已被使用或已过期时不保存，返回 errTokenInvalid
+	ConsumeAndSave(t *UserToken, user *User, now time.Time) error
+	// DeleteExpired 删除已过期的令牌
+	DeleteExpired(before time.Time) (int64, error)
+}
+
+var userTokens UserTokenStore
+
+// normalizeEmail 校验并规范化邮箱地址，空字符串表示未填写
+func normalizeEmail(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", nil
+	}
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Address != s {
+		return "", errInvalidEmail
+	}
+	return strings.ToLower(addr.Address), nil
+}
+
+// accountLink 生成邮件中的前端链接，基础地址取 ACCOUNT_LINK_BASE_URL。
+// front-guess 使用 hash 路由，链接形如 <base>/#/reset-password?token=…，由前端页面再 POST 到接口
+func accountLink(path, token string) string {
+	base := os.Getenv("ACCOUNT_LINK_BASE_URL")
+	if base == "" {
+		base = "http://micro.roliyal.com"
+	}
+	return strings.TrimRight(base, "/") + "/#" + path + "?token=" + url.QueryEscape(token)
+}
+
+// issueUserToken 签发一次性令牌，返回明文令牌
+func issueUserToken(user *User, purpose string, ttl time.Duration) (string, error) {
+	token, err := generateAuthToken()
+	if err != nil {
+		return "", err
+	}
+	id, err := generateRandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	t := &UserToken{
+		ID:        id,
+		UserID:    user.ID,
+		Purpose:   purpose,
+		TokenHash: hashToken(token),
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+	if user.Email != nil {
+		t.Email = *user.Email
+	}
+	return token, userTokens.Create(t)
+}
+
+// sendVerificationEmail 为用户当前邮箱签发验证令牌并发送邮件
+func sendVerificationEmail(user *User) error {
+	token, err := issueUserToken(user, purposeEmailVerify, envDuration("EMAIL_VERIFY_TTL", defaultEmailVerifyTTL))
+	if err != nil {
+		return err
+	}
+	sendMailAsync(MailMessage{
+		To:      *user.Email,
+		Subject: "验证你的邮箱",
+		Body: fmt.Sprintf("%s，你好：\n\n请打开以下链接验证邮箱：\n%s\n\n如果不是你本人操作，请忽略此邮件。\n",
+			user.Username, accountLink("/verify-email", token)),
+	})
+	return nil
+}
+
+type (
+	forgotPasswordRequest struct {
+		Username string `json:"username"`
+		Email    string `json:"email"`
+	}
+	resetPasswordRequest struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	verifyEmailRequest struct {
+		Token string `json:"token"`
+	}
+)
+
+// 申请重置密码：按用户名或邮箱查找账号，向已验证的邮箱发送重置链接。
+// 无论账号是否存在都返回 202，避免被用来探测账号
+func forgotPasswordHandler(c *gin.Context) {
+	var req forgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Username == "" && req.Email == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "username or email required"})
+		return
+	}
+	accepted := gin.H{"success": true}
+
+	var user *User
+	var err error
+	if req.Username != "" {
+		user, err = users.FindByUsername(req.Username)
+	} else {
+		var email string
+		if email, err = normalizeEmail(req.Email); err == nil {
+			user, err = users.FindByEmail(email)
+		}
+	}
+	if err != nil {
+		if err != errUserNotFound && err != errInvalidEmail {
+			logger.Error("DB error", zap.Error(err))
+		}
+		c.JSON(http.StatusAccepted, accepted)
+		return
+	}
+	if user.Email == nil || user.EmailVerifiedAt == nil {
+		logger.Info("Password reset skipped, no verified email", zap.String("userID", user.ID))
+		c.JSON(http.StatusAccepted, accepted)
+		return
+	}
+
+	token, err := issueUserToken(user, purposePasswordReset, envDuration("PASSWORD_RESET_TTL", defaultPasswordResetTTL))
+	if err != nil {
+		logger.Error("Reset token error", zap.String("userID", user.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "token error"})
+		return
+	}
+	sendMailAsync(MailMessage{
+		To:      *user.Email,
+		Subject: "重置密码",
+		Body: fmt.Sprintf("%s，你好：\n\n请在 %s 内打开以下链接重置密码：\n%s\n\n如果不是你本人操作，请忽略此邮件。\n",
+			user.Username, envDuration("PASSWORD_RESET_TTL", defaultPasswordResetTTL), accountLink("/reset-password", token)),
+	})
+	logger.Info("Password reset requested", zap.String("userID", user.ID))
+	c.JSON(http.StatusAccepted, accepted)
+}
+
+// 重置密码：校验一次性令牌后设置新密码，并吊销该用户的全部会话。
+// 新密码不符合规则时令牌保持有效，用户可以换一个密码重试；令牌与新密码在同一事务中生效
+func resetPasswordHandler(c *gin.Context) {
+	var req resetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Token == "" || req.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token and password required"})
+		return
+	}
+
+	t, err := userTokens.Find(purposePasswordReset, hashToken(req.Token), time.Now())
+	if err != nil {
+		respondTokenError(c, err)
+		return
+	}
+	user, err := users.FindByID(t.UserID)
+	if err != nil {
+		respondTokenError(c, err)
+		return
+	}
+	var verrs validationErrors
+	if policy.validatePassword(req.Password, user.Username, &verrs); len(verrs) > 0 {
+		respondValidation(c, verrs)
+		return
+	}
+	hash, err := passwordHasher.Hash(req.Password)
+	if err != nil {
+		logger.Error("Password hash error", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "hash error"})
+		return
+	}
+	user.Password = hash
+	if err = userTokens.ConsumeAndSave(t, user, time.Now()); err != nil {
+		if err == errTokenInvalid {
+			respondTokenError(c, err)
+			return
+		}
+		logger.Error("DB error", zap.String("userID", user.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	if _, err = sessions.RevokeAll(user.ID, time.Now()); err != nil {
+		logger.Error("Session revoke error", zap.String("userID", user.ID), zap.Error(err))
+	}
+	limiter.Succeed(user.Username)
+	logger.Info("Password reset", zap.String("userID", user.ID))
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// 验证邮箱：令牌须对应用户当前的邮箱地址
+func verifyEmailHandler(c *gin.Context) {
+	var req verifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token required"})
+		return
+	}
+
+	now := time.Now()
+	t, err := userTokens.Consume(purposeEmailVerify, hashToken(req.Token), now)
+	if err != nil {
+		respondTokenError(c, err)
+		return
+	}
+	user, err := users.FindByID(t.UserID)
+	if err != nil {
+		respondTokenError(c, err)
+		return
+	}
+	if user.Email == nil || *user.Email != t.Email {
+		respondTokenError(c, errTokenInvalid)
+		return
+	}
+	user.EmailVerifiedAt = &now
+	if err = users.Save(user); err != nil {
+		logger.Error("DB error", zap.String("userID", user.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	logger.Info("Email verified", zap.String("userID", user.ID))
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+func respondTokenError(c *gin.Context, err error) {
+	if err == errTokenInvalid || err == errUserNotFound {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired token"})
+		return
+	}
+	logger.Error("Token lookup error", zap.Error(err))
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+}
+
+/* ----------------- gorm 实现 ----------------- */
+
+type sqlUserTokenStore struct {
+	db *gorm.DB
+}
+
+func (s *sqlUserTokenStore) Create(t *UserToken) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&UserToken{}).
+			Where("UserID = ? AND Purpose = ? AND UsedAt IS NULL", t.UserID, t.Purpose).
+			Update("UsedAt", t.CreatedAt).Error; err != nil {
+			return err
+		}
+		return tx.Create(t).Error
+	})
+}
+
+func (s *sqlUserTokenStore) Consume(purpose, hash string, now time.Time) (*UserToken, error) {
+	var t UserToken
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("TokenHash = ? AND Purpose = ?", hash, purpose).First(&t).Error; err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				return errTokenInvalid
+			}
+			return err
+		}
+		if t.UsedAt != nil || !now.Before(t.ExpiresAt) {
+			return errTokenInvalid
+		}
+		// 条件更新保证并发使用同一令牌时只有一个成功
+		res := tx.Model(&UserToken{}).Where("ID = ? AND UsedAt IS NULL", t.ID).Update("UsedAt", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errTokenInvalid
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (s *sqlUserTokenStore) Find(purpose, hash string, now time.Time) (*UserToken, error) {
+	var t UserToken
+	if err := s.db.Where("TokenHash = ? AND Purpose = ?", hash, purpose).First(&t).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, errTokenInvalid
+		}
+		return nil, err
+	}
+	if t.UsedAt != nil || !now.Before(t.ExpiresAt) {
+		return nil, errTokenInvalid
+	}
+	return &t, nil
+}
+
+func (s *sqlUserTokenStore) ConsumeAndSave(t *UserToken, user *User, now time.Time) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&UserToken{}).Where("ID = ? AND UsedAt IS NULL AND ExpiresAt > ?", t.ID, now).Update("UsedAt", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errTokenInvalid
+		}
+		return tx.Save(user).Error
+	})
+}
+
+func (s *sqlUserTokenStore) DeleteExpired(before time.Time) (int64, error) {
+	res := s.db.Where("ExpiresAt < ?", before).Delete(&UserToken{})
+	return res.RowsAffected, res.Error
+}
+
+/* ----------------- 内存实现 ----------------- */
+
+type memoryUserTokenStore struct {
+	mu     sync.Mutex
+	byHash map[string]*UserToken
+	users  UserStore // ConsumeAndSave 保存用户的存储
+}
+
+func newMemoryUserTokenStore(users UserStore) *memoryUserTokenStore {
+	return &memoryUserTokenStore{byHash: make(map[string]*UserToken), users: users}
+}
+
+func (s *memoryUserTokenStore) Create(t *UserToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, old := range s.byHash {
+		if old.UserID == t.UserID && old.Purpose == t.Purpose && old.UsedAt == nil {
+			at := t.CreatedAt
+			old.UsedAt = &at
+		}
+	}
+	cp := *t
+	s.byHash[cp.TokenHash] = &cp
+	return nil
+}
+
+func (s *memoryUserTokenStore) Consume(purpose, hash string, now time.Time) (*UserToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.byHash[hash]
+	if !ok || t.Purpose != purpose || t.UsedAt != nil || !now.Before(t.ExpiresAt) {
+		return nil, errTokenInvalid
+	}
+	at := now
+	t.UsedAt = &at
+	cp := *t
+	return &cp, nil
+}
+
+func (s *memoryUserTokenStore) Find(purpose, hash string, now time.Time) (*UserToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.byHash[hash]
+	if !ok || t.Purpose != purpose || t.UsedAt != nil || !now.Before(t.ExpiresAt) {
+		return nil, errTokenInvalid
+	}
+	cp := *t
+	return &cp, nil
+}
+
+// ConsumeAndSave 持锁保存用户，保存失败时令牌保持未使用
+func (s *memoryUserTokenStore) ConsumeAndSave(t *UserToken, user *User, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cur, ok := s.byHash[t.TokenHash]
+	if !ok || cur.ID != t.ID || cur.UsedAt != nil || !now.Before(cur.ExpiresAt) {
+		return errTokenInvalid
+	}
+	if err := s.users.Save(user); err != nil {
+		return err
+	}
+	at := now
+	cur.UsedAt = &at
+	return nil
+}
+
+func (s *memoryUserTokenStore) DeleteExpired(before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for hash, t := range s.byHash {
+		if t.ExpiresAt.Before(before) {
+			delete(s.byHash, hash)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func postResetPassword(t *testing.T, token, password string) int {
+	t.Helper()
+	body, _ := json.Marshal(resetPasswordRequest{Token: token, Password: password})
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/password/reset", resetPasswordHandler)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/password/reset", bytes.NewReader(body)))
+	return w.Code
+}
+
+func TestResetPasswordKeepsTokenOnPolicyFailure(t *testing.T) {
+	useMemoryStores(t)
+	user := &User{ID: "u1", Username: "alice", Password: "old-hash"}
+	if err := users.Create(user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	token, err := issueUserToken(user, purposePasswordReset, time.Hour)
+	if err != nil {
+		t.Fatalf("issue token: %v", err)
+	}
+
+	// 不符合密码规则：令牌不应被使用，密码不变
+	if code := postResetPassword(t, token, "short"); code != http.StatusBadRequest {
+		t.Fatalf("weak password: status %d, want 400", code)
+	}
+	if _, err := userTokens.Find(purposePasswordReset, hashToken(token), time.Now()); err != nil {
+		t.Fatalf("token consumed by a rejected password: %v", err)
+	}
+	if got, _ := users.FindByID(user.ID); got.Password != "old-hash" {
+		t.Fatal("password changed by a rejected request")
+	}
+
+	const password = "Correct-Horse-9"
+	if code := postResetPassword(t, token, password); code != http.StatusOK {
+		t.Fatalf("reset: status %d, want 200", code)
+	}
+	got, _ := users.FindByID(user.ID)
+	if ok, err := passwordHasher.Verify(got.Password, password); err != nil || !ok {
+		t.Fatalf("new password not stored: %v", err)
+	}
+
+	// 令牌只能使用一次
+	if code := postResetPassword(t, token, "Another-Pass-7"); code != http.StatusBadRequest {
+		t.Fatalf("reused token: status %d, want 400", code)
+	}
+}
+
+func TestConsumeAndSaveIsSingleUse(t *testing.T) {
+	for _, driver := range []string{driverMemory, driverSQLite} {
+		t.Run(driver, func(t *testing.T) {
+			t.Setenv("STORE_DRIVER", driver)
+			set, err := openStores(DBConfig{DBDriver: driver, DBPath: filepath.Join(t.TempDir(), "login.db")})
+			if err != nil {
+				t.Fatalf("open stores: %v", err)
+			}
+			defer set.users.Close()
+
+			user := &User{ID: "u1", Username: "alice", Password: "old-hash"}
+			if err := set.users.Create(user); err != nil {
+				t.Fatalf("create user: %v", err)
+			}
+			now := time.Now()
+			tok := &UserToken{ID: "t1", UserID: user.ID, Purpose: purposePasswordReset, TokenHash: hashToken("secret"),
+				ExpiresAt: now.Add(time.Hour), CreatedAt: now}
+			if err := set.tokens.Create(tok); err != nil {
+				t.Fatalf("create token: %v", err)
+			}
+
+			first, second := *user, *user
+			first.Password, second.Password = "first", "second"
+			if err := set.tokens.ConsumeAndSave(tok, &first, now); err != nil {
+				t.Fatalf("first consume: %v", err)
+			}
+			if err := set.tokens.ConsumeAndSave(tok, &second, now); err != errTokenInvalid {
+				t.Fatalf("second consume: %v, want errTokenInvalid", err)
+			}
+			if got, _ := set.users.FindByID(user.ID); got.Password != "first" {
+				t.Fatalf("password %q saved by a spent token", got.Password)
+			}
+			if _, err := set.tokens.Find(purposePasswordReset, tok.TokenHash, now); err != errTokenInvalid {
+				t.Fatalf("find spent token: %v, want errTokenInvalid", err)
+			}
+		})
+	}
+}
+
+func TestAccountLinkUsesHashRoute(t *testing.T) {
+	t.Setenv("ACCOUNT_LINK_BASE_URL", "https://guess.example.com/")
+	if got, want := accountLink("/reset-password", "a+b"), "https://guess.example.com/#/reset-password?token=a%2Bb"; got != want {
+		t.Fatalf("link %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// 管理接口：/admin/** 仅限 admin 角色，角色每次从存储读取，收回后立即生效。
+// 每个管理操作都输出 audit=admin_action 的审计日志，记录操作者、目标用户与结果。
+
+const (
+	defaultAdminPageSize = 20
+	maxAdminPageSize     = 100
+)
+
+// adminUserView 管理接口中的用户信息，不含密码与两步验证密钥
+type adminUserView struct {
+	ID            string     `json:"id"`
+	Username      string     `json:"username"`
+	Email         *string    `json:"email,omitempty"`
+	EmailVerified bool       `json:"emailVerified"`
+	TOTPEnabled   bool       `json:"totpEnabled"`
+	DisabledAt    *time.Time `json:"disabledAt,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	Roles         []string   `json:"roles"`
+}
+
+func newAdminUserView(u *User, roles []string) adminUserView {
+	if roles == nil {
+		roles = []string{}
+	}
+	return adminUserView{
+		ID:            u.ID,
+		Username:      u.Username,
+		Email:         u.Email,
+		EmailVerified: u.EmailVerifiedAt != nil,
+		TOTPEnabled:   u.TOTPEnabledAt != nil,
+		DisabledAt:    u.DisabledAt,
+		CreatedAt:     u.CreatedAt,
+		Roles:         roles,
+	}
+}
+
+// auditAdminAction 输出管理操作审计记录
+func auditAdminAction(actor, ip, action, target string, fields ...zap.Field) {
+	logger.Info("admin action", append([]zap.Field{
+		zap.String("audit", "admin_action"),
+		zap.String("action", action),
+		zap.String("actor", actor),
+		zap.String("target", target),
+		zap.String("client_ip", ip),
+	}, fields...)...)
+}
+
+// requireAdmin 校验会话且当前用户拥有 admin 角色
+func requireAdmin(c *gin.Context) (*Session, bool) {
+	sess, ok := requireSession(c)
+	if !ok {
+		return nil, false
+	}
+	admin, err := hasRole(sess.UserID, roleAdmin)
+	if err != nil {
+		logger.Error("Role lookup error", zap.String("userID", sess.UserID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return nil, false
+	}
+	if !admin {
+		logger.Warn("Admin access denied", zap.String("userID", sess.UserID), zap.String("path", c.FullPath()))
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+		return nil, false
+	}
+	return sess, true
+}
+
+// adminTarget 读取路径中的目标用户
+func adminTarget(c *gin.Context) (*User, bool) {
+	user, err := users.FindByID(c.Param("id"))
+	if err == errUserNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return nil, false
+	} else if err != nil {
+		logger.Error("DB error", zap.String("userID", c.Param("id")), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return nil, false
+	}
+	return user, true
+}
+
+// 用户列表：?q= 按用户名前缀过滤，?page= / ?pageSize= 分页
+func adminListUsersHandler(c *gin.Context) {
+	sess, ok := requireAdmin(c)
+	if !ok {
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	size, _ := strconv.Atoi(c.DefaultQuery("pageSize", strconv.Itoa(defaultAdminPageSize)))
+	if size < 1 || size > maxAdminPageSize {
+		size = defaultAdminPageSize
+	}
+	prefix := strings.TrimSpace(c.Query("q"))
+
+	list, total, err := users.List(prefix, (page-1)*size, size)
+	if err != nil {
+		logger.Error("User list error", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	views := make([]adminUserView, 0, len(list))
+	for i := range list {
+		roles, err := userRoles.RolesOf(list[i].ID)
+		if err != nil {
+			logger.Error("Role lookup error", zap.String("userID", list[i].ID), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+		views = append(views, newAdminUserView(&list[i], roles))
+	}
+	auditAdminAction(sess.UserID, c.ClientIP(), "list_users", "", zap.String("q", prefix), zap.Int("page", page))
+	c.JSON(http.StatusOK, gin.H{"users": views, "total": total, "page": page, "pageSize": size})
+}
+
+// 可授予的角色
+func adminListRolesHandler(c *gin.Context) {
+	if _, ok := requireAdmin(c); !ok {
+		return
+	}
+	roles, err := userRoles.Roles()
+	if err != nil {
+		logger.Error("Role list error", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+type disableUserRequest struct {
+	Reason string `json:"reason"`
+}
+
+// 停用账号：拒绝后续登录与刷新，并吊销全部会话；已签发的访问令牌在过期前仍可被其他服务接受
+func adminDisableUserHandler(c *gin.Context) {
+	sess, ok := requireAdmin(c)
+	if !ok {
+		return
+	}
+	var req disableUserRequest
+	_ = c.ShouldBindJSON(&req)
+	user, ok := adminTarget(c)
+	if !ok {
+		return
+	}
+	if user.ID == sess.UserID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot disable yourself"})
+		return
+	}
+
+	// 只更新 DisabledAt 列，避免与同时进行的登录（重新哈希密码）互相覆盖
+	if user.DisabledAt == nil {
+		now := time.Now()
+		user.DisabledAt = &now
+		if err := users.SetDisabledAt(user.ID, &now); err != nil {
+			logger.Error("DB error", zap.String("userID", user.ID), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+	}
+	n, err := sessions.RevokeAll(user.ID, time.Now())
+	if err != nil {
+		logger.Error("Session revoke error", zap.String("userID", user.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	auditAdminAction(sess.UserID, c.ClientIP(), "disable_user", user.ID,
+		zap.String("username", user.Username), zap.String("reason", req.Reason), zap.Int64("revokedSessions", n))
+	c.JSON(http.StatusOK, gin.H{"success": true, "revoked": n})
+}
+
+// 恢复账号
+func adminEnableUserHandler(c *gin.Context) {
+	sess, ok := requireAdmin(c)
+	if !ok {
+		return
+	}
+	user, ok := adminTarget(c)
+	if !ok {
+		return
+	}
+	if user.DisabledAt != nil {
+		user.DisabledAt = nil
+		if err := users.SetDisabledAt(user.ID, nil); err != nil {
+			logger.Error("DB error", zap.String("userID", user.ID), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+	}
+	auditAdminAction(sess.UserID, c.ClientIP(), "enable_user", user.ID, zap.String("username", user.Username))
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// 授予角色，新角色在用户下次登录或刷新令牌后写入访问令牌
+func adminGrantRoleHandler(c *gin.Context) {
+	sess, ok := requireAdmin(c)
+	if !ok {
+		return
+	}
+	user, ok := adminTarget(c)
+	if !ok {
+		return
+	}
+	role := c.Param("role")
+	switch err := userRoles.Grant(user.ID, role, sess.UserID, time.Now()); err {
+	case nil:
+	case errUnknownRole:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown role"})
+		return
+	default:
+		logger.Error("Role grant error", zap.String("userID", user.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	auditAdminAction(sess.UserID, c.ClientIP(), "role_grant", user.ID, zap.String("role", role))
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// 收回角色；管理员不能收回自己的 admin，避免误操作后无人可管理
+func adminRevokeRoleHandler(c *gin.Context) {
+	sess, ok := requireAdmin(c)
+	if !ok {
+		return
+	}
+	user, ok := adminTarget(c)
+	if !ok {
+		return
+	}
+	role := c.Param("role")
+	if user.ID == sess.UserID && role == roleAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot revoke your own admin role"})
+		return
+	}
+	if err := userRoles.Revoke(user.ID, role); err != nil {
+		logger.Error("Role revoke error", zap.String("userID", user.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	auditAdminAction(sess.UserID, c.ClientIP(), "role_revoke", user.ID, zap.String("role", role))
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nacos-group/nacos-sdk-go/vo"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// 热更新配置：每个 Nacos DataId 启动时读取一次，之后通过 ListenConfig 监听变更。
+// 新内容先解析、校验，通过后才替换当前配置；校验失败时保留上一次生效的配置并记录为 rejected。
+// 各 DataId 的版本（成功应用次数与内容 MD5）和最近一次应用结果可通过 GET /admin/config 查看。
+//
+//   - Prod_DATABASE：数据库连接与连接池，变更后整体替换连接池（仅 mysql 驱动），见 dbpool.go
+//   - Login_RUNTIME：日志级别、CORS 来源与功能开关，格式见 runtimeConfig
+
+const configGroup = "DEFAULT_GROUP"
+
+// 配置应用结果
+const (
+	configApplied  = "applied"
+	configRejected = "rejected"
+	configMissing  = "missing" // Nacos 中未配置，使用默认值
+)
+
+var (
+	errConfigMissing = errors.New("config not found in nacos")
+	errNacosDisabled = errors.New("nacos not configured")
+)
+
+// configStatus 某个 DataId 的版本与最近一次应用结果
+type configStatus struct {
+	DataID      string     `json:"dataId"`
+	Group       string     `json:"group"`
+	Status      string     `json:"status"`
+	Version     int        `json:"version"`       // 成功应用的次数
+	MD5         string     `json:"md5,omitempty"` // 当前生效内容的 MD5，与 Nacos 控制台一致
+	AppliedAt   *time.Time `json:"appliedAt,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+	RejectedMD5 string     `json:"rejectedMd5,omitempty"`
+	RejectedAt  *time.Time `json:"rejectedAt,omitempty"`
+}
+
+// configSource 一个被监听的 DataId；apply 解析校验并应用新内容，返回错误时不得改动当前配置
+type configSource struct {
+	dataID string
+	apply  func(content string) error
+
+	mu     sync.Mutex // 串行应用，SDK 回调与启动加载不会交错
+	status configStatus
+}
+
+var (
+	configSourcesMu sync.Mutex
+	configSources   []*configSource
+)
+
+/* ----------------- 监听与应用 ----------------- */
+
+// watchConfig 读取并应用 DataId 的当前内容，然后监听后续变更。
+// 返回首次加载的结果：Nacos 中未配置时返回 errConfigMissing，未配置 Nacos 时返回 errNacosDisabled，
+// 由调用方决定是否使用默认值
+func watchConfig(dataID string, apply func(content string) error) error {
+	s := &configSource{dataID: dataID, apply: apply, status: configStatus{DataID: dataID, Group: configGroup}}
+	configSourcesMu.Lock()
+	configSources = append(configSources, s)
+	configSourcesMu.Unlock()
+
+	if ConfigClient == nil {
+		// 未配置 nacos：记录为 missing，由调用方使用默认值
+		s.mu.Lock()
+		s.status.Status = configMissing
+		s.status.LastError = errNacosDisabled.Error()
+		s.mu.Unlock()
+		return errNacosDisabled
+	}
+
+	content, err := ConfigClient.GetConfig(vo.ConfigParam{DataId: dataID, Group: configGroup})
+	if err == nil && content == "" {
+		err = errConfigMissing
+	}
+	if err != nil {
+		s.mu.Lock()
+		s.status.Status = configMissing
+		s.status.LastError = err.Error()
+		s.mu.Unlock()
+	} else {
+		err = s.update(content)
+	}
+
+	if lerr := ConfigClient.ListenConfig(vo.ConfigParam{
+		DataId: dataID,
+		Group:  configGroup,
+		OnChange: func(namespace, group, dataId, data string) {
+			_ = s.update(data)
+		},
+	}); lerr != nil {
+		logger.Error("listen config", zap.String("dataId", dataID), zap.Error(lerr))
+	}
+	return err
+}
+
+// update 应用一次新内容并记录结果
+func (s *configSource) update(content string) error {
+	sum := md5.Sum([]byte(content))
+	version := hex.EncodeToString(sum[:])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status.Status == configApplied && version == s.status.MD5 {
+		return nil
+	}
+	err := errConfigMissing
+	if content != "" {
+		err = s.apply(content)
+	}
+	now := time.Now()
+	if err != nil {
+		s.status.Status = configRejected
+		s.status.LastError = err.Error()
+		s.status.RejectedMD5 = version
+		s.status.RejectedAt = &now
+		logger.Error("config rejected, keeping previous config",
+			zap.String("dataId", s.dataID), zap.String("md5", version),
+			zap.String("current", s.status.MD5), zap.Error(err))
+		return err
+	}
+	s.status.Status = configApplied
+	s.status.Version++
+	s.status.MD5 = version
+	s.status.AppliedAt = &now
+	s.status.LastError = ""
+	logger.Info("config applied", zap.String("dataId", s.dataID), zap.String("md5", version), zap.Int("version", s.status.Version))
+	return nil
+}
+
+// configStatuses 全部 DataId 的状态，按 DataId 排序
+func configStatuses() []configStatus {
+	configSourcesMu.Lock()
+	sources := append([]*configSource(nil), configSources...)
+	configSourcesMu.Unlock()
+
+	list := make([]configStatus, 0, len(sources))
+	for _, s := range sources {
+		s.mu.Lock()
+		list = append(list, s.status)
+		s.mu.Unlock()
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].DataID < list[j].DataID })
+	return list
+}
+
+/* ----------------- 运行时配置 ----------------- */
+
+// 功能开关及默认值；配置中出现未知开关视为无效配置
+const featureRegistration = "registration" // 关闭后 /register 拒绝新用户注册
+
+var defaultFeatures = map[string]bool{
+	featureRegistration: true,
+}
+
+var defaultCORSOrigins = []string{"http://micro.roliyal.com"}
+
+// runtimeConfig Login_RUNTIME 的内容，字段均可省略，省略时使用默认值：
+//
+//	{"logLevel": "info", "corsOrigins": ["http://micro.roliyal.com"], "features": {"registration": true}}
+type runtimeConfig struct {
+	LogLevel    string          `json:"logLevel"` // debug / info / warn / error，默认取 LOG_LEVEL
+	CORSOrigins []string        `json:"corsOrigins"`
+	Features    map[string]bool `json:"features"`
+
+	level zapcore.Level
+}
+
+var currentRuntime atomic.Pointer[runtimeConfig]
+
+// runtimeSettings 当前生效的运行时配置
+func runtimeSettings() *runtimeConfig {
+	if rc := currentRuntime.Load(); rc != nil {
+		return rc
+	}
+	rc, _ := parseRuntimeConfig("{}")
+	return rc
+}
+
+// parseRuntimeConfig 解析、校验并补全默认值
+func parseRuntimeConfig(content string) (*runtimeConfig, error) {
+	var rc runtimeConfig
+	dec := json.NewDecoder(strings.NewReader(content))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&rc); err != nil {
+		return nil, fmt.Errorf("parse runtime config: %w", err)
+	}
+
+	if rc.LogLevel == "" {
+		// 未配置时沿用启动时的 LOG_LEVEL，无法识别的值按 info 处理
+		rc.level, _ = parseLogLevel(os.Getenv("LOG_LEVEL"))
+	} else {
+		level, err := parseLogLevel(rc.LogLevel)
+		if err != nil {
+			return nil, err
+		}
+		rc.level = level
+	}
+	rc.LogLevel = rc.level.String()
+
+	if len(rc.CORSOrigins) == 0 {
+		rc.CORSOrigins = defaultCORSOrigins
+	}
+	for _, o := range rc.CORSOrigins {
+		if err := validateOrigin(o); err != nil {
+			return nil, err
+		}
+	}
+
+	features := make(map[string]bool, len(defaultFeatures))
+	for name, on := range defaultFeatures {
+		features[name] = on
+	}
+	for name, on := range rc.Features {
+		if _, ok := defaultFeatures[name]; !ok {
+			return nil, fmt.Errorf("unknown feature flag %q", name)
+		}
+		features[name] = on
+	}
+	rc.Features = features
+	return &rc, nil
+}
+
+// parseLogLevel 空值为 info
+func parseLogLevel(s string) (zapcore.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "info":
+		return zap.InfoLevel, nil
+	case "debug":
+		return zap.DebugLevel, nil
+	case "warn":
+		return zap.WarnLevel, nil
+	case "error":
+		return zap.ErrorLevel, nil
+	default:
+		return zap.InfoLevel, fmt.Errorf("unknown log level %q", s)
+	}
+}
+
+// validateOrigin 来源须为 scheme://host[:port]；允许携带凭据，因此不接受 *
+func validateOrigin(origin string) error {
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+		(u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+		return fmt.Errorf("invalid CORS origin %q", origin)
+	}
+	return nil
+}
+
+// applyRuntimeConfig 校验通过后一次性替换运行时配置与日志级别
+func applyRuntimeConfig(content string) error {
+	rc, err := parseRuntimeConfig(content)
+	if err != nil {
+		return err
+	}
+	currentRuntime.Store(rc)
+	logLevel.SetLevel(rc.level)
+	return nil
+}
+
+// initRuntimeConfig 加载并监听 Login_RUNTIME，未配置或无效时使用默认值
+func initRuntimeConfig() {
+	if err := watchConfig("Login_RUNTIME", applyRuntimeConfig); err != nil {
+		logger.Warn("using default runtime config", zap.String("dataId", "Login_RUNTIME"), zap.Error(err))
+	}
+}
+
+// allowsOrigin 供 CORS 中间件按当前配置判断来源
+func allowsOrigin(origin string) bool {
+	origin = strings.TrimSuffix(origin, "/")
+	for _, o := range runtimeSettings().CORSOrigins {
+		if strings.TrimSuffix(o, "/") == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// featureEnabled 读取功能开关
+func featureEnabled(name string) bool {
+	return runtimeSettings().Features[name]
+}
+
+/* ----------------- 管理接口 ----------------- */
+
+// 各 DataId 的版本、应用结果与当前生效的配置（不含数据库密码）
+func adminConfigHandler(c *gin.Context) {
+	if _, ok := requireAdmin(c); !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"sources":  configStatuses(),
+		"runtime":  runtimeSettings(),
+		"database": databaseSettings(),
+	})
+}
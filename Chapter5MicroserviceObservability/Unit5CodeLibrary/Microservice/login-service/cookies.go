@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"microservice/pkg/auth"
+)
+
+// 浏览器 Cookie 与 CSRF：
+//   - Cookie 属性：COOKIE_SECURE（默认 false，HTTPS 部署时应开启）、COOKIE_SAMESITE（lax 默认 / strict / none，
+//     none 要求 COOKIE_SECURE=true）、COOKIE_DOMAIN（默认不设置，仅当前主机）
+//   - CSRF 双提交：签发会话时写入可被前端读取的 XSRF-TOKEN Cookie，携带认证 Cookie 的写请求须在
+//     X-XSRF-TOKEN 头中回传相同的值（校验见 auth.CSRF，与 game-service / scoreboard-service 一致）。
+//     只用 Authorization 头、不带认证 Cookie 的调用方不受影响。
+
+const (
+	csrfCookie = auth.CSRFCookie
+	csrfHeader = auth.CSRFHeader
+)
+
+// cookiePolicy Cookie 属性
+type cookiePolicy struct {
+	secure   bool
+	sameSite http.SameSite
+	domain   string
+}
+
+var cookieAttrs = &cookiePolicy{sameSite: http.SameSiteLaxMode}
+
+// initCookiePolicy 从环境变量加载 Cookie 属性，配置无效时直接退出
+func initCookiePolicy() {
+	p, err := loadCookiePolicy()
+	if err != nil {
+		logger.Fatal("cookie policy", zap.Error(err))
+	}
+	cookieAttrs = p
+	logger.Info("cookie policy",
+		zap.Bool("secure", p.secure),
+		zap.String("sameSite", os.Getenv("COOKIE_SAMESITE")),
+		zap.String("domain", p.domain))
+}
+
+func loadCookiePolicy() (*cookiePolicy, error) {
+	p := &cookiePolicy{
+		secure: strings.EqualFold(os.Getenv("COOKIE_SECURE"), "true"),
+		domain: os.Getenv("COOKIE_DOMAIN"),
+	}
+	switch v := strings.ToLower(os.Getenv("COOKIE_SAMESITE")); v {
+	case "", "lax":
+		p.sameSite = http.SameSiteLaxMode
+	case "strict":
+		p.sameSite = http.SameSiteStrictMode
+	case "none":
+		if !p.secure {
+			return nil, fmt.Errorf("COOKIE_SAMESITE=none requires COOKIE_SECURE=true")
+		}
+		p.sameSite = http.SameSiteNoneMode
+	default:
+		return nil, fmt.Errorf("unknown COOKIE_SAMESITE %q", v)
+	}
+	return p, nil
+}
+
+// set 按配置写入 Cookie；maxAge < 0 表示删除
+func (p *cookiePolicy) set(c *gin.Context, name, value, path string, maxAge int, httpOnly bool) {
+	p.setSameSite(c, name, value, path, maxAge, httpOnly, p.sameSite)
+}
+
+// setSameSite 以指定的 SameSite 写入 Cookie，其余属性取自配置
+func (p *cookiePolicy) setSameSite(c *gin.Context, name, value, path string, maxAge int, httpOnly bool, sameSite http.SameSite) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   p.domain,
+		MaxAge:   maxAge,
+		Secure:   p.secure,
+		HttpOnly: httpOnly,
+		SameSite: sameSite,
+	})
+}
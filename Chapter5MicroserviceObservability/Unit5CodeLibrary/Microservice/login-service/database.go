@@ -1,55 +1,62 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
 	"time"
 
-	"github.com/jinzhu/gorm"
-	_ "github.com/jinzhu/gorm/dialects/mysql"
 	"github.com/joho/godotenv"
 	"github.com/nacos-group/nacos-sdk-go/clients"
 	"github.com/nacos-group/nacos-sdk-go/common/constant"
-	"github.com/nacos-group/nacos-sdk-go/model"
 	"github.com/nacos-group/nacos-sdk-go/vo"
 	"go.uber.org/zap"
 )
 
 /* ----------------- 数据模型 ----------------- */
 
+// User 对应 users 表，表结构见 migrations.go
 type User struct {
-	ID             string    `gorm:"column:ID;primary_key"`
-	Username       string    `gorm:"column:Username;unique;not null"`
-	Password       string    `gorm:"column:Password;not null"`
-	AuthToken      string    `gorm:"column:AuthToken;not null"`
-	Wins           int       `gorm:"column:Wins;default:0"`
-	Attempts       int       `gorm:"column:Attempts;default:0"`
-	CreatedAt      time.Time `gorm:"column:created_at;default:CURRENT_TIMESTAMP"`
-	UpdatedAt      time.Time `gorm:"column:updated_at;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP"`
-	CorrectGuesses int       `gorm:"column:correct_guesses;default:0"`
+	ID              string     `gorm:"column:ID;primary_key"`
+	Username        string     `gorm:"column:Username;unique;not null"`
+	Password        string     `gorm:"column:Password;not null"`
+	Wins            int        `gorm:"column:Wins;default:0"`
+	Attempts        int        `gorm:"column:Attempts;default:0"`
+	CreatedAt       time.Time  `gorm:"column:created_at;default:CURRENT_TIMESTAMP"`
+	UpdatedAt       time.Time  `gorm:"column:updated_at;default:CURRENT_TIMESTAMP"`
+	CorrectGuesses  int        `gorm:"column:correct_guesses;default:0"`
+	Email           *string    `gorm:"column:Email"` // 可选，注册时填写
+	EmailVerifiedAt *time.Time `gorm:"column:EmailVerifiedAt"`
+	// 两步验证：密钥在确认前 TOTPEnabledAt 为空；恢复码为空格分隔的 SHA-256 摘要
+	TOTPSecret    *string    `gorm:"column:TOTPSecret" json:"-"`
+	TOTPEnabledAt *time.Time `gorm:"column:TOTPEnabledAt"`
+	TOTPLastStep  int64      `gorm:"column:TOTPLastStep;default:0" json:"-"`
+	RecoveryCodes string     `gorm:"column:RecoveryCodes" json:"-"`
+	DisabledAt    *time.Time `gorm:"column:DisabledAt"` // 管理员停用账号后无法登录与刷新令牌
 }
 
 func (User) TableName() string { return "users" }
 
-type MaxID struct {
-	MaxID string `gorm:"max(ID)"`
-}
-
 /* ----------------- DB Config ---------------- */
 
 type DBConfig struct {
 	DBUser     string `json:"DB_USER"`
-	DBPassword string `json:"DB_PASSWORD"`
+	DBPassword string `json:"DB_PASSWORD,omitempty"`
 	DBHost     string `json:"DB_HOST"`
 	DBPort     string `json:"DB_PORT"`
 	DBName     string `json:"DB_NAME"`
+	DBDriver   string `json:"DB_DRIVER"` // mysql（默认）/ sqlite / memory
+	DBPath     string `json:"DB_PATH"`   // sqlite 数据库文件路径
+	// 连接池参数，均可省略：最大连接数（0 不限）、最大空闲连接数（默认 2）、连接最长存活时间（如 30m）
+	MaxOpenConns    string `json:"DB_MAX_OPEN_CONNS,omitempty"`
+	MaxIdleConns    string `json:"DB_MAX_IDLE_CONNS,omitempty"`
+	ConnMaxLifetime string `json:"DB_CONN_MAX_LIFETIME,omitempty"`
 }
 
-var db *gorm.DB
-var logger *zap.Logger
+var (
+	logger   *zap.Logger
+	logLevel = zap.NewAtomicLevel() // 启动时取 LOG_LEVEL，运行中可由 Login_RUNTIME 调整
+)
 
 /* ----------------- 初始化 ----------------- */
 
@@ -58,14 +65,41 @@ func init() {
 		_ = godotenv.Load(filepath.Join(wd, ".env"))
 	}
 	// 全局 logger
+	level, _ := parseLogLevel(os.Getenv("LOG_LEVEL"))
+	logLevel.SetLevel(level)
+	cfg := zap.NewProductionConfig()
+	cfg.Level = logLevel
 	var err error
-	logger, err = zap.NewProduction()
+	logger, err = cfg.Build()
 	if err != nil {
 		panic(err)
 	}
 }
 
 func initDatabase() {
+	var dbc DBConfig
+	// 非 MySQL 驱动（sqlite / memory）无需从 Nacos 获取数据库配置
+	if storeDriver("") == driverMySQL {
+		dbc = loadDBConfigFromNacos()
+	}
+
+	stores, err := openStores(dbc)
+	if err != nil {
+		logger.Fatal("open user store", zap.Error(err))
+	}
+	users, sessions, attempts, userIDs = stores.users, stores.sessions, stores.attempts, stores.ids
+	userTokens, identities, userRoles = stores.tokens, stores.idents, stores.roles
+	limiter = newLoginLimiter(attempts)
+	startSessionCleanup()
+	startLimiterCleanup()
+	logger.Info("database connected", zap.String("driver", storeDriver(dbc.DBDriver)))
+	watchDBConfig()
+}
+
+func loadDBConfigFromNacos() DBConfig {
+	if !nacosConfigured() {
+		logger.Fatal("mysql store reads Prod_DATABASE from nacos, set NACOS_SERVER_IP or STORE_DRIVER=sqlite / memory")
+	}
 	cc := constant.ClientConfig{
 		NamespaceId: os.Getenv("NACOS_NAMESPACE"),
 		TimeoutMs:   mustUint(os.Getenv("NACOS_TIMEOUT_MS")),
@@ -93,19 +127,11 @@ func initDatabase() {
 		logger.Fatal("get db config", zap.Error(err))
 	}
 
-	var dbc DBConfig
-	if err = json.Unmarshal([]byte(raw), &dbc); err != nil {
-		logger.Fatal("parse db config", zap.Error(err))
-	}
-
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8&parseTime=True&loc=Local",
-		dbc.DBUser, dbc.DBPassword, dbc.DBHost, dbc.DBPort, dbc.DBName)
-	db, err = gorm.Open("mysql", dsn)
+	dbc, err := parseDBConfig(raw)
 	if err != nil {
-		logger.Fatal("mysql open", zap.Error(err))
+		logger.Fatal("parse db config", zap.Error(err))
 	}
-	db.AutoMigrate(&User{})
-	logger.Info("database connected")
+	return dbc
 }
 
 /* ----------------- 工具函数 ----------------- */
@@ -119,35 +145,7 @@ func mustUint(s string) uint64 {
 }
 
 func closeDatabase() {
-	if db != nil {
-		_ = db.Close()
-	}
-}
-
-func getNextUserID() (string, error) {
-	var res MaxID
-	if err := db.Table("users").Select("MAX(ID) as max_id").Scan(&res).Error; err != nil {
-		return "", err
-	}
-	next := 1
-	if res.MaxID != "" {
-		cur, err := strconv.Atoi(res.MaxID)
-		if err != nil {
-			return "", err
-		}
-		next = cur + 1
-	}
-	if next > 999999 {
-		return "", fmt.Errorf("User ID exceeds 6 digits")
-	}
-	return fmt.Sprintf("%06d", next), nil
-}
-
-func getHealthyInstance(instances []model.Instance) *model.Instance {
-	for _, ins := range instances {
-		if ins.Healthy {
-			return &ins
-		}
+	if users != nil {
+		_ = users.Close()
 	}
-	return nil
 }
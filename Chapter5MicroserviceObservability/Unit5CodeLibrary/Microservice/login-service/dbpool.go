@@ -0,0 +1,128 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap"
+	"microservice/pkg/dbpool"
+	"microservice/pkg/migrate"
+)
+
+// MySQL 连接池热替换见 microservice/pkg/dbpool：gorm 持有 dbPool，Prod_DATABASE 变更时
+// 各存储无需重建；新连接池在切换前执行 login-service 的迁移
+
+var dbPool *dbpool.Pool
+
+// sqlDBOf 返回 gorm 当前使用的 *sql.DB
+func sqlDBOf(db *gorm.DB) *sql.DB {
+	if p, ok := db.CommonDB().(*dbpool.Pool); ok {
+		return p.Current()
+	}
+	return db.DB()
+}
+
+// poolConfig 连接池所需的配置
+func (dbc DBConfig) poolConfig() dbpool.Config {
+	return dbpool.Config{
+		Driver:          driverMySQL,
+		User:            dbc.DBUser,
+		Password:        dbc.DBPassword,
+		Host:            dbc.DBHost,
+		Port:            dbc.DBPort,
+		Name:            dbc.DBName,
+		MaxOpenConns:    dbc.MaxOpenConns,
+		MaxIdleConns:    dbc.MaxIdleConns,
+		ConnMaxLifetime: dbc.ConnMaxLifetime,
+	}
+}
+
+/* ----------------- 建立连接池 ----------------- */
+
+// openMySQL 建立连接池并包装为可替换的 gorm 数据源
+func openMySQL(dbc DBConfig) (*gorm.DB, error) {
+	cfg := dbc.poolConfig()
+	sqlDB, err := dbpool.Open(cfg)
+	if err != nil {
+		return nil, err
+	}
+	p := dbpool.New(sqlDB, cfg, func(err error) {
+		logger.Warn("close previous db pool", zap.Error(err))
+	})
+	gdb, err := gorm.Open("mysql", p)
+	if err != nil {
+		_ = sqlDB.Close()
+		return nil, fmt.Errorf("mysql open: %w", err)
+	}
+	dbPool = p
+	return gdb, nil
+}
+
+/* ----------------- 校验与应用 ----------------- */
+
+// parseDBConfig 解析并校验 Prod_DATABASE
+func parseDBConfig(content string) (DBConfig, error) {
+	var dbc DBConfig
+	if err := json.Unmarshal([]byte(content), &dbc); err != nil {
+		return dbc, fmt.Errorf("parse db config: %w", err)
+	}
+	if storeDriver(dbc.DBDriver) != driverMySQL {
+		return dbc, nil
+	}
+	return dbc, dbc.poolConfig().Validate()
+}
+
+// applyDBConfig 应用 Prod_DATABASE 的变更；新连接池无法建立或迁移失败时保留当前连接池
+func applyDBConfig(content string) error {
+	dbc, err := parseDBConfig(content)
+	if err != nil {
+		return err
+	}
+	if dbPool == nil {
+		return fmt.Errorf("db hot reload requires the mysql driver")
+	}
+	if storeDriver(dbc.DBDriver) != driverMySQL {
+		return fmt.Errorf("changing DB_DRIVER requires a restart")
+	}
+
+	replaced, err := dbPool.Apply(dbc.poolConfig(), func(next *sql.DB) error {
+		if !autoMigrateEnabled() {
+			return nil
+		}
+		applied, err := migrate.New(next, "mysql", "login-service", userMigrations).Up(0)
+		if err != nil {
+			return fmt.Errorf("migrate: %w", err)
+		}
+		for _, m := range applied {
+			logger.Info("migration applied", zap.Int("version", m.Version), zap.String("name", m.Name))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if replaced {
+		logger.Info("db pool replaced", zap.String("host", dbc.DBHost), zap.String("db", dbc.DBName))
+	}
+	return nil
+}
+
+// watchDBConfig 存储打开之后监听 Prod_DATABASE；非 mysql 驱动不从 Nacos 读取数据库配置
+func watchDBConfig() {
+	if dbPool == nil {
+		return
+	}
+	if err := watchConfig("Prod_DATABASE", applyDBConfig); err != nil {
+		logger.Error("db config differs from the one in use", zap.Error(err))
+	}
+}
+
+// databaseSettings 当前连接池的配置，不含密码
+func databaseSettings() dbpool.Config {
+	if dbPool == nil {
+		return dbpool.Config{Driver: storeDriver("")}
+	}
+	return dbPool.Config()
+}
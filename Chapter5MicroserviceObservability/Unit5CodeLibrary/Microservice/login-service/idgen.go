@@ -0,0 +1,270 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap"
+)
+
+/* ----------------- 用户 ID 生成 ----------------- */
+
+// 用户 ID 生成方式由 USER_ID_GENERATOR 指定：
+//
+//	sequence   数据库序列（默认），沿用 %06d 的数字格式，超过 999999 后自然增加位数
+//	snowflake  41 位毫秒时间戳 + 10 位节点号（ID_NODE）+ 12 位序号，十进制字符串
+//	ulid       26 位 Crockford Base32，按时间有序
+//
+// 三种格式互不重叠：雪花 ID 远大于 6 位数字，ULID 含字母，因此切换生成方式后已有的
+// %06d ID 保持不变，新旧 ID 可以共存。
+const (
+	idGenSequence  = "sequence"
+	idGenSnowflake = "snowflake"
+	idGenULID      = "ulid"
+
+	userIDSequence = "users"
+)
+
+var errClockMovedBackwards = errors.New("clock moved backwards")
+
+// IDGenerator 生成全局唯一的用户 ID
+type IDGenerator interface {
+	NextID() (string, error)
+}
+
+var userIDs IDGenerator
+
+// openIDGenerator 按配置创建 ID 生成器；数据库序列在内存存储下退化为进程内计数
+func openIDGenerator(gdb *gorm.DB) (IDGenerator, error) {
+	switch kind := strings.ToLower(os.Getenv("USER_ID_GENERATOR")); kind {
+	case "", idGenSequence:
+		if gdb == nil {
+			return &memorySequence{}, nil
+		}
+		return &sqlSequence{db: gdb, name: userIDSequence, block: int64(envInt("ID_SEQUENCE_BLOCK", 1))}, nil
+	case idGenSnowflake:
+		node, err := snowflakeNode()
+		if err != nil {
+			return nil, err
+		}
+		logger.Info("snowflake id generator", zap.Int64("node", node))
+		return newSnowflake(node), nil
+	case idGenULID:
+		return &ulidGenerator{}, nil
+	default:
+		return nil, fmt.Errorf("unknown USER_ID_GENERATOR %q", kind)
+	}
+}
+
+func formatSequenceID(n int64) string {
+	return fmt.Sprintf("%06d", n)
+}
+
+/* ----------------- 数据库序列 ----------------- */
+
+// sqlSequence 基于 id_sequences 表的序列。每次取号在事务中递增计数，行锁保证多副本下不重复；
+// block > 1 时一次预留一段号码在进程内分配，减少数据库往返（重启后未用完的号码作废）
+type sqlSequence struct {
+	db    *gorm.DB
+	name  string
+	block int64
+
+	mu        sync.Mutex
+	next, end int64
+}
+
+func (s *sqlSequence) NextID() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.next >= s.end {
+		end, err := s.reserve()
+		if err != nil {
+			return "", err
+		}
+		s.next, s.end = end-s.block, end
+	}
+	s.next++
+	return formatSequenceID(s.next), nil
+}
+
+// reserve 预留 block 个号码，返回预留后的序列值
+func (s *sqlSequence) reserve() (int64, error) {
+	var value int64
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Exec("UPDATE id_sequences SET value = value + ? WHERE name = ?", s.block, s.name)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return fmt.Errorf("sequence %q not found, run migrations", s.name)
+		}
+		return tx.Raw("SELECT value FROM id_sequences WHERE name = ?", s.name).Row().Scan(&value)
+	})
+	return value, err
+}
+
+// seedUserSequence 以现有数字 ID 的最大值初始化序列，供迁移使用。
+// 只统计不超过 12 位的纯数字 ID，排除雪花 ID 与 ULID
+func seedUserSequence(tx *sql.Tx, dialect string) error {
+	cast, numeric := "CAST(ID AS UNSIGNED)", "ID REGEXP '^[0-9]+$'"
+	if dialect == "sqlite" {
+		cast, numeric = "CAST(ID AS INTEGER)", "ID <> '' AND ID NOT GLOB '*[^0-9]*'"
+	}
+	var max sql.NullInt64
+	err := tx.QueryRow("SELECT MAX(" + cast + ") FROM users WHERE LENGTH(ID) <= 12 AND " + numeric).Scan(&max)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO id_sequences (name, value) VALUES (?, ?)", userIDSequence, max.Int64)
+	return err
+}
+
+/* ----------------- 进程内序列（内存存储） ----------------- */
+
+type memorySequence struct {
+	mu  sync.Mutex
+	seq int64
+}
+
+func (s *memorySequence) NextID() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	return formatSequenceID(s.seq), nil
+}
+
+/* ----------------- Snowflake ----------------- */
+
+const (
+	snowflakeNodeBits = 10
+	snowflakeSeqBits  = 12
+	snowflakeMaxNode  = 1<<snowflakeNodeBits - 1
+	snowflakeMaxSeq   = 1<<snowflakeSeqBits - 1
+)
+
+// snowflakeEpoch 自定义纪元 2024-01-01 UTC，41 位时间戳可用约 69 年
+var snowflakeEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+
+type snowflake struct {
+	node int64
+
+	mu     sync.Mutex
+	lastMs int64
+	seq    int64
+}
+
+func newSnowflake(node int64) *snowflake {
+	return &snowflake{node: node}
+}
+
+// snowflakeNode 节点号取 ID_NODE；未设置时由 POD_IP / 主机名哈希得到，多副本部署应显式设置
+func snowflakeNode() (int64, error) {
+	if v := os.Getenv("ID_NODE"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 || n > snowflakeMaxNode {
+			return 0, fmt.Errorf("ID_NODE must be between 0 and %d", snowflakeMaxNode)
+		}
+		return n, nil
+	}
+	seed := os.Getenv("POD_IP")
+	if seed == "" {
+		seed, _ = os.Hostname()
+	}
+	h := fnv.New32a()
+	h.Write([]byte(seed))
+	logger.Warn("ID_NODE not set, deriving snowflake node from host", zap.String("seed", seed))
+	return int64(h.Sum32() % (snowflakeMaxNode + 1)), nil
+}
+
+func (s *snowflake) NextID() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UnixMilli()
+	if now < s.lastMs {
+		// 时钟小幅回拨时等待追上，回拨过大则拒绝生成
+		if s.lastMs-now > 100 {
+			return "", errClockMovedBackwards
+		}
+		time.Sleep(time.Duration(s.lastMs-now) * time.Millisecond)
+		now = time.Now().UnixMilli()
+	}
+	if now == s.lastMs {
+		s.seq = (s.seq + 1) & snowflakeMaxSeq
+		if s.seq == 0 {
+			// 本毫秒序号用尽，等待下一毫秒
+			for now <= s.lastMs {
+				now = time.Now().UnixMilli()
+			}
+		}
+	} else {
+		s.seq = 0
+	}
+	s.lastMs = now
+	id := (now-snowflakeEpoch)<<(snowflakeNodeBits+snowflakeSeqBits) | s.node<<snowflakeSeqBits | s.seq
+	return strconv.FormatInt(id, 10), nil
+}
+
+/* ----------------- ULID ----------------- */
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ulidGenerator 同一毫秒内随机部分递增，保证单进程内单调
+type ulidGenerator struct {
+	mu     sync.Mutex
+	lastMs uint64
+	rnd    [10]byte
+}
+
+func (g *ulidGenerator) NextID() (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	ms := uint64(time.Now().UnixMilli())
+	if ms <= g.lastMs && g.incrementRandom() {
+		ms = g.lastMs
+	} else {
+		if _, err := rand.Read(g.rnd[:]); err != nil {
+			return "", err
+		}
+		g.lastMs = ms
+	}
+
+	var b [16]byte
+	binary.BigEndian.PutUint16(b[0:2], uint16(ms>>32))
+	binary.BigEndian.PutUint32(b[2:6], uint32(ms))
+	copy(b[6:], g.rnd[:])
+	return encodeULID(b), nil
+}
+
+// incrementRandom 随机部分加一，溢出时返回 false
+func (g *ulidGenerator) incrementRandom() bool {
+	for i := len(g.rnd) - 1; i >= 0; i-- {
+		g.rnd[i]++
+		if g.rnd[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeULID 128 位按 5 位一组编码为 26 个字符（首字符只用 3 位）
+func encodeULID(b [16]byte) string {
+	hi := binary.BigEndian.Uint64(b[0:8])
+	lo := binary.BigEndian.Uint64(b[8:16])
+	out := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out)
+}
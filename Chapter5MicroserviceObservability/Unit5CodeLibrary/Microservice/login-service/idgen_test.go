@@ -0,0 +1,173 @@
+package main
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+)
+
+// 并发取号的 goroutine 数与每个 goroutine 的取号次数；数据库序列每次取号都要提交事务，次数较少
+const (
+	idWorkers       = 64
+	idsPerWorker    = 250
+	sqlIDsPerWorker = 10
+)
+
+// generateConcurrently 从多个 goroutine 同时取号，返回每个 goroutine 按取得顺序排列的 ID
+func generateConcurrently(t *testing.T, perWorker int, gens ...IDGenerator) [][]string {
+	t.Helper()
+	out := make([][]string, idWorkers)
+	errs := make(chan error, idWorkers)
+	var wg sync.WaitGroup
+	for w := 0; w < idWorkers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			gen := gens[w%len(gens)]
+			for i := 0; i < perWorker; i++ {
+				id, err := gen.NextID()
+				if err != nil {
+					errs <- err
+					return
+				}
+				out[w] = append(out[w], id)
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("NextID: %v", err)
+	}
+	return out
+}
+
+// assertUnique 校验全部 ID 互不相同，返回 ID 集合
+func assertUnique(t *testing.T, batches [][]string) map[string]bool {
+	t.Helper()
+	want := 0
+	for _, batch := range batches {
+		want += len(batch)
+	}
+	seen := make(map[string]bool, want)
+	for _, batch := range batches {
+		for _, id := range batch {
+			if seen[id] {
+				t.Fatalf("duplicate id %s", id)
+			}
+			seen[id] = true
+		}
+	}
+	if len(seen) != want {
+		t.Fatalf("got %d ids, want %d", len(seen), want)
+	}
+	return seen
+}
+
+// openSequenceDB 打开临时 SQLite 数据库并执行迁移，得到初始化好的 id_sequences
+func openSequenceDB(t *testing.T, path string) *gorm.DB {
+	t.Helper()
+	t.Setenv("STORE_DRIVER", driverSQLite)
+	gdb, err := openDatabase(DBConfig{DBDriver: driverSQLite, DBPath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { gdb.Close() })
+	if _, err = newUserMigrator(gdb).Up(0); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return gdb
+}
+
+func TestSQLSequenceUniqueUnderConcurrency(t *testing.T) {
+	gdb := openSequenceDB(t, filepath.Join(t.TempDir(), "ids.db"))
+	seen := assertUnique(t, generateConcurrently(t, sqlIDsPerWorker, &sqlSequence{db: gdb, name: userIDSequence, block: 1}))
+	// 单实例逐个取号时号码连续
+	for n := 1; n <= idWorkers*sqlIDsPerWorker; n++ {
+		if !seen[formatSequenceID(int64(n))] {
+			t.Fatalf("sequence skipped %s", formatSequenceID(int64(n)))
+		}
+	}
+}
+
+func TestSQLSequenceUniqueAcrossReplicas(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ids.db")
+	// 两个连接模拟共用数据库的两个副本，其中一个按段预留号码
+	a := &sqlSequence{db: openSequenceDB(t, path), name: userIDSequence, block: 1}
+	b := &sqlSequence{db: openSequenceDB(t, path), name: userIDSequence, block: 16}
+	for id := range assertUnique(t, generateConcurrently(t, sqlIDsPerWorker, a, b)) {
+		if _, err := strconv.ParseInt(id, 10, 64); err != nil || len(id) < 6 {
+			t.Fatalf("id %q is not a %%06d sequence number", id)
+		}
+	}
+}
+
+func TestMemorySequenceUnique(t *testing.T) {
+	seen := assertUnique(t, generateConcurrently(t, idsPerWorker, &memorySequence{}))
+	if !seen[formatSequenceID(idWorkers*idsPerWorker)] {
+		t.Fatalf("sequence did not reach %d", idWorkers*idsPerWorker)
+	}
+}
+
+func TestSnowflakeUnique(t *testing.T) {
+	nodes := []*snowflake{newSnowflake(1), newSnowflake(snowflakeMaxNode)}
+	batches := generateConcurrently(t, idsPerWorker, nodes[0], nodes[1])
+	assertUnique(t, batches)
+	for w, batch := range batches {
+		wantNode := nodes[w%len(nodes)].node
+		prev := int64(-1)
+		for _, id := range batch {
+			n, err := strconv.ParseInt(id, 10, 64)
+			if err != nil {
+				t.Fatalf("snowflake id %q: %v", id, err)
+			}
+			// 超过 12 位，迁移中的序列初始化不会把雪花 ID 当作序号
+			if len(id) <= 12 {
+				t.Fatalf("snowflake id %q overlaps the sequence format", id)
+			}
+			if node := n >> snowflakeSeqBits & snowflakeMaxNode; node != wantNode {
+				t.Fatalf("id %s encodes node %d, want %d", id, node, wantNode)
+			}
+			if n <= prev {
+				t.Fatalf("snowflake ids not increasing: %d after %d", n, prev)
+			}
+			prev = n
+		}
+	}
+}
+
+func TestULIDUnique(t *testing.T) {
+	batches := generateConcurrently(t, idsPerWorker, &ulidGenerator{})
+	assertUnique(t, batches)
+	for _, batch := range batches {
+		prev := ""
+		for _, id := range batch {
+			if len(id) != 26 || strings.Trim(id, crockford) != "" {
+				t.Fatalf("invalid ulid %q", id)
+			}
+			// 同一生成器单调递增，字典序即时间顺序
+			if id <= prev {
+				t.Fatalf("ulids not increasing: %s after %s", id, prev)
+			}
+			prev = id
+		}
+	}
+}
+
+func TestULIDIncrementOverflow(t *testing.T) {
+	g := &ulidGenerator{}
+	for i := range g.rnd {
+		g.rnd[i] = 0xff
+	}
+	if g.incrementRandom() {
+		t.Fatal("increment of all-ones random part did not report overflow")
+	}
+	g.rnd = [10]byte{9: 0xff}
+	if !g.incrementRandom() || g.rnd != [10]byte{8: 1} {
+		t.Fatalf("carry not propagated: %x", g.rnd)
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+/* ----------------- JWT 访问令牌 ----------------- */
+
+// 访问令牌为签名的 JWT，game-service / scoreboard-service 通过 JWKS 在本地校验。
+// 签名算法由 JWT_ALG 指定：
+//
+//	HS256  JWT_SECRETS 为逗号分隔的共享密钥，第一个用于签名
+//	RS256  JWT_PRIVATE_KEYS 为逗号分隔的 PEM 私钥文件（RSA），第一个用于签名
+//	EdDSA  同上（Ed25519）
+//
+// 轮换密钥时把新密钥放在列表首位、旧密钥保留在其后，直到旧令牌全部过期；
+// 列表中的非对称公钥都会发布在 /.well-known/jwks.json。
+const (
+	algHS256 = "HS256"
+	algRS256 = "RS256"
+	algEdDSA = "EdDSA"
+
+	defaultJWTIssuer = "login-service"
+)
+
+var errUnsupportedKey = errors.New("unsupported private key type")
+
+// accessClaims 访问令牌中的声明
+type accessClaims struct {
+	ID        string   `json:"jti"` // 每次签发唯一，轮换后的令牌不会与旧令牌相同
+	Issuer    string   `json:"iss"`
+	Subject   string   `json:"sub"`
+	Name      string   `json:"name"`
+	SessionID string   `json:"sid"`
+	Roles     []string `json:"roles,omitempty"`
+	IssuedAt  int64    `json:"iat"`
+	ExpiresAt int64    `json:"exp"`
+}
+
+// signingKey 一把签名密钥；secret 与 private 二选一
+type signingKey struct {
+	kid     string
+	alg     string
+	secret  []byte
+	private crypto.Signer
+}
+
+// keyRing 首个密钥用于签发，其余仅用于发布 / 校验
+type keyRing struct {
+	issuer string
+	keys   []signingKey
+}
+
+var jwtKeys *keyRing
+
+func jwtIssuer() string {
+	if v := os.Getenv("JWT_ISSUER"); v != "" {
+		return v
+	}
+	return defaultJWTIssuer
+}
+
+// initJWTKeys 按环境变量加载签名密钥，未配置时生成临时密钥（仅适用于本地开发）
+func initJWTKeys() {
+	ring, err := loadKeyRing(os.Getenv("JWT_ALG"))
+	if err != nil {
+		logger.Fatal("load jwt keys", zap.Error(err))
+	}
+	jwtKeys = ring
+	logger.Info("jwt keys loaded", zap.String("alg", ring.keys[0].alg),
+		zap.String("kid", ring.keys[0].kid), zap.Int("keys", len(ring.keys)))
+}
+
+func loadKeyRing(alg string) (*keyRing, error) {
+	ring := &keyRing{issuer: jwtIssuer()}
+	secrets := splitList(os.Getenv("JWT_SECRETS"))
+	files := splitList(os.Getenv("JWT_PRIVATE_KEYS"))
+
+	var hmacKeys, asymKeys []signingKey
+	for _, s := range secrets {
+		hmacKeys = append(hmacKeys, newHMACKey([]byte(s)))
+	}
+	for _, f := range files {
+		k, err := loadPrivateKeyFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f, err)
+		}
+		asymKeys = append(asymKeys, k)
+	}
+
+	switch alg = normalizeAlg(alg); alg {
+	case "", algHS256:
+		if len(hmacKeys) == 0 {
+			logger.Warn("JWT_SECRETS not set, using a temporary secret; other services cannot verify tokens")
+			secret := make([]byte, 32)
+			if _, err := rand.Read(secret); err != nil {
+				return nil, err
+			}
+			hmacKeys = append(hmacKeys, newHMACKey(secret))
+		}
+		ring.keys = append(hmacKeys, asymKeys...)
+	case algRS256, algEdDSA:
+		if len(asymKeys) == 0 {
+			logger.Warn("JWT_PRIVATE_KEYS not set, generating a temporary key", zap.String("alg", alg))
+			k, err := generateSigningKey(alg)
+			if err != nil {
+				return nil, err
+			}
+			asymKeys = append(asymKeys, k)
+		}
+		if asymKeys[0].alg != alg {
+			return nil, fmt.Errorf("first key in JWT_PRIVATE_KEYS is %s, JWT_ALG is %s", asymKeys[0].alg, alg)
+		}
+		ring.keys = append(asymKeys, hmacKeys...)
+	default:
+		return nil, fmt.Errorf("unknown JWT_ALG %q", alg)
+	}
+	return ring, nil
+}
+
+// normalizeAlg JWT_ALG 不区分大小写
+func normalizeAlg(alg string) string {
+	for _, a := range []string{algHS256, algRS256, algEdDSA} {
+		if strings.EqualFold(alg, a) {
+			return a
+		}
+	}
+	return alg
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// newHMACKey kid 取密钥摘要的前 8 字节，不泄露密钥本身
+func newHMACKey(secret []byte) signingKey {
+	sum := sha256.Sum256(secret)
+	return signingKey{kid: "hs-" + base64.RawURLEncoding.EncodeToString(sum[:8]), alg: algHS256, secret: secret}
+}
+
+func loadPrivateKeyFile(path string) (signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return signingKey{}, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return signingKey{}, errors.New("no PEM block found")
+	}
+	var key interface{}
+	if block.Type == "RSA PRIVATE KEY" {
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else {
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return signingKey{}, err
+	}
+	return newAsymmetricKey(key)
+}
+
+func generateSigningKey(alg string) (signingKey, error) {
+	if alg == algRS256 {
+		k, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return signingKey{}, err
+		}
+		return newAsymmetricKey(k)
+	}
+	_, k, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return signingKey{}, err
+	}
+	return newAsymmetricKey(k)
+}
+
+// newAsymmetricKey kid 为公钥的 JWK 指纹（RFC 7638）
+func newAsymmetricKey(key interface{}) (signingKey, error) {
+	var k signingKey
+	switch pk := key.(type) {
+	case *rsa.PrivateKey:
+		k = signingKey{alg: algRS256, private: pk}
+	case ed25519.PrivateKey:
+		k = signingKey{alg: algEdDSA, private: pk}
+	default:
+		return signingKey{}, errUnsupportedKey
+	}
+	jwk := k.publicJWK()
+	var canonical string
+	if k.alg == algRS256 {
+		canonical = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, jwk["e"], jwk["n"])
+	} else {
+		canonical = fmt.Sprintf(`{"crv":"Ed25519","kty":"OKP","x":"%s"}`, jwk["x"])
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	k.kid = base64.RawURLEncoding.EncodeToString(sum[:])
+	return k, nil
+}
+
+// publicJWK 公钥的 JWK 表示，对称密钥返回 nil
+func (k signingKey) publicJWK() map[string]string {
+	b64 := base64.RawURLEncoding.EncodeToString
+	switch pub := k.private.Public().(type) {
+	case *rsa.PublicKey:
+		return map[string]string{
+			"kty": "RSA", "kid": k.kid, "use": "sig", "alg": k.alg,
+			"n": b64(pub.N.Bytes()), "e": b64(big.NewInt(int64(pub.E)).Bytes()),
+		}
+	case ed25519.PublicKey:
+		return map[string]string{
+			"kty": "OKP", "kid": k.kid, "use": "sig", "alg": k.alg, "crv": "Ed25519", "x": b64(pub),
+		}
+	}
+	return nil
+}
+
+func (k signingKey) sign(input []byte) ([]byte, error) {
+	switch k.alg {
+	case algHS256:
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write(input)
+		return mac.Sum(nil), nil
+	case algRS256:
+		sum := sha256.Sum256(input)
+		return k.private.Sign(rand.Reader, sum[:], crypto.SHA256)
+	default:
+		return k.private.Sign(rand.Reader, input, crypto.Hash(0))
+	}
+}
+
+// signAccessToken 用当前签名密钥签发访问令牌
+func (r *keyRing) signAccessToken(userID, username, sessionID string, roles []string, issuedAt, expiresAt time.Time) (string, error) {
+	k := r.keys[0]
+	header, err := json.Marshal(map[string]string{"alg": k.alg, "typ": "JWT", "kid": k.kid})
+	if err != nil {
+		return "", err
+	}
+	jti, err := generateRandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(accessClaims{
+		ID:        jti,
+		Issuer:    r.issuer,
+		Subject:   userID,
+		Name:      username,
+		SessionID: sessionID,
+		Roles:     roles,
+		IssuedAt:  issuedAt.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+	input := b64(header) + "." + b64(claims)
+	sig, err := k.sign([]byte(input))
+	if err != nil {
+		return "", err
+	}
+	return input + "." + b64(sig), nil
+}
+
+// jwksHandler 发布全部非对称公钥，校验方按 kid 选择密钥
+func jwksHandler(c *gin.Context) {
+	keys := []map[string]string{}
+	for _, k := range jwtKeys.keys {
+		if k.private != nil {
+			keys = append(keys, k.publicJWK())
+		}
+	}
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap"
+)
+
+/* ----------------- 登录失败限流 ----------------- */
+
+// 按用户名与客户端 IP 分别统计失败次数（滑动窗口），达到阈值后临时锁定；
+// 连续锁定时锁定时长按指数增长，直至上限。状态存储可选内存或共享数据库（LIMITER_STORE），
+// 使用数据库时多个副本共享计数。
+
+const limiterCleanupInterval = time.Hour
+
+// loginAttempt 一个限流键（user:<name> / ip:<addr>）的状态。
+// 失败次数按固定窗口记录当前窗口与上一窗口，估算滑动窗口内的失败数
+type loginAttempt struct {
+	AttemptKey   string     `gorm:"column:AttemptKey;primary_key"`
+	WindowStart  time.Time  `gorm:"column:WindowStart"`
+	Failures     int        `gorm:"column:Failures"`
+	PrevFailures int        `gorm:"column:PrevFailures"`
+	Lockouts     int        `gorm:"column:Lockouts"`
+	LockedUntil  *time.Time `gorm:"column:LockedUntil"`
+	UpdatedAt    time.Time  `gorm:"column:UpdatedAt"`
+}
+
+func (loginAttempt) TableName() string { return "login_attempts" }
+
+// LimiterStore 限流状态存储
+type LimiterStore interface {
+	// Get 返回键的状态，不存在时返回 nil
+	Get(key string) (*loginAttempt, error)
+	// Update 原子地修改键的状态，不存在时以零值创建
+	Update(key string, fn func(a *loginAttempt)) error
+	Delete(key string) error
+	// DeleteIdle 删除 before 之后未再更新且未处于锁定的状态
+	DeleteIdle(before time.Time) (int64, error)
+}
+
+// limitPolicy 一类键的限流参数
+type limitPolicy struct {
+	maxFailures int
+	window      time.Duration
+	lockoutBase time.Duration
+	lockoutMax  time.Duration
+}
+
+type loginLimiter struct {
+	store LimiterStore
+	user  limitPolicy
+	ip    limitPolicy
+}
+
+var (
+	attempts LimiterStore
+	limiter  *loginLimiter
+)
+
+// limiterStoreKind 限流状态存储：LIMITER_STORE 为 memory / database，默认与用户存储一致
+func limiterStoreKind(driver string) string {
+	if driver == driverMemory {
+		return driverMemory
+	}
+	if kind := strings.ToLower(os.Getenv("LIMITER_STORE")); kind == driverMemory {
+		return driverMemory
+	}
+	return "database"
+}
+
+func newLoginLimiter(store LimiterStore) *loginLimiter {
+	window := envDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute)
+	base := envDuration("LOGIN_LOCKOUT_BASE", time.Minute)
+	max := envDuration("LOGIN_LOCKOUT_MAX", time.Hour)
+	return &loginLimiter{
+		store: store,
+		user:  limitPolicy{maxFailures: envInt("LOGIN_MAX_FAILURES_USER", 5), window: window, lockoutBase: base, lockoutMax: max},
+		ip:    limitPolicy{maxFailures: envInt("LOGIN_MAX_FAILURES_IP", 20), window: window, lockoutBase: base, lockoutMax: max},
+	}
+}
+
+func userLimitKey(username string) string { return "user:" + strings.ToLower(username) }
+func ipLimitKey(ip string) string         { return "ip:" + ip }
+
+// Check 返回仍需等待的时长，0 表示允许尝试。存储出错时放行，避免限流故障导致无法登录
+func (l *loginLimiter) Check(username, ip string, now time.Time) time.Duration {
+	var wait time.Duration
+	for _, key := range []string{userLimitKey(username), ipLimitKey(ip)} {
+		a, err := l.store.Get(key)
+		if err != nil {
+			logger.Error("limiter get", zap.String("key", key), zap.Error(err))
+			continue
+		}
+		if a != nil && a.LockedUntil != nil && a.LockedUntil.After(now) {
+			if d := a.LockedUntil.Sub(now); d > wait {
+				wait = d
+			}
+		}
+	}
+	return wait
+}
+
+// Fail 记录一次失败；若因此触发锁定，返回锁定时长
+func (l *loginLimiter) Fail(username, ip string, now time.Time) time.Duration {
+	var wait time.Duration
+	for _, k := range []struct {
+		key    string
+		policy limitPolicy
+	}{{userLimitKey(username), l.user}, {ipLimitKey(ip), l.ip}} {
+		var locked time.Duration
+		var failures int
+		err := l.store.Update(k.key, func(a *loginAttempt) {
+			failures, locked = k.policy.fail(a, now)
+		})
+		if err != nil {
+			logger.Error("limiter update", zap.String("key", k.key), zap.Error(err))
+			continue
+		}
+		if locked > 0 {
+			auditLockout(k.key, username, ip, failures, locked, now)
+			if locked > wait {
+				wait = locked
+			}
+		}
+	}
+	return wait
+}
+
+// Succeed 登录成功后清除该用户名的失败记录；IP 计数保留，避免用一个有效账号重置 IP 限流
+func (l *loginLimiter) Succeed(username string) {
+	if err := l.store.Delete(userLimitKey(username)); err != nil {
+		logger.Error("limiter delete", zap.String("username", username), zap.Error(err))
+	}
+}
+
+// fail 在状态上记录一次失败，返回窗口内的失败数与新触发的锁定时长
+func (p limitPolicy) fail(a *loginAttempt, now time.Time) (int, time.Duration) {
+	// 长时间无失败后，连续锁定次数归零
+	if !a.UpdatedAt.IsZero() && now.Sub(a.UpdatedAt) > p.lockoutMax+p.window {
+		a.Lockouts = 0
+	}
+	p.roll(a, now)
+	a.Failures++
+	a.UpdatedAt = now
+
+	failures := p.count(a, now)
+	if failures < p.maxFailures || (a.LockedUntil != nil && a.LockedUntil.After(now)) {
+		return failures, 0
+	}
+	a.Lockouts++
+	d := p.lockoutBase
+	for i := 1; i < a.Lockouts && d < p.lockoutMax; i++ {
+		d *= 2
+	}
+	if d > p.lockoutMax {
+		d = p.lockoutMax
+	}
+	until := now.Add(d)
+	a.LockedUntil = &until
+	a.Failures, a.PrevFailures = 0, 0
+	return failures, d
+}
+
+// roll 窗口前移时把当前窗口计数移入上一窗口
+func (p limitPolicy) roll(a *loginAttempt, now time.Time) {
+	start := now.Truncate(p.window)
+	switch {
+	case start.Equal(a.WindowStart):
+	case start.Equal(a.WindowStart.Add(p.window)):
+		a.PrevFailures, a.Failures = a.Failures, 0
+	default:
+		a.PrevFailures, a.Failures = 0, 0
+	}
+	a.WindowStart = start
+}
+
+// count 滑动窗口内的失败数：上一窗口按剩余比例加权
+func (p limitPolicy) count(a *loginAttempt, now time.Time) int {
+	elapsed := now.Sub(a.WindowStart)
+	weight := float64(p.window-elapsed) / float64(p.window)
+	return a.Failures + int(math.Ceil(float64(a.PrevFailures)*weight))
+}
+
+// auditLockout 输出锁定审计记录
+func auditLockout(key, username, ip string, failures int, d time.Duration, now time.Time) {
+	logger.Warn("login lockout",
+		zap.String("audit", "login_lockout"),
+		zap.String("key", key),
+		zap.String("username", username),
+		zap.String("client_ip", ip),
+		zap.Int("failures", failures),
+		zap.Duration("lockout", d),
+		zap.Time("locked_until", now.Add(d)))
+}
+
+// startLimiterCleanup 定时删除长时间未活动的限流状态
+func startLimiterCleanup() {
+	go func() {
+		ticker := time.NewTicker(limiterCleanupInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			idle := limiter.user.lockoutMax + limiter.user.window
+			if n, err := attempts.DeleteIdle(time.Now().Add(-idle)); err != nil {
+				logger.Warn("limiter cleanup", zap.Error(err))
+			} else if n > 0 {
+				logger.Info("idle limiter entries removed", zap.Int64("count", n))
+			}
+		}
+	}()
+}
+
+/* ----------------- gorm 实现 ----------------- */
+
+// sqlLimiterStore 多副本共享的限流状态，行锁保证并发更新不丢失
+type sqlLimiterStore struct {
+	db *gorm.DB
+}
+
+func (s *sqlLimiterStore) Get(key string) (*loginAttempt, error) {
+	var a loginAttempt
+	if err := s.db.Where("AttemptKey = ?", key).First(&a).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (s *sqlLimiterStore) Update(key string, fn func(a *loginAttempt)) error {
+	insert := "INSERT IGNORE INTO login_attempts (AttemptKey, Failures, PrevFailures, Lockouts) VALUES (?, 0, 0, 0)"
+	if dialectOf(s.db) == "sqlite" {
+		insert = "INSERT OR IGNORE INTO login_attempts (AttemptKey, Failures, PrevFailures, Lockouts) VALUES (?, 0, 0, 0)"
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(insert, key).Error; err != nil {
+			return err
+		}
+		q := tx
+		if dialectOf(tx) == "mysql" {
+			q = tx.Set("gorm:query_option", "FOR UPDATE")
+		}
+		var a loginAttempt
+		if err := q.Where("AttemptKey = ?", key).First(&a).Error; err != nil {
+			return err
+		}
+		fn(&a)
+		return tx.Save(&a).Error
+	})
+}
+
+func (s *sqlLimiterStore) Delete(key string) error {
+	return s.db.Where("AttemptKey = ?", key).Delete(&loginAttempt{}).Error
+}
+
+func (s *sqlLimiterStore) DeleteIdle(before time.Time) (int64, error) {
+	res := s.db.Where("UpdatedAt < ? AND (LockedUntil IS NULL OR LockedUntil < ?)", before, time.Now()).
+		Delete(&loginAttempt{})
+	return res.RowsAffected, res.Error
+}
+
+/* ----------------- 内存实现 ----------------- */
+
+type memoryLimiterStore struct {
+	mu    sync.Mutex
+	byKey map[string]*loginAttempt
+}
+
+func newMemoryLimiterStore() *memoryLimiterStore {
+	return &memoryLimiterStore{byKey: make(map[string]*loginAttempt)}
+}
+
+func (s *memoryLimiterStore) Get(key string) (*loginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.byKey[key]
+	if !ok {
+		return nil, nil
+	}
+	cp := *a
+	return &cp, nil
+}
+
+func (s *memoryLimiterStore) Update(key string, fn func(a *loginAttempt)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.byKey[key]
+	if !ok {
+		a = &loginAttempt{AttemptKey: key}
+		s.byKey[key] = a
+	}
+	fn(a)
+	return nil
+}
+
+func (s *memoryLimiterStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.byKey, key)
+	return nil
+}
+
+func (s *memoryLimiterStore) DeleteIdle(before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	var n int64
+	for key, a := range s.byKey {
+		if a.UpdatedAt.Before(before) && (a.LockedUntil == nil || a.LockedUntil.Before(now)) {
+			delete(s.byKey, key)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+/* ----------------- 邮件发送 ----------------- */
+
+// 发送方式由 MAILER 指定：
+//
+//	smtp    通过 SMTP_HOST / SMTP_PORT / SMTP_USERNAME / SMTP_PASSWORD 发送
+//	file    写入 MAIL_DIR 目录下的 .eml 文件，便于本地查看
+//	memory  保存在内存中（默认），仅用于开发与测试
+//
+// 发件人为 MAIL_FROM。
+
+// MailMessage 一封纯文本邮件
+type MailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer 邮件发送
+type Mailer interface {
+	Send(msg MailMessage) error
+}
+
+var mailer Mailer = newMemoryMailer()
+
+func mailFrom() string {
+	if v := os.Getenv("MAIL_FROM"); v != "" {
+		return v
+	}
+	return "no-reply@micro.roliyal.com"
+}
+
+// initMailer 按环境变量选择发送方式
+func initMailer() {
+	m, err := newMailer(strings.ToLower(os.Getenv("MAILER")))
+	if err != nil {
+		logger.Fatal("mailer", zap.Error(err))
+	}
+	mailer = m
+}
+
+func newMailer(kind string) (Mailer, error) {
+	switch kind {
+	case "", "memory":
+		return newMemoryMailer(), nil
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+		return &fileMailer{dir: dir}, nil
+	case "smtp":
+		host := os.Getenv("SMTP_HOST")
+		if host == "" {
+			return nil, fmt.Errorf("SMTP_HOST is required for the smtp mailer")
+		}
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return &smtpMailer{
+			addr:     net.JoinHostPort(host, port),
+			host:     host,
+			username: os.Getenv("SMTP_USERNAME"),
+			password: os.Getenv("SMTP_PASSWORD"),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown MAILER %q", kind)
+	}
+}
+
+// sendMailAsync 在后台发送，避免响应时间随邮件发送变化（也避免据此推断账号是否存在）
+func sendMailAsync(msg MailMessage) {
+	go func() {
+		if err := mailer.Send(msg); err != nil {
+			logger.Error("send mail", zap.String("subject", msg.Subject), zap.Error(err))
+		}
+	}()
+}
+
+// formatMail 生成 RFC 5322 格式的邮件内容
+func formatMail(from string, msg MailMessage) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return b.Bytes()
+}
+
+/* ----------------- SMTP ----------------- */
+
+type smtpMailer struct {
+	addr     string
+	host     string
+	username string
+	password string
+}
+
+func (m *smtpMailer) Send(msg MailMessage) error {
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+	return smtp.SendMail(m.addr, auth, mailFrom(), []string{msg.To}, formatMail(mailFrom(), msg))
+}
+
+/* ----------------- 文件 ----------------- */
+
+type fileMailer struct {
+	mu  sync.Mutex
+	dir string
+	seq int
+}
+
+func (m *fileMailer) Send(msg MailMessage) error {
+	m.mu.Lock()
+	m.seq++
+	name := fmt.Sprintf("%s-%04d.eml", time.Now().Format("20060102-150405"), m.seq)
+	m.mu.Unlock()
+	path := filepath.Join(m.dir, name)
+	if err := os.WriteFile(path, formatMail(mailFrom(), msg), 0644); err != nil {
+		return err
+	}
+	logger.Info("mail written", zap.String("to", msg.To), zap.String("path", path))
+	return nil
+}
+
+/* ----------------- 内存 ----------------- */
+
+type memoryMailer struct {
+	mu   sync.Mutex
+	sent []MailMessage
+}
+
+func newMemoryMailer() *memoryMailer {
+	return &memoryMailer{}
+}
+
+func (m *memoryMailer) Send(msg MailMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	logger.Info("mail stored in memory", zap.String("to", msg.To), zap.String("subject", msg.Subject))
+	return nil
+}
+
+// Sent 返回已发送邮件的副本
+func (m *memoryMailer) Sent() []MailMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]MailMessage(nil), m.sent...)
+}
@@ -7,17 +7,17 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-contrib/zap"
 	"github.com/gin-gonic/gin"
-	"github.com/jinzhu/gorm"
 	"go.uber.org/zap"
-	"golang.org/x/crypto/bcrypt"
 	_ "google.golang.org/protobuf/proto"
 	_ "google.golang.org/protobuf/runtime/protoimpl"
+	"microservice/pkg/auth"
 )
 
 /* ----------------- DTO ----------------- */
@@ -30,14 +30,32 @@ type (
 	registerRequest struct {
 		Username string `json:"username"`
 		Password string `json:"password"`
+		Email    string `json:"email,omitempty"` // 可选，填写后发送验证邮件
+	}
+	refreshRequest struct {
+		RefreshToken string `json:"refreshToken"`
 	}
 	loginResponse struct {
-		Success   bool   `json:"success"`
-		AuthToken string `json:"authToken,omitempty"`
-		ID        string `json:"id,omitempty"`
+		Success          bool       `json:"success"`
+		AuthToken        string     `json:"authToken,omitempty"`
+		RefreshToken     string     `json:"refreshToken,omitempty"`
+		ExpiresAt        *time.Time `json:"expiresAt,omitempty"`
+		RefreshExpiresAt *time.Time `json:"refreshExpiresAt,omitempty"`
+		ID               string     `json:"id,omitempty"`
 	}
 )
 
+func newLoginResponse(t issuedTokens, id string) loginResponse {
+	return loginResponse{
+		Success:          true,
+		AuthToken:        t.AccessToken,
+		RefreshToken:     t.RefreshToken,
+		ExpiresAt:        &t.AccessExpiresAt,
+		RefreshExpiresAt: &t.RefreshExpiresAt,
+		ID:               id,
+	}
+}
+
 /* ----------------- token helpers ----------------- */
 
 func generateRandomToken(n int) (string, error) {
@@ -51,27 +69,6 @@ func generateAuthToken() (string, error) { return generateRandomToken(32) }
 
 /* ----------------- handlers ----------------- */
 
-// 记录请求的详细信息
-func logRequestDetails(c *gin.Context) {
-	method := c.Request.Method
-	path := c.Request.URL.Path
-	queryParams := c.Request.URL.Query().Encode() // 获取查询字符串
-
-	// 记录请求的详细信息
-	logger.Info("Request Details",
-		zap.String("method", method),
-		zap.String("path", path),
-		zap.String("query", queryParams))
-
-	// 记录请求体
-	if method == "POST" {
-		var body map[string]interface{}
-		if err := c.ShouldBindJSON(&body); err == nil {
-			logger.Info("Request Body", zap.Any("body", body))
-		}
-	}
-}
-
 // 登录处理
 func loginHandler(c *gin.Context) {
 	var req loginRequest
@@ -80,12 +77,21 @@ func loginHandler(c *gin.Context) {
 		return
 	}
 
-	var user User
-	if err := db.Select("ID, Username, Password, AuthToken, Wins, Attempts").
-		Where("username = ?", req.Username).First(&user).Error; err != nil {
+	// 用户名或 IP 处于锁定期
+	clientIP, now := c.ClientIP(), time.Now()
+	if wait := limiter.Check(req.Username, clientIP, now); wait > 0 {
+		respondLocked(c, wait)
+		return
+	}
 
-		if gorm.IsRecordNotFoundError(err) {
+	user, err := users.FindByUsername(req.Username)
+	if err != nil {
+		if err == errUserNotFound {
 			logger.Warn("User not found", zap.String("username", req.Username))
+			if wait := limiter.Fail(req.Username, clientIP, now); wait > 0 {
+				respondLocked(c, wait)
+				return
+			}
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
 		} else {
 			logger.Error("DB error", zap.String("username", req.Username), zap.Error(err))
@@ -94,41 +100,75 @@ func loginHandler(c *gin.Context) {
 		return
 	}
 
-	passOK := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)) == nil ||
-		user.Password == req.Password
+	passOK, rehash, err := verifyPassword(user.Password, req.Password)
+	if err != nil {
+		logger.Error("Password verify error", zap.String("username", req.Username), zap.Error(err))
+	}
 	if !passOK {
 		logger.Warn("Invalid credentials", zap.String("username", req.Username))
+		if wait := limiter.Fail(req.Username, clientIP, now); wait > 0 {
+			respondLocked(c, wait)
+			return
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
 		return
 	}
 
-	// 登录成功，生成 token
-	token := user.AuthToken
-	if token == "" {
-		var err error
-		token, err = generateAuthToken()
-		if err != nil {
-			logger.Error("Token generation error", zap.Error(err))
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "token error"})
-			return
+	// 遗留明文或旧算法 / 旧参数的哈希，以当前算法重新哈希；失败不影响本次登录。
+	// 只在哈希未被并发修改时更新 Password 列，不会覆盖同时写入的 DisabledAt 或新密码
+	if rehash {
+		if hash, err := passwordHasher.Hash(req.Password); err != nil {
+			logger.Error("Password rehash error", zap.String("username", req.Username), zap.Error(err))
+		} else if replaced, err := users.ReplacePassword(user.ID, user.Password, hash); err != nil {
+			logger.Error("Password rehash save error", zap.String("username", req.Username), zap.Error(err))
+		} else if replaced {
+			logger.Info("Password rehashed", zap.String("username", req.Username),
+				zap.String("scheme", passwordHasher.Scheme()))
 		}
-		user.AuthToken = token
-		_ = db.Save(&user).Error
+	}
+
+	if rejectDisabled(c, user) {
+		return
+	}
+
+	// 已启用两步验证：密码正确也不清除失败计数，待 /login/2fa 通过后再签发会话
+	if user.TOTPEnabledAt != nil {
+		respondMFARequired(c, user)
+		return
+	}
+	limiter.Succeed(req.Username)
+
+	// 登录成功，创建新会话
+	tokens, err := issueSession(user)
+	if err != nil {
+		logger.Error("Session create error", zap.String("username", req.Username), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "token error"})
+		return
 	}
 
 	// 记录成功的登录日志
 	logger.Info("User logged in",
 		zap.String("username", req.Username),
-		zap.String("authToken", token),
 		zap.String("userID", user.ID))
 
 	// 设置 cookies
-	writeAuthCookies(c, token, user.ID)
-	c.JSON(http.StatusOK, loginResponse{Success: true, AuthToken: token, ID: user.ID})
+	writeAuthCookies(c, tokens)
+	c.JSON(http.StatusOK, newLoginResponse(tokens, user.ID))
+}
+
+// respondLocked 返回 429，Retry-After 向上取整到秒
+func respondLocked(c *gin.Context, wait time.Duration) {
+	seconds := int((wait + time.Second - 1) / time.Second)
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many failed attempts", "retryAfter": seconds})
 }
 
 // 注册处理
 func registerHandler(c *gin.Context) {
+	if !featureEnabled(featureRegistration) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "registration disabled"})
+		return
+	}
 	var req registerRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		logger.Error("Invalid JSON", zap.Error(err))
@@ -136,56 +176,126 @@ func registerHandler(c *gin.Context) {
 		return
 	}
 
-	var exist User
-	if err := db.Where("Username = ?", req.Username).First(&exist).Error; err == nil {
-		logger.Warn("Username exists", zap.String("username", req.Username))
-		c.JSON(http.StatusConflict, gin.H{"error": "username exists"})
-		return
-	} else if !gorm.IsRecordNotFoundError(err) {
-		logger.Error("Database error", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+	email, verrs := validateRegister(&req)
+	if len(verrs) > 0 {
+		respondValidation(c, verrs)
 		return
 	}
 
-	nextID, err := getNextUserID()
+	nextID, err := userIDs.NextID()
 	if err != nil {
 		logger.Error("ID generation error", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "id error"})
 		return
 	}
 
-	hash, _ := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
-	user := User{ID: nextID, Username: req.Username, Password: string(hash)}
-	if err = db.Create(&user).Error; err != nil {
+	hash, err := passwordHasher.Hash(req.Password)
+	if err != nil {
+		logger.Error("Password hash error", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "hash error"})
+		return
+	}
+	user := User{ID: nextID, Username: req.Username, Password: hash}
+	if email != "" {
+		user.Email = &email
+	}
+	if err = users.Create(&user); err == errUsernameTaken {
+		logger.Warn("Username exists", zap.String("username", req.Username))
+		c.JSON(http.StatusConflict, gin.H{"error": "username exists",
+			"fields": validationErrors{{Field: "username", Code: "taken", Message: "用户名已被注册"}}})
+		return
+	} else if err == errEmailTaken {
+		c.JSON(http.StatusConflict, gin.H{"error": "email exists",
+			"fields": validationErrors{{Field: "email", Code: "taken", Message: "邮箱已被注册"}}})
+		return
+	} else if err != nil {
 		logger.Error("Database insert error", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
 		return
 	}
 
+	tokens, err := issueSession(&user)
+	if err != nil {
+		logger.Error("Session create error", zap.String("username", req.Username), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "token error"})
+		return
+	}
+
+	if user.Email != nil {
+		if err = sendVerificationEmail(&user); err != nil {
+			logger.Error("Verification email error", zap.String("userID", user.ID), zap.Error(err))
+		}
+	}
+
 	logger.Info("User registered", zap.String("username", req.Username))
-	writeAuthCookies(c, user.AuthToken, user.ID)
-	c.JSON(http.StatusCreated, loginResponse{Success: true, AuthToken: user.AuthToken, ID: user.ID})
+	writeAuthCookies(c, tokens)
+	c.JSON(http.StatusCreated, newLoginResponse(tokens, user.ID))
 }
 
-// 获取用户信息
-func userHandler(c *gin.Context) {
-	authToken := c.GetHeader("Authorization")
-	userID := c.GetHeader("X-User-ID")
-	if authToken == "" {
-		authToken, _ = c.Cookie("AuthToken")
+// 刷新令牌：校验刷新令牌后轮换令牌对，刷新令牌取自请求体或 RefreshToken Cookie
+func refreshHandler(c *gin.Context) {
+	var req refreshRequest
+	_ = c.ShouldBindJSON(&req)
+	if req.RefreshToken == "" {
+		req.RefreshToken, _ = c.Cookie("RefreshToken")
 	}
-	if userID == "" {
-		userID, _ = c.Cookie("X-User-ID")
+	if req.RefreshToken == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing refresh token"})
+		return
 	}
 
-	if authToken == "" || userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing auth"})
+	sess, tokens, err := refreshSession(req.RefreshToken)
+	if err != nil {
+		respondSessionError(c, err)
+		return
+	}
+	writeAuthCookies(c, tokens)
+	c.JSON(http.StatusOK, newLoginResponse(tokens, sess.UserID))
+}
+
+// 退出登录：吊销当前会话
+func logoutHandler(c *gin.Context) {
+	sess, ok := requireLogoutSession(c)
+	if !ok {
+		return
+	}
+	if err := revokeSession(sess); err != nil {
+		logger.Error("Session revoke error", zap.String("userID", sess.UserID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	logger.Info("User logged out", zap.String("userID", sess.UserID))
+	clearAuthCookies(c)
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// 退出所有设备：吊销该用户的全部会话
+func logoutAllHandler(c *gin.Context) {
+	sess, ok := requireLogoutSession(c)
+	if !ok {
+		return
+	}
+	n, err := sessions.RevokeAll(sess.UserID, time.Now())
+	if err != nil {
+		logger.Error("Session revoke error", zap.String("userID", sess.UserID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	logger.Info("User logged out of all devices", zap.String("userID", sess.UserID), zap.Int64("sessions", n))
+	clearAuthCookies(c)
+	c.JSON(http.StatusOK, gin.H{"success": true, "revoked": n})
+}
+
+// 获取用户信息
+func userHandler(c *gin.Context) {
+	sess, ok := requireSession(c)
+	if !ok {
 		return
 	}
 
-	var user User
-	if err := db.Where("AuthToken = ? AND ID = ?", authToken, userID).First(&user).Error; err != nil {
-		if gorm.IsRecordNotFoundError(err) {
+	user, err := users.FindByID(sess.UserID)
+	if err != nil {
+		if err == errUserNotFound {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
@@ -195,18 +305,114 @@ func userHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, user)
 }
 
+// requireSession 校验访问令牌，用户身份只取自会话，不信任客户端提供的 X-User-ID
+func requireSession(c *gin.Context) (*Session, bool) {
+	authToken := auth.BearerToken(c)
+	if authToken == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing auth"})
+		return nil, false
+	}
+
+	sess, err := authenticateToken(authToken)
+	if err != nil {
+		respondSessionError(c, err)
+		return nil, false
+	}
+	return sess, true
+}
+
+// requireLogoutSession 退出登录时的会话校验：访问令牌缺失或已过期时，凭刷新令牌
+// （请求体 refreshToken 或 RefreshToken Cookie）找到会话，避免过期客户端无法吊销仍有效的刷新令牌
+func requireLogoutSession(c *gin.Context) (*Session, bool) {
+	var req refreshRequest
+	_ = c.ShouldBindJSON(&req)
+	if req.RefreshToken == "" {
+		req.RefreshToken, _ = c.Cookie("RefreshToken")
+	}
+	sess, err := authenticateToken(auth.BearerToken(c))
+	if err != nil && req.RefreshToken != "" {
+		if sess, err = sessions.FindByRefreshHash(hashToken(req.RefreshToken)); err == nil {
+			err = checkSession(sess, sess.RefreshExpiresAt, time.Now())
+		}
+	}
+	if err != nil {
+		respondSessionError(c, err)
+		return nil, false
+	}
+	return sess, true
+}
+
+// respondSessionError 将会话校验错误转换为响应
+func respondSessionError(c *gin.Context, err error) {
+	switch err {
+	case errSessionNotFound, errUserNotFound:
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+	case errTokenExpired:
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "token expired"})
+	case errTokenRevoked, errRefreshReused:
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "token revoked"})
+	case errAccountDisabled:
+		c.JSON(http.StatusForbidden, gin.H{"error": "account disabled"})
+	default:
+		logger.Error("Session lookup error", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+	}
+}
+
 /* ----------------- cookie util ----------------- */
 
-// 写入认证cookie
-func writeAuthCookies(c *gin.Context, token, id string) {
-	age := 7 * 24 * 3600
-	c.SetCookie("AuthToken", token, age, "/", "", false, true)
-	c.SetCookie("X-User-ID", id, age, "/", "", false, true)
+// 写入认证cookie，有效期与令牌一致；CSRF 令牌需由前端读取，因此不设 HttpOnly
+func writeAuthCookies(c *gin.Context, t issuedTokens) {
+	now := time.Now()
+	accessAge := int(t.AccessExpiresAt.Sub(now).Seconds())
+	refreshAge := int(t.RefreshExpiresAt.Sub(now).Seconds())
+	cookieAttrs.set(c, "AuthToken", t.AccessToken, "/", accessAge, true)
+	cookieAttrs.set(c, "RefreshToken", t.RefreshToken, "/", refreshAge, true)
+	cookieAttrs.set(c, csrfCookie, t.CSRFToken, "/", refreshAge, false)
+}
+
+// 清除认证cookie；X-User-ID 为旧版本写入的 Cookie，一并清除
+func clearAuthCookies(c *gin.Context) {
+	for _, name := range []string{"AuthToken", "RefreshToken", "X-User-ID"} {
+		cookieAttrs.set(c, name, "", "/", -1, true)
+	}
+	cookieAttrs.set(c, csrfCookie, "", "/", -1, false)
 }
 
 func main() {
+	/* ------- migrate 子命令 ------- */
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		migrateMain(os.Args[2:])
+		return
+	}
+	/* ------- rehash-audit 子命令 ------- */
+	if len(os.Args) > 1 && os.Args[1] == "rehash-audit" {
+		rehashAuditMain()
+		return
+	}
+
+	/* ------- roles 子命令 ------- */
+	if len(os.Args) > 1 && os.Args[1] == "roles" {
+		rolesMain(os.Args[2:])
+		return
+	}
+
+	/* ------- oidc-stub 子命令 ------- */
+	if len(os.Args) > 1 && os.Args[1] == "oidc-stub" {
+		oidcStubMain()
+		return
+	}
+
 	/* ------- 初始化 ------- */
 	initNacos()
+	initRegistry()
+	initRuntimeConfig()
+	initJWTKeys()
+	initPasswordHasher()
+	initCredentialPolicy()
+	initCookiePolicy()
+	initMailer()
+	initOIDC()
 	initDatabase()
 	defer closeDatabase()
 	defer logger.Sync()
@@ -217,14 +423,38 @@ func main() {
 	r.Use(ginzap.Ginzap(logger, time.RFC3339, true))
 	r.Use(ginzap.RecoveryWithZap(logger, true))
 	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://micro.roliyal.com"},
+		AllowOriginFunc:  allowsOrigin, // 允许的来源由 Login_RUNTIME 配置
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Content-Type", "Authorization", "X-User-ID"},
+		AllowHeaders:     []string{"Content-Type", "Authorization", csrfHeader},
+		ExposeHeaders:    []string{"Retry-After"},
 		AllowCredentials: true,
 	}))
+	// 以请求体中的凭据认证的接口不依赖 Cookie，无需 CSRF 令牌（首次登录时也还没有）
+	r.Use(auth.CSRF(logger.Sugar(), "/login", "/login/2fa", "/register", "/password/forgot", "/password/reset", "/verify-email"))
 	r.POST("/login", loginHandler)
+	r.POST("/login/2fa", loginMFAHandler)
 	r.POST("/register", registerHandler)
+	r.POST("/refresh", refreshHandler)
+	r.POST("/logout", logoutHandler)
+	r.POST("/logout/all", logoutAllHandler)
 	r.GET("/user", userHandler)
+	r.GET("/.well-known/jwks.json", jwksHandler)
+	r.POST("/password/forgot", forgotPasswordHandler)
+	r.POST("/password/reset", resetPasswordHandler)
+	r.POST("/verify-email", verifyEmailHandler)
+	r.GET("/oidc/login", oidcLoginHandler)
+	r.GET("/oidc/callback", oidcCallbackHandler)
+	r.POST("/2fa/enroll", enrollTOTPHandler)
+	r.POST("/2fa/confirm", confirmTOTPHandler)
+	r.POST("/2fa/disable", disableTOTPHandler)
+	r.POST("/2fa/recovery-codes", regenerateRecoveryCodesHandler)
+	r.GET("/admin/users", adminListUsersHandler)
+	r.GET("/admin/roles", adminListRolesHandler)
+	r.POST("/admin/users/:id/disable", adminDisableUserHandler)
+	r.POST("/admin/users/:id/enable", adminEnableUserHandler)
+	r.PUT("/admin/users/:id/roles/:role", adminGrantRoleHandler)
+	r.DELETE("/admin/users/:id/roles/:role", adminRevokeRoleHandler)
+	r.GET("/admin/config", adminConfigHandler)
 	r.GET("/health", func(c *gin.Context) { c.String(200, "ok") })
 
 	// 启动 HTTP 服务
@@ -238,12 +468,8 @@ func main() {
 		}
 	}()
 
-	/* ------- 注册到 Nacos ------- */
-	hostIP, err := getHostIP()
-	if err != nil {
-		logger.Fatal("get host ip", zap.Error(err))
-	}
-	if err = registerService(NamingClient, "login-service", hostIP, 8083); err != nil {
+	/* ------- 注册服务实例 ------- */
+	if err := registerService("login-service", 8083); err != nil {
 		logger.Fatal("register service", zap.Error(err))
 	}
 	defer deregisterLoginService()
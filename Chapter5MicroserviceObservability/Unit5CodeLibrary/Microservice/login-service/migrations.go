@@ -0,0 +1,398 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap"
+	"microservice/pkg/migrate"
+)
+
+/* ----------------- 数据库迁移 ----------------- */
+
+// login-service 负责 users、sessions、rotated_refresh_tokens、login_attempts、id_sequences、user_tokens、user_identities、roles 与 user_roles 表，是其结构的唯一来源
+var userMigrations = []migrate.Migration{
+	{
+		Version: 1,
+		Name:    "create_users",
+		Up: map[string][]string{
+			"mysql": {`CREATE TABLE IF NOT EXISTS users (
+    ID              VARCHAR(255) NOT NULL,
+    Username        VARCHAR(255) NOT NULL,
+    Password        VARCHAR(255) NOT NULL,
+    AuthToken       VARCHAR(255) NOT NULL DEFAULT '',
+    Wins            INT          DEFAULT 0,
+    Attempts        INT          DEFAULT 0,
+    created_at      DATETIME     DEFAULT CURRENT_TIMESTAMP,
+    updated_at      DATETIME     DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    correct_guesses INT          DEFAULT 0,
+    PRIMARY KEY (ID),
+    CONSTRAINT uix_users_username UNIQUE (Username)
+)`},
+			"sqlite": {`CREATE TABLE IF NOT EXISTS users (
+    ID              VARCHAR(255) NOT NULL,
+    Username        VARCHAR(255) NOT NULL,
+    Password        VARCHAR(255) NOT NULL,
+    AuthToken       VARCHAR(255) NOT NULL DEFAULT '',
+    Wins            INT          DEFAULT 0,
+    Attempts        INT          DEFAULT 0,
+    created_at      DATETIME     DEFAULT CURRENT_TIMESTAMP,
+    updated_at      DATETIME     DEFAULT CURRENT_TIMESTAMP,
+    correct_guesses INT          DEFAULT 0,
+    PRIMARY KEY (ID),
+    CONSTRAINT uix_users_username UNIQUE (Username)
+)`},
+		},
+		Down: migrate.SameSQL(`DROP TABLE IF EXISTS users`),
+	},
+	{
+		// game-service 曾以 CreatedAt / UpdatedAt / CorrectGuesses 列名对 users 执行 AutoMigrate，
+		// 将这些列的数据并入标准列后删除
+		Version: 2,
+		Name:    "merge_legacy_user_columns",
+		UpFunc: func(tx *sql.Tx, dialect string) error {
+			legacy := []struct{ from, to, merge string }{
+				{"CorrectGuesses", "correct_guesses", "correct_guesses = CASE WHEN CorrectGuesses > correct_guesses THEN CorrectGuesses ELSE correct_guesses END"},
+				{"CreatedAt", "created_at", "created_at = COALESCE(created_at, CreatedAt)"},
+				{"UpdatedAt", "updated_at", "updated_at = COALESCE(updated_at, UpdatedAt)"},
+			}
+			for _, col := range legacy {
+				exists, err := migrate.ColumnExists(tx, dialect, "users", col.from)
+				if err != nil {
+					return err
+				}
+				if !exists {
+					continue
+				}
+				if _, err := tx.Exec("UPDATE users SET " + col.merge); err != nil {
+					return err
+				}
+				if _, err := tx.Exec("ALTER TABLE users DROP COLUMN " + col.from); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 3,
+		Name:    "create_sessions",
+		Up: map[string][]string{
+			"mysql": {`CREATE TABLE IF NOT EXISTS sessions (
+    ID               VARCHAR(64)  NOT NULL,
+    UserID           VARCHAR(255) NOT NULL,
+    AccessHash       CHAR(64)     NOT NULL,
+    RefreshHash      CHAR(64)     NOT NULL,
+    AccessExpiresAt  DATETIME     NOT NULL,
+    RefreshExpiresAt DATETIME     NOT NULL,
+    CreatedAt        DATETIME     NOT NULL,
+    RevokedAt        DATETIME     NULL,
+    PRIMARY KEY (ID),
+    CONSTRAINT uix_sessions_access UNIQUE (AccessHash),
+    CONSTRAINT uix_sessions_refresh UNIQUE (RefreshHash),
+    INDEX idx_sessions_user (UserID),
+    INDEX idx_sessions_refresh_expires (RefreshExpiresAt)
+)`},
+			"sqlite": {`CREATE TABLE IF NOT EXISTS sessions (
+    ID               VARCHAR(64)  NOT NULL,
+    UserID           VARCHAR(255) NOT NULL,
+    AccessHash       CHAR(64)     NOT NULL,
+    RefreshHash      CHAR(64)     NOT NULL,
+    AccessExpiresAt  DATETIME     NOT NULL,
+    RefreshExpiresAt DATETIME     NOT NULL,
+    CreatedAt        DATETIME     NOT NULL,
+    RevokedAt        DATETIME     NULL,
+    PRIMARY KEY (ID),
+    CONSTRAINT uix_sessions_access UNIQUE (AccessHash),
+    CONSTRAINT uix_sessions_refresh UNIQUE (RefreshHash)
+)`,
+				`CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions (UserID)`,
+				`CREATE INDEX IF NOT EXISTS idx_sessions_refresh_expires ON sessions (RefreshExpiresAt)`,
+			},
+		},
+		Down: migrate.SameSQL(`DROP TABLE IF EXISTS sessions`),
+	},
+	{
+		// 令牌改由 sessions 表以摘要形式保存，users 表不再保存明文令牌；回滚后旧令牌不会恢复，用户需重新登录
+		Version: 4,
+		Name:    "drop_users_auth_token",
+		Up:      migrate.SameSQL(`ALTER TABLE users DROP COLUMN AuthToken`),
+		Down:    migrate.SameSQL(`ALTER TABLE users ADD COLUMN AuthToken VARCHAR(255) NOT NULL DEFAULT ''`),
+	},
+	{
+		// 登录失败限流状态，多个副本共享
+		Version: 5,
+		Name:    "create_login_attempts",
+		Up: map[string][]string{
+			"mysql": {`CREATE TABLE IF NOT EXISTS login_attempts (
+    AttemptKey   VARCHAR(320) NOT NULL,
+    WindowStart  DATETIME     NULL,
+    Failures     INT          NOT NULL DEFAULT 0,
+    PrevFailures INT          NOT NULL DEFAULT 0,
+    Lockouts     INT          NOT NULL DEFAULT 0,
+    LockedUntil  DATETIME     NULL,
+    UpdatedAt    DATETIME     NULL,
+    PRIMARY KEY (AttemptKey),
+    INDEX idx_login_attempts_updated (UpdatedAt)
+)`},
+			"sqlite": {`CREATE TABLE IF NOT EXISTS login_attempts (
+    AttemptKey   VARCHAR(320) NOT NULL,
+    WindowStart  DATETIME     NULL,
+    Failures     INT          NOT NULL DEFAULT 0,
+    PrevFailures INT          NOT NULL DEFAULT 0,
+    Lockouts     INT          NOT NULL DEFAULT 0,
+    LockedUntil  DATETIME     NULL,
+    UpdatedAt    DATETIME     NULL,
+    PRIMARY KEY (AttemptKey)
+)`,
+				`CREATE INDEX IF NOT EXISTS idx_login_attempts_updated ON login_attempts (UpdatedAt)`,
+			},
+		},
+		Down: migrate.SameSQL(`DROP TABLE IF EXISTS login_attempts`),
+	},
+	{
+		// 用户 ID 序列，初始值取现有 %06d ID 的最大值
+		Version: 6,
+		Name:    "create_id_sequences",
+		Up: migrate.SameSQL(`CREATE TABLE IF NOT EXISTS id_sequences (
+    name  VARCHAR(64) NOT NULL,
+    value BIGINT      NOT NULL DEFAULT 0,
+    PRIMARY KEY (name)
+)`),
+		UpFunc: seedUserSequence,
+		Down:   migrate.SameSQL(`DROP TABLE IF EXISTS id_sequences`),
+	},
+	{
+		// 可选邮箱与找回密码 / 邮箱验证使用的一次性令牌
+		Version: 7,
+		Name:    "add_email_and_user_tokens",
+		Up: map[string][]string{
+			"mysql": {
+				`ALTER TABLE users ADD COLUMN Email VARCHAR(255) NULL, ADD COLUMN EmailVerifiedAt DATETIME NULL`,
+				`CREATE UNIQUE INDEX uix_users_email ON users (Email)`,
+				`CREATE TABLE IF NOT EXISTS user_tokens (
+    ID        VARCHAR(64)  NOT NULL,
+    UserID    VARCHAR(255) NOT NULL,
+    Purpose   VARCHAR(32)  NOT NULL,
+    TokenHash CHAR(64)     NOT NULL,
+    Email     VARCHAR(255) NOT NULL DEFAULT '',
+    ExpiresAt DATETIME     NOT NULL,
+    UsedAt    DATETIME     NULL,
+    CreatedAt DATETIME     NOT NULL,
+    PRIMARY KEY (ID),
+    CONSTRAINT uix_user_tokens_hash UNIQUE (TokenHash),
+    INDEX idx_user_tokens_user (UserID, Purpose),
+    INDEX idx_user_tokens_expires (ExpiresAt)
+)`,
+			},
+			"sqlite": {
+				`ALTER TABLE users ADD COLUMN Email VARCHAR(255) NULL`,
+				`ALTER TABLE users ADD COLUMN EmailVerifiedAt DATETIME NULL`,
+				`CREATE UNIQUE INDEX uix_users_email ON users (Email)`,
+				`CREATE TABLE IF NOT EXISTS user_tokens (
+    ID        VARCHAR(64)  NOT NULL,
+    UserID    VARCHAR(255) NOT NULL,
+    Purpose   VARCHAR(32)  NOT NULL,
+    TokenHash CHAR(64)     NOT NULL,
+    Email     VARCHAR(255) NOT NULL DEFAULT '',
+    ExpiresAt DATETIME     NOT NULL,
+    UsedAt    DATETIME     NULL,
+    CreatedAt DATETIME     NOT NULL,
+    PRIMARY KEY (ID),
+    CONSTRAINT uix_user_tokens_hash UNIQUE (TokenHash)
+)`,
+				`CREATE INDEX IF NOT EXISTS idx_user_tokens_user ON user_tokens (UserID, Purpose)`,
+				`CREATE INDEX IF NOT EXISTS idx_user_tokens_expires ON user_tokens (ExpiresAt)`,
+			},
+		},
+		Down: map[string][]string{
+			"mysql": {
+				`DROP TABLE IF EXISTS user_tokens`,
+				`DROP INDEX uix_users_email ON users`,
+				`ALTER TABLE users DROP COLUMN Email, DROP COLUMN EmailVerifiedAt`,
+			},
+			"sqlite": {
+				`DROP TABLE IF EXISTS user_tokens`,
+				`DROP INDEX IF EXISTS uix_users_email`,
+				`ALTER TABLE users DROP COLUMN Email`,
+				`ALTER TABLE users DROP COLUMN EmailVerifiedAt`,
+			},
+		},
+	},
+	{
+		// 两步验证（TOTP）与恢复码
+		Version: 8,
+		Name:    "add_user_totp",
+		Up: map[string][]string{
+			"mysql": {
+				`ALTER TABLE users
+    ADD COLUMN TOTPSecret    VARCHAR(255)  NULL,
+    ADD COLUMN TOTPEnabledAt DATETIME      NULL,
+    ADD COLUMN TOTPLastStep  BIGINT        NOT NULL DEFAULT 0,
+    ADD COLUMN RecoveryCodes VARCHAR(1024) NOT NULL DEFAULT ''`,
+			},
+			"sqlite": {
+				`ALTER TABLE users ADD COLUMN TOTPSecret VARCHAR(255) NULL`,
+				`ALTER TABLE users ADD COLUMN TOTPEnabledAt DATETIME NULL`,
+				`ALTER TABLE users ADD COLUMN TOTPLastStep BIGINT NOT NULL DEFAULT 0`,
+				`ALTER TABLE users ADD COLUMN RecoveryCodes VARCHAR(1024) NOT NULL DEFAULT ''`,
+			},
+		},
+		Down: map[string][]string{
+			"mysql": {
+				`ALTER TABLE users DROP COLUMN TOTPSecret, DROP COLUMN TOTPEnabledAt, DROP COLUMN TOTPLastStep, DROP COLUMN RecoveryCodes`,
+			},
+			"sqlite": {
+				`ALTER TABLE users DROP COLUMN TOTPSecret`,
+				`ALTER TABLE users DROP COLUMN TOTPEnabledAt`,
+				`ALTER TABLE users DROP COLUMN TOTPLastStep`,
+				`ALTER TABLE users DROP COLUMN RecoveryCodes`,
+			},
+		},
+	},
+	{
+		// OIDC 外部身份与本地用户的绑定
+		Version: 9,
+		Name:    "create_user_identities",
+		Up: map[string][]string{
+			"mysql": {`CREATE TABLE IF NOT EXISTS user_identities (
+    ID          VARCHAR(64)  NOT NULL,
+    Issuer      VARCHAR(255) NOT NULL,
+    Subject     VARCHAR(255) NOT NULL,
+    UserID      VARCHAR(255) NOT NULL,
+    Email       VARCHAR(255) NOT NULL DEFAULT '',
+    CreatedAt   DATETIME     NOT NULL,
+    LastLoginAt DATETIME     NOT NULL,
+    PRIMARY KEY (ID),
+    CONSTRAINT uix_user_identities_subject UNIQUE (Issuer, Subject),
+    INDEX idx_user_identities_user (UserID)
+)`},
+			"sqlite": {
+				`CREATE TABLE IF NOT EXISTS user_identities (
+    ID          VARCHAR(64)  NOT NULL,
+    Issuer      VARCHAR(255) NOT NULL,
+    Subject     VARCHAR(255) NOT NULL,
+    UserID      VARCHAR(255) NOT NULL,
+    Email       VARCHAR(255) NOT NULL DEFAULT '',
+    CreatedAt   DATETIME     NOT NULL,
+    LastLoginAt DATETIME     NOT NULL,
+    PRIMARY KEY (ID),
+    CONSTRAINT uix_user_identities_subject UNIQUE (Issuer, Subject)
+)`,
+				`CREATE INDEX IF NOT EXISTS idx_user_identities_user ON user_identities (UserID)`,
+			},
+		},
+		Down: migrate.SameSQL(`DROP TABLE IF EXISTS user_identities`),
+	},
+	{
+		// 角色与账号停用：roles 为可授予的角色，user_roles 记录授予关系
+		Version: 10,
+		Name:    "create_roles",
+		Up: map[string][]string{
+			"mysql": {
+				`ALTER TABLE users ADD COLUMN DisabledAt DATETIME NULL`,
+				`CREATE TABLE IF NOT EXISTS roles (
+    Name        VARCHAR(32)  NOT NULL,
+    Description VARCHAR(255) NOT NULL DEFAULT '',
+    PRIMARY KEY (Name)
+)`,
+				`INSERT INTO roles (Name, Description) VALUES ('admin', '管理用户、重置游戏与排行榜')`,
+				`CREATE TABLE IF NOT EXISTS user_roles (
+    UserID    VARCHAR(255) NOT NULL,
+    Role      VARCHAR(32)  NOT NULL,
+    GrantedBy VARCHAR(255) NOT NULL DEFAULT '',
+    GrantedAt DATETIME     NOT NULL,
+    PRIMARY KEY (UserID, Role),
+    INDEX idx_user_roles_role (Role)
+)`,
+			},
+			"sqlite": {
+				`ALTER TABLE users ADD COLUMN DisabledAt DATETIME NULL`,
+				`CREATE TABLE IF NOT EXISTS roles (
+    Name        VARCHAR(32)  NOT NULL,
+    Description VARCHAR(255) NOT NULL DEFAULT '',
+    PRIMARY KEY (Name)
+)`,
+				`INSERT INTO roles (Name, Description) VALUES ('admin', '管理用户、重置游戏与排行榜')`,
+				`CREATE TABLE IF NOT EXISTS user_roles (
+    UserID    VARCHAR(255) NOT NULL,
+    Role      VARCHAR(32)  NOT NULL,
+    GrantedBy VARCHAR(255) NOT NULL DEFAULT '',
+    GrantedAt DATETIME     NOT NULL,
+    PRIMARY KEY (UserID, Role)
+)`,
+				`CREATE INDEX IF NOT EXISTS idx_user_roles_role ON user_roles (Role)`,
+			},
+		},
+		Down: migrate.SameSQL(
+			`DROP TABLE IF EXISTS user_roles`,
+			`DROP TABLE IF EXISTS roles`,
+			`ALTER TABLE users DROP COLUMN DisabledAt`,
+		),
+	},
+	{
+		// 已轮换的刷新令牌摘要，再次出现时视为令牌被盗用并吊销所属会话
+		Version: 11,
+		Name:    "create_rotated_refresh_tokens",
+		Up: map[string][]string{
+			"mysql": {`CREATE TABLE IF NOT EXISTS rotated_refresh_tokens (
+    TokenHash CHAR(64)    NOT NULL,
+    SessionID VARCHAR(64) NOT NULL,
+    ExpiresAt DATETIME    NOT NULL,
+    PRIMARY KEY (TokenHash),
+    INDEX idx_rotated_refresh_tokens_expires (ExpiresAt)
+)`},
+			"sqlite": {
+				`CREATE TABLE IF NOT EXISTS rotated_refresh_tokens (
+    TokenHash CHAR(64)    NOT NULL,
+    SessionID VARCHAR(64) NOT NULL,
+    ExpiresAt DATETIME    NOT NULL,
+    PRIMARY KEY (TokenHash)
+)`,
+				`CREATE INDEX IF NOT EXISTS idx_rotated_refresh_tokens_expires ON rotated_refresh_tokens (ExpiresAt)`,
+			},
+		},
+		Down: migrate.SameSQL(`DROP TABLE IF EXISTS rotated_refresh_tokens`),
+	},
+}
+
+// dialectOf 返回迁移使用的方言名称
+func dialectOf(db *gorm.DB) string {
+	if strings.HasPrefix(db.Dialect().GetName(), "sqlite") {
+		return "sqlite"
+	}
+	return "mysql"
+}
+
+func newUserMigrator(db *gorm.DB) *migrate.Migrator {
+	return migrate.New(sqlDBOf(db), dialectOf(db), "login-service", userMigrations)
+}
+
+// autoMigrateEnabled 启动时是否自动执行迁移，AUTO_MIGRATE=false 时关闭
+func autoMigrateEnabled() bool {
+	return !strings.EqualFold(os.Getenv("AUTO_MIGRATE"), "false")
+}
+
+// migrateMain 处理 `login-service migrate ...` 子命令
+func migrateMain(args []string) {
+	var dbc DBConfig
+	if storeDriver("") == driverMySQL {
+		dbc = loadDBConfigFromNacos()
+	}
+	if storeDriver(dbc.DBDriver) == driverMemory {
+		fmt.Println("memory store has no schema to migrate")
+		return
+	}
+	gdb, err := openDatabase(dbc)
+	if err != nil {
+		logger.Fatal("open database", zap.Error(err))
+	}
+	defer gdb.Close()
+
+	if err := migrate.RunCommand(newUserMigrator(gdb), args); err != nil {
+		logger.Fatal("migration failed", zap.Error(err))
+	}
+}
@@ -1,15 +1,12 @@
 package main
 
 import (
-	"fmt"
-	"net"
 	"os"
 
 	"github.com/nacos-group/nacos-sdk-go/clients"
 	"github.com/nacos-group/nacos-sdk-go/clients/config_client"
 	"github.com/nacos-group/nacos-sdk-go/clients/naming_client"
 	"github.com/nacos-group/nacos-sdk-go/common/constant"
-	"github.com/nacos-group/nacos-sdk-go/vo"
 	"go.uber.org/zap"
 )
 
@@ -18,7 +15,12 @@ var ConfigClient config_client.IConfigClient
 
 /* ---------- 初始化 ---------- */
 
+// initNacos 未配置 NACOS_SERVER_IP 时不连接 Nacos，NamingClient / ConfigClient 保持为 nil
 func initNacos() {
+	if !nacosConfigured() {
+		logger.Info("NACOS_SERVER_IP not set, running without nacos")
+		return
+	}
 	cc := constant.ClientConfig{
 		NamespaceId: os.Getenv("NACOS_NAMESPACE"),
 		TimeoutMs:   mustUint(os.Getenv("NACOS_TIMEOUT_MS")),
@@ -45,37 +47,6 @@ func initNacos() {
 	}
 }
 
-/* ---------- 工具 ---------- */
-
-func getHostIP() (string, error) {
-	addrs, _ := net.InterfaceAddrs()
-	for _, a := range addrs {
-		if ipnet, ok := a.(*net.IPNet); ok && !ipnet.IP.IsLoopback() && ipnet.IP.To4() != nil {
-			return ipnet.IP.String(), nil
-		}
-	}
-	return "", fmt.Errorf("no IP found")
-}
-
-func registerService(c naming_client.INamingClient, name, ip string, port uint64) error {
-	ok, err := c.RegisterInstance(vo.RegisterInstanceParam{
-		Ip: ip, Port: port, ServiceName: name,
-		Weight: 10, Enable: true, Healthy: true, Ephemeral: true,
-	})
-	if err != nil {
-		return err
-	}
-	if !ok {
-		return fmt.Errorf("register failed")
-	}
-	return nil
-}
-
-func deregisterLoginService() {
-	hostIP, _ := getHostIP()
-	if _, err := NamingClient.DeregisterInstance(vo.DeregisterInstanceParam{
-		Ip: hostIP, Port: 8083, ServiceName: "login-service",
-	}); err != nil {
-		logger.Error("deregister error", zap.Error(err))
-	}
+func nacosConfigured() bool {
+	return os.Getenv("NACOS_SERVER_IP") != ""
 }
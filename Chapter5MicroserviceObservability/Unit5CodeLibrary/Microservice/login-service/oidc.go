@@ -0,0 +1,852 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap"
+)
+
+// 企业账号登录（OIDC 依赖方）：
+//   - GET /oidc/login    生成 state / nonce / PKCE code_verifier，保存在短期 HttpOnly cookie 后跳转到身份提供方；
+//     携带 link=1 且已登录时，回调后把外部身份绑定到当前用户
+//   - GET /oidc/callback 校验 state，用授权码换取 ID Token，按提供方 JWKS 校验签名、iss、aud、exp、nonce
+//
+// 外部身份保存在 user_identities 表（issuer + sub 唯一）。首次登录时依次尝试：
+// 已绑定的身份 → OIDC_LINK_BY_EMAIL=true 时按双方均已验证的邮箱匹配现有用户 → OIDC_AUTO_CREATE（默认开启）创建新用户。
+// 新用户的本地密码为随机值，只能通过企业账号或找回密码登录。
+//
+// 登录成功后与 /login 一样写入认证 cookie；配置了 OIDC_POST_LOGIN_REDIRECT 时跳转回前端，
+// 前端凭 RefreshToken cookie 调用 /refresh 取得令牌，否则直接返回 loginResponse。
+// 已启用两步验证的用户同样需要 /login/2fa。
+//
+// 配置：OIDC_ISSUER、OIDC_CLIENT_ID、OIDC_CLIENT_SECRET、OIDC_REDIRECT_URL、OIDC_SCOPES（默认 openid profile email）。
+
+const (
+	oidcStateCookie = "oidc_state"
+	oidcStateTTL    = 10 * time.Minute
+	oidcKeyRefetch  = 30 * time.Second
+	oidcClockSkew   = 30 * time.Second
+)
+
+var (
+	errIdentityNotFound = errors.New("identity not found")
+	errIdentityTaken    = errors.New("identity already linked")
+	errOIDCUnknownKey   = errors.New("unknown signing key")
+)
+
+// oidcClient 未配置 OIDC_ISSUER 时为 nil
+var oidcClient *oidcProvider
+
+type oidcConfig struct {
+	issuer            string
+	clientID          string
+	clientSecret      string
+	redirectURL       string
+	scopes            string
+	postLoginRedirect string
+	linkByEmail       bool
+	autoCreate        bool
+}
+
+// oidcMetadata 提供方 /.well-known/openid-configuration 中用到的字段
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcProvider struct {
+	cfg    oidcConfig
+	client *http.Client
+
+	mu        sync.Mutex
+	meta      *oidcMetadata
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+func initOIDC() {
+	issuer := strings.TrimRight(os.Getenv("OIDC_ISSUER"), "/")
+	if issuer == "" {
+		return
+	}
+	cfg := oidcConfig{
+		issuer:            issuer,
+		clientID:          os.Getenv("OIDC_CLIENT_ID"),
+		clientSecret:      os.Getenv("OIDC_CLIENT_SECRET"),
+		redirectURL:       os.Getenv("OIDC_REDIRECT_URL"),
+		scopes:            os.Getenv("OIDC_SCOPES"),
+		postLoginRedirect: os.Getenv("OIDC_POST_LOGIN_REDIRECT"),
+		linkByEmail:       strings.EqualFold(os.Getenv("OIDC_LINK_BY_EMAIL"), "true"),
+		autoCreate:        !strings.EqualFold(os.Getenv("OIDC_AUTO_CREATE"), "false"),
+	}
+	if cfg.clientID == "" || cfg.redirectURL == "" {
+		logger.Fatal("OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required when OIDC_ISSUER is set")
+	}
+	if cfg.scopes == "" {
+		cfg.scopes = "openid profile email"
+	}
+	oidcClient = newOIDCProvider(cfg)
+	logger.Info("oidc enabled", zap.String("issuer", issuer), zap.String("clientID", cfg.clientID))
+}
+
+func newOIDCProvider(cfg oidcConfig) *oidcProvider {
+	return &oidcProvider{cfg: cfg, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (p *oidcProvider) getJSON(u string, v interface{}) error {
+	resp, err := p.client.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// metadata 首次使用时读取提供方配置，失败时下次请求重试
+func (p *oidcProvider) metadata() (*oidcMetadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, nil
+	}
+	var m oidcMetadata
+	if err := p.getJSON(p.cfg.issuer+"/.well-known/openid-configuration", &m); err != nil {
+		return nil, err
+	}
+	if strings.TrimRight(m.Issuer, "/") != p.cfg.issuer {
+		return nil, fmt.Errorf("issuer mismatch: discovered %q", m.Issuer)
+	}
+	if m.AuthorizationEndpoint == "" || m.TokenEndpoint == "" || m.JWKSURI == "" {
+		return nil, errors.New("incomplete provider metadata")
+	}
+	p.meta = &m
+	return p.meta, nil
+}
+
+// key 按 kid 取验签公钥；未知 kid 时重新拉取 JWKS（间隔不少于 30 秒）
+func (p *oidcProvider) key(kid string) (crypto.PublicKey, error) {
+	meta, err := p.metadata()
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if k, ok := p.keys[kid]; ok {
+		return k, nil
+	}
+	if time.Since(p.fetchedAt) < oidcKeyRefetch {
+		return nil, errOIDCUnknownKey
+	}
+	var set struct {
+		Keys []oidcJWK `json:"keys"`
+	}
+	p.fetchedAt = time.Now()
+	if err := p.getJSON(meta.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			logger.Warn("oidc jwk skipped", zap.String("kid", k.Kid), zap.Error(err))
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	p.keys = keys
+	if k, ok := keys[kid]; ok {
+		return k, nil
+	}
+	return nil, errOIDCUnknownKey
+}
+
+// authCodeURL 构造授权请求地址（PKCE S256）
+func (p *oidcProvider) authCodeURL(state, nonce, verifier string) (string, error) {
+	meta, err := p.metadata()
+	if err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.cfg.clientID)
+	q.Set("redirect_uri", p.cfg.redirectURL)
+	q.Set("scope", p.cfg.scopes)
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	q.Set("code_challenge_method", "S256")
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return meta.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// exchange 用授权码换取 ID Token
+func (p *oidcProvider) exchange(code, verifier string) (string, error) {
+	meta, err := p.metadata()
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.redirectURL)
+	form.Set("code_verifier", verifier)
+	req, err := http.NewRequest(http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.cfg.clientID), url.QueryEscape(p.cfg.clientSecret))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return "", fmt.Errorf("token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || body.Error != "" {
+		return "", fmt.Errorf("token endpoint: %s %s %s", resp.Status, body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return "", errors.New("token response without id_token")
+	}
+	return body.IDToken, nil
+}
+
+/* ----------------- ID Token ----------------- */
+
+type idTokenClaims struct {
+	Issuer            string      `json:"iss"`
+	Subject           string      `json:"sub"`
+	Audience          audience    `json:"aud"`
+	AuthorizedParty   string      `json:"azp"`
+	ExpiresAt         int64       `json:"exp"`
+	IssuedAt          int64       `json:"iat"`
+	Nonce             string      `json:"nonce"`
+	Email             string      `json:"email"`
+	EmailVerified     interface{} `json:"email_verified"`
+	PreferredUsername string      `json:"preferred_username"`
+	Name              string      `json:"name"`
+}
+
+// audience aud 可以是字符串或字符串数组
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*a = audience{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+func (a audience) contains(s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// emailVerified 部分提供方以字符串 "true" 表示
+func (c *idTokenClaims) emailVerified() bool {
+	switch v := c.EmailVerified.(type) {
+	case bool:
+		return v
+	case string:
+		return strings.EqualFold(v, "true")
+	}
+	return false
+}
+
+// verifyIDToken 校验签名及 iss / aud / azp / exp / iat / nonce
+func (p *oidcProvider) verifyIDToken(raw, nonce string, now time.Time) (*idTokenClaims, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed id_token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed signature")
+	}
+	pub, err := p.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err = verifyJWS(header.Alg, pub, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, err
+	}
+
+	var claims idTokenClaims
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	meta, _ := p.metadata()
+	skew := int64(oidcClockSkew / time.Second)
+	switch {
+	case claims.Issuer != meta.Issuer:
+		return nil, fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	case !claims.Audience.contains(p.cfg.clientID):
+		return nil, errors.New("audience mismatch")
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != p.cfg.clientID:
+		return nil, errors.New("azp mismatch")
+	case claims.ExpiresAt+skew < now.Unix():
+		return nil, errors.New("id_token expired")
+	case claims.IssuedAt-skew > now.Unix():
+		return nil, errors.New("id_token issued in the future")
+	case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return nil, errors.New("nonce mismatch")
+	case claims.Subject == "":
+		return nil, errors.New("id_token without sub")
+	}
+	return &claims, nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return errors.New("malformed token segment")
+	}
+	return json.Unmarshal(b, v)
+}
+
+// verifyJWS 按 alg 校验签名，alg 须与密钥类型一致
+func verifyJWS(alg string, pub crypto.PublicKey, signed, sig []byte) error {
+	errBad := errors.New("invalid id_token signature")
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		if alg != "RS256" {
+			break
+		}
+		sum := sha256.Sum256(signed)
+		if rsa.VerifyPKCS1v15(k, crypto.SHA256, sum[:], sig) != nil {
+			return errBad
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if alg != "ES256" || len(sig) != 64 {
+			break
+		}
+		sum := sha256.Sum256(signed)
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(k, sum[:], r, s) {
+			return errBad
+		}
+		return nil
+	case ed25519.PublicKey:
+		if alg != "EdDSA" {
+			break
+		}
+		if !ed25519.Verify(k, signed, sig) {
+			return errBad
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported id_token alg %q", alg)
+}
+
+// oidcJWK 提供方 JWKS 中的公钥，支持 RSA、EC P-256 与 Ed25519
+type oidcJWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k oidcJWK) publicKey() (crypto.PublicKey, error) {
+	b := func(s string) ([]byte, error) { return base64.RawURLEncoding.DecodeString(s) }
+	switch k.Kty {
+	case "RSA":
+		n, err := b(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := b(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := b(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := b(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("point not on curve")
+		}
+		return pub, nil
+	case "OKP":
+		x, err := b(k.X)
+		if err != nil || k.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported kty %q", k.Kty)
+}
+
+/* ----------------- 外部身份 ----------------- */
+
+// UserIdentity 外部身份与本地用户的绑定
+type UserIdentity struct {
+	ID          string    `gorm:"column:ID;primary_key"`
+	Issuer      string    `gorm:"column:Issuer"`
+	Subject     string    `gorm:"column:Subject"`
+	UserID      string    `gorm:"column:UserID"`
+	Email       string    `gorm:"column:Email"`
+	CreatedAt   time.Time `gorm:"column:CreatedAt"`
+	LastLoginAt time.Time `gorm:"column:LastLoginAt"`
+}
+
+func (UserIdentity) TableName() string { return "user_identities" }
+
+// IdentityStore 外部身份存储
+type IdentityStore interface {
+	Find(issuer, subject string) (*UserIdentity, error)
+	// Create 同一 issuer + subject 已绑定时返回 errIdentityTaken
+	Create(id *UserIdentity) error
+	Save(id *UserIdentity) error
+}
+
+var identities IdentityStore
+
+/* ----------------- HTTP ----------------- */
+
+// oidcState 授权请求期间保存在 cookie 中的状态
+type oidcState struct {
+	State      string `json:"s"`
+	Nonce      string `json:"n"`
+	Verifier   string `json:"v"`
+	LinkUserID string `json:"l,omitempty"`
+}
+
+// 跳转到身份提供方
+func oidcLoginHandler(c *gin.Context) {
+	if oidcClient == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "oidc not configured"})
+		return
+	}
+
+	var st oidcState
+	if c.Query("link") == "1" {
+		sess, ok := requireSession(c)
+		if !ok {
+			return
+		}
+		st.LinkUserID = sess.UserID
+	}
+	var err error
+	if st.State, err = generateRandomToken(16); err == nil {
+		if st.Nonce, err = generateRandomToken(16); err == nil {
+			st.Verifier, err = generateRandomToken(32)
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "random error"})
+		return
+	}
+	target, err := oidcClient.authCodeURL(st.State, st.Nonce, st.Verifier)
+	if err != nil {
+		logger.Error("OIDC discovery error", zap.Error(err))
+		c.JSON(http.StatusBadGateway, gin.H{"error": "identity provider unavailable"})
+		return
+	}
+	raw, _ := json.Marshal(st)
+	c.SetSameSite(http.SameSiteLaxMode)
+	// 回调是身份提供方发起的跨站跳转，state Cookie 须为 Lax 才会随之发送
+	cookieAttrs.setSameSite(c, oidcStateCookie, base64.RawURLEncoding.EncodeToString(raw), "/oidc", int(oidcStateTTL.Seconds()), true, http.SameSiteLaxMode)
+	c.Redirect(http.StatusFound, target)
+}
+
+// 身份提供方回调
+func oidcCallbackHandler(c *gin.Context) {
+	if oidcClient == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "oidc not configured"})
+		return
+	}
+
+	// state 只能使用一次
+	cookie, _ := c.Cookie(oidcStateCookie)
+	cookieAttrs.setSameSite(c, oidcStateCookie, "", "/oidc", -1, true, http.SameSiteLaxMode)
+	var st oidcState
+	if raw, err := base64.RawURLEncoding.DecodeString(cookie); err != nil || json.Unmarshal(raw, &st) != nil || st.State == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing or expired state"})
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(st.State), []byte(c.Query("state"))) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "state mismatch"})
+		return
+	}
+	if e := c.Query("error"); e != "" {
+		logger.Warn("OIDC authorization denied", zap.String("error", e), zap.String("description", c.Query("error_description")))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authorization denied"})
+		return
+	}
+	code := c.Query("code")
+	if code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing code"})
+		return
+	}
+
+	idToken, err := oidcClient.exchange(code, st.Verifier)
+	if err != nil {
+		logger.Error("OIDC code exchange error", zap.Error(err))
+		c.JSON(http.StatusBadGateway, gin.H{"error": "code exchange failed"})
+		return
+	}
+	claims, err := oidcClient.verifyIDToken(idToken, st.Nonce, time.Now())
+	if err != nil {
+		logger.Warn("Invalid id_token", zap.Error(err))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid id_token"})
+		return
+	}
+
+	user, err := resolveOIDCUser(claims, st.LinkUserID)
+	switch err {
+	case nil:
+	case errIdentityTaken:
+		c.JSON(http.StatusConflict, gin.H{"error": "identity linked to another user"})
+		return
+	case errIdentityNotFound:
+		c.JSON(http.StatusForbidden, gin.H{"error": "no linked account"})
+		return
+	default:
+		logger.Error("OIDC user resolve error", zap.String("sub", claims.Subject), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+
+	if rejectDisabled(c, user) {
+		return
+	}
+	if user.TOTPEnabledAt != nil {
+		if target := oidcClient.cfg.postLoginRedirect; target != "" {
+			token, err := issueUserToken(user, purposeMFALogin, envDuration("MFA_CHALLENGE_TTL", defaultMFAChallenge))
+			if err != nil {
+				logger.Error("MFA challenge error", zap.String("userID", user.ID), zap.Error(err))
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "token error"})
+				return
+			}
+			c.Redirect(http.StatusFound, appendQuery(target, "mfaToken", token))
+			return
+		}
+		respondMFARequired(c, user)
+		return
+	}
+
+	tokens, err := issueSession(user)
+	if err != nil {
+		logger.Error("Session create error", zap.String("userID", user.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "token error"})
+		return
+	}
+	logger.Info("User logged in", zap.String("username", user.Username), zap.String("userID", user.ID),
+		zap.String("issuer", claims.Issuer))
+	writeAuthCookies(c, tokens)
+	if target := oidcClient.cfg.postLoginRedirect; target != "" {
+		c.Redirect(http.StatusFound, appendQuery(target, "oidc", "1"))
+		return
+	}
+	c.JSON(http.StatusOK, newLoginResponse(tokens, user.ID))
+}
+
+func appendQuery(target, key, value string) string {
+	sep := "?"
+	if strings.Contains(target, "?") {
+		sep = "&"
+	}
+	return target + sep + url.QueryEscape(key) + "=" + url.QueryEscape(value)
+}
+
+// resolveOIDCUser 查找或创建外部身份对应的本地用户；linkUserID 非空时绑定到该用户
+func resolveOIDCUser(claims *idTokenClaims, linkUserID string) (*User, error) {
+	now := time.Now()
+	ident, err := identities.Find(claims.Issuer, claims.Subject)
+	if err == nil {
+		if linkUserID != "" && linkUserID != ident.UserID {
+			return nil, errIdentityTaken
+		}
+		ident.LastLoginAt = now
+		if claims.Email != "" {
+			ident.Email = claims.Email
+		}
+		if err = identities.Save(ident); err != nil {
+			return nil, err
+		}
+		return users.FindByID(ident.UserID)
+	}
+	if err != errIdentityNotFound {
+		return nil, err
+	}
+
+	email := ""
+	if claims.emailVerified() {
+		email, _ = normalizeEmail(claims.Email)
+	}
+	var user *User
+	switch {
+	case linkUserID != "":
+		user, err = users.FindByID(linkUserID)
+	case email != "" && oidcClient.cfg.linkByEmail:
+		// 本地邮箱未验证时不绑定，避免他人预先用该邮箱注册后接管企业账号登录
+		user, err = users.FindByEmail(email)
+		if err == nil && user.EmailVerifiedAt == nil {
+			err = errUserNotFound
+		}
+		if err == errUserNotFound && oidcClient.cfg.autoCreate {
+			user, err = createOIDCUser(claims, email)
+		}
+	case oidcClient.cfg.autoCreate:
+		user, err = createOIDCUser(claims, email)
+	default:
+		return nil, errIdentityNotFound
+	}
+	if err == errUserNotFound {
+		return nil, errIdentityNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	identID, err := generateRandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	ident = &UserIdentity{
+		ID:          identID,
+		Issuer:      claims.Issuer,
+		Subject:     claims.Subject,
+		UserID:      user.ID,
+		Email:       claims.Email,
+		CreatedAt:   now,
+		LastLoginAt: now,
+	}
+	if err = identities.Create(ident); err != nil {
+		return nil, err
+	}
+	logger.Info("External identity linked", zap.String("userID", user.ID),
+		zap.String("issuer", claims.Issuer), zap.String("sub", claims.Subject))
+	return user, nil
+}
+
+// createOIDCUser 以 preferred_username / 邮箱前缀为基础生成符合规则且未占用的用户名，本地密码为随机值
+func createOIDCUser(claims *idTokenClaims, email string) (*User, error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+	base = sanitizeUsername(base)
+
+	secret, err := generateAuthToken()
+	if err != nil {
+		return nil, err
+	}
+	hash, err := passwordHasher.Hash(secret)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < 5; i++ {
+		name := base
+		if i > 0 || !usernameAllowed(name) {
+			suffix := make([]byte, 3)
+			if _, err = rand.Read(suffix); err != nil {
+				return nil, err
+			}
+			name = truncate(base, policy.usernameMax-7) + "-" + hex.EncodeToString(suffix)
+		}
+		id, err := userIDs.NextID()
+		if err != nil {
+			return nil, err
+		}
+		user := &User{ID: id, Username: name, Password: hash}
+		if email != "" {
+			now := time.Now()
+			user.Email, user.EmailVerifiedAt = &email, &now
+		}
+		switch err = users.Create(user); err {
+		case nil:
+			logger.Info("User registered", zap.String("username", name), zap.String("issuer", claims.Issuer))
+			return user, nil
+		case errEmailTaken:
+			// 邮箱已属于其他用户且未开启按邮箱绑定，新用户不记录邮箱
+			email = ""
+		case errUsernameTaken:
+		default:
+			return nil, err
+		}
+	}
+	return nil, errors.New("could not allocate username")
+}
+
+func usernameAllowed(name string) bool {
+	var errs validationErrors
+	policy.validateUsername(name, &errs)
+	return len(errs) == 0
+}
+
+// sanitizeUsername 去掉用户名规则不允许的字符
+func sanitizeUsername(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '_' || r == '.' || r == '-':
+			if b.Len() > 0 {
+				b.WriteRune(r)
+			}
+		}
+	}
+	if b.Len() == 0 {
+		return "user"
+	}
+	return truncate(b.String(), policy.usernameMax)
+}
+
+func truncate(s string, n int) string {
+	if n > 0 && len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+/* ----------------- gorm 实现 ----------------- */
+
+type sqlIdentityStore struct {
+	db *gorm.DB
+}
+
+func (s *sqlIdentityStore) Find(issuer, subject string) (*UserIdentity, error) {
+	var id UserIdentity
+	if err := s.db.Where("Issuer = ? AND Subject = ?", issuer, subject).First(&id).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, errIdentityNotFound
+		}
+		return nil, err
+	}
+	return &id, nil
+}
+
+func (s *sqlIdentityStore) Create(id *UserIdentity) error {
+	if _, err := s.Find(id.Issuer, id.Subject); err == nil {
+		return errIdentityTaken
+	} else if err != errIdentityNotFound {
+		return err
+	}
+	return s.db.Create(id).Error
+}
+
+func (s *sqlIdentityStore) Save(id *UserIdentity) error {
+	return s.db.Save(id).Error
+}
+
+/* ----------------- 内存实现 ----------------- */
+
+type memoryIdentityStore struct {
+	mu   sync.Mutex
+	byID map[string]*UserIdentity
+}
+
+func newMemoryIdentityStore() *memoryIdentityStore {
+	return &memoryIdentityStore{byID: make(map[string]*UserIdentity)}
+}
+
+func (s *memoryIdentityStore) Find(issuer, subject string) (*UserIdentity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range s.byID {
+		if id.Issuer == issuer && id.Subject == subject {
+			cp := *id
+			return &cp, nil
+		}
+	}
+	return nil, errIdentityNotFound
+}
+
+func (s *memoryIdentityStore) Create(id *UserIdentity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, old := range s.byID {
+		if old.Issuer == id.Issuer && old.Subject == id.Subject {
+			return errIdentityTaken
+		}
+	}
+	cp := *id
+	s.byID[cp.ID] = &cp
+	return nil
+}
+
+func (s *memoryIdentityStore) Save(id *UserIdentity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp := *id
+	s.byID[cp.ID] = &cp
+	return nil
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// useMemoryStores 以内存存储与临时 JWT 密钥运行测试，结束后恢复全局状态
+func useMemoryStores(t *testing.T) {
+	t.Helper()
+	t.Setenv("STORE_DRIVER", driverMemory)
+	set, err := openStores(DBConfig{DBDriver: driverMemory})
+	if err != nil {
+		t.Fatalf("open stores: %v", err)
+	}
+	useStores(t, set)
+}
+
+// useStores 以 set 中的存储与临时 JWT 密钥替换全局状态，测试结束后恢复
+func useStores(t *testing.T, set *storeSet) {
+	t.Helper()
+	ring, err := loadKeyRing("")
+	if err != nil {
+		t.Fatalf("load key ring: %v", err)
+	}
+
+	prevUsers, prevSessions, prevAttempts, prevIDs := users, sessions, attempts, userIDs
+	prevTokens, prevIdents, prevRoles, prevKeys := userTokens, identities, userRoles, jwtKeys
+	prevLimiter := limiter
+	users, sessions, attempts, userIDs = set.users, set.sessions, set.attempts, set.ids
+	userTokens, identities, userRoles, jwtKeys = set.tokens, set.idents, set.roles, ring
+	limiter = newLoginLimiter(attempts)
+	t.Cleanup(func() {
+		users, sessions, attempts, userIDs = prevUsers, prevSessions, prevAttempts, prevIDs
+		userTokens, identities, userRoles, jwtKeys = prevTokens, prevIdents, prevRoles, prevKeys
+		limiter = prevLimiter
+	})
+}
+
+// oidcTestEnv 桩身份提供方与只挂载 /oidc 路由的 login-service
+type oidcTestEnv struct {
+	stub   *stubOIDCProvider
+	idp    *httptest.Server
+	app    *httptest.Server
+	client *http.Client
+}
+
+func newOIDCTestEnv(t *testing.T, cfg oidcConfig) *oidcTestEnv {
+	t.Helper()
+	useMemoryStores(t)
+
+	env := &oidcTestEnv{}
+	// 签发者地址在服务启动后才确定，先启动再创建桩
+	env.idp = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		env.stub.ServeHTTP(w, r)
+	}))
+	t.Cleanup(env.idp.Close)
+	stub, err := newStubOIDCProvider(env.idp.URL, "guess-game", "stub-secret")
+	if err != nil {
+		t.Fatalf("stub provider: %v", err)
+	}
+	env.stub = stub
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/oidc/login", oidcLoginHandler)
+	r.GET("/oidc/callback", oidcCallbackHandler)
+	env.app = httptest.NewServer(r)
+	t.Cleanup(env.app.Close)
+
+	cfg.issuer, cfg.clientID, cfg.clientSecret = stub.issuer, stub.clientID, stub.clientSecret
+	cfg.redirectURL = env.app.URL + "/oidc/callback"
+	cfg.scopes = "openid profile email"
+	prev := oidcClient
+	oidcClient = newOIDCProvider(cfg)
+	t.Cleanup(func() { oidcClient = prev })
+
+	jar, _ := cookiejar.New(nil)
+	env.client = &http.Client{
+		Jar: jar,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return env
+}
+
+// redirect 请求 u 并返回 302 的跳转地址
+func (env *oidcTestEnv) redirect(t *testing.T, u string) *url.URL {
+	t.Helper()
+	resp, err := env.client.Get(u)
+	if err != nil {
+		t.Fatalf("GET %s: %v", u, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("GET %s: status %d, want 302", u, resp.StatusCode)
+	}
+	loc, err := resp.Location()
+	if err != nil {
+		t.Fatalf("GET %s: %v", u, err)
+	}
+	return loc
+}
+
+// authorize 走 /oidc/login → 提供方 /authorize，返回带 code 与 state 的回调地址
+func (env *oidcTestEnv) authorize(t *testing.T, loginHint string) *url.URL {
+	t.Helper()
+	authURL := env.redirect(t, env.app.URL+"/oidc/login")
+	q := authURL.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" || q.Get("nonce") == "" {
+		t.Fatalf("authorization request lacks PKCE / nonce: %s", authURL)
+	}
+	q.Set("login_hint", loginHint)
+	authURL.RawQuery = q.Encode()
+	return env.redirect(t, authURL.String())
+}
+
+// login 完成一次完整的授权码流程，返回 loginResponse
+func (env *oidcTestEnv) login(t *testing.T, loginHint string) loginResponse {
+	t.Helper()
+	callback := env.authorize(t, loginHint)
+	resp, err := env.client.Get(callback.String())
+	if err != nil {
+		t.Fatalf("callback: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("callback: status %d, want 200", resp.StatusCode)
+	}
+	var body loginResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("callback: %v", err)
+	}
+	if !body.Success || body.ID == "" || body.AuthToken == "" || body.RefreshToken == "" {
+		t.Fatalf("callback: incomplete login response %+v", body)
+	}
+	return body
+}
+
+func TestOIDCLoginFlowLinksIdentity(t *testing.T) {
+	env := newOIDCTestEnv(t, oidcConfig{autoCreate: true})
+
+	first := env.login(t, "alice")
+	ident, err := identities.Find(env.stub.issuer, "stub|alice")
+	if err != nil {
+		t.Fatalf("identity not linked: %v", err)
+	}
+	if ident.UserID != first.ID {
+		t.Fatalf("identity linked to %s, want %s", ident.UserID, first.ID)
+	}
+	user, err := users.FindByID(first.ID)
+	if err != nil {
+		t.Fatalf("find user: %v", err)
+	}
+	if user.Username != "alice" || user.Email == nil || *user.Email != "alice@example.com" || user.EmailVerifiedAt == nil {
+		t.Fatalf("unexpected user %+v", user)
+	}
+	if _, err := authenticateToken(first.AuthToken); err != nil {
+		t.Fatalf("issued access token rejected: %v", err)
+	}
+
+	// 再次登录复用已绑定的身份，不创建新用户
+	second := env.login(t, "alice")
+	if second.ID != first.ID {
+		t.Fatalf("second login resolved to %s, want %s", second.ID, first.ID)
+	}
+	again, err := identities.Find(env.stub.issuer, "stub|alice")
+	if err != nil || again.ID != ident.ID {
+		t.Fatalf("identity replaced: %+v, %v", again, err)
+	}
+
+	if other := env.login(t, "bob"); other.ID == first.ID {
+		t.Fatalf("different subject resolved to the same user %s", other.ID)
+	}
+}
+
+func TestOIDCCallbackRejectsReplayedState(t *testing.T) {
+	env := newOIDCTestEnv(t, oidcConfig{autoCreate: true})
+
+	callback := env.authorize(t, "alice")
+	resp, err := env.client.Get(callback.String())
+	if err != nil {
+		t.Fatalf("callback: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("callback: status %d, want 200", resp.StatusCode)
+	}
+
+	// state cookie 已在首次回调时清除
+	resp, err = env.client.Get(callback.String())
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("replay: status %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestOIDCExchangeRequiresVerifier(t *testing.T) {
+	env := newOIDCTestEnv(t, oidcConfig{autoCreate: true})
+
+	authURL, err := oidcClient.authCodeURL("state", "nonce", "verifier-"+t.Name())
+	if err != nil {
+		t.Fatalf("auth url: %v", err)
+	}
+	code := env.redirect(t, authURL).Query().Get("code")
+	if code == "" {
+		t.Fatal("provider returned no code")
+	}
+	if _, err := oidcClient.exchange(code, "wrong-verifier"); err == nil {
+		t.Fatal("exchange succeeded with a mismatched code_verifier")
+	}
+}
+
+func TestOIDCCallbackWithoutAutoCreate(t *testing.T) {
+	env := newOIDCTestEnv(t, oidcConfig{})
+
+	callback := env.authorize(t, "carol")
+	resp, err := env.client.Get(callback.String())
+	if err != nil {
+		t.Fatalf("callback: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("callback: status %d, want 403", resp.StatusCode)
+	}
+	if _, err := identities.Find(env.stub.issuer, "stub|carol"); err != errIdentityNotFound {
+		t.Fatalf("identity created without auto-create: %v", err)
+	}
+}
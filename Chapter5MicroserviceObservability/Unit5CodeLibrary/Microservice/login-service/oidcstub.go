@@ -0,0 +1,245 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// 本地联调 / 测试用的 OIDC 身份提供方：`login-service oidc-stub`
+//
+// 不做真实认证，/authorize 直接以 login_hint（默认 player）作为用户签发授权码，
+// 邮箱为 <login_hint>@example.com 且视为已验证。要求 PKCE S256，授权码一分钟内有效、只能使用一次，
+// ID Token 以启动时生成的 RSA 密钥签名（RS256）。
+//
+// 配置：OIDC_STUB_ADDR（默认 :9096）、OIDC_STUB_ISSUER（默认 http://localhost:9096）、
+// OIDC_STUB_CLIENT_ID / OIDC_STUB_CLIENT_SECRET（默认 guess-game / stub-secret）。
+
+type stubAuthCode struct {
+	subject     string
+	nonce       string
+	challenge   string
+	redirectURI string
+	expiresAt   time.Time
+}
+
+type stubOIDCProvider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	key          *rsa.PrivateKey
+	kid          string
+
+	mu    sync.Mutex
+	codes map[string]stubAuthCode
+}
+
+func newStubOIDCProvider(issuer, clientID, clientSecret string) (*stubOIDCProvider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	kid, err := generateRandomToken(8)
+	if err != nil {
+		return nil, err
+	}
+	return &stubOIDCProvider{
+		issuer:       strings.TrimRight(issuer, "/"),
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		key:          key,
+		kid:          kid,
+		codes:        make(map[string]stubAuthCode),
+	}, nil
+}
+
+func oidcStubMain() {
+	addr := envOr("OIDC_STUB_ADDR", ":9096")
+	p, err := newStubOIDCProvider(
+		envOr("OIDC_STUB_ISSUER", "http://localhost:9096"),
+		envOr("OIDC_STUB_CLIENT_ID", "guess-game"),
+		envOr("OIDC_STUB_CLIENT_SECRET", "stub-secret"),
+	)
+	if err != nil {
+		logger.Fatal("oidc stub", zap.Error(err))
+	}
+	logger.Info("oidc stub listening", zap.String("addr", addr), zap.String("issuer", p.issuer))
+	if err = http.ListenAndServe(addr, p); err != nil {
+		logger.Fatal("oidc stub", zap.Error(err))
+	}
+}
+
+func envOr(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+func (p *stubOIDCProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/.well-known/openid-configuration":
+		writeStubJSON(w, http.StatusOK, map[string]interface{}{
+			"issuer":                                p.issuer,
+			"authorization_endpoint":                p.issuer + "/authorize",
+			"token_endpoint":                        p.issuer + "/token",
+			"jwks_uri":                              p.issuer + "/jwks",
+			"response_types_supported":              []string{"code"},
+			"subject_types_supported":               []string{"public"},
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+			"code_challenge_methods_supported":      []string{"S256"},
+		})
+	case "/jwks":
+		pub := p.key.PublicKey
+		writeStubJSON(w, http.StatusOK, map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "use": "sig", "alg": "RS256", "kid": p.kid,
+			"n": base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}}})
+	case "/authorize":
+		p.authorize(w, r)
+	case "/token":
+		p.token(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (p *stubOIDCProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirectURI := q.Get("redirect_uri")
+	switch {
+	case q.Get("client_id") != p.clientID:
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	case redirectURI == "":
+		http.Error(w, "redirect_uri required", http.StatusBadRequest)
+		return
+	case q.Get("response_type") != "code":
+		http.Error(w, "unsupported response_type", http.StatusBadRequest)
+		return
+	case q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256":
+		http.Error(w, "PKCE S256 required", http.StatusBadRequest)
+		return
+	}
+	subject := q.Get("login_hint")
+	if subject == "" {
+		subject = "player"
+	}
+
+	code, err := generateRandomToken(16)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	p.mu.Lock()
+	p.codes[code] = stubAuthCode{
+		subject:     subject,
+		nonce:       q.Get("nonce"),
+		challenge:   q.Get("code_challenge"),
+		redirectURI: redirectURI,
+		expiresAt:   time.Now().Add(time.Minute),
+	}
+	p.mu.Unlock()
+
+	back := url.Values{}
+	back.Set("code", code)
+	back.Set("state", q.Get("state"))
+	sep := "?"
+	if strings.Contains(redirectURI, "?") {
+		sep = "&"
+	}
+	http.Redirect(w, r, redirectURI+sep+back.Encode(), http.StatusFound)
+}
+
+func (p *stubOIDCProvider) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil {
+		writeStubJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	id, secret, ok := r.BasicAuth()
+	if ok {
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if id != p.clientID || secret != p.clientSecret {
+		writeStubJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	p.mu.Lock()
+	ac, found := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	switch {
+	case r.PostForm.Get("grant_type") != "authorization_code",
+		!found, time.Now().After(ac.expiresAt),
+		r.PostForm.Get("redirect_uri") != ac.redirectURI,
+		base64.RawURLEncoding.EncodeToString(sum[:]) != ac.challenge:
+		writeStubJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	idToken, err := p.sign(map[string]interface{}{
+		"iss":                p.issuer,
+		"sub":                "stub|" + ac.subject,
+		"aud":                p.clientID,
+		"iat":                now.Unix(),
+		"exp":                now.Add(5 * time.Minute).Unix(),
+		"nonce":              ac.nonce,
+		"email":              ac.subject + "@example.com",
+		"email_verified":     true,
+		"preferred_username": ac.subject,
+		"name":               ac.subject,
+	})
+	if err != nil {
+		writeStubJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	access, _ := generateAuthToken()
+	writeStubJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": access,
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func (p *stubOIDCProvider) sign(claims map[string]interface{}) (string, error) {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": p.kid})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+func writeStubJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
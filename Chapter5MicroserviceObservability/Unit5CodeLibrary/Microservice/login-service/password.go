@@ -0,0 +1,273 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+/* ----------------- 密码哈希 ----------------- */
+
+// 密码哈希算法由 PASSWORD_HASHER 指定：bcrypt（默认，BCRYPT_COST 设置代价）或
+// argon2id（ARGON2_TIME / ARGON2_MEMORY（KiB）/ ARGON2_THREADS 设置参数）。
+// 登录成功时，若存储的哈希与当前算法或参数不一致则透明地重新哈希。
+// 早期版本以明文保存的密码在下次登录成功时以当前算法重新哈希（常量时间比较）；
+// `login-service rehash-audit` 显示遗留明文为 0 后设置 LEGACY_PLAINTEXT_PASSWORDS=false，
+// 之后明文记录一律拒绝登录。Chapter 2 的 login-service 采用相同的策略与开关。
+const (
+	schemeBcrypt    = "bcrypt"
+	schemeArgon2id  = "argon2id"
+	schemePlaintext = "plaintext"
+)
+
+var errUnknownHasher = errors.New("unknown password hasher")
+
+// PasswordHasher 一种密码哈希算法
+type PasswordHasher interface {
+	Scheme() string
+	Hash(password string) (string, error)
+	Verify(hash, password string) (bool, error)
+	// NeedsRehash 哈希由本算法生成但参数与当前配置不同
+	NeedsRehash(hash string) bool
+}
+
+var passwordHasher PasswordHasher = bcryptHasher{cost: bcrypt.DefaultCost}
+
+// initPasswordHasher 按环境变量选择当前使用的哈希算法
+func initPasswordHasher() {
+	h, err := newPasswordHasher(os.Getenv("PASSWORD_HASHER"))
+	if err != nil {
+		logger.Fatal("password hasher", zap.Error(err))
+	}
+	passwordHasher = h
+	logger.Info("password hasher", zap.String("scheme", h.Scheme()))
+	if legacyPlaintextAllowed() {
+		logger.Info("legacy plaintext passwords are rehashed on login, set LEGACY_PLAINTEXT_PASSWORDS=false once rehash-audit reports no legacy accounts")
+	}
+}
+
+func newPasswordHasher(scheme string) (PasswordHasher, error) {
+	switch strings.ToLower(scheme) {
+	case "", schemeBcrypt:
+		cost := envInt("BCRYPT_COST", bcrypt.DefaultCost)
+		if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return bcryptHasher{cost: cost}, nil
+	case schemeArgon2id:
+		// argon2.IDKey 要求 threads 在 1..255 之间，超出范围时 uint8 会回绕（256 变为 0 导致 panic）
+		threads := envInt("ARGON2_THREADS", 2)
+		if threads > 255 {
+			return nil, fmt.Errorf("ARGON2_THREADS must be between 1 and 255")
+		}
+		return argon2idHasher{
+			time:    uint32(envInt("ARGON2_TIME", 3)),
+			memory:  uint32(envInt("ARGON2_MEMORY", 64*1024)),
+			threads: uint8(threads),
+			keyLen:  32,
+			saltLen: 16,
+		}, nil
+	default:
+		return nil, fmt.Errorf("%w %q", errUnknownHasher, scheme)
+	}
+}
+
+func envInt(name string, def int) int {
+	if v := os.Getenv(name); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+		logger.Warn("invalid integer, using default", zap.String("env", name), zap.String("value", v))
+	}
+	return def
+}
+
+// hashScheme 根据存储格式识别哈希算法，无法识别的视为明文
+func hashScheme(stored string) string {
+	switch {
+	case strings.HasPrefix(stored, "$2a$"), strings.HasPrefix(stored, "$2b$"), strings.HasPrefix(stored, "$2y$"):
+		return schemeBcrypt
+	case strings.HasPrefix(stored, "$argon2id$"):
+		return schemeArgon2id
+	default:
+		return schemePlaintext
+	}
+}
+
+// legacyPlaintextAllowed 是否接受并升级明文记录，默认开启，LEGACY_PLAINTEXT_PASSWORDS=false 时关闭
+func legacyPlaintextAllowed() bool {
+	return !strings.EqualFold(os.Getenv("LEGACY_PLAINTEXT_PASSWORDS"), "false")
+}
+
+// verifyPassword 校验密码；rehash 为 true 表示应以当前算法重新哈希后保存
+func verifyPassword(stored, password string) (ok, rehash bool, err error) {
+	switch scheme := hashScheme(stored); scheme {
+	case schemePlaintext:
+		if !legacyPlaintextAllowed() {
+			return false, false, nil
+		}
+		// 遗留明文记录：常量时间比较，成功后立即升级
+		ok = subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+		return ok, ok, nil
+	default:
+		h := passwordHasher
+		if h.Scheme() != scheme {
+			if h, err = newPasswordHasher(scheme); err != nil {
+				return false, false, err
+			}
+		}
+		if ok, err = h.Verify(stored, password); !ok || err != nil {
+			return false, false, err
+		}
+		return true, scheme != passwordHasher.Scheme() || passwordHasher.NeedsRehash(stored), nil
+	}
+}
+
+/* ----------------- bcrypt ----------------- */
+
+type bcryptHasher struct {
+	cost int
+}
+
+func (bcryptHasher) Scheme() string { return schemeBcrypt }
+
+func (h bcryptHasher) Hash(password string) (string, error) {
+	b, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	return string(b), err
+}
+
+func (bcryptHasher) Verify(hash, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (h bcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.cost
+}
+
+/* ----------------- argon2id ----------------- */
+
+// argon2idHasher 以 PHC 格式保存：$argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+type argon2idHasher struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+	keyLen  uint32
+	saltLen int
+}
+
+func (argon2idHasher) Scheme() string { return schemeArgon2id }
+
+func (h argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.time, h.memory, h.threads, h.keyLen)
+	b64 := base64.RawStdEncoding.EncodeToString
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.memory, h.time, h.threads, b64(salt), b64(key)), nil
+}
+
+// decode 解析 PHC 字符串，返回其中的参数、盐与摘要
+func (argon2idHasher) decode(hash string) (p argon2idHasher, salt, key []byte, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return p, nil, nil, errors.New("malformed argon2id hash")
+	}
+	var version int
+	if _, err = fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+	if _, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return p, nil, nil, fmt.Errorf("malformed argon2id params: %w", err)
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return p, nil, nil, err
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return p, nil, nil, err
+	}
+	p.keyLen, p.saltLen = uint32(len(key)), len(salt)
+	return p, salt, key, nil
+}
+
+func (h argon2idHasher) Verify(hash, password string) (bool, error) {
+	p, salt, key, err := h.decode(hash)
+	if err != nil {
+		return false, err
+	}
+	got := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, p.keyLen)
+	return subtle.ConstantTimeCompare(got, key) == 1, nil
+}
+
+func (h argon2idHasher) NeedsRehash(hash string) bool {
+	p, _, _, err := h.decode(hash)
+	return err != nil || p != h
+}
+
+/* ----------------- rehash-audit 子命令 ----------------- */
+
+// rehashAuditMain 处理 `login-service rehash-audit`：统计各哈希算法的账号数量，
+// 以及仍需在下次登录时升级（明文、旧算法或旧参数）的账号数量
+func rehashAuditMain() {
+	initPasswordHasher()
+
+	var dbc DBConfig
+	if storeDriver("") == driverMySQL {
+		dbc = loadDBConfigFromNacos()
+	}
+	if storeDriver(dbc.DBDriver) == driverMemory {
+		fmt.Println("memory store has no accounts to audit")
+		return
+	}
+	gdb, err := openDatabase(dbc)
+	if err != nil {
+		logger.Fatal("open database", zap.Error(err))
+	}
+	defer gdb.Close()
+
+	hashes, err := newSQLUserStore(gdb).PasswordHashes()
+	if err != nil {
+		logger.Fatal("load password hashes", zap.Error(err))
+	}
+	schemes, legacy := auditPasswordHashes(hashes)
+
+	names := make([]string, 0, len(schemes))
+	for name := range schemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Printf("current hasher: %s\n", passwordHasher.Scheme())
+	for _, name := range names {
+		fmt.Printf("%-12s %d\n", name, schemes[name])
+	}
+	fmt.Printf("total        %d\nlegacy       %d\n", len(hashes), legacy)
+}
+
+// auditPasswordHashes 按算法计数，legacy 为下次登录时会被重新哈希的数量
+func auditPasswordHashes(hashes []string) (schemes map[string]int, legacy int) {
+	schemes = make(map[string]int)
+	for _, h := range hashes {
+		scheme := hashScheme(h)
+		schemes[scheme]++
+		if scheme != passwordHasher.Scheme() || passwordHasher.NeedsRehash(h) {
+			legacy++
+		}
+	}
+	return schemes, legacy
+}
@@ -0,0 +1,48 @@
+package main
+
+import "testing"
+
+func TestLegacyPlaintextRehashedByDefault(t *testing.T) {
+	t.Setenv("LEGACY_PLAINTEXT_PASSWORDS", "")
+	// 明文记录可以登录，并要求立即重新哈希
+	if ok, rehash, err := verifyPassword("hunter2", "hunter2"); !ok || !rehash || err != nil {
+		t.Fatalf("plaintext login = ok %v, rehash %v, err %v; want ok and rehash", ok, rehash, err)
+	}
+	if ok, _, _ := verifyPassword("hunter2", "hunter3"); ok {
+		t.Fatal("wrong password accepted for plaintext record")
+	}
+
+	hash, err := passwordHasher.Hash("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, rehash, err := verifyPassword(hash, "hunter2"); !ok || rehash || err != nil {
+		t.Fatalf("current hash = ok %v, rehash %v, err %v", ok, rehash, err)
+	}
+}
+
+func TestLegacyPlaintextRejectedWhenDisabled(t *testing.T) {
+	t.Setenv("LEGACY_PLAINTEXT_PASSWORDS", "false")
+	if ok, _, err := verifyPassword("hunter2", "hunter2"); ok || err != nil {
+		t.Fatalf("plaintext record accepted with LEGACY_PLAINTEXT_PASSWORDS=false: ok=%v err=%v", ok, err)
+	}
+}
+
+func TestArgon2ThreadsValidated(t *testing.T) {
+	for _, v := range []string{"256", "1000"} {
+		t.Setenv("ARGON2_THREADS", v)
+		if _, err := newPasswordHasher(schemeArgon2id); err == nil {
+			t.Errorf("ARGON2_THREADS=%s accepted", v)
+		}
+	}
+	t.Setenv("ARGON2_THREADS", "255")
+	t.Setenv("ARGON2_MEMORY", "2048")
+	t.Setenv("ARGON2_TIME", "1")
+	h, err := newPasswordHasher(schemeArgon2id)
+	if err != nil {
+		t.Fatalf("ARGON2_THREADS=255: %v", err)
+	}
+	if _, err := h.Hash("hunter2"); err != nil {
+		t.Fatal(err)
+	}
+}
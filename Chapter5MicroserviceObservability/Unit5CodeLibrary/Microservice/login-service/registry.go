@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nacos-group/nacos-sdk-go/clients/naming_client"
+	"github.com/nacos-group/nacos-sdk-go/vo"
+	"go.uber.org/zap"
+)
+
+// 服务注册：login-service 只依赖 Registry，不调用其他服务，因此无需 Resolver。
+// 后端由 DISCOVERY_BACKEND 选择，与 game-service / scoreboard-service 一致：
+//   - nacos（默认）：注册到 Nacos
+//   - dns：Kubernetes headless Service，实例由 Endpoints 维护，无需注册
+//   - static：调用方从静态 YAML 文件读取本服务地址，无需注册，本地开发与测试无需 Nacos
+
+const (
+	backendNacos  = "nacos"
+	backendDNS    = "dns"
+	backendStatic = "static"
+)
+
+// ServiceInstance 本服务登记的实例
+type ServiceInstance struct {
+	Service  string
+	Group    string // 为空时使用后端的默认分组
+	Cluster  string // 为空时为 Nacos 的 DEFAULT 集群
+	Host     string
+	Port     uint64
+	Weight   float64
+	Metadata map[string]string
+}
+
+// Registry 把本服务实例登记到注册中心
+type Registry interface {
+	Register(in ServiceInstance) error
+	Deregister(in ServiceInstance) error
+	Name() string
+}
+
+var serviceRegistry Registry
+
+/* ----------------- 初始化 ----------------- */
+
+func initRegistry() {
+	switch backend := discoveryBackend(); backend {
+	case backendNacos:
+		if NamingClient == nil {
+			logger.Fatal("DISCOVERY_BACKEND=nacos requires NACOS_SERVER_IP")
+		}
+		serviceRegistry = &nacosRegistry{client: NamingClient, group: nacosGroup()}
+	case backendDNS, backendStatic:
+		serviceRegistry = noopRegistry(backend)
+	default:
+		logger.Fatal("unknown DISCOVERY_BACKEND, want nacos / dns / static", zap.String("backend", backend))
+	}
+	logger.Info("service registry initialized", zap.String("backend", serviceRegistry.Name()))
+}
+
+func discoveryBackend() string {
+	if v := strings.ToLower(strings.TrimSpace(os.Getenv("DISCOVERY_BACKEND"))); v != "" {
+		return v
+	}
+	return backendNacos
+}
+
+/* ----------------- Nacos ----------------- */
+
+type nacosRegistry struct {
+	client naming_client.INamingClient
+	group  string
+}
+
+func (n *nacosRegistry) Name() string { return backendNacos }
+
+func (n *nacosRegistry) Register(in ServiceInstance) error {
+	ok, err := n.client.RegisterInstance(vo.RegisterInstanceParam{
+		Ip: in.Host, Port: in.Port, ServiceName: in.Service, GroupName: n.groupOf(in), ClusterName: in.Cluster,
+		Weight: in.Weight, Metadata: in.Metadata, Enable: true, Healthy: true, Ephemeral: true,
+	})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("register failed")
+	}
+	return nil
+}
+
+func (n *nacosRegistry) Deregister(in ServiceInstance) error {
+	_, err := n.client.DeregisterInstance(vo.DeregisterInstanceParam{
+		Ip: in.Host, Port: in.Port, ServiceName: in.Service, GroupName: n.groupOf(in), Cluster: in.Cluster, Ephemeral: true,
+	})
+	return err
+}
+
+func (n *nacosRegistry) groupOf(in ServiceInstance) string {
+	if in.Group != "" {
+		return in.Group
+	}
+	return n.group
+}
+
+/* ----------------- dns / static ----------------- */
+
+// noopRegistry 实例列表由 Kubernetes 或静态文件维护，注册与注销为空操作
+type noopRegistry string
+
+func (r noopRegistry) Name() string                     { return string(r) }
+func (r noopRegistry) Register(ServiceInstance) error   { return nil }
+func (r noopRegistry) Deregister(ServiceInstance) error { return nil }
+
+/* ----------------- 本服务实例 ----------------- */
+
+// 本服务实例的注册信息，取自环境变量（Kubernetes 中由 Downward API 注入）：
+//   - POD_IP：注册的地址，未设置时使用第一个非回环 IPv4 地址
+//   - SERVICE_PORT：注册的端口，默认为监听端口
+//   - NACOS_GROUP / NACOS_CLUSTER：分组（默认 DEFAULT_GROUP）与集群（默认 DEFAULT）
+//   - SERVICE_WEIGHT：权重，默认 10
+//   - SERVICE_VERSION / SERVICE_ZONE / SERVICE_METADATA：实例元数据 version、zone 及其他 k1=v1,k2=v2
+//
+// 注销时使用注册成功的同一份信息。启动时 nacos 短暂不可用会按指数退避重试，
+// 最多 REGISTER_MAX_ATTEMPTS 次（默认 6 次，约 15 秒）。
+
+const (
+	registerBaseBackoff = 500 * time.Millisecond
+	registerMaxBackoff  = 8 * time.Second
+)
+
+// registeredInstance 注册成功的实例，注销时原样使用
+var registeredInstance *ServiceInstance
+
+func nacosGroup() string {
+	if g := os.Getenv("NACOS_GROUP"); g != "" {
+		return g
+	}
+	return "DEFAULT_GROUP"
+}
+
+// selfInstance 根据环境变量生成本服务实例的注册信息
+func selfInstance(name string, listenPort uint64) (ServiceInstance, error) {
+	in := ServiceInstance{
+		Service: name,
+		Group:   nacosGroup(),
+		Cluster: os.Getenv("NACOS_CLUSTER"),
+		Host:    os.Getenv("POD_IP"),
+		Port:    listenPort,
+		Weight:  10,
+	}
+	if in.Host == "" {
+		ip, err := getHostIP()
+		if err != nil {
+			return in, err
+		}
+		in.Host = ip
+	} else if net.ParseIP(in.Host) == nil {
+		return in, fmt.Errorf("invalid POD_IP %q", in.Host)
+	}
+	if v := os.Getenv("SERVICE_PORT"); v != "" {
+		port, err := strconv.ParseUint(v, 10, 16)
+		if err != nil || port == 0 {
+			return in, fmt.Errorf("invalid SERVICE_PORT %q", v)
+		}
+		in.Port = port
+	}
+	if v := os.Getenv("SERVICE_WEIGHT"); v != "" {
+		weight, err := strconv.ParseFloat(v, 64)
+		if err != nil || weight <= 0 {
+			return in, fmt.Errorf("invalid SERVICE_WEIGHT %q", v)
+		}
+		in.Weight = weight
+	}
+	metadata, err := parseMetadata(os.Getenv("SERVICE_METADATA"))
+	if err != nil {
+		return in, err
+	}
+	for key, env := range map[string]string{"version": "SERVICE_VERSION", "zone": "SERVICE_ZONE"} {
+		if v := os.Getenv(env); v != "" {
+			if metadata == nil {
+				metadata = make(map[string]string)
+			}
+			metadata[key] = v
+		}
+	}
+	in.Metadata = metadata
+	return in, nil
+}
+
+// parseMetadata 解析 k1=v1,k2=v2 格式的实例元数据，空串返回 nil
+func parseMetadata(s string) (map[string]string, error) {
+	var metadata map[string]string
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid SERVICE_METADATA entry %q, want key=value", pair)
+		}
+		if metadata == nil {
+			metadata = make(map[string]string)
+		}
+		metadata[k] = strings.TrimSpace(v)
+	}
+	return metadata, nil
+}
+
+func getHostIP() (string, error) {
+	addrs, _ := net.InterfaceAddrs()
+	for _, a := range addrs {
+		if ipnet, ok := a.(*net.IPNet); ok && !ipnet.IP.IsLoopback() && ipnet.IP.To4() != nil {
+			return ipnet.IP.String(), nil
+		}
+	}
+	return "", fmt.Errorf("no IP found")
+}
+
+// registerService 注册本服务实例，失败时按指数退避重试
+func registerService(name string, listenPort uint64) error {
+	in, err := selfInstance(name, listenPort)
+	if err != nil {
+		return err
+	}
+	attempts := 6
+	if v, perr := strconv.Atoi(os.Getenv("REGISTER_MAX_ATTEMPTS")); perr == nil && v > 0 {
+		attempts = v
+	}
+	backoff := registerBaseBackoff
+	for attempt := 1; ; attempt++ {
+		if err = serviceRegistry.Register(in); err == nil {
+			break
+		}
+		if attempt >= attempts {
+			return fmt.Errorf("register %s after %d attempts: %w", name, attempt, err)
+		}
+		// 抖动避免多个实例同时重试
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		logger.Warn("register failed, retrying", zap.Int("attempt", attempt), zap.Duration("retryIn", wait), zap.Error(err))
+		time.Sleep(wait)
+		if backoff *= 2; backoff > registerMaxBackoff {
+			backoff = registerMaxBackoff
+		}
+	}
+	registeredInstance = &in
+	logger.Info("service registered", zap.String("service", in.Service), zap.String("ip", in.Host),
+		zap.Uint64("port", in.Port), zap.String("group", in.Group), zap.String("cluster", in.Cluster),
+		zap.Any("metadata", in.Metadata), zap.String("backend", serviceRegistry.Name()))
+	return nil
+}
+
+// deregisterLoginService 使用注册时的实例信息注销
+func deregisterLoginService() {
+	if registeredInstance == nil {
+		return
+	}
+	if err := serviceRegistry.Deregister(*registeredInstance); err != nil {
+		logger.Error("deregister error", zap.Error(err))
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap"
+)
+
+// 角色：user_roles 记录授予关系，签发访问令牌时写入 roles 声明，game-service / scoreboard-service 据此鉴权。
+// 其他服务只在访问令牌过期后才能感知角色变化，login-service 自身的管理接口则每次从存储读取角色。
+//
+// 首个管理员通过子命令授予：`login-service roles grant <username> admin`
+
+const roleAdmin = "admin"
+
+var (
+	errUnknownRole     = errors.New("unknown role")
+	errAccountDisabled = errors.New("account disabled")
+)
+
+// Role 可授予的角色，对应 roles 表
+type Role struct {
+	Name        string `gorm:"column:Name;primary_key" json:"name"`
+	Description string `gorm:"column:Description" json:"description"`
+}
+
+func (Role) TableName() string { return "roles" }
+
+// UserRole 用户被授予的角色
+type UserRole struct {
+	UserID    string    `gorm:"column:UserID;primary_key"`
+	Role      string    `gorm:"column:Role;primary_key"`
+	GrantedBy string    `gorm:"column:GrantedBy"`
+	GrantedAt time.Time `gorm:"column:GrantedAt"`
+}
+
+func (UserRole) TableName() string { return "user_roles" }
+
+// RoleStore 角色存储
+type RoleStore interface {
+	Roles() ([]Role, error)
+	// RolesOf 返回用户的角色名，按名称排序
+	RolesOf(userID string) ([]string, error)
+	// Grant 授予角色，已授予时不做改动；角色不存在时返回 errUnknownRole
+	Grant(userID, role, grantedBy string, at time.Time) error
+	// Revoke 收回角色，未授予时不报错
+	Revoke(userID, role string) error
+}
+
+var userRoles RoleStore
+
+// hasRole 从存储读取用户是否拥有角色
+func hasRole(userID, role string) (bool, error) {
+	roles, err := userRoles.RolesOf(userID)
+	if err != nil {
+		return false, err
+	}
+	for _, r := range roles {
+		if r == role {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// rejectDisabled 账号已停用时返回 403；在校验完凭据之后调用，避免借此探测账号状态
+func rejectDisabled(c *gin.Context, user *User) bool {
+	if user.DisabledAt == nil {
+		return false
+	}
+	logger.Warn("Disabled account login", zap.String("username", user.Username), zap.String("userID", user.ID))
+	c.JSON(http.StatusForbidden, gin.H{"error": "account disabled"})
+	return true
+}
+
+/* ----------------- roles 子命令 ----------------- */
+
+// rolesMain 处理 `login-service roles list|grant|revoke <username> [role]`
+func rolesMain(args []string) {
+	if len(args) < 2 || (args[0] != "list" && len(args) < 3) {
+		fmt.Println("usage: login-service roles list <username> | grant <username> <role> | revoke <username> <role>")
+		os.Exit(2)
+	}
+
+	var dbc DBConfig
+	if storeDriver("") == driverMySQL {
+		dbc = loadDBConfigFromNacos()
+	}
+	if storeDriver(dbc.DBDriver) == driverMemory {
+		fmt.Println("memory store keeps no roles between runs")
+		return
+	}
+	gdb, err := openDatabase(dbc)
+	if err != nil {
+		logger.Fatal("open database", zap.Error(err))
+	}
+	defer gdb.Close()
+
+	store := &sqlRoleStore{db: gdb}
+	user, err := newSQLUserStore(gdb).FindByUsername(args[1])
+	if err != nil {
+		logger.Fatal("find user", zap.String("username", args[1]), zap.Error(err))
+	}
+	switch args[0] {
+	case "list":
+	case "grant":
+		err = store.Grant(user.ID, args[2], "cli", time.Now())
+	case "revoke":
+		err = store.Revoke(user.ID, args[2])
+	default:
+		logger.Fatal("unknown roles command", zap.String("command", args[0]))
+	}
+	if err != nil {
+		logger.Fatal("roles "+args[0], zap.String("username", args[1]), zap.Error(err))
+	}
+	if args[0] != "list" {
+		auditAdminAction("cli", "", "role_"+args[0], user.ID, zap.String("role", args[2]))
+	}
+
+	roles, err := store.RolesOf(user.ID)
+	if err != nil {
+		logger.Fatal("list roles", zap.Error(err))
+	}
+	fmt.Printf("%s (%s): %s\n", user.Username, user.ID, strings.Join(roles, ","))
+}
+
+/* ----------------- gorm 实现 ----------------- */
+
+type sqlRoleStore struct {
+	db *gorm.DB
+}
+
+func (s *sqlRoleStore) Roles() ([]Role, error) {
+	var roles []Role
+	err := s.db.Order("Name").Find(&roles).Error
+	return roles, err
+}
+
+func (s *sqlRoleStore) RolesOf(userID string) ([]string, error) {
+	var roles []string
+	err := s.db.Model(&UserRole{}).Where("UserID = ?", userID).Order("Role").Pluck("Role", &roles).Error
+	return roles, err
+}
+
+func (s *sqlRoleStore) Grant(userID, role, grantedBy string, at time.Time) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var n int
+		if err := tx.Model(&Role{}).Where("Name = ?", role).Count(&n).Error; err != nil {
+			return err
+		}
+		if n == 0 {
+			return errUnknownRole
+		}
+		if err := tx.Model(&UserRole{}).Where("UserID = ? AND Role = ?", userID, role).Count(&n).Error; err != nil {
+			return err
+		}
+		if n > 0 {
+			return nil
+		}
+		return tx.Create(&UserRole{UserID: userID, Role: role, GrantedBy: grantedBy, GrantedAt: at}).Error
+	})
+}
+
+func (s *sqlRoleStore) Revoke(userID, role string) error {
+	return s.db.Where("UserID = ? AND Role = ?", userID, role).Delete(&UserRole{}).Error
+}
+
+/* ----------------- 内存实现 ----------------- */
+
+type memoryRoleStore struct {
+	mu     sync.Mutex
+	roles  map[string]Role
+	grants map[string]map[string]UserRole // UserID -> Role -> 授予记录
+}
+
+// newMemoryRoleStore 预置与迁移相同的角色
+func newMemoryRoleStore() *memoryRoleStore {
+	return &memoryRoleStore{
+		roles:  map[string]Role{roleAdmin: {Name: roleAdmin, Description: "管理用户、重置游戏与排行榜"}},
+		grants: make(map[string]map[string]UserRole),
+	}
+}
+
+func (s *memoryRoleStore) Roles() ([]Role, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	roles := make([]Role, 0, len(s.roles))
+	for _, r := range s.roles {
+		roles = append(roles, r)
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+	return roles, nil
+}
+
+func (s *memoryRoleStore) RolesOf(userID string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var roles []string
+	for name := range s.grants[userID] {
+		roles = append(roles, name)
+	}
+	sort.Strings(roles)
+	return roles, nil
+}
+
+func (s *memoryRoleStore) Grant(userID, role, grantedBy string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.roles[role]; !ok {
+		return errUnknownRole
+	}
+	if s.grants[userID] == nil {
+		s.grants[userID] = make(map[string]UserRole)
+	}
+	if _, ok := s.grants[userID][role]; !ok {
+		s.grants[userID][role] = UserRole{UserID: userID, Role: role, GrantedBy: grantedBy, GrantedAt: at}
+	}
+	return nil
+}
+
+func (s *memoryRoleStore) Revoke(userID, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.grants[userID], role)
+	return nil
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap"
+)
+
+/* ----------------- 会话与令牌 ----------------- */
+
+var (
+	errSessionNotFound = errors.New("session not found")
+	errTokenExpired    = errors.New("token expired")
+	errTokenRevoked    = errors.New("token revoked")
+	errRefreshReused   = errors.New("refresh token reused")
+)
+
+// 令牌默认有效期，可通过 ACCESS_TOKEN_TTL / REFRESH_TOKEN_TTL 修改。
+// 其他服务在本地校验访问令牌、无法感知吊销，因此访问令牌有效期应保持较短
+const (
+	defaultAccessTokenTTL  = 15 * time.Minute
+	defaultRefreshTokenTTL = 7 * 24 * time.Hour
+	sessionCleanupInterval = time.Hour
+)
+
+// Session 一次登录产生的会话；只保存令牌的 SHA-256 摘要，刷新时轮换两个令牌
+type Session struct {
+	ID               string     `gorm:"column:ID;primary_key"`
+	UserID           string     `gorm:"column:UserID;not null"`
+	AccessHash       string     `gorm:"column:AccessHash;not null"`
+	RefreshHash      string     `gorm:"column:RefreshHash;not null"`
+	AccessExpiresAt  time.Time  `gorm:"column:AccessExpiresAt"`
+	RefreshExpiresAt time.Time  `gorm:"column:RefreshExpiresAt"`
+	CreatedAt        time.Time  `gorm:"column:CreatedAt"`
+	RevokedAt        *time.Time `gorm:"column:RevokedAt"`
+}
+
+func (Session) TableName() string { return "sessions" }
+
+// rotatedRefreshToken 已轮换的刷新令牌摘要，保留到该令牌原本的过期时间
+type rotatedRefreshToken struct {
+	TokenHash string    `gorm:"column:TokenHash;primary_key"`
+	SessionID string    `gorm:"column:SessionID;not null"`
+	ExpiresAt time.Time `gorm:"column:ExpiresAt"`
+}
+
+func (rotatedRefreshToken) TableName() string { return "rotated_refresh_tokens" }
+
+// SessionStore 会话存储
+type SessionStore interface {
+	Create(s *Session) error
+	FindByAccessHash(hash string) (*Session, error)
+	FindByRefreshHash(hash string) (*Session, error)
+	// Rotate 仅当会话未吊销且刷新令牌摘要仍为 old.TokenHash 时写入 s 的新令牌对，并记录旧摘要；
+	// 否则（令牌已被并发轮换或会话已吊销）返回 errRefreshReused
+	Rotate(s *Session, old rotatedRefreshToken) error
+	// FindRotated 查找已轮换的刷新令牌，未找到时返回 errSessionNotFound
+	FindRotated(hash string) (*rotatedRefreshToken, error)
+	// Revoke 吊销单个会话
+	Revoke(id string, at time.Time) error
+	// RevokeAll 吊销用户的全部会话（退出所有设备），返回吊销的数量
+	RevokeAll(userID string, at time.Time) (int64, error)
+	// DeleteExpired 删除刷新令牌已过期的会话
+	DeleteExpired(before time.Time) (int64, error)
+}
+
+var sessions SessionStore
+
+// issuedTokens 返回给客户端的一对令牌
+type issuedTokens struct {
+	AccessToken      string
+	RefreshToken     string
+	AccessExpiresAt  time.Time
+	RefreshExpiresAt time.Time
+	CSRFToken        string // 双提交 CSRF 令牌，随令牌对一起轮换
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// envDuration 读取 Go duration 格式的环境变量，无效或未设置时使用默认值
+func envDuration(env string, def time.Duration) time.Duration {
+	if v := os.Getenv(env); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+		logger.Warn("invalid duration, using default", zap.String("env", env), zap.String("value", v))
+	}
+	return def
+}
+
+// fillTokens 为会话生成新的令牌对并写入摘要；访问令牌为签名的 JWT，携带用户当前的角色，刷新令牌为随机串
+func fillTokens(s *Session, user *User, now time.Time) (issuedTokens, error) {
+	if user.DisabledAt != nil {
+		return issuedTokens{}, errAccountDisabled
+	}
+	roles, err := userRoles.RolesOf(user.ID)
+	if err != nil {
+		return issuedTokens{}, err
+	}
+	t := issuedTokens{
+		AccessExpiresAt:  now.Add(envDuration("ACCESS_TOKEN_TTL", defaultAccessTokenTTL)),
+		RefreshExpiresAt: now.Add(envDuration("REFRESH_TOKEN_TTL", defaultRefreshTokenTTL)),
+	}
+	access, err := jwtKeys.signAccessToken(s.UserID, user.Username, s.ID, roles, now, t.AccessExpiresAt)
+	if err != nil {
+		return issuedTokens{}, err
+	}
+	refresh, err := generateAuthToken()
+	if err != nil {
+		return issuedTokens{}, err
+	}
+	csrf, err := generateRandomToken(16)
+	if err != nil {
+		return issuedTokens{}, err
+	}
+	t.AccessToken, t.RefreshToken, t.CSRFToken = access, refresh, csrf
+	s.AccessHash, s.RefreshHash = hashToken(access), hashToken(refresh)
+	s.AccessExpiresAt, s.RefreshExpiresAt = t.AccessExpiresAt, t.RefreshExpiresAt
+	return t, nil
+}
+
+// issueSession 为用户创建新会话
+func issueSession(user *User) (issuedTokens, error) {
+	id, err := generateRandomToken(16)
+	if err != nil {
+		return issuedTokens{}, err
+	}
+	now := time.Now()
+	s := &Session{ID: id, UserID: user.ID, CreatedAt: now}
+	t, err := fillTokens(s, user, now)
+	if err != nil {
+		return issuedTokens{}, err
+	}
+	return t, sessions.Create(s)
+}
+
+// refreshSession 校验刷新令牌并轮换令牌对，旧的访问令牌与刷新令牌随即失效。
+// 轮换以刷新令牌摘要做比较并交换，同一令牌只能成功刷新一次；已轮换的令牌再次出现
+// （被盗用后重放，或并发刷新中落后的一方）时吊销整个会话，双方都需重新登录
+func refreshSession(refreshToken string) (*Session, issuedTokens, error) {
+	hash := hashToken(refreshToken)
+	s, err := sessions.FindByRefreshHash(hash)
+	if err == errSessionNotFound {
+		return nil, issuedTokens{}, detectRefreshReuse(hash)
+	} else if err != nil {
+		return nil, issuedTokens{}, err
+	}
+	now := time.Now()
+	if err = checkSession(s, s.RefreshExpiresAt, now); err != nil {
+		return nil, issuedTokens{}, err
+	}
+	user, err := users.FindByID(s.UserID)
+	if err != nil {
+		return nil, issuedTokens{}, err
+	}
+	old := rotatedRefreshToken{TokenHash: hash, SessionID: s.ID, ExpiresAt: s.RefreshExpiresAt}
+	t, err := fillTokens(s, user, now)
+	if err != nil {
+		return nil, issuedTokens{}, err
+	}
+	if err = sessions.Rotate(s, old); err == errRefreshReused {
+		revokeReusedSession(s.ID, s.UserID)
+	}
+	if err != nil {
+		return nil, issuedTokens{}, err
+	}
+	return s, t, nil
+}
+
+// detectRefreshReuse 未找到会话的刷新令牌若是已轮换的旧令牌，吊销其所属会话
+func detectRefreshReuse(hash string) error {
+	old, err := sessions.FindRotated(hash)
+	if err != nil {
+		return err
+	}
+	if !time.Now().Before(old.ExpiresAt) {
+		return errTokenExpired
+	}
+	revokeReusedSession(old.SessionID, "")
+	return errRefreshReused
+}
+
+func revokeReusedSession(id, userID string) {
+	logger.Warn("Refresh token reuse detected, revoking session", zap.String("sessionID", id), zap.String("userID", userID))
+	if err := sessions.Revoke(id, time.Now()); err != nil {
+		logger.Error("Session revoke error", zap.String("sessionID", id), zap.Error(err))
+	}
+}
+
+// authenticateToken 校验访问令牌，返回其所属会话
+func authenticateToken(accessToken string) (*Session, error) {
+	s, err := sessions.FindByAccessHash(hashToken(accessToken))
+	if err != nil {
+		return nil, err
+	}
+	return s, checkSession(s, s.AccessExpiresAt, time.Now())
+}
+
+func checkSession(s *Session, expiresAt, now time.Time) error {
+	if s.RevokedAt != nil {
+		return errTokenRevoked
+	}
+	if !now.Before(expiresAt) {
+		return errTokenExpired
+	}
+	return nil
+}
+
+// revokeSession 吊销单个会话
+func revokeSession(s *Session) error {
+	now := time.Now()
+	s.RevokedAt = &now
+	return sessions.Revoke(s.ID, now)
+}
+
+// startSessionCleanup 定时删除过期会话与一次性令牌
+func startSessionCleanup() {
+	go func() {
+		ticker := time.NewTicker(sessionCleanupInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			n, err := sessions.DeleteExpired(time.Now())
+			if err != nil {
+				logger.Warn("session cleanup", zap.Error(err))
+			} else if n > 0 {
+				logger.Info("expired sessions removed", zap.Int64("count", n))
+			}
+			n, err = userTokens.DeleteExpired(time.Now())
+			if err != nil {
+				logger.Warn("user token cleanup", zap.Error(err))
+			} else if n > 0 {
+				logger.Info("expired user tokens removed", zap.Int64("count", n))
+			}
+		}
+	}()
+}
+
+/* ----------------- gorm 实现 ----------------- */
+
+// sqlSessionStore 与用户存储共用数据库连接，连接由用户存储负责关闭
+type sqlSessionStore struct {
+	db *gorm.DB
+}
+
+func (s *sqlSessionStore) find(query string, args ...interface{}) (*Session, error) {
+	var sess Session
+	if err := s.db.Where(query, args...).First(&sess).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, errSessionNotFound
+		}
+		return nil, err
+	}
+	return &sess, nil
+}
+
+func (s *sqlSessionStore) Create(sess *Session) error {
+	return s.db.Create(sess).Error
+}
+
+func (s *sqlSessionStore) FindByAccessHash(hash string) (*Session, error) {
+	return s.find("AccessHash = ?", hash)
+}
+
+func (s *sqlSessionStore) FindByRefreshHash(hash string) (*Session, error) {
+	return s.find("RefreshHash = ?", hash)
+}
+
+func (s *sqlSessionStore) Rotate(sess *Session, old rotatedRefreshToken) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&Session{}).
+			Where("ID = ? AND RefreshHash = ? AND RevokedAt IS NULL", sess.ID, old.TokenHash).
+			Updates(map[string]interface{}{
+				"AccessHash":       sess.AccessHash,
+				"RefreshHash":      sess.RefreshHash,
+				"AccessExpiresAt":  sess.AccessExpiresAt,
+				"RefreshExpiresAt": sess.RefreshExpiresAt,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected != 1 {
+			return errRefreshReused
+		}
+		return tx.Create(&old).Error
+	})
+}
+
+func (s *sqlSessionStore) FindRotated(hash string) (*rotatedRefreshToken, error) {
+	var old rotatedRefreshToken
+	if err := s.db.Where("TokenHash = ?", hash).First(&old).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, errSessionNotFound
+		}
+		return nil, err
+	}
+	return &old, nil
+}
+
+func (s *sqlSessionStore) Revoke(id string, at time.Time) error {
+	return s.db.Model(&Session{}).Where("ID = ? AND RevokedAt IS NULL", id).Update("RevokedAt", at).Error
+}
+
+func (s *sqlSessionStore) RevokeAll(userID string, at time.Time) (int64, error) {
+	res := s.db.Model(&Session{}).Where("UserID = ? AND RevokedAt IS NULL", userID).Update("RevokedAt", at)
+	return res.RowsAffected, res.Error
+}
+
+func (s *sqlSessionStore) DeleteExpired(before time.Time) (int64, error) {
+	if err := s.db.Where("ExpiresAt < ?", before).Delete(&rotatedRefreshToken{}).Error; err != nil {
+		return 0, err
+	}
+	res := s.db.Where("RefreshExpiresAt < ?", before).Delete(&Session{})
+	return res.RowsAffected, res.Error
+}
+
+/* ----------------- 内存实现 ----------------- */
+
+type memorySessionStore struct {
+	mu      sync.RWMutex
+	byID    map[string]*Session
+	rotated map[string]rotatedRefreshToken
+}
+
+func newMemorySessionStore() *memorySessionStore {
+	return &memorySessionStore{byID: make(map[string]*Session), rotated: make(map[string]rotatedRefreshToken)}
+}
+
+func (s *memorySessionStore) find(match func(*Session) bool) (*Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, sess := range s.byID {
+		if match(sess) {
+			cp := *sess
+			return &cp, nil
+		}
+	}
+	return nil, errSessionNotFound
+}
+
+func (s *memorySessionStore) Create(sess *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp := *sess
+	s.byID[cp.ID] = &cp
+	return nil
+}
+
+func (s *memorySessionStore) FindByAccessHash(hash string) (*Session, error) {
+	return s.find(func(sess *Session) bool { return sess.AccessHash == hash })
+}
+
+func (s *memorySessionStore) FindByRefreshHash(hash string) (*Session, error) {
+	return s.find(func(sess *Session) bool { return sess.RefreshHash == hash })
+}
+
+func (s *memorySessionStore) Rotate(sess *Session, old rotatedRefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cur, ok := s.byID[sess.ID]
+	if !ok || cur.RefreshHash != old.TokenHash || cur.RevokedAt != nil {
+		return errRefreshReused
+	}
+	cur.AccessHash, cur.RefreshHash = sess.AccessHash, sess.RefreshHash
+	cur.AccessExpiresAt, cur.RefreshExpiresAt = sess.AccessExpiresAt, sess.RefreshExpiresAt
+	s.rotated[old.TokenHash] = old
+	return nil
+}
+
+func (s *memorySessionStore) FindRotated(hash string) (*rotatedRefreshToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	old, ok := s.rotated[hash]
+	if !ok {
+		return nil, errSessionNotFound
+	}
+	return &old, nil
+}
+
+func (s *memorySessionStore) Revoke(id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sess, ok := s.byID[id]; ok && sess.RevokedAt == nil {
+		sess.RevokedAt = &at
+	}
+	return nil
+}
+
+func (s *memorySessionStore) RevokeAll(userID string, at time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for _, sess := range s.byID {
+		if sess.UserID == userID && sess.RevokedAt == nil {
+			t := at
+			sess.RevokedAt = &t
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *memorySessionStore) DeleteExpired(before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hash, old := range s.rotated {
+		if old.ExpiresAt.Before(before) {
+			delete(s.rotated, hash)
+		}
+	}
+	var n int64
+	for id, sess := range s.byID {
+		if sess.RefreshExpiresAt.Before(before) {
+			delete(s.byID, id)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newSessionUser(t *testing.T, set *storeSet) *User {
+	t.Helper()
+	user := &User{ID: "u1", Username: "alice", Password: "hash"}
+	if err := set.users.Create(user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+func TestConcurrentRefreshRotatesOnce(t *testing.T) {
+	forEachStore(t, func(t *testing.T, set *storeSet) {
+		tokens, err := issueSession(newSessionUser(t, set))
+		if err != nil {
+			t.Fatalf("issue session: %v", err)
+		}
+
+		const workers = 8
+		var wg sync.WaitGroup
+		results := make(chan error, workers)
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, _, err := refreshSession(tokens.RefreshToken)
+				results <- err
+			}()
+		}
+		wg.Wait()
+		close(results)
+
+		succeeded := 0
+		for err := range results {
+			switch err {
+			case nil:
+				succeeded++
+			case errRefreshReused, errTokenRevoked:
+			default:
+				t.Errorf("refresh: %v", err)
+			}
+		}
+		if succeeded != 1 {
+			t.Fatalf("%d concurrent refreshes succeeded, want 1", succeeded)
+		}
+	})
+}
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	forEachStore(t, func(t *testing.T, set *storeSet) {
+		stolen, err := issueSession(newSessionUser(t, set))
+		if err != nil {
+			t.Fatalf("issue session: %v", err)
+		}
+		_, rotated, err := refreshSession(stolen.RefreshToken)
+		if err != nil {
+			t.Fatalf("refresh: %v", err)
+		}
+
+		// 已轮换的令牌再次出现：吊销会话，合法客户端持有的新令牌也随之失效
+		if _, _, err := refreshSession(stolen.RefreshToken); err != errRefreshReused {
+			t.Fatalf("reuse: %v, want errRefreshReused", err)
+		}
+		if _, _, err := refreshSession(rotated.RefreshToken); err != errTokenRevoked {
+			t.Fatalf("refresh after reuse: %v, want errTokenRevoked", err)
+		}
+		if _, err := authenticateToken(rotated.AccessToken); err != errTokenRevoked {
+			t.Fatalf("access after reuse: %v, want errTokenRevoked", err)
+		}
+		if _, _, err := refreshSession("unknown"); err != errSessionNotFound {
+			t.Fatalf("unknown token: %v, want errSessionNotFound", err)
+		}
+	})
+}
+
+func TestLogoutWithExpiredAccessToken(t *testing.T) {
+	useMemoryStores(t)
+	t.Setenv("ACCESS_TOKEN_TTL", "1ns")
+	user := &User{ID: "u1", Username: "alice", Password: "hash"}
+	if err := users.Create(user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	tokens, err := issueSession(user)
+	if err != nil {
+		t.Fatalf("issue session: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/logout", logoutHandler)
+	logout := func(body string, cookie *http.Cookie) int {
+		req := httptest.NewRequest(http.MethodPost, "/logout", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := logout("", nil); code != http.StatusUnauthorized {
+		t.Fatalf("expired access token alone: status %d, want 401", code)
+	}
+	if code := logout("", &http.Cookie{Name: "RefreshToken", Value: tokens.RefreshToken}); code != http.StatusOK {
+		t.Fatalf("logout with refresh cookie: status %d, want 200", code)
+	}
+	if _, _, err := refreshSession(tokens.RefreshToken); err != errTokenRevoked {
+		t.Fatalf("refresh after logout: %v, want errTokenRevoked", err)
+	}
+	if code := logout(`{"refreshToken":"`+tokens.RefreshToken+`"}`, nil); code != http.StatusUnauthorized {
+		t.Fatalf("logout of a revoked session: status %d, want 401", code)
+	}
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/mysql"
+	"go.uber.org/zap"
+	_ "modernc.org/sqlite"
+)
+
+/* ----------------- 用户存储 ----------------- */
+
+var (
+	errUserNotFound  = errors.New("user not found")
+	errUsernameTaken = errors.New("username exists")
+	errEmailTaken    = errors.New("email exists")
+)
+
+// UserStore 用户数据存储，屏蔽 MySQL / SQLite / 内存等具体实现
+type UserStore interface {
+	FindByUsername(username string) (*User, error)
+	FindByID(id string) (*User, error)
+	FindByEmail(email string) (*User, error)
+	// List 按 ID 顺序分页列出用户，prefix 非空时只返回用户名以其开头的用户
+	List(prefix string, offset, limit int) (list []User, total int, err error)
+	Create(user *User) error
+	Save(user *User) error
+	// SetDisabledAt 只更新 DisabledAt 列，at 为 nil 时恢复账号
+	SetDisabledAt(id string, at *time.Time) error
+	// ReplacePassword 仅当密码哈希仍为 old 时替换为 hash，返回是否替换；
+	// 并发的重置密码或其他列的更新不会被覆盖
+	ReplacePassword(id, old, hash string) (bool, error)
+	Close() error
+}
+
+// 存储驱动
+const (
+	driverMySQL  = "mysql"
+	driverSQLite = "sqlite"
+	driverMemory = "memory"
+)
+
+var users UserStore
+
+// storeDriver 读取存储驱动：环境变量 STORE_DRIVER 优先，其次为数据库配置中的 DB_DRIVER，默认 mysql
+func storeDriver(configured string) string {
+	driver := os.Getenv("STORE_DRIVER")
+	if driver == "" {
+		driver = configured
+	}
+	if driver == "" {
+		return driverMySQL
+	}
+	return strings.ToLower(driver)
+}
+
+// storeSet 同一数据源上的各类存储
+type storeSet struct {
+	users    UserStore
+	sessions SessionStore
+	attempts LimiterStore
+	ids      IDGenerator
+	tokens   UserTokenStore
+	idents   IdentityStore
+	roles    RoleStore
+}
+
+// openStores 根据配置创建用户、会话、登录限流存储与用户 ID 生成器，SQL 存储在启动时执行未完成的迁移
+func openStores(dbc DBConfig) (*storeSet, error) {
+	if storeDriver(dbc.DBDriver) == driverMemory {
+		ids, err := openIDGenerator(nil)
+		if err != nil {
+			return nil, err
+		}
+		userStore := newMemoryUserStore()
+		return &storeSet{
+			users:    userStore,
+			sessions: newMemorySessionStore(),
+			attempts: newMemoryLimiterStore(),
+			ids:      ids,
+			tokens:   newMemoryUserTokenStore(userStore),
+			idents:   newMemoryIdentityStore(),
+			roles:    newMemoryRoleStore(),
+		}, nil
+	}
+
+	gdb, err := openDatabase(dbc)
+	if err != nil {
+		return nil, err
+	}
+	if autoMigrateEnabled() {
+		applied, err := newUserMigrator(gdb).Up(0)
+		if err != nil {
+			_ = gdb.Close()
+			return nil, fmt.Errorf("migrate: %w", err)
+		}
+		for _, m := range applied {
+			logger.Info("migration applied", zap.Int("version", m.Version), zap.String("name", m.Name))
+		}
+	}
+	ids, err := openIDGenerator(gdb)
+	if err != nil {
+		_ = gdb.Close()
+		return nil, err
+	}
+	var limiterStore LimiterStore = &sqlLimiterStore{db: gdb}
+	if limiterStoreKind(storeDriver(dbc.DBDriver)) == driverMemory {
+		limiterStore = newMemoryLimiterStore()
+	}
+	return &storeSet{
+		users:    newSQLUserStore(gdb),
+		sessions: &sqlSessionStore{db: gdb},
+		attempts: limiterStore,
+		ids:      ids,
+		tokens:   &sqlUserTokenStore{db: gdb},
+		idents:   &sqlIdentityStore{db: gdb},
+		roles:    &sqlRoleStore{db: gdb},
+	}, nil
+}
+
+// openDatabase 按驱动打开 MySQL 或 SQLite 数据库
+func openDatabase(dbc DBConfig) (*gorm.DB, error) {
+	switch driver := storeDriver(dbc.DBDriver); driver {
+	case driverMySQL:
+		return openMySQL(dbc)
+	case driverSQLite:
+		path := dbc.DBPath
+		if path == "" {
+			path = os.Getenv("DB_PATH")
+		}
+		if path == "" {
+			path = "guess.db"
+		}
+		sqlDB, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)")
+		if err != nil {
+			return nil, fmt.Errorf("sqlite open: %w", err)
+		}
+		sqlDB.SetMaxOpenConns(1)
+		gdb, err := gorm.Open("sqlite3", sqlDB)
+		if err != nil {
+			return nil, fmt.Errorf("sqlite open: %w", err)
+		}
+		return gdb, nil
+	default:
+		return nil, fmt.Errorf("unknown store driver %q", driver)
+	}
+}
+
+/* ----------------- gorm 实现（MySQL / SQLite） ----------------- */
+
+type sqlUserStore struct {
+	db *gorm.DB
+}
+
+// newSQLUserStore 表结构由 migrations.go 中的迁移维护
+func newSQLUserStore(db *gorm.DB) *sqlUserStore {
+	return &sqlUserStore{db: db}
+}
+
+func (s *sqlUserStore) find(query string, args ...interface{}) (*User, error) {
+	var user User
+	if err := s.db.Where(query, args...).First(&user).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, errUserNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *sqlUserStore) FindByUsername(username string) (*User, error) {
+	return s.find("Username = ?", username)
+}
+
+func (s *sqlUserStore) FindByID(id string) (*User, error) {
+	return s.find("ID = ?", id)
+}
+
+// PasswordHashes 返回全部账号的密码哈希，供 rehash-audit 统计
+func (s *sqlUserStore) PasswordHashes() ([]string, error) {
+	var hashes []string
+	err := s.db.Model(&User{}).Pluck("Password", &hashes).Error
+	return hashes, err
+}
+
+func (s *sqlUserStore) FindByEmail(email string) (*User, error) {
+	return s.find("Email = ?", email)
+}
+
+func (s *sqlUserStore) List(prefix string, offset, limit int) ([]User, int, error) {
+	q := s.db.Model(&User{})
+	if prefix != "" {
+		q = q.Where("Username LIKE ? ESCAPE '!'", escapeLike(prefix)+"%")
+	}
+	var total int
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var list []User
+	if err := q.Order("ID").Offset(offset).Limit(limit).Find(&list).Error; err != nil {
+		return nil, 0, err
+	}
+	return list, total, nil
+}
+
+// escapeLike 转义 LIKE 通配符，配合 ESCAPE '!' 在 MySQL 与 SQLite 上行为一致
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
+
+func (s *sqlUserStore) Create(user *User) error {
+	if _, err := s.FindByUsername(user.Username); err == nil {
+		return errUsernameTaken
+	} else if err != errUserNotFound {
+		return err
+	}
+	if user.Email != nil {
+		if _, err := s.FindByEmail(*user.Email); err == nil {
+			return errEmailTaken
+		} else if err != errUserNotFound {
+			return err
+		}
+	}
+	return s.db.Create(user).Error
+}
+
+func (s *sqlUserStore) Save(user *User) error {
+	return s.db.Save(user).Error
+}
+
+func (s *sqlUserStore) SetDisabledAt(id string, at *time.Time) error {
+	res := s.db.Model(&User{}).Where("ID = ?", id).Update("DisabledAt", at)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errUserNotFound
+	}
+	return nil
+}
+
+func (s *sqlUserStore) ReplacePassword(id, old, hash string) (bool, error) {
+	res := s.db.Model(&User{}).Where("ID = ? AND Password = ?", id, old).Update("Password", hash)
+	return res.RowsAffected == 1, res.Error
+}
+
+func (s *sqlUserStore) Close() error {
+	return s.db.Close()
+}
+
+/* ----------------- 内存实现（本地开发 / 测试） ----------------- */
+
+type memoryUserStore struct {
+	mu         sync.RWMutex
+	byID       map[string]*User
+	byUsername map[string]*User
+}
+
+func newMemoryUserStore() *memoryUserStore {
+	return &memoryUserStore{
+		byID:       make(map[string]*User),
+		byUsername: make(map[string]*User),
+	}
+}
+
+func (s *memoryUserStore) FindByUsername(username string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.byUsername[username]
+	if !ok {
+		return nil, errUserNotFound
+	}
+	cp := *u
+	return &cp, nil
+}
+
+func (s *memoryUserStore) FindByID(id string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.byID[id]
+	if !ok {
+		return nil, errUserNotFound
+	}
+	cp := *u
+	return &cp, nil
+}
+
+func (s *memoryUserStore) FindByEmail(email string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, u := range s.byID {
+		if u.Email != nil && *u.Email == email {
+			cp := *u
+			return &cp, nil
+		}
+	}
+	return nil, errUserNotFound
+}
+
+func (s *memoryUserStore) List(prefix string, offset, limit int) ([]User, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var all []User
+	for _, u := range s.byID {
+		if strings.HasPrefix(u.Username, prefix) {
+			all = append(all, *u)
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].ID < all[j].ID })
+	total := len(all)
+	if offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	return all[offset:end], total, nil
+}
+
+func (s *memoryUserStore) Create(user *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.byUsername[user.Username]; ok {
+		return errUsernameTaken
+	}
+	if user.Email != nil {
+		for _, u := range s.byID {
+			if u.Email != nil && *u.Email == *user.Email {
+				return errEmailTaken
+			}
+		}
+	}
+	if _, ok := s.byID[user.ID]; ok {
+		return fmt.Errorf("duplicate user id %s", user.ID)
+	}
+	now := time.Now()
+	user.CreatedAt, user.UpdatedAt = now, now
+	cp := *user
+	s.byID[cp.ID] = &cp
+	s.byUsername[cp.Username] = &cp
+	return nil
+}
+
+func (s *memoryUserStore) Save(user *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.byID[user.ID]
+	if !ok {
+		return errUserNotFound
+	}
+	delete(s.byUsername, old.Username)
+	user.UpdatedAt = time.Now()
+	cp := *user
+	s.byID[cp.ID] = &cp
+	s.byUsername[cp.Username] = &cp
+	return nil
+}
+
+func (s *memoryUserStore) SetDisabledAt(id string, at *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.byID[id]
+	if !ok {
+		return errUserNotFound
+	}
+	u.DisabledAt, u.UpdatedAt = at, time.Now()
+	return nil
+}
+
+func (s *memoryUserStore) ReplacePassword(id, old, hash string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.byID[id]
+	if !ok || u.Password != old {
+		return false, nil
+	}
+	u.Password, u.UpdatedAt = hash, time.Now()
+	return true, nil
+}
+
+func (s *memoryUserStore) Close() error { return nil }
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// forEachStore 分别在内存与 SQLite 存储上运行 fn，运行期间 set 同时作为全局存储
+func forEachStore(t *testing.T, fn func(t *testing.T, set *storeSet)) {
+	for _, driver := range []string{driverMemory, driverSQLite} {
+		t.Run(driver, func(t *testing.T) {
+			t.Setenv("STORE_DRIVER", driver)
+			set, err := openStores(DBConfig{DBDriver: driver, DBPath: filepath.Join(t.TempDir(), "login.db")})
+			if err != nil {
+				t.Fatalf("open stores: %v", err)
+			}
+			defer set.users.Close()
+			useStores(t, set)
+			fn(t, set)
+		})
+	}
+}
+
+func TestDisableAndRehashDoNotOverwriteEachOther(t *testing.T) {
+	forEachStore(t, func(t *testing.T, set *storeSet) {
+		if err := set.users.Create(&User{ID: "u1", Username: "alice", Password: "plain"}); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+		// 登录读取用户后，管理员停用账号，随后登录写回重新哈希的密码
+		loaded, _ := set.users.FindByID("u1")
+		now := time.Now().Truncate(time.Second)
+		if err := set.users.SetDisabledAt("u1", &now); err != nil {
+			t.Fatalf("disable: %v", err)
+		}
+		if replaced, err := set.users.ReplacePassword(loaded.ID, loaded.Password, "hashed"); err != nil || !replaced {
+			t.Fatalf("rehash = %v, %v", replaced, err)
+		}
+		got, _ := set.users.FindByID("u1")
+		if got.DisabledAt == nil || got.Password != "hashed" {
+			t.Fatalf("disabled %v, password %q", got.DisabledAt, got.Password)
+		}
+
+		// 哈希已被修改（如重置密码）时不再覆盖
+		if replaced, err := set.users.ReplacePassword("u1", "plain", "stale"); err != nil || replaced {
+			t.Fatalf("stale rehash = %v, %v", replaced, err)
+		}
+		if err := set.users.SetDisabledAt("u1", nil); err != nil {
+			t.Fatalf("enable: %v", err)
+		}
+		if got, _ = set.users.FindByID("u1"); got.DisabledAt != nil || got.Password != "hashed" {
+			t.Fatalf("after enable: disabled %v, password %q", got.DisabledAt, got.Password)
+		}
+		if err := set.users.SetDisabledAt("missing", &now); err != errUserNotFound {
+			t.Fatalf("disable missing user: %v", err)
+		}
+	})
+}
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// 两步验证（RFC 6238 TOTP，SHA-1 / 6 位 / 30 秒，允许前后各一个时间步的偏差）：
+//   - POST /2fa/enroll  生成密钥，返回 otpauth URI 供认证器扫码；确认前不生效
+//   - POST /2fa/confirm 用认证器的验证码确认启用，并一次性返回恢复码
+//   - POST /2fa/disable、/2fa/recovery-codes 需再次提供验证码或恢复码
+//
+// 启用后 /login 校验密码只返回 mfaToken（user_tokens 中 purpose=mfa_login 的短期令牌），
+// 客户端再携带验证码或恢复码调用 /login/2fa 才签发会话。第二步的失败计入登录限流。
+// 同一时间步的验证码只能使用一次；恢复码只保存 SHA-256 摘要，用后即删除。
+//
+// TOTP_ENCRYPTION_KEY 设置后密钥以 AES-GCM 加密保存；TOTP_ISSUER 为认证器中显示的发行方。
+
+const (
+	purposeMFALogin = "mfa_login"
+
+	totpDigits          = 6
+	totpPeriod          = 30
+	totpSkew            = 1
+	recoveryCodeCount   = 10
+	defaultMFAChallenge = 5 * time.Minute
+	encryptedPrefix     = "enc:"
+)
+
+var (
+	errTOTPNotEnrolled = errors.New("2fa not enrolled")
+	errTOTPKeyMissing  = errors.New("TOTP_ENCRYPTION_KEY required to decrypt secret")
+
+	b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+)
+
+/* ----------------- TOTP ----------------- */
+
+// totpCode 计算某个时间步的验证码
+func totpCode(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	off := sum[len(sum)-1] & 0x0f
+	v := binary.BigEndian.Uint32(sum[off:off+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, v%1000000)
+}
+
+// totpMatch 在允许的偏差内查找匹配的时间步；不接受 lastStep 及之前的时间步，防止重放
+func totpMatch(secret []byte, code string, now time.Time, lastStep int64) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	cur := now.Unix() / totpPeriod
+	for step := cur - totpSkew; step <= cur+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(secret, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func totpURI(username, secret string) string {
+	issuer := os.Getenv("TOTP_ISSUER")
+	if issuer == "" {
+		issuer = "GuessNumber"
+	}
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(totpDigits))
+	q.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + url.PathEscape(issuer+":"+username) + "?" + q.Encode()
+}
+
+/* ----------------- 密钥存储 ----------------- */
+
+func totpCipher() (cipher.AEAD, error) {
+	key := os.Getenv("TOTP_ENCRYPTION_KEY")
+	if key == "" {
+		return nil, nil
+	}
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealTOTPSecret 返回写入数据库的密钥；未配置加密密钥时原样保存 base32
+func sealTOTPSecret(secret string) (string, error) {
+	aead, err := totpCipher()
+	if err != nil || aead == nil {
+		return secret, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(secret), nil)
+	return encryptedPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// openTOTPSecret 读取用户的 TOTP 密钥（原始字节）
+func openTOTPSecret(user *User) ([]byte, error) {
+	if user.TOTPSecret == nil {
+		return nil, errTOTPNotEnrolled
+	}
+	secret := *user.TOTPSecret
+	if strings.HasPrefix(secret, encryptedPrefix) {
+		aead, err := totpCipher()
+		if err != nil {
+			return nil, err
+		}
+		if aead == nil {
+			return nil, errTOTPKeyMissing
+		}
+		raw, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(secret, encryptedPrefix))
+		if err != nil || len(raw) < aead.NonceSize() {
+			return nil, errors.New("malformed totp secret")
+		}
+		plain, err := aead.Open(nil, raw[:aead.NonceSize()], raw[aead.NonceSize():], nil)
+		if err != nil {
+			return nil, err
+		}
+		secret = string(plain)
+	}
+	return b32.DecodeString(secret)
+}
+
+/* ----------------- 恢复码 ----------------- */
+
+// newRecoveryCodes 生成一组恢复码，返回明文（仅展示一次）与空格分隔的摘要
+func newRecoveryCodes() ([]string, string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		buf := make([]byte, 10)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, "", err
+		}
+		s := strings.ToLower(b32.EncodeToString(buf))
+		codes[i] = s[0:4] + "-" + s[4:8] + "-" + s[8:12] + "-" + s[12:16]
+		hashes[i] = hashToken(s)
+	}
+	return codes, strings.Join(hashes, " "), nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// useRecoveryCode 匹配成功时从用户记录中删除该恢复码
+func useRecoveryCode(user *User, code string) bool {
+	want := hashToken(normalizeRecoveryCode(code))
+	hashes := strings.Fields(user.RecoveryCodes)
+	for i, h := range hashes {
+		if subtle.ConstantTimeCompare([]byte(h), []byte(want)) == 1 {
+			user.RecoveryCodes = strings.Join(append(hashes[:i], hashes[i+1:]...), " ")
+			return true
+		}
+	}
+	return false
+}
+
+// verifySecondFactor 校验验证码或恢复码，成功时更新 user（需由调用方保存）
+func verifySecondFactor(user *User, code, recoveryCode string, now time.Time) (bool, error) {
+	if code != "" {
+		secret, err := openTOTPSecret(user)
+		if err != nil {
+			return false, err
+		}
+		step, ok := totpMatch(secret, code, now, user.TOTPLastStep)
+		if ok {
+			user.TOTPLastStep = step
+		}
+		return ok, nil
+	}
+	if recoveryCode != "" {
+		return useRecoveryCode(user, recoveryCode), nil
+	}
+	return false, nil
+}
+
+/* ----------------- HTTP ----------------- */
+
+type (
+	totpCodeRequest struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recoveryCode"`
+	}
+	loginMFARequest struct {
+		MFAToken     string `json:"mfaToken"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recoveryCode"`
+	}
+)
+
+// respondMFARequired 密码正确但需要第二步验证
+func respondMFARequired(c *gin.Context, user *User) {
+	ttl := envDuration("MFA_CHALLENGE_TTL", defaultMFAChallenge)
+	token, err := issueUserToken(user, purposeMFALogin, ttl)
+	if err != nil {
+		logger.Error("MFA challenge error", zap.String("userID", user.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "token error"})
+		return
+	}
+	logger.Info("MFA required", zap.String("userID", user.ID))
+	c.JSON(http.StatusOK, gin.H{
+		"success":     false,
+		"mfaRequired": true,
+		"mfaToken":    token,
+		"expiresAt":   time.Now().Add(ttl),
+	})
+}
+
+// 登录第二步：mfaToken + 验证码或恢复码
+func loginMFAHandler(c *gin.Context) {
+	var req loginMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.MFAToken == "" || (req.Code == "" && req.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mfaToken and code required"})
+		return
+	}
+
+	clientIP, now := c.ClientIP(), time.Now()
+	mfaHash := hashToken(req.MFAToken)
+	t, err := userTokens.Find(purposeMFALogin, mfaHash, now)
+	if err != nil {
+		respondMFATokenError(c, err)
+		return
+	}
+	user, err := users.FindByID(t.UserID)
+	if err != nil {
+		respondMFATokenError(c, err)
+		return
+	}
+	if wait := limiter.Check(user.Username, clientIP, now); wait > 0 {
+		respondLocked(c, wait)
+		return
+	}
+
+	ok, err := verifySecondFactor(user, req.Code, req.RecoveryCode, now)
+	if err != nil {
+		logger.Error("TOTP verify error", zap.String("userID", user.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "2fa error"})
+		return
+	}
+	if !ok {
+		logger.Warn("Invalid 2fa code", zap.String("userID", user.ID))
+		if wait := limiter.Fail(user.Username, clientIP, now); wait > 0 {
+			respondLocked(c, wait)
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid code"})
+		return
+	}
+	// 令牌只能换取一次会话，并发提交时仅第一个成功
+	if _, err = userTokens.Consume(purposeMFALogin, mfaHash, now); err != nil {
+		respondMFATokenError(c, err)
+		return
+	}
+	if err = users.Save(user); err != nil {
+		logger.Error("DB error", zap.String("userID", user.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	limiter.Succeed(user.Username)
+	if rejectDisabled(c, user) {
+		return
+	}
+
+	tokens, err := issueSession(user)
+	if err != nil {
+		logger.Error("Session create error", zap.String("userID", user.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "token error"})
+		return
+	}
+	logger.Info("User logged in", zap.String("username", user.Username), zap.String("userID", user.ID),
+		zap.Bool("recoveryCode", req.Code == ""))
+	writeAuthCookies(c, tokens)
+	c.JSON(http.StatusOK, newLoginResponse(tokens, user.ID))
+}
+
+func respondMFATokenError(c *gin.Context, err error) {
+	if err == errTokenInvalid || err == errUserNotFound {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired mfaToken"})
+		return
+	}
+	logger.Error("DB error", zap.Error(err))
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+}
+
+// sessionUser 校验会话并读取当前用户
+func sessionUser(c *gin.Context) (*User, bool) {
+	sess, ok := requireSession(c)
+	if !ok {
+		return nil, false
+	}
+	user, err := users.FindByID(sess.UserID)
+	if err != nil {
+		respondSessionError(c, err)
+		return nil, false
+	}
+	return user, true
+}
+
+// 生成 TOTP 密钥；重复调用会替换尚未确认的密钥
+func enrollTOTPHandler(c *gin.Context) {
+	user, ok := sessionUser(c)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabledAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "2fa already enabled"})
+		return
+	}
+
+	raw := make([]byte, 20)
+	if _, err := rand.Read(raw); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "random error"})
+		return
+	}
+	secret := b32.EncodeToString(raw)
+	sealed, err := sealTOTPSecret(secret)
+	if err != nil {
+		logger.Error("TOTP seal error", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "2fa error"})
+		return
+	}
+	user.TOTPSecret = &sealed
+	user.TOTPLastStep = 0
+	if err = users.Save(user); err != nil {
+		logger.Error("DB error", zap.String("userID", user.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	logger.Info("2fa enrollment started", zap.String("userID", user.ID))
+	c.JSON(http.StatusOK, gin.H{"secret": secret, "otpauthUri": totpURI(user.Username, secret)})
+}
+
+// 用验证码确认启用，返回恢复码
+func confirmTOTPHandler(c *gin.Context) {
+	user, ok := sessionUser(c)
+	if !ok {
+		return
+	}
+	var req totpCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code required"})
+		return
+	}
+	if user.TOTPEnabledAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "2fa already enabled"})
+		return
+	}
+	if user.TOTPSecret == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "2fa not enrolled"})
+		return
+	}
+
+	now := time.Now()
+	if ok, err := verifySecondFactor(user, req.Code, "", now); err != nil {
+		logger.Error("TOTP verify error", zap.String("userID", user.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "2fa error"})
+		return
+	} else if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid code"})
+		return
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "random error"})
+		return
+	}
+	user.TOTPEnabledAt = &now
+	user.RecoveryCodes = hashes
+	if err = users.Save(user); err != nil {
+		logger.Error("DB error", zap.String("userID", user.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	logger.Info("2fa enabled", zap.String("userID", user.ID))
+	c.JSON(http.StatusOK, gin.H{"success": true, "recoveryCodes": codes})
+}
+
+// requireSecondFactor 已启用两步验证的敏感操作需再次提供验证码或恢复码，失败计入限流
+func requireSecondFactor(c *gin.Context) (*User, bool) {
+	user, ok := sessionUser(c)
+	if !ok {
+		return nil, false
+	}
+	var req totpCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Code == "" && req.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code required"})
+		return nil, false
+	}
+	if user.TOTPEnabledAt == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "2fa not enabled"})
+		return nil, false
+	}
+
+	clientIP, now := c.ClientIP(), time.Now()
+	if wait := limiter.Check(user.Username, clientIP, now); wait > 0 {
+		respondLocked(c, wait)
+		return nil, false
+	}
+	ok, err := verifySecondFactor(user, req.Code, req.RecoveryCode, now)
+	if err != nil {
+		logger.Error("TOTP verify error", zap.String("userID", user.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "2fa error"})
+		return nil, false
+	}
+	if !ok {
+		if wait := limiter.Fail(user.Username, clientIP, now); wait > 0 {
+			respondLocked(c, wait)
+			return nil, false
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid code"})
+		return nil, false
+	}
+	return user, true
+}
+
+// 关闭两步验证
+func disableTOTPHandler(c *gin.Context) {
+	user, ok := requireSecondFactor(c)
+	if !ok {
+		return
+	}
+	user.TOTPSecret, user.TOTPEnabledAt = nil, nil
+	user.TOTPLastStep, user.RecoveryCodes = 0, ""
+	if err := users.Save(user); err != nil {
+		logger.Error("DB error", zap.String("userID", user.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	logger.Info("2fa disabled", zap.String("userID", user.ID))
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// 重新生成恢复码，旧恢复码全部失效
+func regenerateRecoveryCodesHandler(c *gin.Context) {
+	user, ok := requireSecondFactor(c)
+	if !ok {
+		return
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "random error"})
+		return
+	}
+	user.RecoveryCodes = hashes
+	if err = users.Save(user); err != nil {
+		logger.Error("DB error", zap.String("userID", user.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	logger.Info("Recovery codes regenerated", zap.String("userID", user.ID))
+	c.JSON(http.StatusOK, gin.H{"success": true, "recoveryCodes": codes})
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// 注册输入校验：
+//   - 用户名：USERNAME_MIN_LENGTH（默认 3）~ USERNAME_MAX_LENGTH（默认 32）个字符，
+//     仅允许字母、数字及 _ . -，且须以字母或数字开头；保留名（内置列表 + RESERVED_USERNAMES）不区分大小写
+//   - 密码：PASSWORD_MIN_LENGTH（默认 8）~ PASSWORD_MAX_LENGTH（默认 72，bcrypt 上限）字节，
+//     至少包含 PASSWORD_MIN_CLASSES（默认 2）类字符（小写 / 大写 / 数字 / 符号），不得包含用户名，
+//     且不在 PASSWORD_DENYLIST_FILE 指定的泄露密码列表中（每行一个，忽略大小写，# 开头为注释）
+//
+// 校验失败时返回 400 与逐字段的错误列表，前端按 field 显示在对应输入框下。
+
+// fieldError 单个字段的校验错误；code 供前端做多语言映射，message 为默认提示
+type fieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type validationErrors []fieldError
+
+func (v *validationErrors) add(field, code, format string, args ...interface{}) {
+	*v = append(*v, fieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+// respondValidation 以统一结构返回字段错误
+func respondValidation(c *gin.Context, errs validationErrors) {
+	c.JSON(http.StatusBadRequest, gin.H{"error": "validation failed", "fields": errs})
+}
+
+// 内置保留用户名，避免冒充管理员或服务账号
+var builtinReservedNames = []string{
+	"admin", "administrator", "root", "system", "sysadmin", "superuser",
+	"support", "help", "security", "official", "moderator",
+	"api", "www", "mail", "postmaster", "webmaster", "hostmaster", "no-reply", "noreply",
+	"login-service", "game-service", "scoreboard-service", "nacos",
+	"null", "undefined", "anonymous", "guest", "test",
+}
+
+// credentialPolicy 用户名与密码规则
+type credentialPolicy struct {
+	usernameMin, usernameMax int
+	passwordMin, passwordMax int
+	passwordClasses          int
+	reserved                 map[string]bool
+	denylist                 map[string]bool
+}
+
+var policy = defaultCredentialPolicy()
+
+func defaultCredentialPolicy() *credentialPolicy {
+	p := &credentialPolicy{
+		usernameMin: 3, usernameMax: 32,
+		passwordMin: 8, passwordMax: 72,
+		passwordClasses: 2,
+		reserved:        map[string]bool{},
+		denylist:        map[string]bool{},
+	}
+	for _, n := range builtinReservedNames {
+		p.reserved[n] = true
+	}
+	return p
+}
+
+// initCredentialPolicy 从环境变量加载规则，泄露密码列表读取失败时直接退出
+func initCredentialPolicy() {
+	p, err := loadCredentialPolicy()
+	if err != nil {
+		logger.Fatal("credential policy", zap.Error(err))
+	}
+	policy = p
+	logger.Info("credential policy",
+		zap.Int("passwordMinLength", p.passwordMin),
+		zap.Int("passwordMinClasses", p.passwordClasses),
+		zap.Int("reservedNames", len(p.reserved)),
+		zap.Int("denylist", len(p.denylist)))
+}
+
+func loadCredentialPolicy() (*credentialPolicy, error) {
+	p := defaultCredentialPolicy()
+	p.usernameMin = envInt("USERNAME_MIN_LENGTH", p.usernameMin)
+	p.usernameMax = envInt("USERNAME_MAX_LENGTH", p.usernameMax)
+	p.passwordMin = envInt("PASSWORD_MIN_LENGTH", p.passwordMin)
+	p.passwordMax = envInt("PASSWORD_MAX_LENGTH", p.passwordMax)
+	p.passwordClasses = envInt("PASSWORD_MIN_CLASSES", p.passwordClasses)
+	if p.usernameMin > p.usernameMax {
+		return nil, fmt.Errorf("USERNAME_MIN_LENGTH %d exceeds USERNAME_MAX_LENGTH %d", p.usernameMin, p.usernameMax)
+	}
+	if p.passwordMin > p.passwordMax {
+		return nil, fmt.Errorf("PASSWORD_MIN_LENGTH %d exceeds PASSWORD_MAX_LENGTH %d", p.passwordMin, p.passwordMax)
+	}
+	if p.passwordClasses > 4 {
+		return nil, fmt.Errorf("PASSWORD_MIN_CLASSES must be between 1 and 4")
+	}
+	for _, n := range splitList(os.Getenv("RESERVED_USERNAMES")) {
+		p.reserved[strings.ToLower(n)] = true
+	}
+	if path := os.Getenv("PASSWORD_DENYLIST_FILE"); path != "" {
+		n, err := loadDenylist(path, p.denylist)
+		if err != nil {
+			return nil, fmt.Errorf("load %s: %w", path, err)
+		}
+		logger.Info("password denylist loaded", zap.String("path", path), zap.Int("entries", n))
+	}
+	return p, nil
+}
+
+func loadDenylist(path string, into map[string]bool) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	n := 0
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		into[strings.ToLower(line)] = true
+		n++
+	}
+	return n, sc.Err()
+}
+
+// validateUsername 校验用户名格式与保留名
+func (p *credentialPolicy) validateUsername(username string, errs *validationErrors) {
+	n := utf8.RuneCountInString(username)
+	switch {
+	case n == 0:
+		errs.add("username", "required", "请输入用户名")
+		return
+	case n < p.usernameMin:
+		errs.add("username", "too_short", "用户名至少 %d 个字符", p.usernameMin)
+		return
+	case n > p.usernameMax:
+		errs.add("username", "too_long", "用户名最多 %d 个字符", p.usernameMax)
+		return
+	}
+	for i, r := range username {
+		alnum := r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r))
+		if i == 0 && !alnum {
+			errs.add("username", "invalid_start", "用户名须以字母或数字开头")
+			return
+		}
+		if !alnum && r != '_' && r != '.' && r != '-' {
+			errs.add("username", "invalid_chars", "用户名只能包含字母、数字及 _ . -")
+			return
+		}
+	}
+	if p.reserved[strings.ToLower(username)] {
+		errs.add("username", "reserved", "该用户名为保留名称")
+	}
+}
+
+// validatePassword 校验密码强度；username 为空时跳过“包含用户名”检查
+func (p *credentialPolicy) validatePassword(password, username string, errs *validationErrors) {
+	switch n := len(password); {
+	case n == 0:
+		errs.add("password", "required", "请输入密码")
+		return
+	case n < p.passwordMin:
+		errs.add("password", "too_short", "密码至少 %d 个字符", p.passwordMin)
+		return
+	case n > p.passwordMax:
+		errs.add("password", "too_long", "密码最多 %d 个字节", p.passwordMax)
+		return
+	}
+	if classes := charClasses(password); classes < p.passwordClasses {
+		errs.add("password", "too_simple", "密码须包含小写字母、大写字母、数字、符号中的至少 %d 类", p.passwordClasses)
+		return
+	}
+	lower := strings.ToLower(password)
+	if username != "" && strings.Contains(lower, strings.ToLower(username)) {
+		errs.add("password", "contains_username", "密码不能包含用户名")
+		return
+	}
+	if p.denylist[lower] {
+		errs.add("password", "breached", "该密码已出现在泄露密码库中，请更换")
+	}
+}
+
+func charClasses(s string) int {
+	var lower, upper, digit, other bool
+	for _, r := range s {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+	n := 0
+	for _, b := range []bool{lower, upper, digit, other} {
+		if b {
+			n++
+		}
+	}
+	return n
+}
+
+// validateRegister 校验注册请求，返回规范化后的邮箱
+func validateRegister(req *registerRequest) (string, validationErrors) {
+	var errs validationErrors
+	policy.validateUsername(req.Username, &errs)
+	policy.validatePassword(req.Password, req.Username, &errs)
+	email, err := normalizeEmail(req.Email)
+	if err != nil {
+		errs.add("email", "invalid", "邮箱格式不正确")
+	}
+	return email, errs
+}
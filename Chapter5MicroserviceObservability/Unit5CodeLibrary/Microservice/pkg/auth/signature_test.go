@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequireSignature(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/events", RequireSignature(" old , new ", nopLogger{}), func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, string(body))
+	})
+	unset := gin.New()
+	unset.POST("/events", RequireSignature("", nopLogger{}), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	const body = `{"events":[]}`
+	do := func(h http.Handler, setup func(*http.Request)) (int, string) {
+		req := httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(body))
+		if setup != nil {
+			setup(req)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code, w.Body.String()
+	}
+	signed := func(secret, payload string) func(*http.Request) {
+		return func(req *http.Request) { SignRequest(req, secret, []byte(payload)) }
+	}
+
+	for _, secret := range []string{"old", "new"} {
+		if code, got := do(r, signed(secret, body)); code != http.StatusOK || got != body {
+			t.Errorf("secret %s: %d %q", secret, code, got)
+		}
+	}
+	cases := []struct {
+		name    string
+		handler http.Handler
+		setup   func(*http.Request)
+	}{
+		{"unsigned", r, nil},
+		{"wrong secret", r, signed("guess", body)},
+		{"tampered body", r, signed("new", `{"events":[{"id":"x"}]}`)},
+		{"stale timestamp", r, func(req *http.Request) {
+			SignRequest(req, "new", []byte(body))
+			ts := strconv.FormatInt(time.Now().Add(-2*SignatureMaxAge).Unix(), 10)
+			req.Header.Set(TimestampHeader, ts)
+			req.Header.Set(SignatureHeader, hex.EncodeToString(signature([]byte("new"), ts, []byte(body))))
+		}},
+		{"no secret configured", unset, signed("", body)},
+	}
+	for _, tc := range cases {
+		if code, _ := do(tc.handler, tc.setup); code != http.StatusUnauthorized {
+			t.Errorf("%s: status %d, want 401", tc.name, code)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+// Package auth 在各服务本地校验 login-service 签发的访问令牌。
+//
+// 访问令牌是 JWT：HS256 令牌用共享密钥（JWT_SECRETS）校验，RS256 / EdDSA 令牌用
+// login-service 发布的 JWKS 校验。遇到未知 kid（密钥轮换）时会提前刷新 JWKS。
+// JWKS 地址如何解析（JWKS_URL 或服务发现）由各服务通过 fetch 函数决定。
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrTokenMalformed = errors.New("malformed token")
+	ErrTokenSignature = errors.New("invalid token signature")
+	ErrTokenExpired   = errors.New("token expired")
+	ErrUnknownKey     = errors.New("unknown signing key")
+)
+
+const (
+	// DefaultRefreshInterval JWKS 定时刷新的默认间隔
+	DefaultRefreshInterval = 5 * time.Minute
+	minRefetchInterval     = 30 * time.Second
+	clockSkew              = 30 * time.Second
+)
+
+// Logger 校验过程中的告警输出，*zap.SugaredLogger 满足该接口
+type Logger interface {
+	Warnf(template string, args ...interface{})
+	Warnw(msg string, keysAndValues ...interface{})
+}
+
+// Claims 访问令牌中的声明
+type Claims struct {
+	Issuer    string   `json:"iss"`
+	Subject   string   `json:"sub"`
+	Name      string   `json:"name"`
+	SessionID string   `json:"sid"`
+	Roles     []string `json:"roles"`
+	IssuedAt  int64    `json:"iat"`
+	ExpiresAt int64    `json:"exp"`
+}
+
+// HasRole 令牌是否携带指定角色
+func (t *Claims) HasRole(role string) bool {
+	for _, r := range t.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Key 按 kid 索引的校验密钥，由 ParseJWKS 从 JWKS 中解析
+type Key struct {
+	alg    string
+	secret []byte
+	public crypto.PublicKey
+}
+
+// FetchFunc 拉取最新的 JWKS 公钥集合
+type FetchFunc func() (map[string]Key, error)
+
+// Verifier 访问令牌校验器，可并发使用
+type Verifier struct {
+	issuer string
+	fetch  FetchFunc
+	log    Logger
+
+	mu        sync.RWMutex
+	secrets   map[string]Key
+	keys      map[string]Key
+	lastFetch time.Time
+}
+
+// NewVerifier 创建校验器；issuer 为空时使用 login-service，secrets 为逗号分隔的 HS256 共享密钥，
+// fetch 为 nil 时只接受共享密钥签名的令牌
+func NewVerifier(issuer, secrets string, fetch FetchFunc, log Logger) *Verifier {
+	v := &Verifier{
+		issuer:  issuer,
+		fetch:   fetch,
+		log:     log,
+		secrets: make(map[string]Key),
+		keys:    make(map[string]Key),
+	}
+	if v.issuer == "" {
+		v.issuer = "login-service"
+	}
+	for _, s := range strings.Split(secrets, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			sum := sha256.Sum256([]byte(s))
+			kid := "hs-" + base64.RawURLEncoding.EncodeToString(sum[:8])
+			v.secrets[kid] = Key{alg: "HS256", secret: []byte(s)}
+		}
+	}
+	return v
+}
+
+// Refresh 重新拉取 JWKS，整体替换公钥集合
+func (v *Verifier) Refresh() error {
+	v.mu.Lock()
+	v.lastFetch = time.Now()
+	v.mu.Unlock()
+	if v.fetch == nil {
+		return nil
+	}
+	keys, err := v.fetch()
+	if err != nil {
+		return err
+	}
+	v.mu.Lock()
+	v.keys = keys
+	v.mu.Unlock()
+	return nil
+}
+
+// RefreshEvery 在后台按 interval 定时刷新 JWKS
+func (v *Verifier) RefreshEvery(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			if err := v.Refresh(); err != nil {
+				v.log.Warnf("JWKS refresh failed: %v", err)
+			}
+		}
+	}()
+}
+
+func (v *Verifier) key(kid string) (Key, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if k, ok := v.secrets[kid]; ok {
+		return k, true
+	}
+	k, ok := v.keys[kid]
+	return k, ok
+}
+
+// lookup 查找 kid 对应的密钥，未知 kid 时按最小间隔刷新一次 JWKS
+func (v *Verifier) lookup(kid string) (Key, error) {
+	if k, ok := v.key(kid); ok {
+		return k, nil
+	}
+	v.mu.RLock()
+	recent := time.Since(v.lastFetch) < minRefetchInterval
+	v.mu.RUnlock()
+	if !recent {
+		if err := v.Refresh(); err != nil {
+			v.log.Warnf("JWKS refresh for kid %s failed: %v", kid, err)
+		}
+		if k, ok := v.key(kid); ok {
+			return k, nil
+		}
+	}
+	return Key{}, ErrUnknownKey
+}
+
+// Verify 校验签名、签发方与有效期，返回令牌声明
+func (v *Verifier) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrTokenMalformed
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrTokenMalformed
+	}
+	key, err := v.lookup(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	// 算法以密钥为准，防止通过篡改 alg 降级
+	if header.Alg != key.alg {
+		return nil, ErrTokenSignature
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrTokenMalformed
+	}
+	if !key.verify([]byte(parts[0]+"."+parts[1]), sig) {
+		return nil, ErrTokenSignature
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrTokenMalformed
+	}
+	if claims.Issuer != v.issuer || claims.Subject == "" {
+		return nil, ErrTokenSignature
+	}
+	if time.Now().Add(-clockSkew).Unix() >= claims.ExpiresAt {
+		return nil, ErrTokenExpired
+	}
+	return &claims, nil
+}
+
+func (k Key) verify(input, sig []byte) bool {
+	switch k.alg {
+	case "HS256":
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write(input)
+		return hmac.Equal(mac.Sum(nil), sig)
+	case "RS256":
+		pub, ok := k.public.(*rsa.PublicKey)
+		sum := sha256.Sum256(input)
+		return ok && rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], sig) == nil
+	case "EdDSA":
+		pub, ok := k.public.(ed25519.PublicKey)
+		return ok && ed25519.Verify(pub, input, sig)
+	}
+	return false
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,233 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Warnf(string, ...interface{}) {}
+func (nopLogger) Warnw(string, ...interface{}) {}
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+// sign 按 login-service 的格式签发令牌
+func sign(t *testing.T, alg, kid string, claims Claims, signer func([]byte) []byte) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := b64(header) + "." + b64(payload)
+	return input + "." + b64(signer([]byte(input)))
+}
+
+func hs256(secret string) func([]byte) []byte {
+	return func(input []byte) []byte {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(input)
+		return mac.Sum(nil)
+	}
+}
+
+func validClaims() Claims {
+	now := time.Now()
+	return Claims{Issuer: "login-service", Subject: "u1", Name: "alice", Roles: []string{"admin"},
+		IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix()}
+}
+
+// secretKid 与 NewVerifier 中共享密钥 kid 的推导方式一致
+func secretKid(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return "hs-" + b64(sum[:8])
+}
+
+func TestVerifySharedSecret(t *testing.T) {
+	v := NewVerifier("", " old , new ", nil, nopLogger{})
+	for _, secret := range []string{"old", "new"} {
+		claims, err := v.Verify(sign(t, "HS256", secretKid(secret), validClaims(), hs256(secret)))
+		if err != nil {
+			t.Fatalf("secret %s: %v", secret, err)
+		}
+		if claims.Subject != "u1" || !claims.HasRole("admin") || claims.HasRole("root") {
+			t.Fatalf("claims %+v", claims)
+		}
+	}
+
+	expired := validClaims()
+	expired.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+	foreign := validClaims()
+	foreign.Issuer = "someone-else"
+
+	cases := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"wrong secret", sign(t, "HS256", secretKid("new"), validClaims(), hs256("guess")), ErrTokenSignature},
+		{"alg downgrade", sign(t, "none", secretKid("new"), validClaims(), func([]byte) []byte { return nil }), ErrTokenSignature},
+		{"unknown kid", sign(t, "HS256", "other", validClaims(), hs256("new")), ErrUnknownKey},
+		{"malformed", "a.b", ErrTokenMalformed},
+		{"expired", sign(t, "HS256", secretKid("new"), expired, hs256("new")), ErrTokenExpired},
+		{"issuer", sign(t, "HS256", secretKid("new"), foreign, hs256("new")), ErrTokenSignature},
+	}
+	for _, tc := range cases {
+		if _, err := v.Verify(tc.token); err != tc.want {
+			t.Errorf("%s: error %v, want %v", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestVerifyJWKSRefreshesOnUnknownKid(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := []JWK{{Kty: "RSA", Kid: "rsa-1", Alg: "RS256", N: b64(rsaKey.N.Bytes()), E: b64(big.NewInt(int64(rsaKey.E)).Bytes())}}
+
+	fetches := 0
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": set})
+	}))
+	defer jwks.Close()
+
+	v := NewVerifier("", "", func() (map[string]Key, error) { return FetchJWKS(jwks.URL) }, nopLogger{})
+	if err := v.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	rsaToken := sign(t, "RS256", "rsa-1", validClaims(), func(input []byte) []byte {
+		sum := sha256.Sum256(input)
+		sig, _ := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, sum[:])
+		return sig
+	})
+	if _, err := v.Verify(rsaToken); err != nil {
+		t.Fatalf("RS256: %v", err)
+	}
+
+	// 密钥轮换：新 kid 触发一次提前刷新
+	set = append(set, JWK{Kty: "OKP", Kid: "ed-1", Crv: "Ed25519", X: b64(edPub)})
+	edToken := sign(t, "EdDSA", "ed-1", validClaims(), func(input []byte) []byte { return ed25519.Sign(edPriv, input) })
+	v.lastFetch = time.Now().Add(-time.Minute)
+	if _, err := v.Verify(edToken); err != nil {
+		t.Fatalf("EdDSA after rotation: %v", err)
+	}
+	if fetches != 2 {
+		t.Fatalf("%d JWKS fetches, want 2", fetches)
+	}
+
+	// 最小间隔内的未知 kid 不再刷新
+	if _, err := v.Verify(sign(t, "EdDSA", "ed-2", validClaims(), func(input []byte) []byte { return ed25519.Sign(edPriv, input) })); err != ErrUnknownKey {
+		t.Fatalf("unknown kid: %v", err)
+	}
+	if fetches != 2 {
+		t.Fatalf("unknown kid refetched within the minimum interval (%d fetches)", fetches)
+	}
+}
+
+func TestParseJWKSSkipsUnsupportedKeys(t *testing.T) {
+	keys := ParseJWKS([]JWK{
+		{Kty: "EC", Kid: "ec", Crv: "P-256"},
+		{Kty: "RSA", Kid: "rsa-bad", Alg: "RS256", N: "!!", E: "AQAB"},
+		{Kty: "OKP", Kid: "ed-short", Crv: "Ed25519", X: b64([]byte("short"))},
+	})
+	if len(keys) != 0 {
+		t.Fatalf("unsupported keys parsed: %v", keys)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	v := NewVerifier("", "secret", nil, nopLogger{})
+	r := gin.New()
+	ok := func(c *gin.Context) {
+		claims, _ := ClaimsFrom(c)
+		subject := ""
+		if claims != nil {
+			subject = claims.Subject
+		}
+		c.String(http.StatusOK, subject)
+	}
+	r.GET("/optional", v.Middleware(false), ok)
+	r.GET("/admin", v.Middleware(true), RequireRole("admin", nopLogger{}), ok)
+	r.POST("/write", CSRF(nopLogger{}), ok)
+	r.POST("/login", CSRF(nopLogger{}, "/login"), ok)
+
+	token := sign(t, "HS256", secretKid("secret"), validClaims(), hs256("secret"))
+	user := validClaims()
+	user.Roles = nil
+	userToken := sign(t, "HS256", secretKid("secret"), user, hs256("secret"))
+
+	do := func(method, path string, setup func(*http.Request)) (int, string) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, nil)
+		if setup != nil {
+			setup(req)
+		}
+		r.ServeHTTP(w, req)
+		return w.Code, w.Body.String()
+	}
+	bearer := func(tok string) func(*http.Request) {
+		return func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+tok) }
+	}
+
+	if code, body := do("GET", "/optional", nil); code != http.StatusOK || body != "" {
+		t.Errorf("anonymous optional: %d %q", code, body)
+	}
+	if code, body := do("GET", "/optional", func(req *http.Request) {
+		req.AddCookie(&http.Cookie{Name: "AuthToken", Value: token})
+	}); code != http.StatusOK || body != "u1" {
+		t.Errorf("cookie token: %d %q", code, body)
+	}
+	if code, _ := do("GET", "/optional", bearer("garbage")); code != http.StatusUnauthorized {
+		t.Errorf("invalid token on optional route: %d", code)
+	}
+	if code, _ := do("GET", "/admin", nil); code != http.StatusUnauthorized {
+		t.Errorf("anonymous admin: %d", code)
+	}
+	if code, _ := do("GET", "/admin", bearer(userToken)); code != http.StatusForbidden {
+		t.Errorf("admin without role: %d", code)
+	}
+	if code, body := do("GET", "/admin", bearer(token)); code != http.StatusOK || body != "u1" {
+		t.Errorf("admin: %d %q", code, body)
+	}
+
+	withCookies := func(xsrf string) func(*http.Request) {
+		return func(req *http.Request) {
+			req.AddCookie(&http.Cookie{Name: "AuthToken", Value: token})
+			req.AddCookie(&http.Cookie{Name: "XSRF-TOKEN", Value: "x1"})
+			req.Header.Set("X-XSRF-TOKEN", xsrf)
+		}
+	}
+	if code, _ := do("POST", "/write", withCookies("x2")); code != http.StatusForbidden {
+		t.Errorf("csrf mismatch: %d", code)
+	}
+	if code, _ := do("POST", "/write", withCookies("x1")); code != http.StatusOK {
+		t.Errorf("csrf match: %d", code)
+	}
+	if code, _ := do("POST", "/write", bearer(token)); code != http.StatusOK {
+		t.Errorf("header-only caller blocked by csrf: %d", code)
+	}
+	if code, _ := do("POST", "/login", withCookies("x2")); code != http.StatusOK {
+		t.Errorf("exempt route blocked by csrf: %d", code)
+	}
+}
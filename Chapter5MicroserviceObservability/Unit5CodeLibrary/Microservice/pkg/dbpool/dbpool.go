@@ -0,0 +1,190 @@
+// Package dbpool 可热替换的 MySQL 连接池。
+//
+// gorm 持有的是 Pool，Prod_DATABASE 变更时只替换其中的 *sql.DB，各存储无需重建。
+// 连接信息变化时先建立并验证新连接池（由调用方决定是否执行迁移）再切换，
+// 已开始的查询与事务继续在旧连接池上完成，旧连接池在 DrainDelay 后关闭；
+// 只有连接池参数变化时直接在当前连接池上调整。
+//
+// 连接池参数（均可省略）：DB_MAX_OPEN_CONNS、DB_MAX_IDLE_CONNS、DB_CONN_MAX_LIFETIME（如 30m）
+package dbpool
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DrainDelay 替换后旧连接池保留的时间
+const DrainDelay = 30 * time.Second
+
+// Config 连接信息与连接池参数，JSON 键与 Prod_DATABASE 一致
+type Config struct {
+	Driver          string `json:"DB_DRIVER,omitempty"`
+	User            string `json:"DB_USER"`
+	Password        string `json:"DB_PASSWORD,omitempty"`
+	Host            string `json:"DB_HOST"`
+	Port            string `json:"DB_PORT"`
+	Name            string `json:"DB_NAME"`
+	MaxOpenConns    string `json:"DB_MAX_OPEN_CONNS,omitempty"`
+	MaxIdleConns    string `json:"DB_MAX_IDLE_CONNS,omitempty"`
+	ConnMaxLifetime string `json:"DB_CONN_MAX_LIFETIME,omitempty"`
+}
+
+// Validate 校验 MySQL 连接信息与连接池参数
+func (c Config) Validate() error {
+	for _, f := range []struct{ name, value string }{
+		{"DB_USER", c.User}, {"DB_HOST", c.Host}, {"DB_PORT", c.Port}, {"DB_NAME", c.Name},
+	} {
+		if f.value == "" {
+			return fmt.Errorf("database config: %s is required", f.name)
+		}
+	}
+	if _, err := strconv.ParseUint(c.Port, 10, 16); err != nil {
+		return fmt.Errorf("database config: invalid DB_PORT %q", c.Port)
+	}
+	for _, f := range []struct{ name, value string }{
+		{"DB_MAX_OPEN_CONNS", c.MaxOpenConns}, {"DB_MAX_IDLE_CONNS", c.MaxIdleConns},
+	} {
+		if f.value == "" {
+			continue
+		}
+		if n, err := strconv.Atoi(f.value); err != nil || n < 0 {
+			return fmt.Errorf("database config: invalid %s %q", f.name, f.value)
+		}
+	}
+	if v := c.ConnMaxLifetime; v != "" {
+		if d, err := time.ParseDuration(v); err != nil || d < 0 {
+			return fmt.Errorf("database config: invalid DB_CONN_MAX_LIFETIME %q", v)
+		}
+	}
+	return nil
+}
+
+// sameConnection 连接信息是否相同（不比较连接池参数）
+func (c Config) sameConnection(o Config) bool {
+	return c.Driver == o.Driver && c.User == o.User && c.Password == o.Password &&
+		c.Host == o.Host && c.Port == o.Port && c.Name == o.Name
+}
+
+// Open 建立并验证一个 MySQL 连接池
+func Open(c Config) (*sql.DB, error) {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8&parseTime=True&loc=Local",
+		c.User, c.Password, c.Host, c.Port, c.Name)
+	sqlDB, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("mysql open: %w", err)
+	}
+	if err = sqlDB.Ping(); err != nil {
+		_ = sqlDB.Close()
+		return nil, fmt.Errorf("mysql open: %w", err)
+	}
+	applySettings(sqlDB, c)
+	return sqlDB, nil
+}
+
+// applySettings 设置连接池参数，配置已通过校验；未配置的参数恢复为 database/sql 的默认值
+func applySettings(sqlDB *sql.DB, c Config) {
+	maxOpen, _ := strconv.Atoi(c.MaxOpenConns)
+	sqlDB.SetMaxOpenConns(maxOpen)
+	maxIdle := 2
+	if c.MaxIdleConns != "" {
+		maxIdle, _ = strconv.Atoi(c.MaxIdleConns)
+	}
+	sqlDB.SetMaxIdleConns(maxIdle)
+	lifetime, _ := time.ParseDuration(c.ConnMaxLifetime)
+	sqlDB.SetConnMaxLifetime(lifetime)
+}
+
+// Pool 实现 gorm 所需的 SQLCommon 与事务接口，所有调用转发给当前连接池
+type Pool struct {
+	cur     atomic.Pointer[sql.DB]
+	onDrain func(error)
+
+	mu     sync.Mutex
+	config Config // 当前连接池对应的配置
+}
+
+// New 以已建立的连接池创建 Pool；onDrain 接收关闭旧连接池时的错误，可为 nil
+func New(db *sql.DB, c Config, onDrain func(error)) *Pool {
+	p := &Pool{config: c, onDrain: onDrain}
+	p.cur.Store(db)
+	return p
+}
+
+// Current 当前使用的连接池
+func (p *Pool) Current() *sql.DB { return p.cur.Load() }
+
+// Config 当前连接池对应的配置，不含密码
+func (p *Pool) Config() Config {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c := p.config
+	c.Password = ""
+	return c
+}
+
+// Apply 应用新配置：连接信息不变时只调整连接池参数；否则建立新连接池，
+// prepare（可为 nil，如执行迁移）成功后再切换。返回是否替换了连接池，出错时保留当前连接池
+func (p *Pool) Apply(c Config, prepare func(*sql.DB) error) (bool, error) {
+	if err := c.Validate(); err != nil {
+		return false, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.config.sameConnection(c) {
+		applySettings(p.Current(), c)
+		p.config = c
+		return false, nil
+	}
+
+	next, err := Open(c)
+	if err != nil {
+		return false, err
+	}
+	if prepare != nil {
+		if err := prepare(next); err != nil {
+			_ = next.Close()
+			return false, err
+		}
+	}
+	prev := p.cur.Swap(next)
+	p.config = c
+	time.AfterFunc(DrainDelay, func() {
+		if err := prev.Close(); err != nil && p.onDrain != nil {
+			p.onDrain(err)
+		}
+	})
+	return true, nil
+}
+
+func (p *Pool) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return p.Current().Exec(query, args...)
+}
+
+func (p *Pool) Prepare(query string) (*sql.Stmt, error) {
+	return p.Current().Prepare(query)
+}
+
+func (p *Pool) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return p.Current().Query(query, args...)
+}
+
+func (p *Pool) QueryRow(query string, args ...interface{}) *sql.Row {
+	return p.Current().QueryRow(query, args...)
+}
+
+func (p *Pool) Begin() (*sql.Tx, error) {
+	return p.Current().Begin()
+}
+
+func (p *Pool) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return p.Current().BeginTx(ctx, opts)
+}
+
+func (p *Pool) Close() error {
+	return p.Current().Close()
+}
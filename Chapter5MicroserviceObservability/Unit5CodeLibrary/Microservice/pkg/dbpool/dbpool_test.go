@@ -0,0 +1,90 @@
+package dbpool
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// stubDriver 只用于得到一个 *sql.DB，测试不会真正建立连接
+type stubDriver struct{}
+
+func (stubDriver) Open(string) (driver.Conn, error) { return nil, errors.New("stub driver") }
+
+func init() { sql.Register("dbpool-stub", stubDriver{}) }
+
+func validConfig() Config {
+	return Config{Driver: "mysql", User: "game", Password: "secret", Host: "db-1", Port: "3306", Name: "guess"}
+}
+
+func newStubPool(t *testing.T, c Config) (*Pool, *sql.DB) {
+	t.Helper()
+	db, err := sql.Open("dbpool-stub", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return New(db, c, nil), db
+}
+
+func TestValidate(t *testing.T) {
+	if err := validConfig().Validate(); err != nil {
+		t.Fatalf("valid config rejected: %v", err)
+	}
+	cases := map[string]func(*Config){
+		"DB_HOST":              func(c *Config) { c.Host = "" },
+		"DB_PORT \"db\"":       func(c *Config) { c.Port = "db" },
+		"DB_PORT \"70000\"":    func(c *Config) { c.Port = "70000" },
+		"DB_MAX_OPEN_CONNS":    func(c *Config) { c.MaxOpenConns = "-1" },
+		"DB_MAX_IDLE_CONNS":    func(c *Config) { c.MaxIdleConns = "many" },
+		"DB_CONN_MAX_LIFETIME": func(c *Config) { c.ConnMaxLifetime = "30" },
+	}
+	for want, mutate := range cases {
+		c := validConfig()
+		mutate(&c)
+		if err := c.Validate(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: error %v", want, err)
+		}
+	}
+}
+
+func TestApplyPoolSettingsInPlace(t *testing.T) {
+	p, db := newStubPool(t, validConfig())
+
+	c := validConfig()
+	c.MaxOpenConns = "7"
+	replaced, err := p.Apply(c, func(*sql.DB) error {
+		t.Fatal("prepare called although the connection did not change")
+		return nil
+	})
+	if err != nil || replaced {
+		t.Fatalf("Apply = %v, %v; want in-place update", replaced, err)
+	}
+	if p.Current() != db || db.Stats().MaxOpenConnections != 7 {
+		t.Fatalf("pool settings not applied in place: max open %d", db.Stats().MaxOpenConnections)
+	}
+	if got := p.Config(); got.MaxOpenConns != "7" || got.Password != "" {
+		t.Fatalf("Config() = %+v", got)
+	}
+}
+
+func TestApplyKeepsPoolOnFailure(t *testing.T) {
+	p, db := newStubPool(t, validConfig())
+
+	invalid := validConfig()
+	invalid.Port = ""
+	if _, err := p.Apply(invalid, nil); err == nil {
+		t.Fatal("invalid config applied")
+	}
+	// 测试中没有注册 mysql 驱动，新连接池无法建立
+	moved := validConfig()
+	moved.Host = "db-2"
+	if replaced, err := p.Apply(moved, nil); err == nil || replaced {
+		t.Fatalf("Apply = %v, %v; want open error", replaced, err)
+	}
+	if p.Current() != db || p.Config().Host != "db-1" {
+		t.Fatalf("pool replaced after failed apply: host %s", p.Config().Host)
+	}
+}
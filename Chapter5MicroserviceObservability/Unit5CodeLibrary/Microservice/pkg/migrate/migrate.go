@@ -0,0 +1,244 @@
+// Package migrate 各服务共用的带编号数据库迁移，执行记录保存在 schema_migrations 表中，
+// 以服务名区分，多个服务可共用同一个数据库。
+package migrate
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Migration 一个带编号的数据库迁移。Up/Down 按方言（mysql / sqlite）给出 SQL 语句；
+// UpFunc 用于需要先查询再决定的数据修正，在 Up 语句之后执行。Down 为空表示不可回滚。
+type Migration struct {
+	Version int
+	Name    string
+	Up      map[string][]string
+	Down    map[string][]string
+	UpFunc  func(tx *sql.Tx, dialect string) error
+}
+
+// SameSQL 各方言通用的语句
+func SameSQL(stmts ...string) map[string][]string {
+	return map[string][]string{"mysql": stmts, "sqlite": stmts}
+}
+
+// Status 迁移状态
+type Status struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// Migrator 在 schema_migrations 表中记录每个服务已执行的迁移版本
+type Migrator struct {
+	db         *sql.DB
+	dialect    string
+	service    string
+	migrations []Migration
+}
+
+// New 创建迁移器；dialect 为 mysql 或 sqlite，service 为记录在 schema_migrations 中的服务名
+func New(db *sql.DB, dialect, service string, migrations []Migration) *Migrator {
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	return &Migrator{db: db, dialect: dialect, service: service, migrations: sorted}
+}
+
+func (m *Migrator) ensureTable() error {
+	_, err := m.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+    service    VARCHAR(64)  NOT NULL,
+    version    INT          NOT NULL,
+    name       VARCHAR(255) NOT NULL,
+    applied_at TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (service, version)
+)`)
+	return err
+}
+
+func (m *Migrator) applied() (map[int]time.Time, error) {
+	if err := m.ensureTable(); err != nil {
+		return nil, fmt.Errorf("create schema_migrations: %w", err)
+	}
+	rows, err := m.db.Query("SELECT version, applied_at FROM schema_migrations WHERE service = ?", m.service)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// Status 返回全部迁移及其执行时间
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	status := make([]Status, 0, len(m.migrations))
+	for _, mg := range m.migrations {
+		s := Status{Version: mg.Version, Name: mg.Name}
+		if at, ok := applied[mg.Version]; ok {
+			s.AppliedAt = &at
+		}
+		status = append(status, s)
+	}
+	return status, nil
+}
+
+// Up 依次执行未执行的迁移，target 为 0 时执行到最新版本；返回本次执行的迁移
+func (m *Migrator) Up(target int) ([]Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for _, mg := range m.migrations {
+		if target > 0 && mg.Version > target {
+			break
+		}
+		if _, ok := applied[mg.Version]; ok {
+			continue
+		}
+		if err := m.run(mg, mg.Up[m.dialect], mg.UpFunc, true); err != nil {
+			return done, fmt.Errorf("migration %d_%s up: %w", mg.Version, mg.Name, err)
+		}
+		done = append(done, mg)
+	}
+	return done, nil
+}
+
+// Down 回滚最近执行的 steps 个迁移
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		mg := m.migrations[i]
+		if _, ok := applied[mg.Version]; !ok {
+			continue
+		}
+		stmts, ok := mg.Down[m.dialect]
+		if !ok {
+			return done, fmt.Errorf("migration %d_%s is irreversible", mg.Version, mg.Name)
+		}
+		if err := m.run(mg, stmts, nil, false); err != nil {
+			return done, fmt.Errorf("migration %d_%s down: %w", mg.Version, mg.Name, err)
+		}
+		done = append(done, mg)
+	}
+	return done, nil
+}
+
+// run 在事务中执行迁移并更新 schema_migrations（MySQL 的 DDL 会隐式提交）
+func (m *Migrator) run(mg Migration, stmts []string, fn func(*sql.Tx, string) error, up bool) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if fn != nil {
+		if err := fn(tx, m.dialect); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if up {
+		_, err = tx.Exec("INSERT INTO schema_migrations (service, version, name, applied_at) VALUES (?, ?, ?, ?)",
+			m.service, mg.Version, mg.Name, time.Now())
+	} else {
+		_, err = tx.Exec("DELETE FROM schema_migrations WHERE service = ? AND version = ?", m.service, mg.Version)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// ColumnExists 判断表中是否存在某列，供需要兼容旧表结构的迁移使用
+func ColumnExists(tx *sql.Tx, dialect, table, column string) (bool, error) {
+	var n int
+	var err error
+	if dialect == "mysql" {
+		err = tx.QueryRow(`SELECT COUNT(*) FROM information_schema.COLUMNS
+    WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND BINARY COLUMN_NAME = ?`, table, column).Scan(&n)
+	} else {
+		err = tx.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&n)
+	}
+	return n > 0, err
+}
+
+// RunCommand 处理 migrate 子命令：
+//
+//	migrate up [version]   执行迁移（默认到最新版本）
+//	migrate down [steps]   回滚迁移（默认 1 个）
+//	migrate status         查看迁移状态
+func RunCommand(m *Migrator, args []string) error {
+	action := "up"
+	if len(args) > 0 {
+		action = args[0]
+	}
+	n := 0
+	if len(args) > 1 {
+		v, err := strconv.Atoi(args[1])
+		if err != nil || v < 0 {
+			return fmt.Errorf("invalid number %q", args[1])
+		}
+		n = v
+	}
+
+	switch action {
+	case "up":
+		done, err := m.Up(n)
+		for _, mg := range done {
+			fmt.Printf("applied  %03d_%s\n", mg.Version, mg.Name)
+		}
+		if err == nil && len(done) == 0 {
+			fmt.Println("schema is up to date")
+		}
+		return err
+	case "down":
+		if n == 0 {
+			n = 1
+		}
+		done, err := m.Down(n)
+		for _, mg := range done {
+			fmt.Printf("reverted %03d_%s\n", mg.Version, mg.Name)
+		}
+		return err
+	case "status":
+		status, err := m.Status()
+		if err != nil {
+			return err
+		}
+		for _, s := range status {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%03d_%-40s %s\n", s.Version, s.Name, applied)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate action %q (want up, down or status)", action)
+	}
+}
@@ -0,0 +1,42 @@
+// admin.go
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"microservice/pkg/auth"
+)
+
+// 管理接口：需要访问令牌携带 admin 角色，每个操作输出 audit=admin_action 的审计日志
+const roleAdmin = "admin"
+
+// auditAdminAction 输出管理操作审计记录
+func auditAdminAction(c *gin.Context, action, target string, keysAndValues ...interface{}) {
+	actor := ""
+	if claims, ok := auth.ClaimsFrom(c); ok {
+		actor = claims.Subject
+	}
+	zapLog.Infow("Admin action", append([]interface{}{
+		"audit", "admin_action",
+		"action", action,
+		"actor", actor,
+		"target", target,
+		"ip", c.ClientIP(),
+	}, keysAndValues...)...)
+}
+
+// adminRemoveEntryHandler 从排行榜中移除用户；之后该用户的新事件会重新计入排行榜
+func adminRemoveEntryHandler(c *gin.Context) {
+	userID := c.Param("userId")
+	removed, err := store.RemoveUser(userID)
+	if err != nil {
+		zapLog.Errorw("Error removing leaderboard entry", "user_id", userID, "err", err)
+		c.JSON(500, gin.H{"error": "Internal Server Error", "success": false})
+		return
+	}
+	if !removed {
+		c.JSON(404, gin.H{"error": "Entry not found", "success": false})
+		return
+	}
+	auditAdminAction(c, "remove_leaderboard_entry", userID)
+	c.JSON(200, gin.H{"success": true})
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"microservice/pkg/auth"
+)
+
+/* ----------------- 访问令牌本地校验 ----------------- */
+
+// 令牌校验逻辑见 microservice/pkg/auth；这里只决定 JWKS 地址：优先取 JWKS_URL，
+// 否则通过服务发现（DISCOVERY_BACKEND）找到 login-service
+
+var verifier *auth.Verifier
+
+// initVerifier 加载共享密钥并拉取 JWKS，之后定时刷新
+func initVerifier() {
+	verifier = auth.NewVerifier(os.Getenv("JWT_ISSUER"), os.Getenv("JWT_SECRETS"), fetchJWKS, zapLog)
+	if err := verifier.Refresh(); err != nil {
+		zapLog.Warnf("Initial JWKS fetch failed: %v", err)
+	}
+	interval := auth.DefaultRefreshInterval
+	if v := os.Getenv("JWKS_REFRESH_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			interval = d
+		}
+	}
+	verifier.RefreshEvery(interval)
+}
+
+// fetchJWKS 从 login-service 拉取 JWKS
+func fetchJWKS() (map[string]auth.Key, error) {
+	url := os.Getenv("JWKS_URL")
+	if url == "" {
+		instance, err := resolveOne("login-service")
+		if err != nil {
+			return nil, fmt.Errorf("discover login-service: %w", err)
+		}
+		url = fmt.Sprintf("http://%s:%d/.well-known/jwks.json", instance.Host, instance.Port)
+	}
+	return auth.FetchJWKS(url)
+}
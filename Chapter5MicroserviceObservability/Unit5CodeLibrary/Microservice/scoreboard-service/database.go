@@ -16,7 +16,6 @@ type User struct {
 	ID             string    `json:"id"`
 	Username       string    `json:"username"`
 	Password       string    `json:"-"`
-	AuthToken      string    `json:"auth_token"`
 	Wins           int       `json:"wins"`
 	Attempts       int       `json:"attempts"`
 	CorrectGuesses int       `json:"correct_guesses"`
@@ -24,17 +23,11 @@ type User struct {
 	UpdatedAt      time.Time `json:"updated_at"`
 }
 
-// SetupDatabase 初始化数据库连接
-func SetupDatabase(nacosClient config_client.IConfigClient) (*sql.DB, error) {
-	dbConfig, err := getDatabaseConfigFromNacos(nacosClient)
-	if err != nil {
-		return nil, err
-	}
-	return initDB(dbConfig)
-}
-
 // getDatabaseConfigFromNacos 从 Nacos 获取数据库配置
 func getDatabaseConfigFromNacos(nacosClient config_client.IConfigClient) (map[string]string, error) {
+	if nacosClient == nil {
+		return nil, fmt.Errorf("mysql store reads Prod_DATABASE from Nacos, set NACOS_SERVER_IP or STORE_DRIVER=sqlite / memory")
+	}
 	content, err := nacosClient.GetConfig(vo.ConfigParam{
 		DataId: "Prod_DATABASE",
 		Group:  "DEFAULT_GROUP",
@@ -66,30 +59,99 @@ func initDB(dbConfig map[string]string) (*sql.DB, error) {
 	return db, nil
 }
 
-// getScoreboardData 获取排行榜数据
-func getScoreboardData(db *sql.DB) ([]ScoreboardEntry, error) {
-	query := `
-SELECT game.ID, users.username, game.Attempts, game.TargetNumber
-    FROM game
-    JOIN users ON game.ID = users.idthi is gary
-    ORDER BY game.Attempts ASC
+// scoreboardBaseQuery 每个用户一行的排行榜数据，来自事件维护的投影表
+const scoreboardBaseQuery = `
+SELECT UserID AS ID, Username, Attempts, Wins, CorrectGuesses
+    FROM scoreboard_player
 `
-	stmt, err := db.Prepare(query)
+
+// getScoreboardData 按排序方式分页获取排行榜数据，并计算请求者自己的排名
+func getScoreboardData(db *sql.DB, q ScoreboardQuery) (ScoreboardPage, error) {
+	page := ScoreboardPage{Entries: []ScoreboardEntry{}, Limit: q.Limit, Offset: q.Offset, Sort: q.Sort}
+	sorting, ok := scoreboardSorts[q.Sort]
+	if !ok {
+		return page, fmt.Errorf("unknown sort %q", q.Sort)
+	}
+	// 排序列来自白名单，可以安全地拼接进 SQL
+	direction, before, after := "ASC", "<", ">"
+	if sorting.Desc {
+		direction, before, after = "DESC", ">", "<"
+	}
+
+	if err := db.QueryRow(`SELECT COUNT(*) FROM scoreboard_player`).Scan(&page.Total); err != nil {
+		return page, fmt.Errorf("Failed to count scoreboard: %v", err)
+	}
+
+	// 游标分页：取排在游标之后的条目，名次从游标及之前的条目数起算
+	where, args := "", []interface{}{}
+	if q.After != nil {
+		countQuery := fmt.Sprintf(`SELECT COUNT(*) FROM (%s) s WHERE %s %s ? OR (%s = ? AND ID <= ?)`,
+			scoreboardBaseQuery, sorting.Column, before, sorting.Column)
+		if err := db.QueryRow(countQuery, q.After.Value, q.After.Value, q.After.ID).Scan(&page.Offset); err != nil {
+			return page, fmt.Errorf("Failed to locate cursor: %v", err)
+		}
+		where = fmt.Sprintf(`WHERE %s %s ? OR (%s = ? AND ID > ?)`, sorting.Column, after, sorting.Column)
+		args = append(args, q.After.Value, q.After.Value, q.After.ID)
+	}
+
+	query := fmt.Sprintf(`SELECT ID, Username, Attempts, Wins, CorrectGuesses FROM (%s) s %s
+    ORDER BY %s %s, ID ASC
+    LIMIT ? OFFSET ?`, scoreboardBaseQuery, where, sorting.Column, direction)
+	offset := page.Offset
+	if q.After != nil {
+		offset = 0
+	}
+	rows, err := db.Query(query, append(args, q.Limit, offset)...)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to prepare query: %v", err)
+		return page, fmt.Errorf("Failed to execute query: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry ScoreboardEntry
+		if err = rows.Scan(&entry.ID, &entry.Username, &entry.Attempts, &entry.Wins, &entry.CorrectGuesses); err != nil {
+			return page, fmt.Errorf("Failed to scan row: %v", err)
+		}
+		entry.Rank = page.Offset + len(page.Entries) + 1
+		page.Entries = append(page.Entries, entry)
 	}
-	defer stmt.Close()
+	if err = rows.Err(); err != nil {
+		return page, fmt.Errorf("Row iteration error: %v", err)
+	}
+	if n := len(page.Entries); n > 0 && page.Offset+n < page.Total {
+		page.NextCursor = cursorAfter(q.Sort, page.Entries[n-1])
+	}
+
+	if q.UserID == "" {
+		return page, nil
+	}
+	me, ok, err := getScoreboardEntry(db, q.UserID)
+	if err != nil || !ok {
+		return page, err
+	}
+	rankQuery := fmt.Sprintf(`SELECT COUNT(*) FROM (%s) s WHERE %s %s ? OR (%s = ? AND ID < ?)`,
+		scoreboardBaseQuery, sorting.Column, before, sorting.Column)
+	value := sorting.value(me)
+	if err = db.QueryRow(rankQuery, value, value, me.ID).Scan(&me.Rank); err != nil {
+		return page, fmt.Errorf("Failed to query own rank: %v", err)
+	}
+	me.Rank++
+	page.Me = &me
+	return page, nil
+}
 
-	rows, err := stmt.Query()
+// getScoreboardEntries 获取全部用户的排行榜统计
+func getScoreboardEntries(db *sql.DB) ([]ScoreboardEntry, error) {
+	rows, err := db.Query(scoreboardBaseQuery)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to execute query: %v", err)
 	}
 	defer rows.Close()
 
-	var entries []ScoreboardEntry
+	entries := []ScoreboardEntry{}
 	for rows.Next() {
 		var entry ScoreboardEntry
-		if err = rows.Scan(&entry.ID, &entry.Username, &entry.Attempts, &entry.TargetNumber); err != nil {
+		if err = rows.Scan(&entry.ID, &entry.Username, &entry.Attempts, &entry.Wins, &entry.CorrectGuesses); err != nil {
 			return nil, fmt.Errorf("Failed to scan row: %v", err)
 		}
 		entries = append(entries, entry)
@@ -100,6 +162,154 @@ SELECT game.ID, users.username, game.Attempts, game.TargetNumber
 	return entries, nil
 }
 
+// getScoreboardEntry 获取单个用户的排行榜统计
+func getScoreboardEntry(db *sql.DB, userID string) (ScoreboardEntry, bool, error) {
+	var entry ScoreboardEntry
+	err := db.QueryRow(fmt.Sprintf(`SELECT ID, Username, Attempts, Wins, CorrectGuesses FROM (%s) s WHERE ID = ?`, scoreboardBaseQuery), userID).
+		Scan(&entry.ID, &entry.Username, &entry.Attempts, &entry.Wins, &entry.CorrectGuesses)
+	if err == sql.ErrNoRows {
+		return entry, false, nil
+	}
+	if err != nil {
+		return entry, false, fmt.Errorf("Failed to query entry: %v", err)
+	}
+	return entry, true, nil
+}
+
+// getDifficultyScoreboardData 获取指定难度的排行榜：按最少尝试次数、获胜局数排序
+func getDifficultyScoreboardData(db *sql.DB, difficulty string) ([]DifficultyScoreboardEntry, error) {
+	query := `
+SELECT scoreboard_difficulty.UserID, scoreboard_player.Username, scoreboard_difficulty.Wins, scoreboard_difficulty.BestAttempts
+    FROM scoreboard_difficulty
+    JOIN scoreboard_player ON scoreboard_difficulty.UserID = scoreboard_player.UserID
+    WHERE scoreboard_difficulty.Difficulty = ? AND scoreboard_difficulty.Wins > 0
+    ORDER BY scoreboard_difficulty.BestAttempts ASC, scoreboard_difficulty.Wins DESC, scoreboard_difficulty.UserID ASC
+`
+	rows, err := db.Query(query, difficulty)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to execute query: %v", err)
+	}
+	defer rows.Close()
+
+	entries := []DifficultyScoreboardEntry{}
+	for rows.Next() {
+		entry := DifficultyScoreboardEntry{Difficulty: difficulty}
+		if err = rows.Scan(&entry.ID, &entry.Username, &entry.Wins, &entry.BestAttempts); err != nil {
+			return nil, fmt.Errorf("Failed to scan row: %v", err)
+		}
+		entry.Rank = len(entries) + 1
+		entries = append(entries, entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("Row iteration error: %v", err)
+	}
+	return entries, nil
+}
+
+// applyEvents 在事务中将事件写入投影表，已处理过的事件跳过；返回实际生效的事件
+func applyEvents(db *sql.DB, events []GameEvent) ([]GameEvent, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var applied []GameEvent
+	for _, e := range events {
+		var seen int
+		if err = tx.QueryRow(`SELECT COUNT(*) FROM scoreboard_processed_event WHERE EventID = ?`, e.ID).Scan(&seen); err != nil {
+			return nil, fmt.Errorf("Failed to check event %s: %v", e.ID, err)
+		}
+		if seen > 0 {
+			continue
+		}
+		if _, err = tx.Exec(`INSERT INTO scoreboard_processed_event (EventID, ProcessedAt) VALUES (?, ?)`, e.ID, time.Now()); err != nil {
+			return nil, fmt.Errorf("Failed to record event %s: %v", e.ID, err)
+		}
+		if err = applyEventTx(tx, e); err != nil {
+			return nil, fmt.Errorf("Failed to apply event %s: %v", e.ID, err)
+		}
+		applied = append(applied, e)
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
+// applyEventTx 按事件类型更新投影
+func applyEventTx(tx *sql.Tx, e GameEvent) error {
+	if err := ensureRow(tx, `SELECT COUNT(*) FROM scoreboard_player WHERE UserID = ?`,
+		`INSERT INTO scoreboard_player (UserID, Username) VALUES (?, ?)`, []interface{}{e.UserID}, e.UserID, e.Username); err != nil {
+		return err
+	}
+	if e.Username != "" {
+		if _, err := tx.Exec(`UPDATE scoreboard_player SET Username = ? WHERE UserID = ?`, e.Username, e.UserID); err != nil {
+			return err
+		}
+	}
+
+	switch e.Type {
+	case EventGuessMade:
+		column := "Attempts"
+		if e.Correct {
+			column = "CorrectGuesses"
+		}
+		_, err := tx.Exec(`UPDATE scoreboard_player SET `+column+` = `+column+` + 1 WHERE UserID = ?`, e.UserID)
+		return err
+	case EventRoundWon:
+		if _, err := tx.Exec(`UPDATE scoreboard_player SET Wins = Wins + 1 WHERE UserID = ?`, e.UserID); err != nil {
+			return err
+		}
+		if err := ensureRow(tx, `SELECT COUNT(*) FROM scoreboard_difficulty WHERE UserID = ? AND Difficulty = ?`,
+			`INSERT INTO scoreboard_difficulty (UserID, Difficulty) VALUES (?, ?)`,
+			[]interface{}{e.UserID, e.Difficulty}, e.UserID, e.Difficulty); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`UPDATE scoreboard_difficulty
+    SET Wins = Wins + 1,
+        BestAttempts = CASE WHEN BestAttempts = 0 OR ? < BestAttempts THEN ? ELSE BestAttempts END
+    WHERE UserID = ? AND Difficulty = ?`, e.Attempts, e.Attempts, e.UserID, e.Difficulty)
+		return err
+	}
+	return nil
+}
+
+// ensureRow 行不存在时插入，MySQL 与 SQLite 通用
+func ensureRow(tx *sql.Tx, countQuery, insertQuery string, keys []interface{}, values ...interface{}) error {
+	var n int
+	if err := tx.QueryRow(countQuery, keys...).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	_, err := tx.Exec(insertQuery, values...)
+	return err
+}
+
+// removeUser 在事务中删除用户的总榜与难度榜统计
+func removeUser(db *sql.DB, userID string) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`DELETE FROM scoreboard_player WHERE UserID = ?`, userID)
+	if err != nil {
+		return false, fmt.Errorf("Failed to delete player %s: %v", userID, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if _, err = tx.Exec(`DELETE FROM scoreboard_difficulty WHERE UserID = ?`, userID); err != nil {
+		return false, fmt.Errorf("Failed to delete difficulty stats %s: %v", userID, err)
+	}
+	return n > 0, tx.Commit()
+}
+
 // closeDatabase 关闭数据库连接
 func closeDatabase(db *sql.DB) {
 	if db != nil {
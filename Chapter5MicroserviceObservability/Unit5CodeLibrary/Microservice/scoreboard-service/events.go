@@ -0,0 +1,77 @@
+// events.go
+package main
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// game-service 领域事件类型
+const (
+	EventRoundStarted   = "RoundStarted"
+	EventGuessMade      = "GuessMade"
+	EventRoundWon       = "RoundWon"
+	EventRoundLost      = "RoundLost"
+	EventRoundAbandoned = "RoundAbandoned"
+)
+
+// GameEvent game-service 发布的领域事件，字段与其 DomainEvent 一致。
+// 事件至少投递一次，按 ID 去重；投影只做累加与取最小值，与到达顺序无关。
+type GameEvent struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	UserID     string    `json:"user_id"`
+	Username   string    `json:"username"`
+	RoundID    uint      `json:"round_id"`
+	Difficulty string    `json:"difficulty"`
+	Number     int       `json:"number,omitempty"`
+	Correct    bool      `json:"correct,omitempty"`
+	Attempts   int       `json:"attempts"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// eventBatchRequest POST /scoreboard/events 的请求体
+type eventBatchRequest struct {
+	Events []GameEvent `json:"events"`
+}
+
+// scoreboardEventHandler 消费 game-service 推送的事件：更新投影，再增量更新内存排行榜。
+// 请求签名已由 auth.RequireSignature 校验
+func scoreboardEventHandler(c *gin.Context) {
+	var req eventBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request body", "success": false})
+		return
+	}
+	for _, e := range req.Events {
+		if e.ID == "" || e.Type == "" || e.UserID == "" {
+			c.JSON(400, gin.H{"error": "id, type and user_id are required", "success": false})
+			return
+		}
+	}
+
+	applied, err := store.ApplyEvents(req.Events)
+	if err != nil {
+		zapLog.Errorw("Error applying game events", "count", len(req.Events), "err", err)
+		c.JSON(500, gin.H{"error": "Internal Server Error", "success": false})
+		return
+	}
+	eventsConsumed.WithLabelValues("applied").Add(float64(len(applied)))
+	eventsConsumed.WithLabelValues("duplicate").Add(float64(len(req.Events) - len(applied)))
+
+	if leaderboard != nil {
+		seen := make(map[string]bool)
+		for _, e := range applied {
+			if seen[e.UserID] {
+				continue
+			}
+			seen[e.UserID] = true
+			if err := leaderboard.Apply(e.UserID); err != nil {
+				// 投影已更新，内存排行榜会在下一次刷新时追上
+				zapLog.Warnw("Error updating leaderboard", "user_id", e.UserID, "err", err)
+			}
+		}
+	}
+	c.JSON(200, gin.H{"success": true, "applied": len(applied)})
+}
@@ -0,0 +1,292 @@
+// leaderboard.go
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 内存排行榜的默认刷新间隔，可通过 LEADERBOARD_REFRESH_INTERVAL 修改，设为 0 时不使用内存排行榜
+const defaultLeaderboardRefreshInterval = 30 * time.Second
+
+// leaderboardSnapshot 全量刷新构建的排行榜，之后由增量更新在锁内原地修改
+type leaderboardSnapshot struct {
+	sorted  map[string][]ScoreboardEntry // 排序方式 -> 已排序且填好名次的条目
+	byID    map[string]ScoreboardEntry   // 用户 ID -> 条目
+	digest  uint64                       // 各条目哈希的异或，与顺序无关，可逐条增量维护
+	builtAt time.Time
+}
+
+// cachedLeaderboard 在内存中维护已排序的排行榜：按间隔全量刷新，收到对局结束事件时增量更新单个用户。
+// 读请求直接从快照分页，自己的名次通过二分查找得到；难度排行榜透传给底层存储。
+type cachedLeaderboard struct {
+	LeaderboardStore
+
+	mu       sync.RWMutex // 保护 snapshot 与 version
+	snapshot *leaderboardSnapshot
+	version  uint64 // 每次修改快照时递增，全量刷新据此丢弃读取期间已过期的数据
+	interval time.Duration
+	stop     chan struct{}
+}
+
+// leaderboardRefreshInterval 读取刷新间隔配置
+func leaderboardRefreshInterval() time.Duration {
+	v := os.Getenv("LEADERBOARD_REFRESH_INTERVAL")
+	if v == "" {
+		return defaultLeaderboardRefreshInterval
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		zapLog.Warnw("Invalid LEADERBOARD_REFRESH_INTERVAL, using default", "value", v)
+		return defaultLeaderboardRefreshInterval
+	}
+	return d
+}
+
+func newCachedLeaderboard(backend LeaderboardStore, interval time.Duration) *cachedLeaderboard {
+	return &cachedLeaderboard{
+		LeaderboardStore: backend,
+		interval:         interval,
+		stop:             make(chan struct{}),
+	}
+}
+
+// Start 构建首个快照并开始定时刷新；首次构建失败时请求回落到底层存储，直到下一次刷新成功
+func (l *cachedLeaderboard) Start() {
+	if err := l.Refresh(); err != nil {
+		zapLog.Errorw("Initial leaderboard refresh failed", "err", err)
+	}
+	go func() {
+		ticker := time.NewTicker(l.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := l.Refresh(); err != nil {
+					zapLog.Errorw("Leaderboard refresh failed", "err", err)
+				}
+			case <-l.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Refresh 从底层存储全量重建快照；读取期间快照已被增量更新时丢弃本次结果，等待下一次刷新
+func (l *cachedLeaderboard) Refresh() error {
+	start := time.Now()
+	l.mu.RLock()
+	version := l.version
+	l.mu.RUnlock()
+
+	entries, err := l.LeaderboardStore.Entries()
+	if err != nil {
+		leaderboardRefreshes.WithLabelValues("error").Inc()
+		return err
+	}
+	next := buildSnapshot(entries)
+
+	l.mu.Lock()
+	if l.version != version {
+		l.mu.Unlock()
+		leaderboardRefreshes.WithLabelValues("stale").Inc()
+		return nil
+	}
+	prev := l.snapshot
+	l.snapshot = next
+	l.version++
+	l.mu.Unlock()
+	if prev != nil && prev.digest != next.digest {
+		// 全量刷新中的变化无法逐个定位，通知客户端重新拉取
+		hub.Publish(streamEventRefresh, gin.H{"etag": next.etag()})
+	}
+
+	leaderboardRefreshes.WithLabelValues("ok").Inc()
+	leaderboardRefreshDuration.Observe(time.Since(start).Seconds())
+	return nil
+}
+
+// Apply 重新读取单个用户的统计，在各排序列表中把该用户移到新位置
+func (l *cachedLeaderboard) Apply(userID string) error {
+	entry, ok, err := l.LeaderboardStore.Entry(userID)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	snap := l.snapshot
+	if snap == nil {
+		// 尚无快照，等待下一次全量刷新
+		l.mu.Unlock()
+		return nil
+	}
+	old, had := snap.byID[userID]
+	var changes []rankChange
+	for _, name := range sortedScoreboardSorts() {
+		var before, after int
+		snap.sorted[name], before, after = moveEntry(snap.sorted[name], scoreboardSorts[name], old, had, entry, ok)
+		if before != after {
+			changes = append(changes, rankChange{Sort: name, Rank: after, PreviousRank: before})
+		}
+	}
+	if had {
+		delete(snap.byID, userID)
+		snap.digest ^= entryDigest(old)
+	}
+	if ok {
+		entry.Rank = 0
+		snap.byID[userID] = entry
+		snap.digest ^= entryDigest(entry)
+	}
+	l.version++
+	l.mu.Unlock()
+	leaderboardIncrementalUpdates.Inc()
+
+	if len(changes) > 0 {
+		event := rankChangeEvent{UserID: userID, Changes: changes}
+		if ok {
+			event.Username = entry.Username
+		}
+		hub.Publish(streamEventRankChange, event)
+	}
+	return nil
+}
+
+// RemoveUser 删除底层存储中的统计后立即从快照中移除该用户
+func (l *cachedLeaderboard) RemoveUser(userID string) (bool, error) {
+	removed, err := l.LeaderboardStore.RemoveUser(userID)
+	if err != nil {
+		return false, err
+	}
+	return removed, l.Apply(userID)
+}
+
+// Scoreboard 从快照分页；快照尚未构建时回落到底层存储
+func (l *cachedLeaderboard) Scoreboard(q ScoreboardQuery) (ScoreboardPage, error) {
+	l.mu.RLock()
+	snap := l.snapshot
+	if _, ok := scoreboardSorts[q.Sort]; snap == nil || !ok {
+		l.mu.RUnlock()
+		leaderboardCacheRequests.WithLabelValues("miss").Inc()
+		return l.LeaderboardStore.Scoreboard(q)
+	}
+	defer l.mu.RUnlock()
+	leaderboardCacheRequests.WithLabelValues("hit").Inc()
+
+	page := paginate(snap.sorted[q.Sort], q)
+	page.ETag = snap.etag()
+	if me, ok := snap.find(q.Sort, q.UserID); ok {
+		page.Me = &me
+	}
+	return page, nil
+}
+
+// find 通过二分查找返回用户在某排序方式下的条目（含名次）
+func (s *leaderboardSnapshot) find(sortName, userID string) (ScoreboardEntry, bool) {
+	entry, ok := s.byID[userID]
+	if !ok {
+		return ScoreboardEntry{}, false
+	}
+	sorting := scoreboardSorts[sortName]
+	sorted := s.sorted[sortName]
+	i := sort.Search(len(sorted), func(i int) bool { return !sorting.less(sorted[i], entry) })
+	if i < len(sorted) && sorted[i].ID == userID {
+		return sorted[i], true
+	}
+	return ScoreboardEntry{}, false
+}
+
+// etag 以数据摘要作为 ETag，相同数据在不同实例上得到相同的 ETag
+func (s *leaderboardSnapshot) etag() string {
+	return fmt.Sprintf("%x", s.digest)
+}
+
+// staleness 距上次全量刷新的时间
+func (l *cachedLeaderboard) staleness() time.Duration {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if snap := l.snapshot; snap != nil {
+		return time.Since(snap.builtAt)
+	}
+	return 0
+}
+
+// size 快照中的用户数
+func (l *cachedLeaderboard) size() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if snap := l.snapshot; snap != nil {
+		return len(snap.byID)
+	}
+	return 0
+}
+
+func (l *cachedLeaderboard) Close() error {
+	close(l.stop)
+	return l.LeaderboardStore.Close()
+}
+
+// buildSnapshot 对全部条目按每种排序方式排序
+func buildSnapshot(entries []ScoreboardEntry) *leaderboardSnapshot {
+	snap := &leaderboardSnapshot{
+		sorted:  make(map[string][]ScoreboardEntry, len(scoreboardSorts)),
+		byID:    make(map[string]ScoreboardEntry, len(entries)),
+		builtAt: time.Now(),
+	}
+	for _, e := range entries {
+		e.Rank = 0
+		snap.byID[e.ID] = e
+		snap.digest ^= entryDigest(e)
+	}
+	for name, sorting := range scoreboardSorts {
+		sorted := append([]ScoreboardEntry(nil), entries...)
+		rankEntries(sorted, sorting)
+		snap.sorted[name] = sorted
+	}
+	return snap
+}
+
+// moveEntry 在已排序列表中移除旧条目（had 为 true 时）并按新值插入（keep 为 true 时），
+// 只重新编号两个位置之间受影响的条目；返回新列表以及前后名次，不在榜上时名次为 0
+func moveEntry(sorted []ScoreboardEntry, sorting scoreboardSort, old ScoreboardEntry, had bool, entry ScoreboardEntry, keep bool) ([]ScoreboardEntry, int, int) {
+	from, to := -1, -1
+	if had {
+		from = sort.Search(len(sorted), func(i int) bool { return !sorting.less(sorted[i], old) })
+		sorted = append(sorted[:from], sorted[from+1:]...)
+	}
+	if keep {
+		to = sort.Search(len(sorted), func(i int) bool { return !sorting.less(sorted[i], entry) })
+		sorted = append(sorted, ScoreboardEntry{})
+		copy(sorted[to+1:], sorted[to:])
+		sorted[to] = entry
+	}
+
+	lo, hi := from, to
+	switch {
+	case !had && !keep:
+		return sorted, 0, 0
+	case !had:
+		lo, hi = to, len(sorted)-1
+	case !keep:
+		hi = len(sorted) - 1
+	case lo > hi:
+		lo, hi = hi, lo
+	}
+	for i := lo; i <= hi; i++ {
+		sorted[i].Rank = i + 1
+	}
+	return sorted, from + 1, to + 1
+}
+
+// entryDigest 单个条目的哈希，快照摘要为全部条目哈希的异或
+func entryDigest(e ScoreboardEntry) uint64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s\x00%s\x00%d\x00%d\x00%d\n", e.ID, e.Username, e.Attempts, e.Wins, e.CorrectGuesses)
+	return h.Sum64()
+}
@@ -2,26 +2,41 @@
 package main
 
 import (
-	"database/sql"
 	"github.com/gin-gonic/gin"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/joho/godotenv"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"microservice/pkg/auth"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
 // ScoreboardEntry 定义了用户在排行榜中的信息
 type ScoreboardEntry struct {
+	Rank           int    `json:"rank"`
+	ID             string `json:"id"`
+	Username       string `json:"username"`
+	Attempts       int    `json:"attempts"`
+	Wins           int    `json:"wins"`
+	CorrectGuesses int    `json:"correct_guesses"`
+}
+
+// DifficultyScoreboardEntry 定义了用户在某个难度排行榜中的信息
+type DifficultyScoreboardEntry struct {
+	Rank         int    `json:"rank"`
 	ID           string `json:"id"`
 	Username     string `json:"username"`
-	Attempts     int    `json:"attempts"`
-	TargetNumber int    `json:"target_number"`
+	Difficulty   string `json:"difficulty"`
+	Wins         int    `json:"wins"`
+	BestAttempts int    `json:"best_attempts"`
 }
 
-var db *sql.DB
+var store LeaderboardStore
+var leaderboard *cachedLeaderboard // 未启用内存排行榜时为 nil
 var zapLog *zap.SugaredLogger
 
 // ---------- Logger ----------
@@ -64,33 +79,67 @@ func init() {
 		zapLog.Fatalf("Could not determine working directory: %v", err)
 	}
 	if err = godotenv.Load(filepath.Join(pwd, ".env")); err != nil {
-		zapLog.Fatalf("Error loading .env file: %v", err)
+		zapLog.Infof("No .env file loaded, using environment variables: %v", err)
 	}
 }
 
 // ---------- main ----------
 func main() {
+	// migrate 子命令：仅 MySQL 需要通过 Nacos 读取数据库配置
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if storeDriver(nil) == driverMySQL {
+			if _, _, err := initNacos(); err != nil {
+				zapLog.Fatal("Error initializing Nacos:", err)
+			}
+		}
+		migrateMain(os.Args[2:])
+		return
+	}
+
 	_, configClient, err := initNacos()
 	if err != nil {
 		zapLog.Fatal("Error initializing Nacos:", err)
 	}
+	if err = initDiscovery(); err != nil {
+		zapLog.Fatal("Error initializing service discovery:", err)
+	}
+	if err = registerService("scoreboard-service", 8085); err != nil {
+		zapLog.Fatal("Error registering service:", err)
+	}
 	defer func() {
-		if err = deregisterService("scoreboard-service", 8085); err != nil {
+		if err = deregisterService(); err != nil {
 			zapLog.Fatal("Error deregistering service:", err)
 		}
 	}()
 
-	db, err = SetupDatabase(configClient)
+	// 加载访问令牌校验密钥（共享密钥 / login-service JWKS）
+	initVerifier()
+
+	store, err = SetupStore(configClient)
 	if err != nil {
 		zapLog.Fatal("Error setting up the database:", err)
 	}
-	defer closeDatabase(db)
+	// 内存排行榜：定时刷新 + 对局结束事件增量更新
+	if interval := leaderboardRefreshInterval(); interval > 0 {
+		leaderboard = newCachedLeaderboard(store, interval)
+		leaderboard.Start()
+		store = leaderboard
+		zapLog.Infow("In-memory leaderboard enabled", "refresh_interval", interval.String())
+	}
+	defer store.Close()
+	registerMetrics(leaderboard)
 
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
 	r.Use(ZapRequestLogger(), gin.Recovery())
 	r.Use(corsMiddleware)
-	r.GET("/scoreboard", getScoreboardHandler)
+	r.Use(auth.CSRF(zapLog))
+	r.GET("/scoreboard", verifier.Middleware(false), getScoreboardHandler)
+	// 只接受 game-service 签名的事件，网关不转发该路径
+	r.POST("/scoreboard/events", auth.RequireSignature(os.Getenv("EVENT_SIGNING_SECRETS"), zapLog), scoreboardEventHandler)
+	r.GET("/scoreboard/stream", scoreboardStreamHandler)
+	r.DELETE("/admin/scoreboard/:userId", verifier.Middleware(true), auth.RequireRole(roleAdmin, zapLog), adminRemoveEntryHandler)
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
 	zapLog.Infof("Starting server on port 8085")
 	if err = r.Run(":8085"); err != nil {
@@ -101,9 +150,10 @@ func main() {
 // ---------- CORS ----------
 func corsMiddleware(c *gin.Context) {
 	c.Header("Access-Control-Allow-Origin", "http://micro.roliyal.com")
-	c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, X-User-ID")
+	c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, X-XSRF-TOKEN, Last-Event-ID")
 	c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 	c.Header("Access-Control-Allow-Credentials", "true")
+	c.Header("Access-Control-Expose-Headers", "ETag")
 	c.Header("Access-Control-Max-Age", "100")
 	if c.Request.Method == "OPTIONS" {
 		c.AbortWithStatus(200)
@@ -114,11 +164,49 @@ func corsMiddleware(c *gin.Context) {
 
 // ---------- Handler ----------
 func getScoreboardHandler(c *gin.Context) {
-	data, err := getScoreboardData(db)
+	if difficulty := strings.ToLower(strings.TrimSpace(c.Query("difficulty"))); difficulty != "" {
+		data, err := store.DifficultyScoreboard(difficulty)
+		if err != nil {
+			zapLog.Errorw("Error fetching difficulty scoreboard data", "difficulty", difficulty, "err", err)
+			c.JSON(500, gin.H{"error": "Internal Server Error", "success": false})
+			return
+		}
+		c.JSON(200, data)
+		return
+	}
+
+	q, err := parseScoreboardQuery(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	data, err := store.Scoreboard(q)
 	if err != nil {
 		zapLog.Errorw("Error fetching scoreboard data", "err", err)
 		c.JSON(500, gin.H{"error": "Internal Server Error", "success": false})
 		return
 	}
+	if data.ETag != "" {
+		etag := `"` + data.ETag + `"`
+		c.Header("ETag", etag)
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Vary", "Authorization, Cookie")
+		if etagMatches(c.GetHeader("If-None-Match"), etag) {
+			leaderboardNotModified.Inc()
+			c.Status(304)
+			return
+		}
+	}
 	c.JSON(200, data)
 }
+
+// etagMatches 判断 If-None-Match 是否包含当前 ETag（弱比较）
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
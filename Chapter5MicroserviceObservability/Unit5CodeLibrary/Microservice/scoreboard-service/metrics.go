@@ -0,0 +1,88 @@
+// metrics.go
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 排行榜缓存指标；命中率 = hit / (hit + miss)
+var (
+	leaderboardCacheRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "scoreboard_cache_requests_total",
+			Help: "Scoreboard requests by cache result (hit: served from the in-memory leaderboard, miss: served from the database).",
+		},
+		[]string{"result"},
+	)
+
+	leaderboardNotModified = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "scoreboard_not_modified_total",
+			Help: "Scoreboard requests answered with 304 Not Modified.",
+		},
+	)
+
+	leaderboardRefreshes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "scoreboard_cache_refreshes_total",
+			Help: "Full leaderboard rebuilds by result.",
+		},
+		[]string{"result"},
+	)
+
+	leaderboardRefreshDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "scoreboard_cache_refresh_duration_seconds",
+			Help:    "Duration of full leaderboard rebuilds in seconds.",
+			Buckets: prometheus.DefBuckets,
+		},
+	)
+
+	leaderboardIncrementalUpdates = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "scoreboard_cache_incremental_updates_total",
+			Help: "Single-user leaderboard updates triggered by game events.",
+		},
+	)
+
+	eventsConsumed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "scoreboard_events_consumed_total",
+			Help: "Game events received from game-service by result (applied or duplicate).",
+		},
+		[]string{"result"},
+	)
+
+	streamClients = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "scoreboard_stream_clients",
+			Help: "Number of connected /scoreboard/stream clients.",
+		},
+	)
+)
+
+// registerMetrics 注册指标；leaderboard 为空时不注册缓存的状态指标
+func registerMetrics(leaderboard *cachedLeaderboard) {
+	prometheus.MustRegister(
+		leaderboardCacheRequests,
+		leaderboardNotModified,
+		leaderboardRefreshes,
+		leaderboardRefreshDuration,
+		leaderboardIncrementalUpdates,
+		streamClients,
+		eventsConsumed,
+	)
+	if leaderboard == nil {
+		return
+	}
+	prometheus.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "scoreboard_cache_staleness_seconds",
+			Help: "Seconds since the in-memory leaderboard was last rebuilt.",
+		}, func() float64 { return leaderboard.staleness().Seconds() }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "scoreboard_cache_entries",
+			Help: "Number of users in the in-memory leaderboard.",
+		}, func() float64 { return float64(leaderboard.size()) }),
+	)
+}
@@ -0,0 +1,133 @@
+// migrations.go
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+
+	"microservice/pkg/migrate"
+)
+
+// scoreboard-service 负责排行榜投影表 scoreboard_*，由 game-service 的领域事件维护；
+// 早期直接查询 game-service 表时在 game_round 上补充的索引保留在迁移 1 中
+var scoreboardMigrations = []migrate.Migration{
+	{
+		Version: 1,
+		Name:    "add_leaderboard_indexes",
+		UpFunc: func(tx *sql.Tx, dialect string) error {
+			// 独立部署的数据库中没有 game_round，跳过
+			if ok, err := migrate.ColumnExists(tx, dialect, "game_round", "Result"); err != nil || !ok {
+				return err
+			}
+			stmt := "CREATE INDEX idx_round_leaderboard ON game_round (Result, Difficulty, UserID)"
+			if dialect == "sqlite" {
+				stmt = "CREATE INDEX IF NOT EXISTS idx_round_leaderboard ON game_round (Result, Difficulty, UserID)"
+			}
+			_, err := tx.Exec(stmt)
+			return err
+		},
+		Down: map[string][]string{
+			"mysql":  {"DROP INDEX idx_round_leaderboard ON game_round"},
+			"sqlite": {"DROP INDEX IF EXISTS idx_round_leaderboard"},
+		},
+	},
+	{
+		Version: 2,
+		Name:    "create_scoreboard_projection",
+		Up: migrate.SameSQL(`CREATE TABLE IF NOT EXISTS scoreboard_player (
+    UserID         VARCHAR(255) NOT NULL,
+    Username       VARCHAR(255) NOT NULL DEFAULT '',
+    Attempts       INT          NOT NULL DEFAULT 0,
+    Wins           INT          NOT NULL DEFAULT 0,
+    CorrectGuesses INT          NOT NULL DEFAULT 0,
+    PRIMARY KEY (UserID)
+)`, `CREATE TABLE IF NOT EXISTS scoreboard_difficulty (
+    UserID       VARCHAR(255) NOT NULL,
+    Difficulty   VARCHAR(64)  NOT NULL,
+    Wins         INT          NOT NULL DEFAULT 0,
+    BestAttempts INT          NOT NULL DEFAULT 0,
+    PRIMARY KEY (UserID, Difficulty)
+)`, `CREATE TABLE IF NOT EXISTS scoreboard_processed_event (
+    EventID     VARCHAR(64) NOT NULL,
+    ProcessedAt DATETIME    NOT NULL,
+    PRIMARY KEY (EventID)
+)`),
+		Down: migrate.SameSQL(
+			`DROP TABLE IF EXISTS scoreboard_processed_event`,
+			`DROP TABLE IF EXISTS scoreboard_difficulty`,
+			`DROP TABLE IF EXISTS scoreboard_player`,
+		),
+	},
+	{
+		// 与 game-service 共用数据库时，从其表中回填投影；已写入 outbox 的事件视为已处理，避免重复计数
+		Version: 3,
+		Name:    "backfill_scoreboard_projection",
+		UpFunc: func(tx *sql.Tx, dialect string) error {
+			for _, table := range []struct{ name, column string }{{"game", "ID"}, {"users", "ID"}, {"game_round", "Result"}} {
+				if ok, err := migrate.ColumnExists(tx, dialect, table.name, table.column); err != nil || !ok {
+					return err
+				}
+			}
+			stmts := []string{
+				`INSERT INTO scoreboard_player (UserID, Username, Attempts, Wins, CorrectGuesses)
+    SELECT game.ID, users.Username, game.Attempts,
+           (SELECT COUNT(*) FROM game_round WHERE game_round.UserID = game.ID AND game_round.Result = 'won'),
+           game.CorrectGuesses
+    FROM game JOIN users ON game.ID = users.ID`,
+				`INSERT INTO scoreboard_difficulty (UserID, Difficulty, Wins, BestAttempts)
+    SELECT UserID, Difficulty, COUNT(*), MIN(Attempts)
+    FROM game_round WHERE Result = 'won' GROUP BY UserID, Difficulty`,
+			}
+			if ok, err := migrate.ColumnExists(tx, dialect, "outbox_events", "EventID"); err != nil {
+				return err
+			} else if ok {
+				stmts = append(stmts, `INSERT INTO scoreboard_processed_event (EventID, ProcessedAt)
+    SELECT EventID, CURRENT_TIMESTAMP FROM outbox_events`)
+			}
+			for _, stmt := range stmts {
+				if _, err := tx.Exec(stmt); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: migrate.SameSQL(
+			`DELETE FROM scoreboard_processed_event`,
+			`DELETE FROM scoreboard_difficulty`,
+			`DELETE FROM scoreboard_player`,
+		),
+	},
+}
+
+func newScoreboardMigrator(db *sql.DB, driver string) *migrate.Migrator {
+	return migrate.New(db, driver, "scoreboard-service", scoreboardMigrations)
+}
+
+// autoMigrateEnabled 启动时是否自动执行迁移，AUTO_MIGRATE=false 时关闭
+func autoMigrateEnabled() bool {
+	return !strings.EqualFold(os.Getenv("AUTO_MIGRATE"), "false")
+}
+
+// migrateMain 处理 `scoreboard-service migrate ...` 子命令
+func migrateMain(args []string) {
+	dbConfig, err := loadStoreConfig(ConfigClient)
+	if err != nil {
+		zapLog.Fatal("Error loading database config:", err)
+	}
+	driver := storeDriver(dbConfig)
+	if driver == driverMemory {
+		fmt.Println("memory store has no schema to migrate")
+		return
+	}
+	db, err := openDB(driver, dbConfig)
+	if err != nil {
+		zapLog.Fatal("Error opening database:", err)
+	}
+	defer db.Close()
+
+	if err = migrate.RunCommand(newScoreboardMigrator(db, driver), args); err != nil {
+		zapLog.Fatal("Migration failed:", err)
+	}
+}
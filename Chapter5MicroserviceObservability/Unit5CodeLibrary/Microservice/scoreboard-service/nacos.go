@@ -3,7 +3,6 @@ package main
 
 import (
 	"fmt"
-	"net"
 	"os"
 	"strconv"
 
@@ -11,15 +10,19 @@ import (
 	"github.com/nacos-group/nacos-sdk-go/clients/config_client"
 	"github.com/nacos-group/nacos-sdk-go/clients/naming_client"
 	"github.com/nacos-group/nacos-sdk-go/common/constant"
-	"github.com/nacos-group/nacos-sdk-go/vo"
 )
 
 // 全局变量
 var NamingClient naming_client.INamingClient
 var ConfigClient config_client.IConfigClient
 
-// initNacos 初始化 Nacos 客户端
+// initNacos 初始化 Nacos 客户端（不注册服务，由 main 负责）；
+// 未配置 NACOS_SERVER_IP 时不连接 Nacos，返回的客户端均为 nil
 func initNacos() (naming_client.INamingClient, config_client.IConfigClient, error) {
+	if os.Getenv("NACOS_SERVER_IP") == "" {
+		zapLog.Info("NACOS_SERVER_IP not set, running without Nacos")
+		return nil, nil, nil
+	}
 	timeoutMs, err := strconv.ParseUint(os.Getenv("NACOS_TIMEOUT_MS"), 10, 64)
 	if err != nil {
 		return nil, nil, fmt.Errorf("Failed to parse NACOS_TIMEOUT_MS: %v", err)
@@ -61,67 +64,5 @@ func initNacos() (naming_client.INamingClient, config_client.IConfigClient, erro
 		return nil, nil, fmt.Errorf("Failed to create Nacos config client: %v", err)
 	}
 	ConfigClient = cc
-
-	if err = registerService(NamingClient, "scoreboard-service", 8085); err != nil {
-		return nil, nil, fmt.Errorf("Error registering service: %v", err)
-	}
 	return nc, cc, nil
 }
-
-// getHostIP 获取主机的非回环 IP 地址
-func getHostIP() (string, error) {
-	addrs, err := net.InterfaceAddrs()
-	if err != nil {
-		return "", err
-	}
-	for _, addr := range addrs {
-		if ip, _, _ := net.ParseCIDR(addr.String()); ip != nil && !ip.IsLoopback() && ip.To4() != nil {
-			return ip.String(), nil
-		}
-	}
-	return "", fmt.Errorf("No valid IP address found")
-}
-
-// registerService 注册服务到 Nacos
-func registerService(client naming_client.INamingClient, serviceName string, port uint64) error {
-	hostIP, err := getHostIP()
-	if err != nil {
-		return fmt.Errorf("Failed to get host IP address: %w", err)
-	}
-
-	ok, err := client.RegisterInstance(vo.RegisterInstanceParam{
-		Ip:          hostIP,
-		Port:        port,
-		ServiceName: serviceName,
-		Weight:      10,
-		Enable:      true,
-		Healthy:     true,
-		Ephemeral:   true,
-	})
-	if err != nil {
-		return fmt.Errorf("registerService error: %w", err)
-	}
-	if !ok {
-		return fmt.Errorf("Failed to register service")
-	}
-	zapLog.Infow("Service registered", "service", serviceName, "ip", hostIP, "port", port)
-	return nil
-}
-
-// deregisterService 注销服务从 Nacos
-func deregisterService(serviceName string, port uint64) error {
-	hostIP, err := getHostIP()
-	if err != nil {
-		return fmt.Errorf("Failed to get host IP address: %w", err)
-	}
-	if _, err = NamingClient.DeregisterInstance(vo.DeregisterInstanceParam{
-		Ip:          hostIP,
-		Port:        port,
-		ServiceName: serviceName,
-		GroupName:   "DEFAULT_GROUP",
-	}); err != nil {
-		return fmt.Errorf("failed to deregister service instance: %w", err)
-	}
-	zapLog.Infow("Service deregistered", "service", serviceName)
-	return nil
-}
@@ -0,0 +1,561 @@
+// registry.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nacos-group/nacos-sdk-go/clients/naming_client"
+	"github.com/nacos-group/nacos-sdk-go/vo"
+	"gopkg.in/yaml.v3"
+)
+
+// 服务注册与发现：服务只依赖 Registry / Resolver，后端由 DISCOVERY_BACKEND 选择：
+//   - nacos（默认）：注册到 Nacos，按 Nacos 的健康实例解析
+//   - dns：Kubernetes headless Service，实例由 Endpoints 维护，注册为空操作；
+//     DISCOVERY_DNS_TARGETS（service=host[:port],...）/ DISCOVERY_DNS_DOMAIN / DISCOVERY_DNS_PORT_NAME
+//   - static：静态 YAML 文件 DISCOVERY_STATIC_FILE（默认 discovery.yml），本地开发与测试无需 Nacos
+
+const (
+	backendNacos  = "nacos"
+	backendDNS    = "dns"
+	backendStatic = "static"
+)
+
+var errServiceNotFound = errors.New("service not found")
+
+// ServiceInstance 一个服务实例
+type ServiceInstance struct {
+	Service  string            `json:"service" yaml:"-"`
+	Group    string            `json:"group,omitempty" yaml:"-"`   // 为空时使用后端的默认分组
+	Cluster  string            `json:"cluster,omitempty" yaml:"-"` // 为空时为 Nacos 的 DEFAULT 集群
+	Host     string            `json:"host" yaml:"host"`
+	Port     uint64            `json:"port" yaml:"port"`
+	Weight   float64           `json:"weight" yaml:"weight"`
+	Metadata map[string]string `json:"metadata,omitempty" yaml:"metadata"`
+}
+
+// Registry 把本服务实例登记到注册中心
+type Registry interface {
+	Register(in ServiceInstance) error
+	Deregister(in ServiceInstance) error
+}
+
+// Resolver 解析服务的当前实例列表
+type Resolver interface {
+	Resolve(service string) ([]ServiceInstance, error)
+}
+
+// DiscoveryBackend 同时提供注册与解析的后端
+type DiscoveryBackend interface {
+	Registry
+	Resolver
+	Name() string
+}
+
+var serviceBackend DiscoveryBackend
+
+// initDiscovery 在 initNacos 之后调用
+func initDiscovery() error {
+	switch backend := discoveryBackend(); backend {
+	case backendNacos:
+		if NamingClient == nil {
+			return errors.New("DISCOVERY_BACKEND=nacos requires NACOS_SERVER_IP")
+		}
+		serviceBackend = &nacosRegistry{client: NamingClient, group: nacosGroup()}
+	case backendDNS:
+		targets, err := parseDNSTargets(os.Getenv("DISCOVERY_DNS_TARGETS"))
+		if err != nil {
+			return err
+		}
+		serviceBackend = newDNSRegistry(targets, os.Getenv("DISCOVERY_DNS_DOMAIN"), os.Getenv("DISCOVERY_DNS_PORT_NAME"))
+	case backendStatic:
+		path := os.Getenv("DISCOVERY_STATIC_FILE")
+		if path == "" {
+			path = "discovery.yml"
+		}
+		static, err := loadStaticRegistry(path)
+		if err != nil {
+			return err
+		}
+		serviceBackend = static
+	default:
+		return fmt.Errorf("unknown DISCOVERY_BACKEND %q, want nacos / dns / static", backend)
+	}
+	zapLog.Infow("Service discovery initialized", "backend", serviceBackend.Name())
+	return nil
+}
+
+func discoveryBackend() string {
+	if v := strings.ToLower(strings.TrimSpace(os.Getenv("DISCOVERY_BACKEND"))); v != "" {
+		return v
+	}
+	return backendNacos
+}
+
+// resolveOne 按权重随机选择一个实例
+func resolveOne(service string) (ServiceInstance, error) {
+	if serviceBackend == nil {
+		return ServiceInstance{}, errors.New("service discovery not initialized")
+	}
+	list, err := serviceBackend.Resolve(service)
+	if err != nil {
+		return ServiceInstance{}, err
+	}
+	total := 0.0
+	for _, in := range list {
+		total += in.Weight
+	}
+	r := rand.Float64() * total
+	for _, in := range list {
+		if r -= in.Weight; r < 0 {
+			return in, nil
+		}
+	}
+	return list[len(list)-1], nil
+}
+
+// validateInstance 校验实例地址并补全默认权重
+func validateInstance(in *ServiceInstance) error {
+	if in.Host == "" {
+		return fmt.Errorf("%s: host is required", in.Service)
+	}
+	if in.Port == 0 || in.Port > 65535 {
+		return fmt.Errorf("%s: invalid port %d", in.Service, in.Port)
+	}
+	if in.Weight < 0 {
+		return fmt.Errorf("%s: invalid weight %v", in.Service, in.Weight)
+	}
+	if in.Weight == 0 {
+		in.Weight = 1
+	}
+	return nil
+}
+
+/* ----------------- Nacos ----------------- */
+
+type nacosRegistry struct {
+	client naming_client.INamingClient
+	group  string
+}
+
+func (n *nacosRegistry) Name() string { return backendNacos }
+
+func (n *nacosRegistry) Register(in ServiceInstance) error {
+	if err := validateInstance(&in); err != nil {
+		return err
+	}
+	ok, err := n.client.RegisterInstance(vo.RegisterInstanceParam{
+		Ip:          in.Host,
+		Port:        in.Port,
+		ServiceName: in.Service,
+		GroupName:   n.groupOf(in),
+		ClusterName: in.Cluster,
+		Weight:      in.Weight,
+		Metadata:    in.Metadata,
+		Enable:      true,
+		Healthy:     true,
+		Ephemeral:   true,
+	})
+	if err != nil {
+		return fmt.Errorf("registerService error: %w", err)
+	}
+	if !ok {
+		return fmt.Errorf("Failed to register service")
+	}
+	return nil
+}
+
+func (n *nacosRegistry) Deregister(in ServiceInstance) error {
+	if _, err := n.client.DeregisterInstance(vo.DeregisterInstanceParam{
+		Ip:          in.Host,
+		Port:        in.Port,
+		ServiceName: in.Service,
+		GroupName:   n.groupOf(in),
+		Cluster:     in.Cluster,
+		Ephemeral:   true,
+	}); err != nil {
+		return fmt.Errorf("failed to deregister service instance: %w", err)
+	}
+	return nil
+}
+
+func (n *nacosRegistry) groupOf(in ServiceInstance) string {
+	if in.Group != "" {
+		return in.Group
+	}
+	return n.group
+}
+
+func (n *nacosRegistry) Resolve(service string) ([]ServiceInstance, error) {
+	hosts, err := n.client.SelectInstances(vo.SelectInstancesParam{
+		ServiceName: service,
+		GroupName:   n.group,
+		HealthyOnly: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("discover %s: %w", service, err)
+	}
+	list := make([]ServiceInstance, 0, len(hosts))
+	for _, h := range hosts {
+		if !h.Enable || h.Weight <= 0 {
+			continue
+		}
+		list = append(list, ServiceInstance{Service: service, Group: n.group, Cluster: h.ClusterName, Host: h.Ip, Port: h.Port, Weight: h.Weight, Metadata: h.Metadata})
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("%w: %s", errServiceNotFound, service)
+	}
+	return list, nil
+}
+
+/* ----------------- Kubernetes headless Service DNS ----------------- */
+
+// dnsRegistry 服务的 DNS 名称取 targets 中的映射，未映射时为 "<service>.<domain>"；
+// 名称带端口时解析 A/AAAA 记录（每个 Pod IP 一个实例），否则按 portName 查询 SRV 记录。
+// 解析结果缓存 dnsCacheTTL，查询失败时继续使用上一次的结果
+type dnsRegistry struct {
+	targets  map[string]string
+	domain   string
+	portName string
+
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+	lookupSRV  func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+
+	mu    sync.Mutex
+	cache map[string]dnsCacheEntry
+}
+
+type dnsCacheEntry struct {
+	list      []ServiceInstance
+	expiresAt time.Time
+}
+
+const (
+	dnsCacheTTL     = 5 * time.Second
+	dnsQueryTimeout = 2 * time.Second
+)
+
+func newDNSRegistry(targets map[string]string, domain, portName string) *dnsRegistry {
+	return &dnsRegistry{
+		targets:    targets,
+		domain:     strings.TrimPrefix(domain, "."),
+		portName:   portName,
+		lookupHost: net.DefaultResolver.LookupHost,
+		lookupSRV:  net.DefaultResolver.LookupSRV,
+		cache:      make(map[string]dnsCacheEntry),
+	}
+}
+
+func (d *dnsRegistry) Name() string { return backendDNS }
+
+func (d *dnsRegistry) Register(ServiceInstance) error   { return nil }
+func (d *dnsRegistry) Deregister(ServiceInstance) error { return nil }
+
+func (d *dnsRegistry) Resolve(service string) ([]ServiceInstance, error) {
+	d.mu.Lock()
+	e, ok := d.cache[service]
+	d.mu.Unlock()
+	if ok && time.Now().Before(e.expiresAt) {
+		return e.list, nil
+	}
+
+	list, err := d.lookup(service)
+	if err != nil {
+		if !ok {
+			return nil, err
+		}
+		// 沿用旧结果一个 TTL，避免 DNS 故障期间每次请求都等待查询超时
+		zapLog.Warnw("DNS lookup failed, keeping last known instances", "service", service, "error", err)
+		list = e.list
+	}
+	d.mu.Lock()
+	d.cache[service] = dnsCacheEntry{list: list, expiresAt: time.Now().Add(dnsCacheTTL)}
+	d.mu.Unlock()
+	return list, nil
+}
+
+func (d *dnsRegistry) lookup(service string) ([]ServiceInstance, error) {
+	target, ok := d.targets[service]
+	if !ok {
+		target = service
+		if d.domain != "" {
+			target += "." + d.domain
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dnsQueryTimeout)
+	defer cancel()
+
+	var list []ServiceInstance
+	if host, portStr, err := net.SplitHostPort(target); err == nil {
+		port, err := strconv.ParseUint(portStr, 10, 16)
+		if err != nil || port == 0 {
+			return nil, fmt.Errorf("discover %s: invalid port in %q", service, target)
+		}
+		addrs, err := d.lookupHost(ctx, host)
+		if err != nil {
+			return nil, fmt.Errorf("discover %s: %w", service, err)
+		}
+		for _, addr := range addrs {
+			list = append(list, ServiceInstance{Service: service, Host: addr, Port: port, Weight: 1})
+		}
+	} else {
+		if d.portName == "" {
+			return nil, fmt.Errorf("discover %s: no port for %q and DISCOVERY_DNS_PORT_NAME not set", service, target)
+		}
+		_, records, err := d.lookupSRV(ctx, d.portName, "tcp", target)
+		if err != nil {
+			return nil, fmt.Errorf("discover %s: %w", service, err)
+		}
+		for _, r := range records {
+			weight := float64(r.Weight)
+			if weight == 0 {
+				weight = 1
+			}
+			list = append(list, ServiceInstance{Service: service, Host: strings.TrimSuffix(r.Target, "."), Port: uint64(r.Port), Weight: weight})
+		}
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("%w: %s", errServiceNotFound, service)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Host < list[j].Host })
+	return list, nil
+}
+
+// parseDNSTargets 解析 service=host[:port],... 格式的服务地址映射
+func parseDNSTargets(s string) (map[string]string, error) {
+	targets := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, target, ok := strings.Cut(pair, "=")
+		name, target = strings.TrimSpace(name), strings.TrimSpace(target)
+		if !ok || name == "" || target == "" {
+			return nil, fmt.Errorf("invalid DISCOVERY_DNS_TARGETS entry %q, want service=host[:port]", pair)
+		}
+		targets[name] = target
+	}
+	return targets, nil
+}
+
+/* ----------------- 静态文件 ----------------- */
+
+// staticRegistry 静态实例列表，注册与注销为空操作。文件格式：
+//
+//	services:
+//	  login-service:
+//	    - host: 127.0.0.1
+//	      port: 8083
+//	      weight: 1          # 可省略，默认 1
+type staticRegistry struct {
+	services map[string][]ServiceInstance
+}
+
+func loadStaticRegistry(path string) (*staticRegistry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read static registry: %w", err)
+	}
+	var f struct {
+		Services map[string][]ServiceInstance `yaml:"services"`
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("parse static registry %s: %w", path, err)
+	}
+	s := &staticRegistry{services: make(map[string][]ServiceInstance, len(f.Services))}
+	for name, list := range f.Services {
+		for i := range list {
+			list[i].Service = name
+			if err := validateInstance(&list[i]); err != nil {
+				return nil, fmt.Errorf("static registry: %w", err)
+			}
+		}
+		s.services[name] = list
+	}
+	return s, nil
+}
+
+func (s *staticRegistry) Name() string { return backendStatic }
+
+func (s *staticRegistry) Register(ServiceInstance) error   { return nil }
+func (s *staticRegistry) Deregister(ServiceInstance) error { return nil }
+
+func (s *staticRegistry) Resolve(service string) ([]ServiceInstance, error) {
+	list := s.services[service]
+	if len(list) == 0 {
+		return nil, fmt.Errorf("%w: %s", errServiceNotFound, service)
+	}
+	return append([]ServiceInstance(nil), list...), nil
+}
+
+/* ----------------- 本服务实例 ----------------- */
+
+// 本服务实例的注册信息，取自环境变量（Kubernetes 中由 Downward API 注入）：
+//   - POD_IP：注册的地址，未设置时使用第一个非回环 IPv4 地址
+//   - SERVICE_PORT：注册的端口，默认为监听端口
+//   - NACOS_GROUP / NACOS_CLUSTER：分组（默认 DEFAULT_GROUP）与集群（默认 DEFAULT），分组同时用于发现 login-service
+//   - SERVICE_WEIGHT：权重，默认 10
+//   - SERVICE_VERSION / SERVICE_ZONE / SERVICE_METADATA：实例元数据 version、zone 及其他 k1=v1,k2=v2
+//
+// 注销时使用注册成功的同一份信息。启动时 Nacos 短暂不可用会按指数退避重试，
+// 最多 REGISTER_MAX_ATTEMPTS 次（默认 6 次，约 15 秒）。
+
+const (
+	registerBaseBackoff = 500 * time.Millisecond
+	registerMaxBackoff  = 8 * time.Second
+)
+
+// registeredInstance 注册成功的实例，注销时原样使用
+var registeredInstance *ServiceInstance
+
+// nacosGroup 注册与发现使用的 Nacos 分组
+func nacosGroup() string {
+	if g := os.Getenv("NACOS_GROUP"); g != "" {
+		return g
+	}
+	return "DEFAULT_GROUP"
+}
+
+// selfInstance 根据环境变量生成本服务实例的注册信息
+func selfInstance(serviceName string, listenPort uint64) (ServiceInstance, error) {
+	in := ServiceInstance{
+		Service: serviceName,
+		Group:   nacosGroup(),
+		Cluster: os.Getenv("NACOS_CLUSTER"),
+		Host:    os.Getenv("POD_IP"),
+		Port:    listenPort,
+		Weight:  10,
+	}
+	if in.Host == "" {
+		hostIP, err := getHostIP()
+		if err != nil {
+			return in, fmt.Errorf("Failed to get host IP address: %w", err)
+		}
+		in.Host = hostIP
+	} else if net.ParseIP(in.Host) == nil {
+		return in, fmt.Errorf("invalid POD_IP %q", in.Host)
+	}
+	if v := os.Getenv("SERVICE_PORT"); v != "" {
+		port, err := strconv.ParseUint(v, 10, 16)
+		if err != nil || port == 0 {
+			return in, fmt.Errorf("invalid SERVICE_PORT %q", v)
+		}
+		in.Port = port
+	}
+	if v := os.Getenv("SERVICE_WEIGHT"); v != "" {
+		weight, err := strconv.ParseFloat(v, 64)
+		if err != nil || weight <= 0 {
+			return in, fmt.Errorf("invalid SERVICE_WEIGHT %q", v)
+		}
+		in.Weight = weight
+	}
+	metadata, err := parseMetadata(os.Getenv("SERVICE_METADATA"))
+	if err != nil {
+		return in, err
+	}
+	for key, env := range map[string]string{"version": "SERVICE_VERSION", "zone": "SERVICE_ZONE"} {
+		if v := os.Getenv(env); v != "" {
+			if metadata == nil {
+				metadata = make(map[string]string)
+			}
+			metadata[key] = v
+		}
+	}
+	in.Metadata = metadata
+	return in, nil
+}
+
+// parseMetadata 解析 k1=v1,k2=v2 格式的实例元数据，空串返回 nil
+func parseMetadata(s string) (map[string]string, error) {
+	var metadata map[string]string
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid SERVICE_METADATA entry %q, want key=value", pair)
+		}
+		if metadata == nil {
+			metadata = make(map[string]string)
+		}
+		metadata[k] = strings.TrimSpace(v)
+	}
+	return metadata, nil
+}
+
+// getHostIP 获取主机的非回环 IP 地址
+func getHostIP() (string, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return "", err
+	}
+	for _, addr := range addrs {
+		if ip, _, _ := net.ParseCIDR(addr.String()); ip != nil && !ip.IsLoopback() && ip.To4() != nil {
+			return ip.String(), nil
+		}
+	}
+	return "", fmt.Errorf("No valid IP address found")
+}
+
+// registerService 注册服务实例，失败时按指数退避重试；dns / static 后端不需要注册
+func registerService(serviceName string, listenPort uint64) error {
+	in, err := selfInstance(serviceName, listenPort)
+	if err != nil {
+		return err
+	}
+
+	attempts := 6
+	if v, perr := strconv.Atoi(os.Getenv("REGISTER_MAX_ATTEMPTS")); perr == nil && v > 0 {
+		attempts = v
+	}
+	backoff := registerBaseBackoff
+	for attempt := 1; ; attempt++ {
+		if err = serviceBackend.Register(in); err == nil {
+			break
+		}
+		if attempt >= attempts {
+			return fmt.Errorf("register %s after %d attempts: %w", serviceName, attempt, err)
+		}
+		// 抖动避免多个实例同时重试
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		zapLog.Warnw("Register failed, retrying", "service", serviceName, "attempt", attempt, "retry_in", wait.String(), "error", err)
+		time.Sleep(wait)
+		if backoff *= 2; backoff > registerMaxBackoff {
+			backoff = registerMaxBackoff
+		}
+	}
+
+	registeredInstance = &in
+	zapLog.Infow("Service registered", "service", in.Service, "ip", in.Host, "port", in.Port,
+		"group", in.Group, "cluster", in.Cluster, "metadata", in.Metadata, "backend", serviceBackend.Name())
+	return nil
+}
+
+// deregisterService 使用注册时的实例信息注销
+func deregisterService() error {
+	if registeredInstance == nil {
+		return nil
+	}
+	if err := serviceBackend.Deregister(*registeredInstance); err != nil {
+		return err
+	}
+	zapLog.Infow("Service deregistered", "service", registeredInstance.Service)
+	return nil
+}
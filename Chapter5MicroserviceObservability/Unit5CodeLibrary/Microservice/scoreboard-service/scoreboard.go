@@ -0,0 +1,202 @@
+// scoreboard.go
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"microservice/pkg/auth"
+)
+
+// 分页参数
+const (
+	defaultScoreboardLimit = 20
+	maxScoreboardLimit     = 100
+)
+
+// scoreboardSort 排行榜排序方式：排序列（查询中的列别名）与方向，同值时按用户 ID 升序
+type scoreboardSort struct {
+	Column string
+	Desc   bool
+}
+
+// 支持的排序方式，key 为 sort 查询参数
+var scoreboardSorts = map[string]scoreboardSort{
+	"attempts":        {Column: "Attempts", Desc: false},
+	"wins":            {Column: "Wins", Desc: true},
+	"correct_guesses": {Column: "CorrectGuesses", Desc: true},
+}
+
+const defaultScoreboardSort = "attempts"
+
+// sortedScoreboardSorts 按名称排序的排序方式，保证输出顺序稳定
+func sortedScoreboardSorts() []string {
+	names := make([]string, 0, len(scoreboardSorts))
+	for name := range scoreboardSorts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ScoreboardQuery 排行榜查询条件；After 非空时按游标分页，忽略 Offset
+type ScoreboardQuery struct {
+	Sort   string
+	Limit  int
+	Offset int
+	After  *scoreboardCursor
+	UserID string // 请求者 ID，非空时在结果中返回其排名
+}
+
+// ScoreboardPage 一页排行榜数据；游标分页时 Offset 为本页第一条之前的条目数
+type ScoreboardPage struct {
+	Entries    []ScoreboardEntry `json:"entries"`
+	Total      int               `json:"total"`
+	Limit      int               `json:"limit"`
+	Offset     int               `json:"offset"`
+	Sort       string            `json:"sort"`
+	NextCursor string            `json:"next_cursor,omitempty"` // 还有下一页时，作为 cursor 参数取下一页
+	Me         *ScoreboardEntry  `json:"me,omitempty"`          // 请求者自己的排名，未参与游戏时为空
+	ETag       string            `json:"-"`                     // 数据版本，来自内存排行榜
+}
+
+// scoreboardCursor 上一页最后一条的排序值与用户 ID；数据在翻页期间变化时不会重复或跳过未变化的条目
+type scoreboardCursor struct {
+	Sort  string `json:"s"`
+	Value int    `json:"v"`
+	ID    string `json:"id"`
+}
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// cursorAfter 生成指向条目 e 之后的游标
+func cursorAfter(sortName string, e ScoreboardEntry) string {
+	raw, _ := json.Marshal(scoreboardCursor{Sort: sortName, Value: scoreboardSorts[sortName].value(e), ID: e.ID})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// parseCursor 解析游标，游标须由同一排序方式生成
+func parseCursor(s, sortName string) (*scoreboardCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	var cur scoreboardCursor
+	if err = json.Unmarshal(raw, &cur); err != nil || cur.ID == "" || cur.Sort != sortName {
+		return nil, errInvalidCursor
+	}
+	return &cur, nil
+}
+
+// entry 游标位置对应的排序键，用于与条目比较
+func (c *scoreboardCursor) entry() ScoreboardEntry {
+	e := ScoreboardEntry{ID: c.ID}
+	switch scoreboardSorts[c.Sort].Column {
+	case "Wins":
+		e.Wins = c.Value
+	case "CorrectGuesses":
+		e.CorrectGuesses = c.Value
+	default:
+		e.Attempts = c.Value
+	}
+	return e
+}
+
+// value 返回条目在该排序方式下的排序值
+func (s scoreboardSort) value(e ScoreboardEntry) int {
+	switch s.Column {
+	case "Wins":
+		return e.Wins
+	case "CorrectGuesses":
+		return e.CorrectGuesses
+	default:
+		return e.Attempts
+	}
+}
+
+// less 判断 a 是否排在 b 之前
+func (s scoreboardSort) less(a, b ScoreboardEntry) bool {
+	va, vb := s.value(a), s.value(b)
+	if va != vb {
+		if s.Desc {
+			return va > vb
+		}
+		return va < vb
+	}
+	return a.ID < b.ID
+}
+
+// rankEntries 按排序方式就地排序并填写名次
+func rankEntries(entries []ScoreboardEntry, sorting scoreboardSort) {
+	sort.Slice(entries, func(i, j int) bool { return sorting.less(entries[i], entries[j]) })
+	for i := range entries {
+		entries[i].Rank = i + 1
+	}
+}
+
+// paginate 从已排序的条目中截取一页
+func paginate(sorted []ScoreboardEntry, q ScoreboardQuery) ScoreboardPage {
+	start := q.Offset
+	if q.After != nil {
+		sorting, after := scoreboardSorts[q.Sort], q.After.entry()
+		start = sort.Search(len(sorted), func(i int) bool { return sorting.less(after, sorted[i]) })
+	}
+	page := ScoreboardPage{Entries: []ScoreboardEntry{}, Total: len(sorted), Limit: q.Limit, Offset: start, Sort: q.Sort}
+	if start < len(sorted) {
+		end := start + q.Limit
+		if end > len(sorted) {
+			end = len(sorted)
+		}
+		page.Entries = append(page.Entries, sorted[start:end]...)
+		if end < len(sorted) {
+			page.NextCursor = cursorAfter(q.Sort, sorted[end-1])
+		}
+	}
+	return page
+}
+
+// parseScoreboardQuery 解析 sort / limit / offset / cursor 参数，请求者 ID 取自已校验的访问令牌
+func parseScoreboardQuery(c *gin.Context) (ScoreboardQuery, error) {
+	q := ScoreboardQuery{
+		Sort:  strings.ToLower(strings.TrimSpace(c.DefaultQuery("sort", defaultScoreboardSort))),
+		Limit: defaultScoreboardLimit,
+	}
+	if _, ok := scoreboardSorts[q.Sort]; !ok {
+		return q, fmt.Errorf("invalid sort %q", q.Sort)
+	}
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxScoreboardLimit {
+			return q, fmt.Errorf("limit must be between 1 and %d", maxScoreboardLimit)
+		}
+		q.Limit = n
+	}
+	if v := c.Query("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return q, fmt.Errorf("offset must be a non-negative integer")
+		}
+		q.Offset = n
+	}
+	if v := c.Query("cursor"); v != "" {
+		if q.Offset > 0 {
+			return q, fmt.Errorf("offset and cursor cannot be used together")
+		}
+		cur, err := parseCursor(v, q.Sort)
+		if err != nil {
+			return q, err
+		}
+		q.After = cur
+	}
+
+	if claims, ok := auth.ClaimsFrom(c); ok {
+		q.UserID = claims.Subject
+	}
+	return q, nil
+}
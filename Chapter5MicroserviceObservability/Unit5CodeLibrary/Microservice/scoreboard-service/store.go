@@ -0,0 +1,349 @@
+// store.go
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/nacos-group/nacos-sdk-go/clients/config_client"
+	_ "modernc.org/sqlite"
+)
+
+// LeaderboardStore 排行榜数据存储，屏蔽 MySQL / SQLite / 内存等具体实现
+type LeaderboardStore interface {
+	Scoreboard(q ScoreboardQuery) (ScoreboardPage, error)
+	// Entries 返回全部用户的排行榜统计（未排序），用于构建内存排行榜
+	Entries() ([]ScoreboardEntry, error)
+	// Entry 返回单个用户的统计，用户不存在或未参与游戏时 ok 为 false
+	Entry(userID string) (entry ScoreboardEntry, ok bool, err error)
+	// ApplyEvents 将 game-service 的领域事件写入排行榜投影，返回去重后实际生效的事件
+	ApplyEvents(events []GameEvent) ([]GameEvent, error)
+	DifficultyScoreboard(difficulty string) ([]DifficultyScoreboardEntry, error)
+	// RemoveUser 删除用户的排行榜统计，已处理事件的记录保留以继续去重；用户不在排行榜中时 removed 为 false
+	RemoveUser(userID string) (removed bool, err error)
+	Close() error
+}
+
+// 存储驱动
+const (
+	driverMySQL  = "mysql"
+	driverSQLite = "sqlite"
+	driverMemory = "memory"
+)
+
+// storeDriver 读取存储驱动：环境变量 STORE_DRIVER 优先，其次为数据库配置中的 DB_DRIVER，默认 mysql
+func storeDriver(dbConfig map[string]string) string {
+	driver := os.Getenv("STORE_DRIVER")
+	if driver == "" {
+		driver = dbConfig["DB_DRIVER"]
+	}
+	if driver == "" {
+		return driverMySQL
+	}
+	return strings.ToLower(driver)
+}
+
+// loadStoreConfig 读取数据库配置；非 MySQL 驱动无需从 Nacos 获取
+func loadStoreConfig(nacosClient config_client.IConfigClient) (map[string]string, error) {
+	if storeDriver(nil) != driverMySQL {
+		return map[string]string{"DB_PATH": os.Getenv("DB_PATH")}, nil
+	}
+	return getDatabaseConfigFromNacos(nacosClient)
+}
+
+// SetupStore 根据配置初始化排行榜存储，SQL 存储在启动时执行未完成的迁移
+func SetupStore(nacosClient config_client.IConfigClient) (LeaderboardStore, error) {
+	dbConfig, err := loadStoreConfig(nacosClient)
+	if err != nil {
+		return nil, err
+	}
+
+	driver := storeDriver(dbConfig)
+	if driver == driverMemory {
+		zapLog.Info("Using in-memory leaderboard store")
+		return newMemoryLeaderboardStore(), nil
+	}
+	db, err := openDB(driver, dbConfig)
+	if err != nil {
+		return nil, err
+	}
+	if autoMigrateEnabled() {
+		applied, err := newScoreboardMigrator(db, driver).Up(0)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("migrate: %w", err)
+		}
+		for _, m := range applied {
+			zapLog.Infow("Migration applied", "version", m.Version, "name", m.Name)
+		}
+	}
+	return &sqlLeaderboardStore{db: db}, nil
+}
+
+// openDB 按驱动打开 MySQL 或 SQLite 数据库
+func openDB(driver string, dbConfig map[string]string) (*sql.DB, error) {
+	switch driver {
+	case driverMySQL:
+		return initDB(dbConfig)
+	case driverSQLite:
+		path := dbConfig["DB_PATH"]
+		if path == "" {
+			path = "guess.db"
+		}
+		db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)")
+		if err != nil {
+			return nil, err
+		}
+		if err = db.Ping(); err != nil {
+			return nil, err
+		}
+		zapLog.Infow("SQLite database opened", "path", path)
+		return db, nil
+	default:
+		return nil, fmt.Errorf("unknown store driver %q", driver)
+	}
+}
+
+// ---------- database/sql 实现（MySQL / SQLite） ----------
+
+type sqlLeaderboardStore struct {
+	db *sql.DB
+}
+
+func (s *sqlLeaderboardStore) Scoreboard(q ScoreboardQuery) (ScoreboardPage, error) {
+	return getScoreboardData(s.db, q)
+}
+
+func (s *sqlLeaderboardStore) Entries() ([]ScoreboardEntry, error) {
+	return getScoreboardEntries(s.db)
+}
+
+func (s *sqlLeaderboardStore) Entry(userID string) (ScoreboardEntry, bool, error) {
+	return getScoreboardEntry(s.db, userID)
+}
+
+func (s *sqlLeaderboardStore) ApplyEvents(events []GameEvent) ([]GameEvent, error) {
+	return applyEvents(s.db, events)
+}
+
+func (s *sqlLeaderboardStore) DifficultyScoreboard(difficulty string) ([]DifficultyScoreboardEntry, error) {
+	return getDifficultyScoreboardData(s.db, difficulty)
+}
+
+func (s *sqlLeaderboardStore) RemoveUser(userID string) (bool, error) {
+	return removeUser(s.db, userID)
+}
+
+func (s *sqlLeaderboardStore) Close() error {
+	closeDatabase(s.db)
+	return nil
+}
+
+// ---------- 内存实现（本地开发 / 测试） ----------
+
+type memoryGame struct {
+	Attempts       int
+	CorrectGuesses int
+}
+
+type memoryRound struct {
+	UserID     string
+	Difficulty string
+	Result     string
+	Attempts   int
+}
+
+type memoryLeaderboardStore struct {
+	mu        sync.RWMutex
+	users     map[string]string // ID -> Username
+	games     map[string]memoryGame
+	rounds    []memoryRound
+	processed map[string]bool // 已处理的事件 ID
+}
+
+func newMemoryLeaderboardStore() *memoryLeaderboardStore {
+	return &memoryLeaderboardStore{
+		users:     make(map[string]string),
+		games:     make(map[string]memoryGame),
+		processed: make(map[string]bool),
+	}
+}
+
+// PutUser 写入或更新用户名
+func (s *memoryLeaderboardStore) PutUser(id, username string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[id] = username
+}
+
+// PutGame 写入或更新用户的游戏统计
+func (s *memoryLeaderboardStore) PutGame(id string, game memoryGame) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.games[id] = game
+}
+
+// AddRound 记录一局对局结果
+func (s *memoryLeaderboardStore) AddRound(round memoryRound) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rounds = append(s.rounds, round)
+}
+
+func (s *memoryLeaderboardStore) ApplyEvents(events []GameEvent) ([]GameEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var applied []GameEvent
+	for _, e := range events {
+		if s.processed[e.ID] {
+			continue
+		}
+		s.processed[e.ID] = true
+		if _, ok := s.users[e.UserID]; !ok || e.Username != "" {
+			s.users[e.UserID] = e.Username
+		}
+		g := s.games[e.UserID]
+		switch e.Type {
+		case EventGuessMade:
+			if e.Correct {
+				g.CorrectGuesses++
+			} else {
+				g.Attempts++
+			}
+		case EventRoundWon:
+			s.rounds = append(s.rounds, memoryRound{UserID: e.UserID, Difficulty: e.Difficulty, Result: "won", Attempts: e.Attempts})
+		}
+		s.games[e.UserID] = g
+		applied = append(applied, e)
+	}
+	return applied, nil
+}
+
+func (s *memoryLeaderboardStore) Scoreboard(q ScoreboardQuery) (ScoreboardPage, error) {
+	sorting, ok := scoreboardSorts[q.Sort]
+	if !ok {
+		return ScoreboardPage{}, fmt.Errorf("unknown sort %q", q.Sort)
+	}
+	all, _ := s.Entries()
+	rankEntries(all, sorting)
+	page := paginate(all, q)
+	for i := range all {
+		if all[i].ID == q.UserID {
+			me := all[i]
+			page.Me = &me
+		}
+	}
+	return page, nil
+}
+
+func (s *memoryLeaderboardStore) Entries() ([]ScoreboardEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	wins := s.winsByUser()
+	all := []ScoreboardEntry{}
+	for id, g := range s.games {
+		if username, ok := s.users[id]; ok {
+			all = append(all, newMemoryEntry(id, username, g, wins[id]))
+		}
+	}
+	return all, nil
+}
+
+func (s *memoryLeaderboardStore) Entry(userID string) (ScoreboardEntry, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	g, ok := s.games[userID]
+	username, found := s.users[userID]
+	if !ok || !found {
+		return ScoreboardEntry{}, false, nil
+	}
+	return newMemoryEntry(userID, username, g, s.winsByUser()[userID]), true, nil
+}
+
+func (s *memoryLeaderboardStore) RemoveUser(userID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, removed := s.games[userID]
+	delete(s.users, userID)
+	delete(s.games, userID)
+	kept := s.rounds[:0]
+	for _, r := range s.rounds {
+		if r.UserID != userID {
+			kept = append(kept, r)
+		}
+	}
+	s.rounds = kept
+	return removed, nil
+}
+
+// winsByUser 统计每个用户的获胜局数，调用方需持有读锁
+func (s *memoryLeaderboardStore) winsByUser() map[string]int {
+	wins := make(map[string]int)
+	for _, r := range s.rounds {
+		if r.Result == "won" {
+			wins[r.UserID]++
+		}
+	}
+	return wins
+}
+
+func newMemoryEntry(id, username string, g memoryGame, wins int) ScoreboardEntry {
+	return ScoreboardEntry{
+		ID:             id,
+		Username:       username,
+		Attempts:       g.Attempts,
+		Wins:           wins,
+		CorrectGuesses: g.CorrectGuesses,
+	}
+}
+
+func (s *memoryLeaderboardStore) DifficultyScoreboard(difficulty string) ([]DifficultyScoreboardEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	byUser := make(map[string]*DifficultyScoreboardEntry)
+	for _, r := range s.rounds {
+		username, ok := s.users[r.UserID]
+		if !ok || r.Result != "won" || r.Difficulty != difficulty {
+			continue
+		}
+		e, ok := byUser[r.UserID]
+		if !ok {
+			e = &DifficultyScoreboardEntry{ID: r.UserID, Username: username, Difficulty: difficulty, BestAttempts: r.Attempts}
+			byUser[r.UserID] = e
+		}
+		e.Wins++
+		if r.Attempts < e.BestAttempts {
+			e.BestAttempts = r.Attempts
+		}
+	}
+
+	entries := make([]DifficultyScoreboardEntry, 0, len(byUser))
+	for _, e := range byUser {
+		entries = append(entries, *e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.BestAttempts != b.BestAttempts {
+			return a.BestAttempts < b.BestAttempts
+		}
+		if a.Wins != b.Wins {
+			return a.Wins > b.Wins
+		}
+		return a.ID < b.ID
+	})
+	for i := range entries {
+		entries[i].Rank = i + 1
+	}
+	return entries, nil
+}
+
+func (s *memoryLeaderboardStore) Close() error { return nil }
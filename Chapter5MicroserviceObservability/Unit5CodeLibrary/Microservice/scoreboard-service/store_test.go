@@ -0,0 +1,372 @@
+// store_test.go
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// openTestDB 打开内存 SQLite 数据库；setup 在迁移前执行，用于模拟与 game-service 共用数据库
+func openTestDB(t *testing.T, setup ...string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 内存数据库随连接存在，只用一个连接
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	for _, stmt := range setup {
+		if _, err = db.Exec(stmt); err != nil {
+			t.Fatalf("setup: %v", err)
+		}
+	}
+	if _, err = newScoreboardMigrator(db, driverSQLite).Up(0); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+// testPlayer 测试数据：未猜中次数、获胜局数、猜中次数
+type testPlayer struct {
+	id, name                string
+	attempts, wins, correct int
+}
+
+var testPlayers = []testPlayer{
+	{"u1", "alice", 5, 2, 2},
+	{"u2", "bob", 3, 1, 1},
+	{"u3", "carol", 3, 0, 4},
+	{"u4", "dave", 8, 3, 3},
+	{"u5", "erin", 1, 1, 1},
+}
+
+// 各排序方式下的期望顺序，同值按 ID 升序
+var expectedOrder = map[string][]string{
+	"attempts":        {"u5", "u2", "u3", "u1", "u4"},
+	"wins":            {"u4", "u1", "u2", "u5", "u3"},
+	"correct_guesses": {"u3", "u4", "u1", "u2", "u5"},
+}
+
+// playerEvents 生成使投影达到 testPlayers 统计的事件
+func playerEvents() []GameEvent {
+	var events []GameEvent
+	add := func(p testPlayer, typ string, correct bool) {
+		events = append(events, GameEvent{
+			ID: fmt.Sprintf("%s-%d", p.id, len(events)), Type: typ, UserID: p.id, Username: p.name,
+			Difficulty: "normal", Correct: correct, Attempts: 3, OccurredAt: time.Now(),
+		})
+	}
+	for _, p := range testPlayers {
+		for i := 0; i < p.attempts; i++ {
+			add(p, EventGuessMade, false)
+		}
+		for i := 0; i < p.correct; i++ {
+			add(p, EventGuessMade, true)
+		}
+		for i := 0; i < p.wins; i++ {
+			add(p, EventRoundWon, false)
+		}
+	}
+	return events
+}
+
+// testStores 分别以 SQLite、内存存储和基于 SQLite 的内存排行榜运行同一组用例
+func testStores(t *testing.T, run func(t *testing.T, s LeaderboardStore)) {
+	open := map[string]func(t *testing.T) LeaderboardStore{
+		"sqlite": func(t *testing.T) LeaderboardStore { return &sqlLeaderboardStore{db: openTestDB(t)} },
+		"memory": func(t *testing.T) LeaderboardStore { return newMemoryLeaderboardStore() },
+		"cached": func(t *testing.T) LeaderboardStore {
+			return newCachedLeaderboard(&sqlLeaderboardStore{db: openTestDB(t)}, time.Hour)
+		},
+	}
+	for _, name := range []string{"sqlite", "memory", "cached"} {
+		t.Run(name, func(t *testing.T) {
+			s := open[name](t)
+			if _, err := s.ApplyEvents(playerEvents()); err != nil {
+				t.Fatalf("apply events: %v", err)
+			}
+			if l, ok := s.(*cachedLeaderboard); ok {
+				if err := l.Refresh(); err != nil {
+					t.Fatalf("refresh: %v", err)
+				}
+			}
+			run(t, s)
+		})
+	}
+}
+
+func entryIDs(entries []ScoreboardEntry) []string {
+	ids := make([]string, 0, len(entries))
+	for _, e := range entries {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+func checkRanks(t *testing.T, entries []ScoreboardEntry, first int) {
+	t.Helper()
+	for i, e := range entries {
+		if e.Rank != first+i {
+			t.Errorf("%s: rank %d, want %d", e.ID, e.Rank, first+i)
+		}
+	}
+}
+
+func TestScoreboardSorts(t *testing.T) {
+	testStores(t, func(t *testing.T, s LeaderboardStore) {
+		for _, sortName := range sortedScoreboardSorts() {
+			page, err := s.Scoreboard(ScoreboardQuery{Sort: sortName, Limit: maxScoreboardLimit})
+			if err != nil {
+				t.Fatalf("%s: %v", sortName, err)
+			}
+			if got := entryIDs(page.Entries); !reflect.DeepEqual(got, expectedOrder[sortName]) {
+				t.Errorf("%s: order %v, want %v", sortName, got, expectedOrder[sortName])
+			}
+			checkRanks(t, page.Entries, 1)
+			if page.Total != len(testPlayers) || page.NextCursor != "" {
+				t.Errorf("%s: total %d next %q, want %d and no cursor", sortName, page.Total, page.NextCursor, len(testPlayers))
+			}
+		}
+		for _, e := range mustPage(t, s, ScoreboardQuery{Sort: "attempts", Limit: 1}).Entries {
+			if e != (ScoreboardEntry{Rank: 1, ID: "u5", Username: "erin", Attempts: 1, Wins: 1, CorrectGuesses: 1}) {
+				t.Errorf("unexpected entry %+v", e)
+			}
+		}
+		if _, err := s.Scoreboard(ScoreboardQuery{Sort: "target", Limit: 10}); err == nil {
+			t.Error("unknown sort accepted")
+		}
+	})
+}
+
+func mustPage(t *testing.T, s LeaderboardStore, q ScoreboardQuery) ScoreboardPage {
+	t.Helper()
+	page, err := s.Scoreboard(q)
+	if err != nil {
+		t.Fatalf("scoreboard %+v: %v", q, err)
+	}
+	return page
+}
+
+func TestScoreboardOffsetPaging(t *testing.T) {
+	testStores(t, func(t *testing.T, s LeaderboardStore) {
+		for _, sortName := range sortedScoreboardSorts() {
+			var got []string
+			for offset := 0; offset < len(testPlayers); offset += 2 {
+				page := mustPage(t, s, ScoreboardQuery{Sort: sortName, Limit: 2, Offset: offset})
+				if page.Offset != offset || page.Limit != 2 || page.Total != len(testPlayers) {
+					t.Errorf("%s offset %d: page header %+v", sortName, offset, page)
+				}
+				checkRanks(t, page.Entries, offset+1)
+				got = append(got, entryIDs(page.Entries)...)
+			}
+			if !reflect.DeepEqual(got, expectedOrder[sortName]) {
+				t.Errorf("%s: paged order %v, want %v", sortName, got, expectedOrder[sortName])
+			}
+			if page := mustPage(t, s, ScoreboardQuery{Sort: sortName, Limit: 2, Offset: 10}); len(page.Entries) != 0 {
+				t.Errorf("%s: offset past the end returned %v", sortName, entryIDs(page.Entries))
+			}
+		}
+	})
+}
+
+func TestScoreboardCursorPaging(t *testing.T) {
+	testStores(t, func(t *testing.T, s LeaderboardStore) {
+		for _, sortName := range sortedScoreboardSorts() {
+			var got []string
+			q := ScoreboardQuery{Sort: sortName, Limit: 2}
+			for pages := 0; ; pages++ {
+				if pages > len(testPlayers) {
+					t.Fatalf("%s: cursor paging does not terminate", sortName)
+				}
+				page := mustPage(t, s, q)
+				checkRanks(t, page.Entries, len(got)+1)
+				if page.Offset != len(got) {
+					t.Errorf("%s: page offset %d, want %d", sortName, page.Offset, len(got))
+				}
+				got = append(got, entryIDs(page.Entries)...)
+				if page.NextCursor == "" {
+					break
+				}
+				cur, err := parseCursor(page.NextCursor, sortName)
+				if err != nil {
+					t.Fatalf("%s: %v", sortName, err)
+				}
+				q.After = cur
+			}
+			if !reflect.DeepEqual(got, expectedOrder[sortName]) {
+				t.Errorf("%s: cursor order %v, want %v", sortName, got, expectedOrder[sortName])
+			}
+		}
+	})
+}
+
+func TestScoreboardCursorSurvivesRemoval(t *testing.T) {
+	testStores(t, func(t *testing.T, s LeaderboardStore) {
+		first := mustPage(t, s, ScoreboardQuery{Sort: "attempts", Limit: 2})
+		cur, err := parseCursor(first.NextCursor, "attempts")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 游标指向的用户被删除后，下一页仍从其后开始
+		if _, err = s.RemoveUser(cur.ID); err != nil {
+			t.Fatal(err)
+		}
+		next := mustPage(t, s, ScoreboardQuery{Sort: "attempts", Limit: 2, After: cur})
+		if got, want := entryIDs(next.Entries), []string{"u3", "u1"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("page after removed cursor %v, want %v", got, want)
+		}
+		checkRanks(t, next.Entries, 2)
+	})
+}
+
+func TestScoreboardCursorValidation(t *testing.T) {
+	cursor := cursorAfter("wins", ScoreboardEntry{ID: "u1", Wins: 2})
+	if _, err := parseCursor(cursor, "attempts"); err != errInvalidCursor {
+		t.Errorf("cursor for another sort accepted: %v", err)
+	}
+	for _, bad := range []string{"not base64!", "e30"} {
+		if _, err := parseCursor(bad, "wins"); err != errInvalidCursor {
+			t.Errorf("cursor %q accepted: %v", bad, err)
+		}
+	}
+	gin.SetMode(gin.TestMode)
+	for _, query := range []string{"cursor=" + cursor + "&offset=2", "cursor=" + cursor + "&sort=attempts"} {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/scoreboard?"+query, nil)
+		if _, err := parseScoreboardQuery(c); err == nil {
+			t.Errorf("query %q accepted", query)
+		}
+	}
+}
+
+func TestScoreboardOwnRank(t *testing.T) {
+	testStores(t, func(t *testing.T, s LeaderboardStore) {
+		for _, sortName := range sortedScoreboardSorts() {
+			for i, id := range expectedOrder[sortName] {
+				page := mustPage(t, s, ScoreboardQuery{Sort: sortName, Limit: 1, UserID: id})
+				if page.Me == nil || page.Me.ID != id || page.Me.Rank != i+1 {
+					t.Errorf("%s: own entry for %s = %+v, want rank %d", sortName, id, page.Me, i+1)
+				}
+			}
+		}
+		if page := mustPage(t, s, ScoreboardQuery{Sort: "wins", Limit: 1, UserID: "nobody"}); page.Me != nil {
+			t.Errorf("own entry for unknown user: %+v", page.Me)
+		}
+	})
+}
+
+// game-service 的表结构（含 TargetNumber），迁移 3 从中回填投影
+var gameServiceTables = []string{
+	`CREATE TABLE users (ID VARCHAR(255) PRIMARY KEY, Username VARCHAR(255), Password VARCHAR(255))`,
+	`CREATE TABLE game (ID VARCHAR(255) PRIMARY KEY, TargetNumber INT, Attempts INT, CorrectGuesses INT, Version INT)`,
+	`CREATE TABLE game_round (ID INTEGER PRIMARY KEY, UserID VARCHAR(255), Difficulty VARCHAR(64), Result VARCHAR(32), Attempts INT, TargetNumber INT)`,
+	`INSERT INTO users VALUES ('u1', 'alice', 'secret'), ('u2', 'bob', 'secret')`,
+	`INSERT INTO game VALUES ('u1', 4242, 5, 2, 7), ('u2', 4243, 3, 1, 4)`,
+	`INSERT INTO game_round VALUES (1, 'u1', 'normal', 'won', 3, 4244), (2, 'u1', 'normal', 'won', 2, 4245), (3, 'u2', 'normal', 'won', 4, 4246)`,
+}
+
+func TestScoreboardResponseHidesTargetNumber(t *testing.T) {
+	prev := store
+	store = &sqlLeaderboardStore{db: openTestDB(t, gameServiceTables...)}
+	defer func() { store = prev }()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/scoreboard", getScoreboardHandler)
+	for _, query := range []string{"", "?sort=wins", "?sort=correct_guesses&limit=1", "?difficulty=normal"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/scoreboard"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET /scoreboard%s: status %d", query, w.Code)
+		}
+		body := w.Body.String()
+		if !strings.Contains(body, "alice") {
+			t.Errorf("GET /scoreboard%s: backfilled player missing: %s", query, body)
+		}
+		if strings.Contains(strings.ToLower(body), "target") || strings.Contains(body, "424") ||
+			strings.Contains(body, "secret") {
+			t.Errorf("GET /scoreboard%s leaks game internals: %s", query, body)
+		}
+	}
+}
+
+// entriesHookStore 在返回全量数据前执行 hook，用于模拟刷新读取期间到达的事件
+type entriesHookStore struct {
+	LeaderboardStore
+	hook func()
+}
+
+func (s *entriesHookStore) Entries() ([]ScoreboardEntry, error) {
+	entries, err := s.LeaderboardStore.Entries()
+	if err == nil && s.hook != nil {
+		s.hook()
+	}
+	return entries, err
+}
+
+func TestCachedLeaderboardApply(t *testing.T) {
+	backend := &entriesHookStore{LeaderboardStore: newMemoryLeaderboardStore()}
+	l := newCachedLeaderboard(backend, time.Hour)
+	if _, err := backend.ApplyEvents(playerEvents()); err != nil {
+		t.Fatalf("apply events: %v", err)
+	}
+	if err := l.Refresh(); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	win := func(id, userID, username string) {
+		t.Helper()
+		event := GameEvent{ID: id, Type: EventRoundWon, UserID: userID, Username: username,
+			Difficulty: "normal", Attempts: 3, OccurredAt: time.Now()}
+		if _, err := backend.ApplyEvents([]GameEvent{event}); err != nil {
+			t.Fatalf("apply event: %v", err)
+		}
+		if err := l.Apply(userID); err != nil {
+			t.Fatalf("apply %s: %v", userID, err)
+		}
+	}
+	// 增量更新后的顺序、名次与 ETag 应与全量重建一致：上移、新用户加入、移除用户
+	win("w1", "u5", "erin")
+	win("w2", "u5", "erin")
+	win("w3", "u6", "frank")
+	if _, err := l.RemoveUser("u2"); err != nil {
+		t.Fatalf("remove user: %v", err)
+	}
+	entries, err := backend.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := buildSnapshot(entries)
+	for _, name := range sortedScoreboardSorts() {
+		page := mustPage(t, l, ScoreboardQuery{Sort: name, Limit: 10})
+		if got, exp := entryIDs(page.Entries), entryIDs(want.sorted[name]); !reflect.DeepEqual(got, exp) {
+			t.Errorf("%s: order %v, want %v", name, got, exp)
+		}
+		checkRanks(t, page.Entries, 1)
+		if page.ETag != want.etag() {
+			t.Errorf("%s: etag %s, want %s", name, page.ETag, want.etag())
+		}
+	}
+
+	// 刷新读取数据之后到达的更新不应被刷新结果覆盖
+	backend.hook = func() {
+		backend.hook = nil
+		win("w4", "u3", "carol")
+	}
+	if err := l.Refresh(); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	page := mustPage(t, l, ScoreboardQuery{Sort: "wins", Limit: 10, UserID: "u3"})
+	if page.Me == nil || page.Me.Wins != 1 {
+		t.Fatalf("update lost by a concurrent refresh: %+v", page.Me)
+	}
+}
@@ -0,0 +1,200 @@
+// stream.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 推送参数
+const (
+	streamHistorySize     = 256              // 保留的最近事件数，用于断线重连时补发
+	streamClientBuffer    = 32               // 每个连接的待发送队列，写满时断开该连接，客户端重连后补发
+	streamHeartbeat       = 15 * time.Second // 心跳间隔，防止代理断开空闲连接
+	streamRetryMillis     = 3000             // 建议客户端的重连间隔
+	streamEventRankChange = "rank"
+	streamEventRefresh    = "refresh"
+	streamEventReset      = "reset"
+)
+
+// rankChange 某一排序方式下的名次变化，PreviousRank 为 0 表示新上榜，Rank 为 0 表示已下榜
+type rankChange struct {
+	Sort         string `json:"sort"`
+	Rank         int    `json:"rank"`
+	PreviousRank int    `json:"previous_rank"`
+}
+
+// rankChangeEvent 一个用户统计变化导致的名次变化；只包含该用户本人，
+// 其他用户因此被动移动的名次由客户端重新拉取当前页获得
+type rankChangeEvent struct {
+	UserID   string       `json:"user_id"`
+	Username string       `json:"username,omitempty"`
+	Changes  []rankChange `json:"changes"`
+}
+
+// streamEvent 一条 SSE 事件
+type streamEvent struct {
+	ID   string
+	Seq  uint64
+	Name string
+	Data []byte
+}
+
+// streamHub 向所有订阅者广播排行榜事件，并保留最近的事件供重连补发。
+// 事件 ID 形如 "<启动时间>-<序号>"，服务重启后旧 ID 无法补发，客户端收到 reset 后应重新拉取排行榜。
+type streamHub struct {
+	mu          sync.Mutex
+	epoch       string
+	seq         uint64
+	history     []streamEvent
+	subscribers map[chan streamEvent]struct{}
+}
+
+var hub = newStreamHub()
+
+func newStreamHub() *streamHub {
+	return &streamHub{
+		epoch:       strconv.FormatInt(time.Now().UnixNano(), 36),
+		subscribers: make(map[chan streamEvent]struct{}),
+	}
+}
+
+// Publish 广播事件；队列已满的订阅者会被断开
+func (h *streamHub) Publish(name string, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		zapLog.Errorw("Error encoding stream event", "event", name, "err", err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	event := streamEvent{ID: fmt.Sprintf("%s-%d", h.epoch, h.seq), Seq: h.seq, Name: name, Data: data}
+	h.history = append(h.history, event)
+	if len(h.history) > streamHistorySize {
+		h.history = h.history[len(h.history)-streamHistorySize:]
+	}
+	for ch := range h.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe 注册订阅者并返回 lastEventID 之后的事件；无法补发时 ok 为 false
+func (h *streamHub) Subscribe(lastEventID string) (ch chan streamEvent, missed []streamEvent, ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch = make(chan streamEvent, streamClientBuffer)
+	h.subscribers[ch] = struct{}{}
+	streamClients.Set(float64(len(h.subscribers)))
+	if lastEventID == "" {
+		return ch, nil, true
+	}
+	missed, ok = h.since(lastEventID)
+	return ch, missed, ok
+}
+
+// Unsubscribe 注销订阅者
+func (h *streamHub) Unsubscribe(ch chan streamEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subscribers[ch]; ok {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+	streamClients.Set(float64(len(h.subscribers)))
+}
+
+// since 返回指定 ID 之后的历史事件，调用方需持有锁
+func (h *streamHub) since(lastEventID string) ([]streamEvent, bool) {
+	epoch, seqStr, found := strings.Cut(lastEventID, "-")
+	seq, err := strconv.ParseUint(seqStr, 10, 64)
+	if !found || err != nil || epoch != h.epoch || seq > h.seq {
+		return nil, false
+	}
+	if seq == h.seq {
+		return nil, true
+	}
+	if len(h.history) == 0 || h.history[0].Seq > seq+1 {
+		// 需要的事件已不在历史中
+		return nil, false
+	}
+	missed := make([]streamEvent, 0, h.seq-seq)
+	for _, e := range h.history {
+		if e.Seq > seq {
+			missed = append(missed, e)
+		}
+	}
+	return missed, true
+}
+
+// writeStreamEvent 按 SSE 格式写出一条事件
+func writeStreamEvent(w io.Writer, e streamEvent) error {
+	_, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.ID, e.Name, e.Data)
+	return err
+}
+
+// scoreboardStreamHandler 以 SSE 推送排行榜名次变化，支持 Last-Event-ID 断线重连
+func scoreboardStreamHandler(c *gin.Context) {
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	ch, missed, ok := hub.Subscribe(lastEventID)
+	defer hub.Unsubscribe(ch)
+
+	w := c.Writer
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(200)
+
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetryMillis)
+	if !ok {
+		// 无法补发错过的事件，通知客户端重新拉取完整排行榜
+		fmt.Fprintf(w, "event: %s\ndata: {}\n\n", streamEventReset)
+	}
+	for _, e := range missed {
+		if writeStreamEvent(w, e) != nil {
+			return
+		}
+	}
+	w.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case e, open := <-ch:
+			if !open {
+				// 发送过慢被断开，客户端会带 Last-Event-ID 重连
+				return
+			}
+			if writeStreamEvent(w, e) != nil {
+				return
+			}
+			w.Flush()
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return
+			}
+			w.Flush()
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}